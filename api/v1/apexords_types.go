@@ -17,6 +17,7 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -28,12 +29,19 @@ type ApexOrdsSpec struct {
 	// INSERT ADDITIONAL SPEC FIELDS - desired state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
 
+	//Name of an OracleDatabase in the same namespace to install Ords in. Several ApexOrds can share it,
+	//the DB is provisioned and Apex installed once. The DB fields below are ignored when it is set
+	// +optional
+	DatabaseRef string `json:"databaseref,omitempty"`
+
 	// sys apex ords schema passwords will be genrated randomly and shown in operator logs
-	// The CDB name for oracle 19c database
-	Dbname string `json:"dbname"`
+	// The CDB name for oracle 19c database,required without databaseref
+	// +optional
+	Dbname string `json:"dbname,omitempty"`
 
-	// The PDB name as well as the service name
-	Dbservice string `json:"dbservice"`
+	// The PDB name as well as the service name,required without databaseref
+	// +optional
+	Dbservice string `json:"dbservice,omitempty"`
 
 	// The Database listening port,default is 1521
 	// +optional
@@ -45,16 +53,382 @@ type ApexOrdsSpec struct {
 	//Specify to install Apex runtime only,default is false
 	// +optional
 	Apexruntimeonly bool `json:"apexruntimeonly,omitempty"`
+
+	//Database connection settings
+	// +optional
+	Database *DatabaseSpec `json:"database,omitempty"`
+
+	//Ords settings
+	// +optional
+	Ords *OrdsSpec `json:"ords,omitempty"`
+
+	//Secrets to pull the images of all pods of the ApexOrds: DB statefulset,helper pods and Ords deployment
+	// +optional
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagepullsecrets,omitempty"`
+
+	//Patches applied to the objects generated from the base manifests before they are created,
+	//ie to add sidecars, annotations, volumes or env vars
+	// +optional
+	Overrides []ObjectOverride `json:"overrides,omitempty"`
+
+	//Stop changing the objects of the ApexOrds,the status is still observed. The paused annotation does the same
+	// +optional
+	Paused bool `json:"paused,omitempty"`
+
+	//Scale Ords to zero and serve a maintenance page from httpd on the Ords services
+	// +optional
+	Maintenance bool `json:"maintenance,omitempty"`
+
+	//HTML of the maintenance page,default is a short page telling the site is under maintenance
+	// +optional
+	MaintenancePage string `json:"maintenancepage,omitempty"`
+}
+
+// DatabaseSpec defines how sqlplus and Ords connect to the database and how it is tuned
+type DatabaseSpec struct {
+	// Connect with TCPS using an Oracle wallet instead of plain TCP
+	// +optional
+	TLS *DatabaseTLS `json:"tls,omitempty"`
+
+	// Initialization parameters set with ALTER SYSTEM in the CDB,ie sga_target: 2G,processes: "300".
+	// Static parameters are written to the spfile and take effect after a DB restart.
+	// A value is a comma separated list of numbers,names and 'quoted strings'
+	// +optional
+	Parameters map[string]string `json:"parameters,omitempty"`
+
+	// Manual (default) leaves the restart for static parameters to the admin,
+	// Automatic restarts the DB pod once after they are changed
+	// +kubebuilder:validation:Enum=Manual;Automatic
+	// +optional
+	RestartPolicy string `json:"restartpolicy,omitempty"`
+
+	// The DB container image,default is henryxie/apexords-operator-database:19.2
+	// +optional
+	Image string `json:"image,omitempty"`
+
+	// Secrets to pull the DB image and the sqlplus image of the helper pods working on the DB from a private registry
+	// +optional
+	ImagePullSecrets []corev1.LocalObjectReference `json:"imagepullsecrets,omitempty"`
+
+	// Character set of a new DB,ie AL32UTF8. Default is the one of the image
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9]+$`
+	// +optional
+	CharacterSet string `json:"characterset,omitempty"`
+
+	// National character set of a new DB,AL16UTF16 or UTF8. Default is the one of the image
+	// +kubebuilder:validation:Enum=AL16UTF16;UTF8
+	// +optional
+	NationalCharacterSet string `json:"nationalcharacterset,omitempty"`
+
+	// Edition of the DB: EE (Enterprise),SE2 (Standard) or XE (Express,needs an XE image).
+	// Default is the edition of the image
+	// +kubebuilder:validation:Enum=EE;SE2;XE
+	// +optional
+	Edition string `json:"edition,omitempty"`
+
+	// Create the DB in archivelog mode
+	// +optional
+	EnableArchiveLog bool `json:"enablearchivelog,omitempty"`
+
+	// Where the sys password of the DB comes from,default is a password generated from the names
+	// +optional
+	Credentials *DatabaseCredentials `json:"credentials,omitempty"`
+}
+
+// DatabaseCreation holds the settings of spec.database a DB is created with,the DB image reads them at first boot only
+type DatabaseCreation struct {
+	// +optional
+	CharacterSet string `json:"characterset,omitempty"`
+
+	// +optional
+	NationalCharacterSet string `json:"nationalcharacterset,omitempty"`
+
+	// +optional
+	Edition string `json:"edition,omitempty"`
+
+	// +optional
+	EnableArchiveLog bool `json:"enablearchivelog,omitempty"`
+}
+
+// Providers of the DB credentials
+const (
+	CredentialsProviderSecret = "Secret"
+	CredentialsProviderVault  = "Vault"
+)
+
+// DatabaseCredentials defines the secret store holding the sys password of the DB. The operator creates the DB with it
+// and changes the sys password in the DB when a new version of the secret is found
+type DatabaseCredentials struct {
+	// Secret (default) reads a Kubernetes secret of the namespace,Vault a KV v2 secret of HashiCorp Vault
+	// +kubebuilder:validation:Enum=Secret;Vault
+	// +optional
+	Provider string `json:"provider,omitempty"`
+
+	// Name of the Kubernetes secret of provider Secret
+	// +optional
+	SecretName string `json:"secretname,omitempty"`
+
+	// Key of the sys password in the secret,default is sys_password
+	// +optional
+	Key string `json:"key,omitempty"`
+
+	// The Vault secret of provider Vault
+	// +optional
+	Vault *VaultSecret `json:"vault,omitempty"`
+}
+
+// VaultSecret defines a secret of a KV v2 secrets engine and how the operator logs in to Vault
+type VaultSecret struct {
+	// Address of Vault,ie https://vault.vault:8200
+	Address string `json:"address"`
+
+	// Mount path of the KV v2 secrets engine,default is secret
+	// +optional
+	Mount string `json:"mount,omitempty"`
+
+	// Path of the secret in the secrets engine,ie apexords/apexdevcdb
+	Path string `json:"path"`
+
+	// Version of the secret to read,default is the latest
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Version int `json:"version,omitempty"`
+
+	// Role of the Kubernetes auth method,the operator logs in with the token of its service account.
+	// The address must be in --vault-addresses of the operator. The operator logs in the same way for every
+	// namespace,so the policy of the role must only allow the secrets of the namespaces meant to use it
+	// +optional
+	Role string `json:"role,omitempty"`
+
+	// Mount path of the Kubernetes auth method,default is kubernetes
+	// +optional
+	AuthMount string `json:"authmount,omitempty"`
+
+	// Secret with a Vault token in key token,used instead of the Kubernetes auth method
+	// +optional
+	TokenSecret string `json:"tokensecret,omitempty"`
+
+	// Secret with the CA certificate of Vault in key ca.crt
+	// +optional
+	CASecret string `json:"casecret,omitempty"`
+
+	// How often the secret is read to find a new version,default is 5m
+	// +optional
+	RefreshInterval *metav1.Duration `json:"refreshinterval,omitempty"`
+}
+
+// Editions of the DB
+const (
+	DbEditionEE  = "EE"
+	DbEditionSE2 = "SE2"
+	DbEditionXE  = "XE"
+)
+
+// Restart policies of the DB for static parameters
+const (
+	DbRestartManual    = "Manual"
+	DbRestartAutomatic = "Automatic"
+)
+
+// DatabaseTLS defines the wallet and TCPS endpoint of the database.
+// The DB created by the operator has no TCPS listener,tls connects to an existing DB named by tnsalias or host
+type DatabaseTLS struct {
+	// Secret with the wallet files (cwallet.sso, ewallet.p12, sqlnet.ora, tnsnames.ora ...),
+	// mounted at /opt/oracle/wallet which is the TNS_ADMIN of sqlplus and Ords
+	WalletSecret string `json:"walletsecret"`
+
+	// The host of the TCPS listener of the database
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=253
+	// +optional
+	Host string `json:"host,omitempty"`
+
+	// The TCPS listening port of host,default is 2484
+	// +kubebuilder:validation:Pattern=`^[0-9]{1,5}$`
+	// +optional
+	Port string `json:"port,omitempty"`
+
+	// An alias of the tnsnames.ora in the wallet to connect to,ie the _high service of an Autonomous DB
+	// +optional
+	TNSAlias string `json:"tnsalias,omitempty"`
+}
+
+// OrdsSpec defines the Ords deployment of an ApexOrds
+type OrdsSpec struct {
+	//Pools for more PDBs of the CDB served by the same Ords deployment besides the default pool of dbservice
+	// +optional
+	Pools []OrdsPool `json:"pools,omitempty"`
+}
+
+// OrdsPool defines an Ords connection pool to a PDB and the requests routed to it
+type OrdsPool struct {
+	// Name of the pool and its config files
+	// +kubebuilder:validation:Pattern=`^[a-z][a-z0-9_]*$`
+	Name string `json:"name"`
+
+	// The PDB service name of the pool
+	Dbservice string `json:"dbservice"`
+
+	// Secret with the password of the Apex and Ords users of the pool in key password,
+	// default is the password of the default pool
+	// +optional
+	CredentialsSecret string `json:"credentialssecret,omitempty"`
+
+	// Requests with this path prefix,ie /sales,go to the pool
+	// +kubebuilder:validation:Pattern=`^/[^/].*$`
+	// +optional
+	PathPrefix string `json:"pathprefix,omitempty"`
+
+	// Requests to this host,ie sales.example.com,go to the pool
+	// +optional
+	Host string `json:"host,omitempty"`
+}
+
+// Patch types of an ObjectOverride
+const (
+	PatchTypeStrategicMerge = "strategic"
+	PatchTypeJSON           = "json"
+)
+
+// ObjectOverride patches a generated object, similar to the patches of kustomize
+type ObjectOverride struct {
+	// Kind of the generated object: StatefulSet, Deployment, Service or ConfigMap
+	// +kubebuilder:validation:Enum=StatefulSet;Deployment;Service;ConfigMap
+	Kind string `json:"kind"`
+
+	// Name of the generated object ie apexdevcdb-apexords-db-sts,empty patches all objects of the kind
+	// +optional
+	Name string `json:"name,omitempty"`
+
+	// strategic (strategic merge patch,default) or json (RFC 6902 JSON patch)
+	// +kubebuilder:validation:Enum=strategic;json
+	// +optional
+	Type string `json:"type,omitempty"`
+
+	// The patch in YAML or JSON
+	Patch string `json:"patch"`
+}
+
+// GeneratedObject is an object the operator created for a resource in its namespace
+type GeneratedObject struct {
+	// Kind of the object: StatefulSet, Deployment, Service, ConfigMap or Secret
+	Kind string `json:"kind"`
+
+	// Name of the object
+	Name string `json:"name"`
 }
 
+// Phases of an ApexOrds instance
+const (
+	PhaseProvisioning   = "Provisioning"
+	PhaseInstallingApex = "InstallingApex"
+	PhaseInstallingOrds = "InstallingOrds"
+	PhaseReady          = "Ready"
+	PhaseFailed         = "Failed"
+)
+
+// Condition types of an ApexOrds instance
+const (
+	ConditionDatabaseProvisioned = "DatabaseProvisioned"
+	ConditionApexInstalled       = "ApexInstalled"
+	ConditionOrdsInstalled       = "OrdsInstalled"
+	ConditionParametersApplied   = "ParametersApplied"
+	ConditionWaitingForDatabase  = "WaitingForDatabase"
+	ConditionPaused              = "Paused"
+	ConditionMaintenance         = "Maintenance"
+	ConditionFailed              = "Failed"
+)
+
+// RotatePasswordsAnnotation triggers a rotation of the Apex admin and public user passwords when its value changes,
+// ie kubectl annotate apexords the-name operator.apexords-operator/rotate-passwords=$(date +%s) --overwrite
+const RotatePasswordsAnnotation = "operator.apexords-operator/rotate-passwords"
+
+// PausedAnnotation set to true pauses the reconcile of an ApexOrds like spec.paused,
+// ie kubectl annotate apexords the-name operator.apexords-operator/paused=true
+const PausedAnnotation = "operator.apexords-operator/paused"
+
 // ApexOrdsStatus defines the observed state of ApexOrds
 type ApexOrdsStatus struct {
 	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
 	// Important: Run "make" to regenerate code after modifying this file
+
+	// The step the operator is working on: Provisioning,InstallingApex,InstallingOrds,Ready or Failed
+	// +optional
+	Phase string `json:"phase,omitempty"`
+
+	// DatabaseProvisioned,ApexInstalled and OrdsInstalled record finished steps,which are skipped on later reconciles.
+	// ParametersApplied records the generation whose DB parameters are set.
+	// Failed carries the reason and message of the last failed step
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// DB parameters set in the spfile which take effect after the next DB restart
+	// +optional
+	PendingRestart []string `json:"pendingrestart,omitempty"`
+
+	// Apex version installed in the DB,ie 19.1.0.00.15
+	// +optional
+	ApexVersion string `json:"apexversion,omitempty"`
+
+	// Version of ords.war which installed the Ords schemas,ie 19.4.0.r3521226
+	// +optional
+	OrdsVersion string `json:"ordsversion,omitempty"`
+
+	// Value of the rotate-passwords annotation of the last password rotation
+	// +optional
+	PasswordsRotation string `json:"passwordsrotation,omitempty"`
+
+	// Time of the last password rotation
+	// +optional
+	PasswordsRotatedAt *metav1.Time `json:"passwordsrotatedat,omitempty"`
+
+	// Value of the rotate-passwords annotation whose rotation kept the old public password working,
+	// the old password is expired once the Ords pods use the new one
+	// +optional
+	PasswordsRollover string `json:"passwordsrollover,omitempty"`
+
+	// Version of the database.credentials secret whose sys password the DB has,
+	// the resourceVersion of a Kubernetes secret or the version of a Vault secret
+	// +optional
+	CredentialsVersion string `json:"credentialsversion,omitempty"`
+
+	// Ready pods of the Ords deployment,observed also while the ApexOrds is paused
+	// +optional
+	OrdsReadyReplicas int32 `json:"ordsreadyreplicas,omitempty"`
+
+	// The dbname the generated DB objects are named after,spec.dbname can't change once it is recorded
+	// +optional
+	Dbname string `json:"dbname,omitempty"`
+
+	// The OracleDatabase the Ords objects were set up for,spec.databaseref can't change once it is recorded
+	// +optional
+	DatabaseRef string `json:"databaseref,omitempty"`
+
+	// The ordsname the generated Ords objects are named after,spec.ordsname can't change once it is recorded
+	// +optional
+	Ordsname string `json:"ordsname,omitempty"`
+
+	// Objects generated for the ApexOrds
+	// +optional
+	Objects []GeneratedObject `json:"objects,omitempty"`
+
+	// Hash of the spec.overrides the objects were created with,spec.overrides can't change once it is recorded
+	// +optional
+	OverridesHash string `json:"overrideshash,omitempty"`
+
+	// The settings of spec.database the DB was created with,they can't change once they are recorded
+	// +optional
+	DatabaseCreation *DatabaseCreation `json:"databasecreation,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Apex",type=string,JSONPath=`.status.apexversion`,priority=1
+//+kubebuilder:printcolumn:name="Ords",type=string,JSONPath=`.status.ordsversion`,priority=1
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // ApexOrds is the Schema for the apexords API
 type ApexOrds struct {
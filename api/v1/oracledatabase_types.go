@@ -0,0 +1,137 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// OracleDatabaseSpec defines the desired state of OracleDatabase
+type OracleDatabaseSpec struct {
+	// The CDB name for oracle 19c database
+	Dbname string `json:"dbname"`
+
+	// The PDB name as well as the service name
+	Dbservice string `json:"dbservice"`
+
+	// The Database listening port,default is 1521
+	// +optional
+	Dbport string `json:"dbport,omitempty"`
+
+	//Specify to install Apex runtime only,default is false
+	// +optional
+	Apexruntimeonly bool `json:"apexruntimeonly,omitempty"`
+
+	// Connection,parameters,image and creation settings of the DB
+	DatabaseSpec `json:",inline"`
+
+	//Patches applied to the DB statefulset and service before they are created
+	// +optional
+	Overrides []ObjectOverride `json:"overrides,omitempty"`
+}
+
+// OracleDatabaseStatus defines the observed state of OracleDatabase
+type OracleDatabaseStatus struct {
+	// The step the operator is working on: Provisioning,InstallingApex,InstallingOrds,Ready or Failed
+	// +optional
+	Phase string `json:"phase,omitempty"`
+
+	// DatabaseProvisioned,ApexInstalled and OrdsInstalled record finished steps,which are skipped on later reconciles.
+	// ParametersApplied records the generation whose DB parameters are set.
+	// Failed carries the reason and message of the last failed step
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// DB parameters set in the spfile which take effect after the next DB restart
+	// +optional
+	PendingRestart []string `json:"pendingrestart,omitempty"`
+
+	// Apex version installed in the DB,ie 19.1.0.00.15
+	// +optional
+	ApexVersion string `json:"apexversion,omitempty"`
+
+	// Ords version whose schemas are installed in the DB,the ApexOrds of the DB set up their pools only
+	// +optional
+	OrdsVersion string `json:"ordsversion,omitempty"`
+
+	// Value of the rotate-passwords annotation of the last password rotation
+	// +optional
+	PasswordsRotation string `json:"passwordsrotation,omitempty"`
+
+	// Time of the last password rotation
+	// +optional
+	PasswordsRotatedAt *metav1.Time `json:"passwordsrotatedat,omitempty"`
+
+	// Value of the rotate-passwords annotation whose rotation kept the old public password working,
+	// the old password is expired once the Ords pods use the new one
+	// +optional
+	PasswordsRollover string `json:"passwordsrollover,omitempty"`
+
+	// Version of the database.credentials secret whose sys password the DB has,
+	// the resourceVersion of a Kubernetes secret or the version of a Vault secret
+	// +optional
+	CredentialsVersion string `json:"credentialsversion,omitempty"`
+
+	// The dbname the generated objects are named after,spec.dbname can't change once it is recorded
+	// +optional
+	Dbname string `json:"dbname,omitempty"`
+
+	// Objects generated for the OracleDatabase
+	// +optional
+	Objects []GeneratedObject `json:"objects,omitempty"`
+
+	// Hash of the spec.overrides the objects were created with,spec.overrides can't change once it is recorded
+	// +optional
+	OverridesHash string `json:"overrideshash,omitempty"`
+
+	// The settings of spec.database the DB was created with,they can't change once they are recorded
+	// +optional
+	DatabaseCreation *DatabaseCreation `json:"databasecreation,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="DB",type=string,JSONPath=`.spec.dbname`
+//+kubebuilder:printcolumn:name="Service",type=string,JSONPath=`.spec.dbservice`
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Apex",type=string,JSONPath=`.status.apexversion`,priority=1
+//+kubebuilder:printcolumn:name="Ords",type=string,JSONPath=`.status.ordsversion`,priority=1
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// OracleDatabase is the Schema for the oracledatabases API,a DB with Apex installed which several ApexOrds can share
+type OracleDatabase struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   OracleDatabaseSpec   `json:"spec,omitempty"`
+	Status OracleDatabaseStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// OracleDatabaseList contains a list of OracleDatabase
+type OracleDatabaseList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []OracleDatabase `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&OracleDatabase{}, &OracleDatabaseList{})
+}
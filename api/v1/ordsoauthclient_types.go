@@ -0,0 +1,126 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// OrdsOAuthName is the name of an Ords role or privilege. It goes into a sqlplus script,so it can't span lines
+// +kubebuilder:validation:Pattern=`^[^\r\n]*$`
+type OrdsOAuthName string
+
+// OrdsOAuthClientSpec defines the desired state of OrdsOAuthClient
+type OrdsOAuthClientSpec struct {
+	// Name of the ApexOrds in the same namespace whose Ords and DB host the client
+	ApexOrdsRef string `json:"apexordsref"`
+
+	// The REST enabled schema which owns the OAuth client,an unquoted Oracle identifier
+	// +kubebuilder:validation:Pattern=`^[A-Za-z][A-Za-z0-9_$#]*$`
+	// +kubebuilder:validation:MaxLength=128
+	Schema string `json:"schema"`
+
+	// The OAuth client name registered in Ords,default is the resource name
+	// +kubebuilder:validation:Pattern=`^[^\r\n]*$`
+	// +optional
+	ClientName string `json:"clientname,omitempty"`
+
+	// Description of the OAuth client
+	// +kubebuilder:validation:Pattern=`^[^\r\n]*$`
+	// +optional
+	Description string `json:"description,omitempty"`
+
+	// Support email shown for the OAuth client
+	// +kubebuilder:validation:Pattern=`^[^\r\n]*$`
+	// +optional
+	SupportEmail string `json:"supportemail,omitempty"`
+
+	// Ords roles granted to the client
+	// +optional
+	Roles []OrdsOAuthName `json:"roles,omitempty"`
+
+	// Ords privileges the client is allowed to access
+	// +optional
+	Privileges []OrdsOAuthName `json:"privileges,omitempty"`
+
+	// Secret to write client_id and client_secret into,default is <name>-ords-oauth
+	// +optional
+	SecretName string `json:"secretname,omitempty"`
+
+	// Change this value to rotate the client secret
+	// +optional
+	RotationToken string `json:"rotationtoken,omitempty"`
+}
+
+// OrdsOAuthClientStatus defines the observed state of OrdsOAuthClient
+type OrdsOAuthClientStatus struct {
+	// Ready or Failed
+	// +optional
+	Phase string `json:"phase,omitempty"`
+
+	// The client_id generated by Ords
+	// +optional
+	ClientID string `json:"clientid,omitempty"`
+
+	// The Secret holding client_id and client_secret
+	// +optional
+	SecretName string `json:"secretname,omitempty"`
+
+	// The rotation token the current client secret was issued for
+	// +optional
+	ObservedRotationToken string `json:"observedrotationtoken,omitempty"`
+
+	// Time the client secret was last issued
+	// +optional
+	LastRotationTime *metav1.Time `json:"lastrotationtime,omitempty"`
+
+	// WaitingForDatabase tells the client waits for another resource to finish its scripts in the DB,
+	// Failed tells why the last reconcile failed
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Schema",type=string,JSONPath=`.spec.schema`
+//+kubebuilder:printcolumn:name="Secret",type=string,JSONPath=`.status.secretname`
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// OrdsOAuthClient is the Schema for the ordsoauthclients API
+type OrdsOAuthClient struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   OrdsOAuthClientSpec   `json:"spec,omitempty"`
+	Status OrdsOAuthClientStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// OrdsOAuthClientList contains a list of OrdsOAuthClient
+type OrdsOAuthClientList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []OrdsOAuthClient `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&OrdsOAuthClient{}, &OrdsOAuthClientList{})
+}
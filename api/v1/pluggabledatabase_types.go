@@ -0,0 +1,113 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// States of a PDB
+const (
+	PdbStateOpen   = "Open"
+	PdbStateClosed = "Closed"
+)
+
+// PluggableDatabaseSpec defines the desired state of PluggableDatabase
+type PluggableDatabaseSpec struct {
+	// Name of the OracleDatabase in the same namespace whose CDB hosts the PDB
+	DatabaseRef string `json:"databaseref"`
+
+	// The PDB name as well as its service name
+	// +kubebuilder:validation:Pattern=`^[A-Za-z][A-Za-z0-9_]*$`
+	// +kubebuilder:validation:MaxLength=30
+	Pdbname string `json:"pdbname"`
+
+	// Clone the PDB from this PDB of the same CDB instead of the seed,ie the dbservice of the OracleDatabase
+	// to get a PDB with Apex installed
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[A-Za-z][A-Za-z0-9_]*$`
+	CloneFrom string `json:"clonefrom,omitempty"`
+
+	// Open or Closed,default is Open
+	// +optional
+	// +kubebuilder:validation:Enum=Open;Closed
+	State string `json:"state,omitempty"`
+
+	// Storage quota of the PDB,ie 10G or UNLIMITED,default is UNLIMITED
+	// +optional
+	// +kubebuilder:validation:Pattern=`^([1-9][0-9]*[KMGT]|UNLIMITED)$`
+	MaxSize string `json:"maxsize,omitempty"`
+
+	// Save the state of the PDB,so the CDB opens it again after a restart
+	// +optional
+	SaveState bool `json:"savestate,omitempty"`
+
+	// Keep the PDB in the CDB when the resource is deleted,default drops it including datafiles
+	// +optional
+	KeepOnDelete bool `json:"keepondelete,omitempty"`
+}
+
+// PluggableDatabaseStatus defines the observed state of PluggableDatabase
+type PluggableDatabaseStatus struct {
+	// Provisioning,Ready or Failed
+	// +optional
+	Phase string `json:"phase,omitempty"`
+
+	// The pdbname the PDB was created with,spec.pdbname can't change once it is set
+	// +optional
+	Pdbname string `json:"pdbname,omitempty"`
+
+	// Open mode of the PDB reported by v$pdbs,ie READ WRITE or MOUNTED
+	// +optional
+	OpenMode string `json:"openmode,omitempty"`
+
+	// Failed carries the reason and message of the last failed step
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="CDB",type=string,JSONPath=`.spec.databaseref`
+//+kubebuilder:printcolumn:name="PDB",type=string,JSONPath=`.spec.pdbname`
+//+kubebuilder:printcolumn:name="Open Mode",type=string,JSONPath=`.status.openmode`
+//+kubebuilder:printcolumn:name="Phase",type=string,JSONPath=`.status.phase`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// PluggableDatabase is the Schema for the pluggabledatabases API,a PDB in the CDB of an OracleDatabase
+type PluggableDatabase struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PluggableDatabaseSpec   `json:"spec,omitempty"`
+	Status PluggableDatabaseStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// PluggableDatabaseList contains a list of PluggableDatabase
+type PluggableDatabaseList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PluggableDatabase `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PluggableDatabase{}, &PluggableDatabaseList{})
+}
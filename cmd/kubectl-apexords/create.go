@@ -0,0 +1,80 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+
+	operatorv1 "apexords-operator/apexords-operator/api/v1"
+)
+
+//runCreate creates an ApexOrds from flags,with --dry-run it prints the resource instead
+func runCreate(o *options, args []string) error {
+	fs := o.newFlagSet("create", "create NAME (--dbname CDB --dbservice PDB | --databaseref ORACLEDATABASE) [flags]")
+	var spec operatorv1.ApexOrdsSpec
+	var dryRun bool
+	fs.StringVar(&spec.Dbname, "dbname", "", "Name of the CDB the operator creates")
+	fs.StringVar(&spec.Dbservice, "dbservice", "", "Name of the PDB Apex and Ords are installed in")
+	fs.StringVar(&spec.Dbport, "dbport", "", "Listener port of the DB,default is 1521")
+	fs.StringVar(&spec.DatabaseRef, "databaseref", "", "Name of an OracleDatabase in the namespace to install Ords for,instead of --dbname")
+	fs.StringVar(&spec.Ordsname, "ordsname", "", "Name of the Ords deployment and its objects,default is NAME")
+	fs.BoolVar(&spec.Apexruntimeonly, "apexruntimeonly", false, "Install the Apex runtime without the App Builder")
+	fs.BoolVar(&dryRun, "dry-run", false, "Print the ApexOrds as yaml instead of creating it")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	name, err := nameArg(fs, positional)
+	if err != nil {
+		return err
+	}
+	if spec.DatabaseRef == "" && (spec.Dbname == "" || spec.Dbservice == "") {
+		return fmt.Errorf("--dbname and --dbservice are required without --databaseref")
+	}
+	if spec.DatabaseRef != "" && (spec.Dbname != "" || spec.Dbservice != "" || spec.Dbport != "") {
+		return fmt.Errorf("--dbname,--dbservice and --dbport come from the OracleDatabase of --databaseref")
+	}
+	if spec.Ordsname == "" {
+		spec.Ordsname = name
+	}
+	if err := o.connect(); err != nil {
+		return err
+	}
+
+	apexords := &operatorv1.ApexOrds{
+		TypeMeta:   metav1.TypeMeta{APIVersion: operatorv1.GroupVersion.String(), Kind: "ApexOrds"},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: o.namespace},
+		Spec:       spec,
+	}
+	if dryRun {
+		data, err := yaml.Marshal(apexords)
+		if err != nil {
+			return err
+		}
+		_, err = o.out.Write(data)
+		return err
+	}
+	if err := o.client.Create(context.Background(), apexords); err != nil {
+		return err
+	}
+	fmt.Fprintf(o.out, "apexords/%s created\n", name)
+	return nil
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"text/tabwriter"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	operatorv1 "apexords-operator/apexords-operator/api/v1"
+	"apexords-operator/apexords-operator/controllers"
+)
+
+//runCredentials prints the login of the Apex internal workspace and the sys password from the credentials secret
+func runCredentials(o *options, args []string) error {
+	fs := o.newFlagSet("credentials", "credentials NAME [flags]")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	name, err := nameArg(fs, positional)
+	if err != nil {
+		return err
+	}
+	if err := o.connect(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	var apexords operatorv1.ApexOrds
+	if err := o.client.Get(ctx, client.ObjectKey{Namespace: o.namespace, Name: name}, &apexords); err != nil {
+		return err
+	}
+	var secret corev1.Secret
+	secretname := controllers.CredentialsSecretName(&apexords)
+	if err := o.client.Get(ctx, client.ObjectKey{Namespace: o.namespace, Name: secretname}, &secret); err != nil {
+		return fmt.Errorf("unable to get secret %s,the operator writes it once the DB is running: %v", secretname, err)
+	}
+
+	w := tabwriter.NewWriter(o.out, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(w, "URL:\t%s\n", orNone(ordsURL(ctx, o.client, &apexords)))
+	fmt.Fprintln(w, "Workspace:\tinternal")
+	fmt.Fprintln(w, "Username:\tadmin")
+	fmt.Fprintf(w, "Password:\t%s\n", secret.Data[controllers.CredentialsApexAdminPasswordKey])
+	fmt.Fprintf(w, "DB sys password:\t%s\n", secret.Data[controllers.CredentialsSysPasswordKey])
+	return w.Flush()
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	operatorv1 "apexords-operator/apexords-operator/api/v1"
+	"apexords-operator/apexords-operator/controllers"
+)
+
+//schemas ords.war install creates in a PDB
+var ordsSchemas = []string{"ORDS_METADATA", "ORDS_PUBLIC_USER"}
+
+var pdbName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_$#]*$`)
+
+//runDelete deletes the ApexOrds. With --drop-schemas it first drops the Ords schemas in the PDB of the ApexOrds
+//and of its pools,after the name of the ApexOrds is typed to confirm
+func runDelete(o *options, args []string) error {
+	fs := o.newFlagSet("delete", "delete NAME [--drop-schemas [--yes]] [flags]")
+	var dropSchemas, yes bool
+	fs.BoolVar(&dropSchemas, "drop-schemas", false, "Drop the Ords schemas "+strings.Join(ordsSchemas, ",")+" in the DB before deleting the ApexOrds")
+	fs.BoolVar(&yes, "yes", false, "Drop the schemas without asking to confirm")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	name, err := nameArg(fs, positional)
+	if err != nil {
+		return err
+	}
+	if err := o.connect(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	var apexords operatorv1.ApexOrds
+	if err := o.client.Get(ctx, client.ObjectKey{Namespace: o.namespace, Name: name}, &apexords); err != nil {
+		return err
+	}
+	if dropSchemas {
+		if err := o.dropOrdsSchemas(ctx, &apexords, yes); err != nil {
+			return err
+		}
+	}
+	if err := o.client.Delete(ctx, &apexords); err != nil {
+		return err
+	}
+	fmt.Fprintf(o.out, "apexords/%s deleted\n", name)
+	return nil
+}
+
+//dropOrdsSchemas runs sqlplus as sysdba in the DB pod,the schemas of a PDB another ApexOrds serves are not dropped
+func (o *options) dropOrdsSchemas(ctx context.Context, apexords *operatorv1.ApexOrds, yes bool) error {
+	oradb, err := controllers.ApexOrdsDatabase(ctx, o.client, apexords)
+	if err != nil {
+		return fmt.Errorf("unable to get the DB of apexords %s: %v", apexords.ObjectMeta.Name, err)
+	}
+	pdbs := ordsPdbs(apexords, &oradb.Spec)
+	for _, pdb := range pdbs {
+		if !pdbName.MatchString(pdb) {
+			return fmt.Errorf("%s is no PDB name,drop the Ords schemas by hand", pdb)
+		}
+	}
+
+	var list operatorv1.ApexOrdsList
+	if err := o.client.List(ctx, &list, client.InNamespace(apexords.ObjectMeta.Namespace)); err != nil {
+		return err
+	}
+	for i := range list.Items {
+		other := &list.Items[i]
+		if other.ObjectMeta.Name == apexords.ObjectMeta.Name {
+			continue
+		}
+		otherdb, err := controllers.ApexOrdsDatabase(ctx, o.client, other)
+		if err != nil || otherdb.Spec.Dbname != oradb.Spec.Dbname {
+			continue
+		}
+		for _, pdb := range ordsPdbs(other, &otherdb.Spec) {
+			for _, own := range pdbs {
+				if strings.EqualFold(pdb, own) {
+					return fmt.Errorf("apexords %s serves PDB %s as well,its Ords schemas can't be dropped", other.ObjectMeta.Name, pdb)
+				}
+			}
+		}
+	}
+
+	if !yes {
+		fmt.Fprintf(o.out, "This drops the Ords schemas %s in PDB %s of DB %s,which can't be undone.\n",
+			strings.Join(ordsSchemas, ","), strings.Join(pdbs, ","), oradb.Spec.Dbname)
+		fmt.Fprintf(o.out, "Type the name of the ApexOrds to confirm: ")
+		answer, _ := bufio.NewReader(o.in).ReadString('\n')
+		if strings.TrimSpace(answer) != apexords.ObjectMeta.Name {
+			return fmt.Errorf("not confirmed,apexords %s is kept", apexords.ObjectMeta.Name)
+		}
+	}
+
+	dbpod := controllers.DbPodName(&oradb.Spec)
+	command := []string{"/bin/sh", "-c", dropOrdsSchemasCommand(pdbs)}
+	result, err := o.runner.Run(ctx, apexords.ObjectMeta.Namespace, dbpod, command, nil)
+	if err != nil {
+		if sqlErr := controllers.FirstSqlplusError(result.Stdout); sqlErr != nil {
+			return fmt.Errorf("dropping the Ords schemas failed in pod %s: %v", dbpod, sqlErr)
+		}
+		return fmt.Errorf("dropping the Ords schemas failed in pod %s: %v %s", dbpod, err, result.Stderr)
+	}
+	fmt.Fprintf(o.out, "Ords schemas dropped in %s\n", strings.Join(pdbs, ","))
+	return nil
+}
+
+//ordsPdbs returns the PDBs the ApexOrds installed Ords in,its dbservice and the ones of its pools
+func ordsPdbs(apexords *operatorv1.ApexOrds, db *operatorv1.OracleDatabaseSpec) []string {
+	pdbs := []string{strings.ToUpper(db.Dbservice)}
+	for _, pool := range controllers.OrdsPools(apexords) {
+		pdbs = append(pdbs, strings.ToUpper(pool.Dbservice))
+	}
+	return pdbs
+}
+
+//dropOrdsSchemasCommand locks the Ords schemas in each PDB,kills the sessions the Ords deployment still has
+//and drops them. It connects with OS authentication in the DB pod,so it needs no password.
+func dropOrdsSchemasCommand(pdbs []string) string {
+	var quoted []string
+	for _, schema := range ordsSchemas {
+		quoted = append(quoted, "'"+schema+"'")
+	}
+	users := "select username from dba_users where username in (" + strings.Join(quoted, ", ") + ")"
+	script := "sqlplus -s -L / as sysdba <<'EOF'\n" +
+		"whenever sqlerror exit failure\n" +
+		"set feedback off\n"
+	for _, pdb := range pdbs {
+		script += "alter session set container = " + pdb + ";\n" +
+			"begin\n" +
+			"  for u in (" + users + ") loop\n" +
+			"    execute immediate 'alter user ' || u.username || ' account lock';\n" +
+			"  end loop;\n" +
+			"  for s in (select sid, serial# from v$session where username in (" + strings.Join(quoted, ", ") + ")) loop\n" +
+			"    begin\n" +
+			"      execute immediate 'alter system kill session ''' || s.sid || ',' || s.serial# || ''' immediate';\n" +
+			"    exception\n" +
+			"      when others then null;\n" +
+			"    end;\n" +
+			"  end loop;\n" +
+			"  for u in (" + users + ") loop\n" +
+			"    execute immediate 'drop user ' || u.username || ' cascade';\n" +
+			"  end loop;\n" +
+			"end;\n" +
+			"/\n"
+	}
+	script += "exit\n" +
+		"EOF"
+	return script
+}
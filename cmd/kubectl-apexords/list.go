@@ -0,0 +1,117 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/duration"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	operatorv1 "apexords-operator/apexords-operator/api/v1"
+)
+
+//runList prints the ApexOrds with their phase,URL and versions
+func runList(o *options, args []string) error {
+	fs := o.newFlagSet("list", "list [-A] [flags]")
+	var allNamespaces bool
+	fs.BoolVar(&allNamespaces, "A", false, "List the ApexOrds of all namespaces")
+	fs.BoolVar(&allNamespaces, "all-namespaces", false, "Same as -A")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 0 {
+		fs.Usage()
+		return fmt.Errorf("list takes no arguments")
+	}
+	if err := o.connect(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	var list operatorv1.ApexOrdsList
+	var listOpts []client.ListOption
+	if !allNamespaces {
+		listOpts = append(listOpts, client.InNamespace(o.namespace))
+	}
+	if err := o.client.List(ctx, &list, listOpts...); err != nil {
+		return err
+	}
+	if len(list.Items) == 0 {
+		fmt.Fprintln(o.out, "No ApexOrds found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(o.out, 0, 8, 3, ' ', 0)
+	if allNamespaces {
+		fmt.Fprint(w, "NAMESPACE\t")
+	}
+	fmt.Fprintln(w, "NAME\tPHASE\tURL\tAPEX\tORDS\tAGE")
+	for i := range list.Items {
+		apexords := &list.Items[i]
+		if allNamespaces {
+			fmt.Fprint(w, apexords.ObjectMeta.Namespace+"\t")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			apexords.ObjectMeta.Name,
+			orNone(apexords.Status.Phase),
+			orNone(ordsURL(ctx, o.client, apexords)),
+			orNone(apexords.Status.ApexVersion),
+			orNone(apexords.Status.OrdsVersion),
+			duration.HumanDuration(time.Since(apexords.ObjectMeta.CreationTimestamp.Time)))
+	}
+	return w.Flush()
+}
+
+//ordsURL returns the Apex URL of the load balancer service of the Ords deployment,or the node port
+//of its nodeport service while the load balancer has no address
+func ordsURL(ctx context.Context, c client.Client, apexords *operatorv1.ApexOrds) string {
+	var lbsvc corev1.Service
+	key := client.ObjectKey{Namespace: apexords.ObjectMeta.Namespace, Name: apexords.Spec.Ordsname + "-apexords-svc"}
+	if err := c.Get(ctx, key, &lbsvc); err == nil {
+		for _, ingress := range lbsvc.Status.LoadBalancer.Ingress {
+			if ingress.Hostname != "" {
+				return "http://" + ingress.Hostname + "/ords/"
+			}
+			if ingress.IP != "" {
+				return "http://" + ingress.IP + "/ords/"
+			}
+		}
+	}
+	var nodeportsvc corev1.Service
+	key.Name = apexords.Spec.Ordsname + "-apexords-nodeport-svc"
+	if err := c.Get(ctx, key, &nodeportsvc); err == nil {
+		for _, port := range nodeportsvc.Spec.Ports {
+			if port.NodePort != 0 {
+				return fmt.Sprintf("http://<node>:%d/ords/", port.NodePort)
+			}
+		}
+	}
+	return ""
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "<none>"
+	}
+	return s
+}
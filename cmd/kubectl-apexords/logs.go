@@ -0,0 +1,223 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/watch"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	operatorv1 "apexords-operator/apexords-operator/api/v1"
+	"apexords-operator/apexords-operator/controllers"
+)
+
+//runLogs prints the output of the install steps of the ApexOrds the operator keeps in its install log configmaps,
+//the one of its OracleDatabase first with databaseref. With --events it prints the events of each step instead,
+//with --db the log of the DB pod,which shows the DB creation at first boot
+func runLogs(o *options, args []string) error {
+	fs := o.newFlagSet("logs", "logs NAME [-f] [--events | --db [--tail n]] [flags]")
+	var follow, events, dblog bool
+	var tail int64
+	fs.BoolVar(&follow, "f", false, "Follow the output of new install steps,new events with --events or the DB pod log with --db")
+	fs.BoolVar(&follow, "follow", false, "Same as -f")
+	fs.BoolVar(&events, "events", false, "Show the events of the install steps instead of their output")
+	fs.BoolVar(&dblog, "db", false, "Show the log of the DB pod instead of the install output")
+	fs.Int64Var(&tail, "tail", -1, "Lines of the DB pod log to show,default is all")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	name, err := nameArg(fs, positional)
+	if err != nil {
+		return err
+	}
+	if events && dblog {
+		return fmt.Errorf("--events and --db can't be used together")
+	}
+	if err := o.connect(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	var apexords operatorv1.ApexOrds
+	if err := o.client.Get(ctx, client.ObjectKey{Namespace: o.namespace, Name: name}, &apexords); err != nil {
+		return err
+	}
+	if dblog {
+		return o.dbPodLog(ctx, &apexords, follow, tail)
+	}
+	if events {
+		return o.installEvents(ctx, &apexords, follow)
+	}
+	return o.installLogs(ctx, &apexords, follow)
+}
+
+//installLogs prints the install log configmaps of the ApexOrds,each step under a header with its key.
+//While follow is set it prints the steps which run or run again later
+func (o *options) installLogs(ctx context.Context, apexords *operatorv1.ApexOrds, follow bool) error {
+	names := []string{controllers.InstallLogName(apexords)}
+	if apexords.Spec.DatabaseRef != "" {
+		oradb := &operatorv1.OracleDatabase{}
+		if err := o.client.Get(ctx, client.ObjectKey{Namespace: apexords.ObjectMeta.Namespace, Name: apexords.Spec.DatabaseRef}, oradb); err != nil {
+			return err
+		}
+		names = append([]string{controllers.InstallLogName(oradb)}, names...)
+	}
+
+	printed := map[string]string{}
+	printNew := func(cm *corev1.ConfigMap) {
+		for _, key := range controllers.InstallLogKeys(cm.Data) {
+			id := cm.ObjectMeta.Name + "/" + key
+			if output, ok := printed[id]; ok && output == cm.Data[key] {
+				continue
+			}
+			printed[id] = cm.Data[key]
+			fmt.Fprintf(o.out, "==> %s <==\n%s", key, cm.Data[key])
+			if !strings.HasSuffix(cm.Data[key], "\n") {
+				fmt.Fprintln(o.out)
+			}
+		}
+	}
+	configmaps := o.clientset.CoreV1().ConfigMaps(apexords.ObjectMeta.Namespace)
+	for _, name := range names {
+		cm, err := configmaps.Get(ctx, name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		printNew(cm)
+	}
+	if !follow {
+		if len(printed) == 0 {
+			fmt.Fprintln(o.out, "no install steps ran for apexords/"+apexords.ObjectMeta.Name+" yet")
+		}
+		return nil
+	}
+
+	//the watch starts with the configmaps as they are,printNew skips the steps printed already
+	selector := labels.SelectorFromSet(labels.Set{controllers.LabelComponent: controllers.ComponentInstall}).String()
+	watcher, err := configmaps.Watch(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return err
+	}
+	defer watcher.Stop()
+	for change := range watcher.ResultChan() {
+		cm, ok := change.Object.(*corev1.ConfigMap)
+		if !ok || (change.Type != watch.Added && change.Type != watch.Modified) {
+			continue
+		}
+		for _, name := range names {
+			if cm.ObjectMeta.Name == name {
+				printNew(cm)
+			}
+		}
+	}
+	return nil
+}
+
+//installEvents prints the events of the ApexOrds oldest first,then the new ones while follow is set
+func (o *options) installEvents(ctx context.Context, apexords *operatorv1.ApexOrds, follow bool) error {
+	selector := fields.Set{
+		"involvedObject.kind": "ApexOrds",
+		"involvedObject.name": apexords.ObjectMeta.Name,
+	}.AsSelector().String()
+	events, err := o.clientset.CoreV1().Events(apexords.ObjectMeta.Namespace).List(ctx, metav1.ListOptions{FieldSelector: selector})
+	if err != nil {
+		return err
+	}
+	var items []corev1.Event
+	for _, event := range events.Items {
+		if event.InvolvedObject.UID == apexords.ObjectMeta.UID {
+			items = append(items, event)
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return eventTime(&items[i]).Before(eventTime(&items[j]))
+	})
+	for i := range items {
+		printEvent(o.out, &items[i])
+	}
+	if !follow {
+		return nil
+	}
+
+	watcher, err := o.clientset.CoreV1().Events(apexords.ObjectMeta.Namespace).Watch(ctx, metav1.ListOptions{
+		FieldSelector:   selector,
+		ResourceVersion: events.ListMeta.ResourceVersion,
+	})
+	if err != nil {
+		return err
+	}
+	defer watcher.Stop()
+	for change := range watcher.ResultChan() {
+		event, ok := change.Object.(*corev1.Event)
+		if !ok || (change.Type != watch.Added && change.Type != watch.Modified) {
+			continue
+		}
+		if event.InvolvedObject.UID == apexords.ObjectMeta.UID {
+			printEvent(o.out, event)
+		}
+	}
+	return nil
+}
+
+//dbPodLog streams the log of the pod of the DB statefulset,which belongs to the OracleDatabase with databaseref
+func (o *options) dbPodLog(ctx context.Context, apexords *operatorv1.ApexOrds, follow bool, tail int64) error {
+	oradb, err := controllers.ApexOrdsDatabase(ctx, o.client, apexords)
+	if err != nil {
+		return err
+	}
+	logOpts := &corev1.PodLogOptions{Follow: follow}
+	if tail >= 0 {
+		logOpts.TailLines = &tail
+	}
+	stream, err := o.clientset.CoreV1().Pods(apexords.ObjectMeta.Namespace).GetLogs(controllers.DbPodName(&oradb.Spec), logOpts).Stream(ctx)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	_, err = io.Copy(o.out, stream)
+	return err
+}
+
+//eventTime is when the event last happened,events of newer clients only set EventTime
+func eventTime(event *corev1.Event) time.Time {
+	if !event.LastTimestamp.IsZero() {
+		return event.LastTimestamp.Time
+	}
+	if !event.EventTime.IsZero() {
+		return event.EventTime.Time
+	}
+	return event.ObjectMeta.CreationTimestamp.Time
+}
+
+func printEvent(w io.Writer, event *corev1.Event) {
+	fmt.Fprintf(w, "%s  %-7s  %-24s %s\n", eventTime(event).Local().Format("2006-01-02 15:04:05"), event.Type, event.Reason, event.Message)
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+//kubectl-apexords is a kubectl plugin to create,list,inspect and delete ApexOrds resources,
+//install it on the PATH and run kubectl apexords <command>
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
+	_ "k8s.io/client-go/plugin/pkg/client/auth"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/kubernetes"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	operatorv1 "apexords-operator/apexords-operator/api/v1"
+	"apexords-operator/apexords-operator/controllers"
+)
+
+var scheme = runtime.NewScheme()
+
+func init() {
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(operatorv1.AddToScheme(scheme))
+}
+
+const usage = `kubectl apexords manages ApexOrds resources of the apexords-operator
+
+Usage:
+  kubectl apexords <command> [flags] [NAME]
+
+Commands:
+  create            create an ApexOrds from flags
+  list              list ApexOrds with phase,URL and Apex and Ords versions
+  credentials       show the Apex admin and DB sys passwords of an ApexOrds
+  logs              show the output of the install steps of an ApexOrds,its events with --events or the DB pod log with --db
+  rotate-passwords  rotate the Apex admin and public user passwords of an ApexOrds
+  delete            delete an ApexOrds,optionally dropping its Ords schemas first
+
+Examples:
+  # create an ApexOrds with its own DB,Apex and Ords
+  kubectl apexords create apexdev --dbname apexdevcdb --dbservice apexdevpdb
+  # create an ApexOrds serving the Apex of an OracleDatabase
+  kubectl apexords create apexsales --databaseref devdb
+  # list ApexOrds of all namespaces
+  kubectl apexords list -A
+  # show the login of the Apex internal workspace
+  kubectl apexords credentials apexdev
+  # follow the output of the install steps
+  kubectl apexords logs apexdev -f
+  # new Apex admin and public user passwords,Ords rolls to pick them up
+  kubectl apexords rotate-passwords apexdev
+  # drop the Ords schemas and delete the ApexOrds
+  kubectl apexords delete apexdev --drop-schemas
+
+Run kubectl apexords <command> -h for the flags of a command.
+`
+
+//options are the connection flags of all commands and the clients built from them
+type options struct {
+	namespace  string
+	kubeconfig string
+
+	in  io.Reader
+	out io.Writer
+
+	client    client.Client
+	clientset kubernetes.Interface
+	runner    controllers.CommandRunner
+}
+
+var commands = map[string]func(o *options, args []string) error{
+	"create":           runCreate,
+	"list":             runList,
+	"credentials":      runCredentials,
+	"logs":             runLogs,
+	"rotate-passwords": runRotatePasswords,
+	"delete":           runDelete,
+}
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] == "-h" || os.Args[1] == "--help" || os.Args[1] == "help" {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	run, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+	o := &options{in: os.Stdin, out: os.Stdout}
+	if err := run(o, os.Args[2:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		fmt.Fprintln(os.Stderr, "error: "+err.Error())
+		os.Exit(1)
+	}
+}
+
+//newFlagSet returns the flags of a command with the connection flags every command has
+func (o *options) newFlagSet(name string, synopsis string) *flag.FlagSet {
+	fs := flag.NewFlagSet("kubectl apexords "+name, flag.ContinueOnError)
+	fs.StringVar(&o.namespace, "n", "", "Namespace of the ApexOrds,default is the namespace of the kubeconfig context")
+	fs.StringVar(&o.namespace, "namespace", "", "Same as -n")
+	fs.StringVar(&o.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file,default is $KUBECONFIG or ~/.kube/config")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: kubectl apexords %s\n\nFlags:\n", synopsis)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+//parseArgs parses flags before and after the positional arguments,ie create NAME --dbname x,
+//as kubectl does. It returns the positional arguments.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+//nameArg returns the single NAME argument of a command
+func nameArg(fs *flag.FlagSet, args []string) (string, error) {
+	if len(args) != 1 {
+		fs.Usage()
+		return "", fmt.Errorf("expected one ApexOrds name,got %d arguments", len(args))
+	}
+	return args[0], nil
+}
+
+//connect builds the clients from the kubeconfig,the namespace of its context is the default namespace.
+//Clients set already,ie by tests,are kept.
+func (o *options) connect() error {
+	if o.client != nil {
+		if o.namespace == "" {
+			o.namespace = "default"
+		}
+		return nil
+	}
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = o.kubeconfig
+	kubeconfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{})
+	cfg, err := kubeconfig.ClientConfig()
+	if err != nil {
+		return err
+	}
+	if o.namespace == "" {
+		if o.namespace, _, err = kubeconfig.Namespace(); err != nil {
+			return err
+		}
+	}
+	if o.client, err = client.New(cfg, client.Options{Scheme: scheme}); err != nil {
+		return err
+	}
+	if o.clientset, err = kubernetes.NewForConfig(cfg); err != nil {
+		return err
+	}
+	o.runner, err = controllers.NewSPDYCommandRunner(cfg)
+	return err
+}
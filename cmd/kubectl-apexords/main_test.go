@@ -0,0 +1,248 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	operatorv1 "apexords-operator/apexords-operator/api/v1"
+	"apexords-operator/apexords-operator/controllers"
+)
+
+//fakeRunner records the commands instead of running them in a pod
+type fakeRunner struct {
+	pods     []string
+	commands []string
+	result   controllers.CommandResult
+	err      error
+}
+
+func (r *fakeRunner) Run(ctx context.Context, Namespace string, Podname string, Command []string, stdin io.Reader) (controllers.CommandResult, error) {
+	r.pods = append(r.pods, Podname)
+	r.commands = append(r.commands, Command[len(Command)-1])
+	return r.result, r.err
+}
+
+var _ = Describe("kubectl-apexords", func() {
+	var (
+		o      *options
+		out    *bytes.Buffer
+		runner *fakeRunner
+	)
+
+	newOptions := func(input string, objs ...client.Object) {
+		out = &bytes.Buffer{}
+		runner = &fakeRunner{}
+		o = &options{
+			in:        strings.NewReader(input),
+			out:       out,
+			client:    fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build(),
+			clientset: kubefake.NewSimpleClientset(),
+			runner:    runner,
+		}
+	}
+
+	apexords := func(name string, spec operatorv1.ApexOrdsSpec) *operatorv1.ApexOrds {
+		return &operatorv1.ApexOrds{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID(name)}, Spec: spec}
+	}
+
+	It("creates an ApexOrds from flags given before and after the name", func() {
+		newOptions("")
+		Expect(runCreate(o, []string{"--dbname", "apexdevcdb", "apexdev", "--dbservice", "apexdevpdb", "--apexruntimeonly"})).To(Succeed())
+		Expect(out.String()).To(Equal("apexords/apexdev created\n"))
+
+		created := &operatorv1.ApexOrds{}
+		Expect(o.client.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "apexdev"}, created)).To(Succeed())
+		Expect(created.Spec).To(Equal(operatorv1.ApexOrdsSpec{Dbname: "apexdevcdb", Dbservice: "apexdevpdb", Ordsname: "apexdev", Apexruntimeonly: true}))
+
+		Expect(runCreate(o, []string{"apexsales", "--databaseref", "devdb", "--dbname", "x"})).To(MatchError(ContainSubstring("come from the OracleDatabase")))
+		Expect(runCreate(o, []string{"apexsales"})).To(MatchError(ContainSubstring("--dbname and --dbservice are required")))
+	})
+
+	It("prints the ApexOrds with --dry-run", func() {
+		newOptions("")
+		Expect(runCreate(o, []string{"apexsales", "-n", "sales", "--databaseref", "devdb", "--dry-run"})).To(Succeed())
+		Expect(out.String()).To(ContainSubstring("kind: ApexOrds"))
+		Expect(out.String()).To(ContainSubstring("namespace: sales"))
+		Expect(out.String()).To(ContainSubstring("databaseref: devdb"))
+		Expect(out.String()).To(ContainSubstring("ordsname: apexsales"))
+	})
+
+	It("lists phase,URL and versions", func() {
+		ready := apexords("apexdev", operatorv1.ApexOrdsSpec{Dbname: "apexdevcdb", Dbservice: "apexdevpdb", Ordsname: "devords"})
+		ready.Status = operatorv1.ApexOrdsStatus{Phase: operatorv1.PhaseReady, ApexVersion: "19.1.0.00.15", OrdsVersion: "19.4.0.r3521226"}
+		lbsvc := &corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "devords-apexords-svc", Namespace: "default"}}
+		lbsvc.Status.LoadBalancer.Ingress = []corev1.LoadBalancerIngress{{IP: "10.0.0.7"}}
+		installing := apexords("apexsales", operatorv1.ApexOrdsSpec{DatabaseRef: "devdb", Ordsname: "salesords"})
+		installing.Status.Phase = operatorv1.PhaseInstallingOrds
+		nodeportsvc := &corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "salesords-apexords-nodeport-svc", Namespace: "default"},
+			Spec:       corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "http", Port: 80, NodePort: 30080}}},
+		}
+		newOptions("", ready, lbsvc, installing, nodeportsvc)
+
+		Expect(runList(o, nil)).To(Succeed())
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		Expect(lines).To(HaveLen(3))
+		Expect(strings.Fields(lines[0])).To(Equal([]string{"NAME", "PHASE", "URL", "APEX", "ORDS", "AGE"}))
+		Expect(strings.Fields(lines[1])[:5]).To(Equal([]string{"apexdev", "Ready", "http://10.0.0.7/ords/", "19.1.0.00.15", "19.4.0.r3521226"}))
+		Expect(strings.Fields(lines[2])[:5]).To(Equal([]string{"apexsales", "InstallingOrds", "http://<node>:30080/ords/", "<none>", "<none>"}))
+	})
+
+	It("shows the credentials of the ApexOrds", func() {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "devords-apexords-credentials", Namespace: "default"},
+			Data: map[string][]byte{
+				controllers.CredentialsSysPasswordKey:       []byte("syspass"),
+				controllers.CredentialsApexAdminPasswordKey: []byte("apexpass"),
+			},
+		}
+		newOptions("", apexords("apexdev", operatorv1.ApexOrdsSpec{Dbname: "apexdevcdb", Dbservice: "apexdevpdb", Ordsname: "devords"}), secret)
+
+		Expect(runCredentials(o, []string{"apexdev"})).To(Succeed())
+		Expect(out.String()).To(ContainSubstring("Workspace:        internal"))
+		Expect(out.String()).To(ContainSubstring("Password:         apexpass"))
+		Expect(out.String()).To(ContainSubstring("DB sys password:  syspass"))
+	})
+
+	It("annotates the ApexOrds,or its OracleDatabase,to rotate the passwords", func() {
+		oradb := &operatorv1.OracleDatabase{ObjectMeta: metav1.ObjectMeta{Name: "devdb", Namespace: "default"}}
+		newOptions("", apexords("apexdev", operatorv1.ApexOrdsSpec{Dbname: "apexdevcdb", Dbservice: "apexdevpdb", Ordsname: "devords"}),
+			apexords("apexsales", operatorv1.ApexOrdsSpec{DatabaseRef: "devdb", Ordsname: "salesords"}), oradb)
+
+		Expect(runRotatePasswords(o, []string{"apexdev"})).To(Succeed())
+		Expect(out.String()).To(HavePrefix("apexords/apexdev annotated"))
+		annotated := &operatorv1.ApexOrds{}
+		Expect(o.client.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "apexdev"}, annotated)).To(Succeed())
+		Expect(annotated.Annotations).To(HaveKey(operatorv1.RotatePasswordsAnnotation))
+
+		Expect(runRotatePasswords(o, []string{"apexsales"})).To(Succeed())
+		Expect(out.String()).To(ContainSubstring("oracledatabase/devdb annotated"))
+		Expect(o.client.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "devdb"}, oradb)).To(Succeed())
+		Expect(oradb.Annotations).To(HaveKey(operatorv1.RotatePasswordsAnnotation))
+	})
+
+	It("prints the install events oldest first", func() {
+		newOptions("", apexords("apexdev", operatorv1.ApexOrdsSpec{Dbname: "apexdevcdb", Dbservice: "apexdevpdb", Ordsname: "devords"}))
+		event := func(name string, uid string, minute int, reason string) *corev1.Event {
+			return &corev1.Event{
+				ObjectMeta:     metav1.ObjectMeta{Name: name, Namespace: "default"},
+				InvolvedObject: corev1.ObjectReference{Kind: "ApexOrds", Name: "apexdev", UID: types.UID(uid)},
+				LastTimestamp:  metav1.Date(2021, 7, 1, 10, minute, 0, 0, metav1.Now().Location()),
+				Type:           corev1.EventTypeNormal,
+				Reason:         reason,
+				Message:        reason + " message",
+			}
+		}
+		o.clientset = kubefake.NewSimpleClientset(
+			event("b", "apexdev", 20, controllers.ReasonApexInstallFinished),
+			event("a", "apexdev", 5, controllers.ReasonApexInstallStarted),
+			event("old", "deleted-apexdev", 1, controllers.ReasonApexInstallFailed),
+		)
+
+		Expect(runLogs(o, []string{"apexdev", "--events"})).To(Succeed())
+		lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+		Expect(lines).To(HaveLen(2))
+		Expect(lines[0]).To(ContainSubstring(controllers.ReasonApexInstallStarted + " message"))
+		Expect(lines[1]).To(ContainSubstring(controllers.ReasonApexInstallFinished + " message"))
+	})
+
+	It("prints the install output of the OracleDatabase and then of the ApexOrds", func() {
+		oradb := &operatorv1.OracleDatabase{ObjectMeta: metav1.ObjectMeta{Name: "devdb", Namespace: "default"},
+			Spec: operatorv1.OracleDatabaseSpec{Dbname: "devcdb", Dbservice: "devpdb"}}
+		newOptions("", oradb, apexords("apexsales", operatorv1.ApexOrdsSpec{DatabaseRef: "devdb", Ordsname: "salesords"}))
+		installLog := func(name string, data map[string]string) *corev1.ConfigMap {
+			return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}, Data: data}
+		}
+		o.clientset = kubefake.NewSimpleClientset(
+			installLog("salesords-apexords-install-log", map[string]string{"01-ords-setup-hr.log": "hr is set up\n"}),
+			installLog("devcdb-apexords-db-install-log", map[string]string{
+				"02-updatepass.sql.log": "passwords updated",
+				"01-createapex.sql.log": "Apex installed\n",
+				"03-ords-install.log":   "Ords installed\n",
+			}),
+		)
+
+		Expect(runLogs(o, []string{"apexsales"})).To(Succeed())
+		Expect(out.String()).To(Equal("==> 01-createapex.sql.log <==\nApex installed\n" +
+			"==> 02-updatepass.sql.log <==\npasswords updated\n" +
+			"==> 03-ords-install.log <==\nOrds installed\n" +
+			"==> 01-ords-setup-hr.log <==\nhr is set up\n"))
+	})
+
+	It("says so when no install step ran yet and rejects --events with --db", func() {
+		newOptions("", apexords("apexdev", operatorv1.ApexOrdsSpec{Dbname: "apexdevcdb", Dbservice: "apexdevpdb", Ordsname: "devords"}))
+		Expect(runLogs(o, []string{"apexdev"})).To(Succeed())
+		Expect(out.String()).To(Equal("no install steps ran for apexords/apexdev yet\n"))
+		Expect(runLogs(o, []string{"apexdev", "--events", "--db"})).To(MatchError(ContainSubstring("can't be used together")))
+	})
+
+	It("drops the Ords schemas of the ApexOrds and its pools after the name is typed", func() {
+		spec := operatorv1.ApexOrdsSpec{Dbname: "apexdevcdb", Dbservice: "apexdevpdb", Ordsname: "devords",
+			Ords: &operatorv1.OrdsSpec{Pools: []operatorv1.OrdsPool{{Name: "hr", Dbservice: "apexhrpdb"}}}}
+		newOptions("apexdev\n", apexords("apexdev", spec))
+
+		Expect(runDelete(o, []string{"apexdev", "--drop-schemas"})).To(Succeed())
+		Expect(out.String()).To(ContainSubstring("ORDS_METADATA,ORDS_PUBLIC_USER in PDB APEXDEVPDB,APEXHRPDB of DB apexdevcdb"))
+		Expect(out.String()).To(HaveSuffix("apexords/apexdev deleted\n"))
+		Expect(runner.pods).To(Equal([]string{"apexdevcdb-apexords-db-sts-0"}))
+		Expect(runner.commands[0]).To(HavePrefix("sqlplus -s -L / as sysdba <<'EOF'\nwhenever sqlerror exit failure\n"))
+		Expect(runner.commands[0]).To(ContainSubstring("alter session set container = APEXDEVPDB;"))
+		Expect(runner.commands[0]).To(ContainSubstring("alter session set container = APEXHRPDB;"))
+		Expect(runner.commands[0]).To(ContainSubstring("'drop user ' || u.username || ' cascade'"))
+		err := o.client.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "apexdev"}, &operatorv1.ApexOrds{})
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
+	It("keeps the ApexOrds and its schemas when the name is not typed", func() {
+		newOptions("y\n", apexords("apexdev", operatorv1.ApexOrdsSpec{Dbname: "apexdevcdb", Dbservice: "apexdevpdb", Ordsname: "devords"}))
+
+		Expect(runDelete(o, []string{"apexdev", "--drop-schemas"})).To(MatchError(ContainSubstring("not confirmed")))
+		Expect(runner.commands).To(BeEmpty())
+		Expect(o.client.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "apexdev"}, &operatorv1.ApexOrds{})).To(Succeed())
+	})
+
+	It("refuses to drop the schemas of a PDB another ApexOrds serves", func() {
+		oradb := &operatorv1.OracleDatabase{
+			ObjectMeta: metav1.ObjectMeta{Name: "devdb", Namespace: "default"},
+			Spec:       operatorv1.OracleDatabaseSpec{Dbname: "devcdb", Dbservice: "devpdb"},
+		}
+		newOptions("", oradb,
+			apexords("apexsales", operatorv1.ApexOrdsSpec{DatabaseRef: "devdb", Ordsname: "salesords"}),
+			apexords("apexhr", operatorv1.ApexOrdsSpec{DatabaseRef: "devdb", Ordsname: "hrords"}))
+
+		Expect(runDelete(o, []string{"apexsales", "--drop-schemas", "--yes"})).To(MatchError(ContainSubstring("apexords apexhr serves PDB DEVPDB as well")))
+		Expect(runner.commands).To(BeEmpty())
+
+		//without --drop-schemas only the ApexOrds is deleted
+		Expect(runDelete(o, []string{"apexsales"})).To(Succeed())
+		Expect(runner.commands).To(BeEmpty())
+	})
+})
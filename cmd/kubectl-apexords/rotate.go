@@ -0,0 +1,73 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	operatorv1 "apexords-operator/apexords-operator/api/v1"
+)
+
+//runRotatePasswords sets the rotate-passwords annotation to the current time,on the OracleDatabase
+//when the ApexOrds has databaseref as the passwords belong to its Apex
+func runRotatePasswords(o *options, args []string) error {
+	fs := o.newFlagSet("rotate-passwords", "rotate-passwords NAME [flags]")
+	positional, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	name, err := nameArg(fs, positional)
+	if err != nil {
+		return err
+	}
+	if err := o.connect(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	var apexords operatorv1.ApexOrds
+	if err := o.client.Get(ctx, client.ObjectKey{Namespace: o.namespace, Name: name}, &apexords); err != nil {
+		return err
+	}
+	var obj client.Object = &apexords
+	resource := "apexords/" + name
+	if apexords.Spec.DatabaseRef != "" {
+		var oradb operatorv1.OracleDatabase
+		if err := o.client.Get(ctx, client.ObjectKey{Namespace: o.namespace, Name: apexords.Spec.DatabaseRef}, &oradb); err != nil {
+			return err
+		}
+		obj = &oradb
+		resource = "oracledatabase/" + oradb.ObjectMeta.Name
+	}
+
+	patch := client.MergeFrom(obj.DeepCopyObject().(client.Object))
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[operatorv1.RotatePasswordsAnnotation] = time.Now().UTC().Format(time.RFC3339)
+	obj.SetAnnotations(annotations)
+	if err := o.client.Patch(ctx, obj, patch); err != nil {
+		return err
+	}
+	fmt.Fprintf(o.out, "%s annotated,the operator rotates the passwords,rolls Ords and expires the old public password once the rollout is done\n", resource)
+	return nil
+}
@@ -18,24 +18,32 @@ package controllers
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
+	"reflect"
 	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/kubernetes/scheme"
-	"k8s.io/client-go/tools/remotecommand"
-	ctrlconfig "sigs.k8s.io/controller-runtime/pkg/client/config"
+	"k8s.io/client-go/tools/record"
 
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	operatorv1 "apexords-operator/apexords-operator/api/v1"
 	config "apexords-operator/apexords-operator/controllers/config"
@@ -44,20 +52,95 @@ import (
 // ApexOrdsReconciler reconciles a ApexOrds object
 type ApexOrdsReconciler struct {
 	client.Client
-	Scheme     *runtime.Scheme
-	Log        logr.Logger
-	Dbpassword string
+	Scheme   *runtime.Scheme
+	Log      logr.Logger
+	Recorder record.EventRecorder
+	Runner   CommandRunner
+	//MaxConcurrentReconciles is the number of ApexOrds reconciled at once,default 1
+	MaxConcurrentReconciles int
 }
 
 //+kubebuilder:rbac:groups=operator.apexords-operator,resources=apexords,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=operator.apexords-operator,resources=apexords/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=operator.apexords-operator,resources=apexords/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=events,verbs=create;patch
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apps,resources=deployments,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=services,verbs=get;list;watch;create;update;patch;delete
 
 var (
 	//set label details for related objects
 	Apexordsoperatorlabel = map[string]string{
 		"app": "apexords-operator",
 	}
+	//how long to wait for the helper pods to run,variables so tests can shorten them
+	OrdsPodStartTimeout    = 20 * time.Minute
+	SqlplusPodStartTimeout = 8 * time.Minute
+	PodPollInterval        = 5 * time.Second
+)
+
+// Event reasons recorded on the ApexOrds object, shown in kubectl describe apexords
+const (
+	ReasonInvalidSpec            = "InvalidSpec"
+	ReasonDbStatefulSetCreated   = "DbStatefulSetCreated"
+	ReasonDbServiceCreated       = "DbServiceCreated"
+	ReasonDbFailed               = "DbFailed"
+	ReasonPodReady               = "PodReady"
+	ReasonPodTimeout             = "PodTimeout"
+	ReasonPodFailed              = "PodFailed"
+	ReasonApexInstallStarted     = "ApexInstallStarted"
+	ReasonApexInstallFinished    = "ApexInstallFinished"
+	ReasonApexInstallFailed      = "ApexInstallFailed"
+	ReasonOrdsInstallStarted     = "OrdsInstallStarted"
+	ReasonOrdsInstallFinished    = "OrdsInstallFinished"
+	ReasonOrdsInstallFailed      = "OrdsInstallFailed"
+	ReasonConfigMapCreated       = "ConfigMapCreated"
+	ReasonOrdsDeploymentCreated  = "OrdsDeploymentCreated"
+	ReasonServiceCreated         = "ServiceCreated"
+	ReasonCreateFailed           = "CreateFailed"
+	ReasonTemplateInvalid        = "TemplateInvalid"
+	ReasonOverrideInvalid        = "OverrideInvalid"
+	ReasonPodNotReady            = "PodNotReady"
+	ReasonDatabaseNotReady       = "DatabaseNotReady"
+	ReasonDatabaseReady          = "DatabaseReady"
+	ReasonDatabaseInUse          = "DatabaseInUse"
+	ReasonSecretNotFound         = "SecretNotFound"
+	ReasonPdbSQLFailed           = "PdbSQLFailed"
+	ReasonParametersApplied      = "ParametersApplied"
+	ReasonParametersFailed       = "ParametersFailed"
+	ReasonRestartRequired        = "RestartRequired"
+	ReasonDbRestarting           = "DbRestarting"
+	ReasonPasswordsRotated       = "PasswordsRotated"
+	ReasonPasswordsFailed        = "PasswordsFailed"
+	ReasonPasswordsRolledOver    = "PasswordsRolledOver"
+	ReasonOrdsConfigUpdated      = "OrdsConfigUpdated"
+	ReasonCredentialsUnavailable = "CredentialsUnavailable"
+	ReasonSysPasswordChanged     = "SysPasswordChanged"
+	ReasonDatabaseBusy           = "DatabaseBusy"
+	ReasonDatabaseLocked         = "DatabaseLocked"
+	ReasonPaused                 = "Paused"
+	ReasonResumed                = "Resumed"
+	ReasonMaintenanceStarted     = "MaintenanceStarted"
+	ReasonMaintenancePending     = "MaintenancePending"
+	ReasonMaintenanceFinished    = "MaintenanceFinished"
+	ReasonNameChanged            = "NameChanged"
+	ReasonOverridesChanged       = "OverridesChanged"
+	ReasonReconciled             = "Reconciled"
+)
+
+// Reconcile steps,used to label failure metrics
+const (
+	StepSpec        = "spec"
+	StepDatabase    = "database"
+	StepApex        = "apex"
+	StepOrds        = "ords"
+	StepPdb         = "pdb"
+	StepParameters  = "parameters"
+	StepPasswords   = "passwords"
+	StepCredentials = "credentials"
 )
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
@@ -81,25 +164,52 @@ func (r *ApexOrdsReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		return ctrl.Result{}, client.IgnoreNotFound(err)
 	}
 
-	if apexords.Spec.Dbname == "" {
-		log.Log.Error(nil, "DB name can't be empty")
-		return ctrl.Result{}, nil
+	//a paused ApexOrds is only observed,maintenance is done on its objects by hand
+	if IsPaused(&apexords) {
+		return r.reconcilePaused(ctx, &apexords)
+	}
+	r.resume(ctx, &apexords)
+
+	if apexords.Spec.DatabaseRef == "" && apexords.Spec.Dbname == "" {
+		return r.handleStepError(ctx, &apexords, TerminalError(StepSpec, ReasonInvalidSpec, fmt.Errorf("DB name can't be empty without databaseref")))
 	}
 	if apexords.Spec.Ordsname == "" {
-		log.Log.Error(nil, "Ords name can't be empty")
-		return ctrl.Result{}, nil
+		return r.handleStepError(ctx, &apexords, TerminalError(StepSpec, ReasonInvalidSpec, fmt.Errorf("Ords name can't be empty")))
 	}
-	// set default db port to 1521
-	if apexords.Spec.Dbport == "" {
-		apexords.Spec.Dbport = "1521"
+	if err := ValidateOrdsPools(OrdsPools(&apexords)); err != nil {
+		return r.handleStepError(ctx, &apexords, TerminalError(StepSpec, ReasonInvalidSpec, err))
+	}
+	if apexords.Spec.DatabaseRef != "" && apexords.Spec.Database != nil {
+		//the DB belongs to the OracleDatabase,only the tls of the ApexOrds is accepted as before
+		dbsettings := *apexords.Spec.Database
+		dbsettings.TLS = nil
+		if !reflect.DeepEqual(dbsettings, operatorv1.DatabaseSpec{}) {
+			return r.handleStepError(ctx, &apexords, TerminalError(StepSpec, ReasonInvalidSpec, fmt.Errorf("database settings can't be set with databaseref,set them on OracleDatabase %s", apexords.Spec.DatabaseRef)))
+		}
+	}
+	if apexords.Spec.DatabaseRef == "" {
+		if err := ValidateDatabase(InlineDatabase(&apexords)); err != nil {
+			return r.handleStepError(ctx, &apexords, TerminalError(StepSpec, ReasonInvalidSpec, err))
+		}
+	}
+	//the objects are named after dbname and ordsname,they can't change afterwards
+	if err := ApexOrdsNames(&apexords); err != nil {
+		return r.handleStepError(ctx, &apexords, err)
+	}
+	//the overrides are applied when the objects are created,they can't change afterwards either
+	if err := checkOverrides(apexords.Status.OverridesHash, apexords.Spec.Overrides); err != nil {
+		return r.handleStepError(ctx, &apexords, err)
+	}
+	//so are the settings the DB image creates an inline DB with
+	if apexords.Spec.DatabaseRef == "" {
+		if err := checkDatabaseCreation(apexords.Status.DatabaseCreation, InlineDatabase(&apexords)); err != nil {
+			return r.handleStepError(ctx, &apexords, err)
+		}
 	}
 
-	//create password for DB
-	r.Dbpassword = Autopasswd(apexords.Spec.Dbname + apexords.Spec.Ordsname)
-
-	// Get the deployments of ords with the name specified in apexords.spec
+	// Get the deployments of ords generated for the ApexOrds
 	var Ordsdeployment appsv1.DeploymentList
-	if err := r.List(ctx, &Ordsdeployment, client.InNamespace(req.Namespace)); err != nil {
+	if err := r.List(ctx, &Ordsdeployment, client.InNamespace(req.Namespace), client.MatchingLabels(InstanceLabels(&apexords))); err != nil {
 		log.Log.Error(err, "unable to list Ords deployments")
 		return ctrl.Result{}, err
 	}
@@ -107,323 +217,622 @@ func (r *ApexOrdsReconciler) Reconcile(ctx context.Context, req ctrl.Request) (c
 		log.Log.Info("Found deployment name is " + Ordsdeployment.Items[i].ObjectMeta.Name)
 	}
 
+	if apexords.Spec.DatabaseRef != "" {
+		//the DB and Apex belong to the OracleDatabase,only Ords is installed for this ApexOrds
+		oradb, dbpassword, err := r.referencedDatabase(ctx, req, &apexords)
+		if err != nil {
+			return r.handleStepError(ctx, &apexords, AsStepError(StepDatabase, err))
+		}
+		apexords.Status.DatabaseRef = apexords.Spec.DatabaseRef
+		if RotationRequested(&apexords, apexords.Status.PasswordsRotation) != "" {
+			//the passwords belong to the Apex of the OracleDatabase
+			r.warnf(&apexords, StepPasswords, ReasonPasswordsFailed, "passwords are rotated on OracleDatabase %s,annotate it with %s", oradb.ObjectMeta.Name, operatorv1.RotatePasswordsAnnotation)
+		}
+		unlock := r.lockDatabase(ctx, &apexords, &oradb.Spec)
+		if unlock == nil {
+			return ctrl.Result{RequeueAfter: DatabaseLockRetryInterval}, nil
+		}
+		defer unlock()
+		return r.installOrds(ctx, req, &apexords, oradb, dbpassword)
+	}
+
+	//create password for DB
+	dbpassword := Autopasswd(apexords.Spec.Dbname + apexords.Spec.Ordsname)
+	oradb, err := ApexOrdsDatabase(ctx, r.Client, &apexords)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	unlock := r.lockDatabase(ctx, &apexords, &oradb.Spec)
+	if unlock == nil {
+		return ctrl.Result{RequeueAfter: DatabaseLockRetryInterval}, nil
+	}
+	defer unlock()
+	//the sys password of database.credentials replaces the generated one
+	sysPassword, err := ResolveSysPassword(ctx, r.Client, req.Namespace, &oradb.Spec)
+	if err != nil {
+		log.Log.Error(err, "unable to read database.credentials")
+		return r.handleStepError(ctx, &apexords, AsStepError(StepCredentials, err))
+	}
+	if sysPassword != nil {
+		dbpassword = sysPassword.Password
+	}
+	dbinstaller := &DatabaseInstaller{
+		Client:     r.Client,
+		Scheme:     r.Scheme,
+		Recorder:   r.Recorder,
+		Runner:     r.Runner,
+		Owner:      &apexords,
+		Database:   &oradb.Spec,
+		Dbpassword: dbpassword,
+		Secretname: CredentialsSecretName(&apexords),
+		Creating:   func() error { return r.recordCreation(ctx, &apexords) },
+	}
+
 	//install DB statefulset
-	if err := CreateDbstsOption(r, req, &apexords); err != nil {
-		log.Log.Error(err, "unable to create Apex on DB")
+	if !meta.IsStatusConditionTrue(apexords.Status.Conditions, operatorv1.ConditionDatabaseProvisioned) {
+		r.setPhase(ctx, &apexords, operatorv1.PhaseProvisioning)
+		start := time.Now()
+		if err := dbinstaller.CreateDbstsOption(req); err != nil {
+			log.Log.Error(err, "unable to create DB statefulset")
+			return r.handleStepError(ctx, &apexords, AsStepError(StepDatabase, err))
+		}
+		DbProvisionDuration.Observe(time.Since(start).Seconds())
+		r.setCondition(ctx, &apexords, operatorv1.ConditionDatabaseProvisioned, metav1.ConditionTrue, ReasonDbStatefulSetCreated, "DB statefulset and service are created")
 	}
 
 	//install apex 19.1 in the db,password would be same as sys
-	if err := CreateApexOption(r, req, &apexords); err != nil {
-		log.Log.Error(err, "unable to create Apex on DB")
+	if !meta.IsStatusConditionTrue(apexords.Status.Conditions, operatorv1.ConditionApexInstalled) {
+		r.setPhase(ctx, &apexords, operatorv1.PhaseInstallingApex)
+		start := time.Now()
+		if err := dbinstaller.CreateApexOption(ctx, req); err != nil {
+			log.Log.Error(err, "unable to create Apex on DB")
+			return r.handleStepError(ctx, &apexords, AsStepError(StepApex, err))
+		}
+		ApexInstallDuration.Observe(time.Since(start).Seconds())
+		apexords.Status.ApexVersion = dbinstaller.ApexVersion
+		r.setCondition(ctx, &apexords, operatorv1.ConditionApexInstalled, metav1.ConditionTrue, ReasonApexInstallFinished, "Apex is installed in "+apexords.Spec.Dbservice)
+	}
+
+	//set the DB parameters,again whenever the spec changes
+	condition, pending, err := dbinstaller.DbParametersStep(ctx, req, apexords.Status.Conditions, apexords.ObjectMeta.Generation)
+	if err != nil {
+		log.Log.Error(err, "unable to set DB parameters")
+		return r.handleStepError(ctx, &apexords, AsStepError(StepParameters, err))
+	}
+	if condition != nil {
+		apexords.Status.PendingRestart = pending
+		r.setCondition(ctx, &apexords, condition.Type, condition.Status, condition.Reason, condition.Message)
+		if condition.Reason == ReasonDbRestarting {
+			return ctrl.Result{RequeueAfter: PodPollInterval}, nil
+		}
+	}
+
+	//rotate the Apex admin and public passwords once per value of the annotation,
+	//a rotation waits for the rollover of the previous one
+	if rotation := RotationRequested(&apexords, apexords.Status.PasswordsRotation); rotation != "" && apexords.Status.PasswordsRollover == "" {
+		if err := dbinstaller.RotatePasswords(ctx, req); err != nil {
+			log.Log.Error(err, "unable to rotate passwords")
+			return r.handleStepError(ctx, &apexords, AsStepError(StepPasswords, err))
+		}
+		now := metav1.Now()
+		apexords.Status.PasswordsRotation = rotation
+		apexords.Status.PasswordsRotatedAt = &now
+		apexords.Status.PasswordsRollover = rotation
+		if err := r.Status().Update(ctx, &apexords); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	//the DB gets the sys password of each new version of the database.credentials secret
+	if sysPassword != nil && sysPassword.Version != apexords.Status.CredentialsVersion {
+		if err := dbinstaller.UpdateSysPassword(ctx, req); err != nil {
+			log.Log.Error(err, "unable to change the sys password")
+			return r.handleStepError(ctx, &apexords, AsStepError(StepCredentials, err))
+		}
+		apexords.Status.CredentialsVersion = sysPassword.Version
+		if err := r.Status().Update(ctx, &apexords); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	result, err := r.installOrds(ctx, req, &apexords, oradb, dbpassword)
+	if err == nil && sysPassword != nil && sysPassword.RefreshAfter > 0 && apexords.Status.Phase == operatorv1.PhaseReady {
+		//a secret store without watch is read again for new versions
+		result.RequeueAfter = sysPassword.RefreshAfter
+	}
+	//the old public password works until the Ords pods use the new one
+	if err == nil && apexords.Status.PasswordsRollover != "" {
+		rollover, err := r.finishPasswordsRollover(ctx, req, &apexords, dbinstaller)
+		if err != nil {
+			log.Log.Error(err, "unable to expire the old passwords")
+			return r.handleStepError(ctx, &apexords, AsStepError(StepPasswords, err))
+		}
+		if rollover && (result.RequeueAfter == 0 || result.RequeueAfter > RolloverPollInterval) {
+			result.RequeueAfter = RolloverPollInterval
+		}
+	}
+	return result, err
+}
+
+//referencedDatabase returns the OracleDatabase of spec.databaseref once Apex is installed in it,
+//and the sys password of the DB from its credentials secret
+func (r *ApexOrdsReconciler) referencedDatabase(ctx context.Context, req ctrl.Request, apexords *operatorv1.ApexOrds) (*operatorv1.OracleDatabase, string, error) {
+	if !meta.IsStatusConditionTrue(apexords.Status.Conditions, operatorv1.ConditionApexInstalled) {
+		r.setPhase(ctx, apexords, operatorv1.PhaseProvisioning)
+	}
+	oradb, err := ApexOrdsDatabase(ctx, r.Client, apexords)
+	if err != nil {
+		return nil, "", RetryableError(StepDatabase, ReasonDatabaseNotReady, fmt.Errorf("unable to get OracleDatabase %s: %v", apexords.Spec.DatabaseRef, err))
+	}
+	if !meta.IsStatusConditionTrue(oradb.Status.Conditions, operatorv1.ConditionApexInstalled) ||
+		!meta.IsStatusConditionTrue(oradb.Status.Conditions, operatorv1.ConditionOrdsInstalled) {
+		log.Log.Info("waiting for OracleDatabase " + oradb.ObjectMeta.Name + " to install Apex and Ords.......")
+		return nil, "", RetryableError(StepDatabase, ReasonDatabaseNotReady, fmt.Errorf("OracleDatabase %s is %s", oradb.ObjectMeta.Name, oradb.Status.Phase))
 	}
 
+	dbcredentials, err := ReadCredentials(ctx, r.Client, apexords.ObjectMeta.Namespace, DbCredentialsSecretName(oradb), "")
+	if err != nil {
+		return nil, "", RetryableError(StepDatabase, ReasonDatabaseNotReady, fmt.Errorf("unable to get secret %s: %v", DbCredentialsSecretName(oradb), err))
+	}
+	if dbcredentials.Public == "" {
+		//updatepass.sql set the sys password for the public users
+		dbcredentials.Public = dbcredentials.Sys
+	}
+
+	//the sqlpluspods of this ApexOrds,ie for Ords OAuth clients,read the passwords from its own secret,
+	//Ords the public password which a rotation of the OracleDatabase changes
+	if err := CreateCredentialsSecret(r, apexords, dbcredentials); err != nil {
+		return nil, "", err
+	}
+	if !meta.IsStatusConditionTrue(apexords.Status.Conditions, operatorv1.ConditionApexInstalled) {
+		message := "OracleDatabase " + oradb.ObjectMeta.Name + " is ready"
+		meta.SetStatusCondition(&apexords.Status.Conditions, metav1.Condition{
+			Type:               operatorv1.ConditionDatabaseProvisioned,
+			Status:             metav1.ConditionTrue,
+			Reason:             ReasonDatabaseReady,
+			Message:            message,
+			ObservedGeneration: apexords.ObjectMeta.Generation,
+		})
+		r.setCondition(ctx, apexords, operatorv1.ConditionApexInstalled, metav1.ConditionTrue, ReasonDatabaseReady, message)
+	}
+	return oradb, dbcredentials.Sys, nil
+}
+
+//installOrds installs Ords in the DB and creates its deployment and services,then marks the ApexOrds ready
+func (r *ApexOrdsReconciler) installOrds(ctx context.Context, req ctrl.Request, apexords *operatorv1.ApexOrds, oradb *operatorv1.OracleDatabase, Dbpassword string) (ctrl.Result, error) {
 	//install ords and http and load balancer
-	if err := CreateOrdsOption(r, req, &apexords); err != nil {
-		log.Log.Error(err, "unable to create Http,Ords")
+	if apexords.Spec.DatabaseRef != "" {
+		apexords.Status.ApexVersion = oradb.Status.ApexVersion
+		apexords.Status.OrdsVersion = oradb.Status.OrdsVersion
+		apexords.Status.PasswordsRotatedAt = oradb.Status.PasswordsRotatedAt
+	}
+	if !meta.IsStatusConditionTrue(apexords.Status.Conditions, operatorv1.ConditionOrdsInstalled) {
+		r.setPhase(ctx, apexords, operatorv1.PhaseInstallingOrds)
+		start := time.Now()
+		if err := CreateOrdsOption(ctx, r, req, apexords, &oradb.Spec, Dbpassword); err != nil {
+			log.Log.Error(err, "unable to create Http,Ords")
+			return r.handleStepError(ctx, apexords, AsStepError(StepOrds, err))
+		}
+		OrdsInstallDuration.Observe(time.Since(start).Seconds())
+		r.setCondition(ctx, apexords, operatorv1.ConditionOrdsInstalled, metav1.ConditionTrue, ReasonOrdsInstallFinished, "Ords deployment and services are created")
+	}
+
+	//pick up rotated passwords,the old public password works until the rollout is done
+	if err := r.syncOrdsCredentials(ctx, apexords, &oradb.Spec, Dbpassword); err != nil {
+		log.Log.Error(err, "unable to update the Ords passwords")
+		return r.handleStepError(ctx, apexords, AsStepError(StepOrds, err))
+	}
+
+	//serve the maintenance page instead of Ords while spec.maintenance is set
+	waiting, err := r.syncMaintenance(ctx, apexords, &oradb.Spec)
+	if err != nil {
+		log.Log.Error(err, "unable to switch maintenance")
+		return r.handleStepError(ctx, apexords, AsStepError(StepOrds, err))
+	}
+	if err := r.observeOrds(ctx, apexords); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	meta.SetStatusCondition(&apexords.Status.Conditions, metav1.Condition{
+		Type:               operatorv1.ConditionFailed,
+		Status:             metav1.ConditionFalse,
+		Reason:             ReasonReconciled,
+		Message:            "All steps finished",
+		ObservedGeneration: apexords.ObjectMeta.Generation,
+	})
+	apexords.Status.Phase = operatorv1.PhaseReady
+	apexords.Status.Objects = ApexOrdsObjects(apexords)
+	apexords.Status.OverridesHash = OverridesHash(apexords.Spec.Overrides)
+	if apexords.Spec.DatabaseRef == "" {
+		apexords.Status.DatabaseCreation = DatabaseCreationOf(InlineDatabase(apexords))
+	}
+	if err := r.Status().Update(ctx, apexords); err != nil {
+		return ctrl.Result{}, err
+	}
+	if waiting {
+		return ctrl.Result{RequeueAfter: MaintenancePollInterval}, nil
 	}
+	return ctrl.Result{}, nil
+}
 
+//handleStepError reports a failed step in events,metrics and the Failed condition.
+//Retryable errors are returned so the request is requeued with backoff,terminal errors are not.
+func (r *ApexOrdsReconciler) handleStepError(ctx context.Context, apexords *operatorv1.ApexOrds, stepErr *StepError) (ctrl.Result, error) {
+	log.Log.Error(stepErr, "reconcile step failed", "step", stepErr.Step, "reason", stepErr.Reason, "retryable", stepErr.Retryable)
+	r.warnf(apexords, stepErr.Step, stepErr.Reason, "%v", stepErr.Err)
+
+	meta.SetStatusCondition(&apexords.Status.Conditions, metav1.Condition{
+		Type:               operatorv1.ConditionFailed,
+		Status:             metav1.ConditionTrue,
+		Reason:             stepErr.Reason,
+		Message:            stepErr.Error(),
+		ObservedGeneration: apexords.ObjectMeta.Generation,
+	})
+	if !stepErr.Retryable {
+		apexords.Status.Phase = operatorv1.PhaseFailed
+	}
+	if err := r.Status().Update(ctx, apexords); err != nil {
+		log.Log.Error(err, "unable to update ApexOrds status")
+	}
+
+	if stepErr.Retryable {
+		return ctrl.Result{}, stepErr
+	}
 	return ctrl.Result{}, nil
 }
 
+//warnf records a warning event on the ApexOrds and counts the failure of the step
+func (r *ApexOrdsReconciler) warnf(apexords *operatorv1.ApexOrds, step string, reason string, messageFmt string, args ...interface{}) {
+	StepFailures.WithLabelValues(step, reason).Inc()
+	r.Recorder.Eventf(apexords, corev1.EventTypeWarning, reason, messageFmt, args...)
+}
+
+//setPhase saves the phase in ApexOrds status
+func (r *ApexOrdsReconciler) setPhase(ctx context.Context, apexords *operatorv1.ApexOrds, phase string) {
+	if apexords.Status.Phase == phase {
+		return
+	}
+	apexords.Status.Phase = phase
+	if err := r.Status().Update(ctx, apexords); err != nil {
+		log.Log.Error(err, "unable to update ApexOrds status phase to "+phase)
+	}
+}
+
+//setCondition saves a step condition in ApexOrds status
+func (r *ApexOrdsReconciler) setCondition(ctx context.Context, apexords *operatorv1.ApexOrds, conditionType string, status metav1.ConditionStatus, reason string, message string) {
+	meta.SetStatusCondition(&apexords.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: apexords.ObjectMeta.Generation,
+	})
+	if err := r.Status().Update(ctx, apexords); err != nil {
+		log.Log.Error(err, "unable to update ApexOrds condition "+conditionType)
+	}
+}
+
+//recordCreation saves the overrides,and the settings of an inline DB,in status before the first object is created
+//with them,checkOverrides and checkDatabaseCreation compare the spec with them from then on
+func (r *ApexOrdsReconciler) recordCreation(ctx context.Context, apexords *operatorv1.ApexOrds) error {
+	changed := false
+	if apexords.Status.OverridesHash == "" {
+		apexords.Status.OverridesHash = OverridesHash(apexords.Spec.Overrides)
+		changed = true
+	}
+	if apexords.Spec.DatabaseRef == "" && apexords.Status.DatabaseCreation == nil {
+		apexords.Status.DatabaseCreation = DatabaseCreationOf(InlineDatabase(apexords))
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return r.Status().Update(ctx, apexords)
+}
+
+//lockDatabase takes the lock of the DB,while another resource runs scripts in the DB it marks the ApexOrds
+//waiting and returns nil
+func (r *ApexOrdsReconciler) lockDatabase(ctx context.Context, apexords *operatorv1.ApexOrds, db *operatorv1.OracleDatabaseSpec) func() {
+	unlock, changed := lockDatabase(r.Recorder, apexords, "ApexOrds", &apexords.Status.Conditions, db)
+	if changed {
+		if err := r.Status().Update(ctx, apexords); err != nil {
+			log.Log.Error(err, "unable to update ApexOrds status")
+		}
+	}
+	return unlock
+}
+
+//createIfNotExists creates obj,an object left by an earlier reconcile is not an error.
+//It returns true when obj was created.
+func createIfNotExists(ctx context.Context, c client.Client, obj client.Object) (bool, error) {
+	if err := c.Create(ctx, obj); err != nil {
+		if apierrors.IsAlreadyExists(err) {
+			log.Log.Info(obj.GetName() + " exists. Do nothing")
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
 //CreateOrdsOption to create http and ords deployments plus load balancer
-func CreateOrdsOption(r *ApexOrdsReconciler, req ctrl.Request, apexords *operatorv1.ApexOrds) error {
-	ctx := context.Background()
+//db is the DB Ords is installed in,the referenced OracleDatabase or the inline DB settings
+//Dbpassword the sys password of that DB
+func CreateOrdsOption(ctx context.Context, r *ApexOrdsReconciler, req ctrl.Request, apexords *operatorv1.ApexOrds, db *operatorv1.OracleDatabaseSpec, Dbpassword string) error {
 	_ = log.FromContext(ctx)
-	apexordsordsdeployname := apexords.Spec.Ordsname + "-apexords-ords-deployment"
+	apexordsordsdeployname := OrdsDeploymentName(apexords)
 	log.Log.Info("Creating Ords deployment :" + apexordsordsdeployname)
 	// complete http and ords deployment  settings
 
-	//update sys apex passwords, dbhost, db service in yaml
-	config.Ordsconfigmapyml = strings.ReplaceAll(config.Ordsconfigmapyml, "replacepwdapexordsauto", r.Dbpassword)
-	config.Ordsconfigmapyml = strings.ReplaceAll(config.Ordsconfigmapyml, "ordsautodbhost", apexords.Spec.Dbname+"-apexords-db-svc")
-	config.Ordsconfigmapyml = strings.ReplaceAll(config.Ordsconfigmapyml, "ordsautodbport", apexords.Spec.Dbport)
-	config.Ordsconfigmapyml = strings.ReplaceAll(config.Ordsconfigmapyml, "ordsautodbservice", apexords.Spec.Dbservice)
-	config.Ordsconfigmapyml = strings.ReplaceAll(config.Ordsconfigmapyml, "replacepwdsysordsauto", r.Dbpassword)
+	//the public users connect with the password of the credentials secret,which a rotation changes
+	credentials, err := ReadCredentials(ctx, r.Client, req.NamespacedName.Namespace, CredentialsSecretName(apexords), Dbpassword)
+	if err != nil {
+		return RetryableError(StepOrds, ReasonSecretNotFound, fmt.Errorf("unable to get secret %s: %v", CredentialsSecretName(apexords), err))
+	}
 
 	//complete ords settings
 	decode := scheme.Codecs.UniversalDeserializer().Decode
 	obj, _, err := decode([]byte(config.Ordsyml), nil, nil)
 	if err != nil {
-		log.Log.Error(err, "can't deserialize Ords deployment yaml")
+		return TerminalError(StepOrds, ReasonTemplateInvalid, fmt.Errorf("can't deserialize Ords deployment yaml: %v", err))
+	}
+	ordsdeployment, ok := obj.(*appsv1.Deployment)
+	if !ok {
+		return TerminalError(StepOrds, ReasonTemplateInvalid, fmt.Errorf("Ords deployment yaml is a %T", obj))
 	}
 	//Update selector and owner reference
-	var ordsselector = map[string]string{
-		"ordsauto": apexords.Spec.Ordsname + "-DeploymentSelector",
-	}
-	var apexordsownerref = []metav1.OwnerReference{{
-		Kind:       apexords.TypeMeta.Kind,
-		APIVersion: apexords.TypeMeta.APIVersion,
-		Name:       apexords.ObjectMeta.Name,
-		UID:        apexords.ObjectMeta.UID,
-	}}
-	ordsdeployment := obj.(*appsv1.Deployment)
+	var ordsselector = OrdsSelector(apexords)
 	ordsdeployment.ObjectMeta.Name = apexordsordsdeployname
 	ordsdeployment.ObjectMeta.Namespace = req.NamespacedName.Namespace
-	ordsdeployment.ObjectMeta.OwnerReferences = apexordsownerref // add owner reference, so easy to clean up
 	ordsdeployment.Spec.Selector.MatchLabels = ordsselector
-	ordsdeployment.Spec.Template.ObjectMeta.Labels = ordsselector
+	ordsdeployment.Spec.Template.ObjectMeta.Labels = mergeLabels(ordsselector, ComponentLabels(apexords, ComponentOrds))
 	ordsdeployment.Spec.Template.Spec.Volumes[0].VolumeSource.ConfigMap.LocalObjectReference = corev1.LocalObjectReference{Name: apexords.Spec.Ordsname + "-apexords-http-cm"}
-	ordsdeployment.Spec.Template.Spec.Volumes[1].VolumeSource.ConfigMap.LocalObjectReference = corev1.LocalObjectReference{Name: apexords.Spec.Ordsname + "-apexords-ords-cm"}
+	ordsdeployment.Spec.Template.Spec.Volumes[1].VolumeSource = OrdsConfigVolumeSource(apexords)
+	ordsdeployment.Spec.Template.ObjectMeta.Annotations = map[string]string{OrdsPasswordHashAnnotation: passwordHash(apexords, credentials.Public)}
+	MountWallet(db, &ordsdeployment.Spec.Template.Spec, "ords")
+	Images.ResolveImages(&ordsdeployment.Spec.Template.Spec)
+	AddImagePullSecrets(&ordsdeployment.Spec.Template.Spec, db.ImagePullSecrets)
 
 	//Update LB service name
 	obj, _, err = decode([]byte(config.OrdsLBsvcyml), nil, nil)
 	if err != nil {
-		log.Log.Error(err, "can't deserialize Ords Load balancer service yaml")
+		return TerminalError(StepOrds, ReasonTemplateInvalid, fmt.Errorf("can't deserialize Ords Load balancer service yaml: %v", err))
+	}
+	ordssvc, ok := obj.(*corev1.Service)
+	if !ok {
+		return TerminalError(StepOrds, ReasonTemplateInvalid, fmt.Errorf("Ords Load balancer service yaml is a %T", obj))
 	}
-	ordssvc := obj.(*corev1.Service)
 	ordssvc.ObjectMeta.Name = apexords.Spec.Ordsname + "-apexords-svc"
 	ordssvc.ObjectMeta.Namespace = req.NamespacedName.Namespace
-	ordssvc.ObjectMeta.OwnerReferences = apexordsownerref // add owner reference, so easy to clean up created related objects
 	ordssvc.Spec.Selector = ordsselector
 
 	//Update nodeport service name
 	obj, _, err = decode([]byte(config.OrdsNodePortsvcyml), nil, nil)
 	if err != nil {
-		log.Log.Error(err, "can't deserialize Ords Load balancer service yaml")
+		return TerminalError(StepOrds, ReasonTemplateInvalid, fmt.Errorf("can't deserialize Ords nodeport service yaml: %v", err))
+	}
+	ordsnodeportsvc, ok := obj.(*corev1.Service)
+	if !ok {
+		return TerminalError(StepOrds, ReasonTemplateInvalid, fmt.Errorf("Ords nodeport service yaml is a %T", obj))
 	}
-	ordsnodeportsvc := obj.(*corev1.Service)
 	ordsnodeportsvc.ObjectMeta.Name = apexords.Spec.Ordsname + "-apexords-nodeport-svc"
 	ordsnodeportsvc.ObjectMeta.Namespace = req.NamespacedName.Namespace
-	ordsnodeportsvc.ObjectMeta.OwnerReferences = apexordsownerref // add owner reference, so easy to clean up created related objects
 	ordsnodeportsvc.Spec.Selector = ordsselector
 
 	//complete ords and http configmap settings
-	obj, _, err = decode([]byte(config.Ordsconfigmapyml), nil, nil)
+	ordsconfigmap, ordsfiles, err := OrdsConfigMap(apexords, db, credentials.Public, Dbpassword)
 	if err != nil {
-		log.Log.Error(err, "can't deserialize Ords configmap yaml")
+		return err
 	}
-	ordsconfigmap := obj.(*corev1.ConfigMap)
-	ordsconfigmap.ObjectMeta.Name = apexords.Spec.Ordsname + "-apexords-ords-cm"
-	ordsconfigmap.ObjectMeta.Namespace = req.NamespacedName.Namespace
-	ordsconfigmap.ObjectMeta.OwnerReferences = apexordsownerref // add owner reference, so easy to clean up
 
 	obj, _, err = decode([]byte(config.Httpconfigmapyml), nil, nil)
 	if err != nil {
-		log.Log.Error(err, "can't deserialize Ords configmap yaml")
+		return TerminalError(StepOrds, ReasonTemplateInvalid, fmt.Errorf("can't deserialize http configmap yaml: %v", err))
+	}
+	httpconfigmap, ok := obj.(*corev1.ConfigMap)
+	if !ok {
+		return TerminalError(StepOrds, ReasonTemplateInvalid, fmt.Errorf("http configmap yaml is a %T", obj))
 	}
-	httpconfigmap := obj.(*corev1.ConfigMap)
 	httpconfigmap.ObjectMeta.Name = apexords.Spec.Ordsname + "-apexords-http-cm"
 	httpconfigmap.ObjectMeta.Namespace = req.NamespacedName.Namespace
-	httpconfigmap.ObjectMeta.OwnerReferences = apexordsownerref // add owner reference, so easy to clean up
+
+	// add owner reference, so easy to clean up created related objects
+	for _, obj := range []client.Object{ordsdeployment, ordssvc, ordsnodeportsvc, ordsconfigmap, httpconfigmap} {
+		if err := setControllerReference(apexords, obj, r.Scheme, StepOrds); err != nil {
+			return err
+		}
+	}
+	//apply spec.overrides to the generated objects,OrdsConfigMap applied them to the Ords configmap
+	for _, obj := range []client.Object{ordsdeployment, ordssvc, ordsnodeportsvc, httpconfigmap} {
+		SetLabels(obj, apexords, ComponentOrds)
+		if err := ApplyOverrides(apexords.Spec.Overrides, obj); err != nil {
+			return TerminalError(StepOrds, ReasonOverrideInvalid, err)
+		}
+	}
+
+	//the overrides can't change once the first object is created with them
+	if err := r.recordCreation(ctx, apexords); err != nil {
+		return RetryableError(StepOrds, ReasonCreateFailed, fmt.Errorf("unable to record the overrides of the Ords objects: %v", err))
+	}
 
 	//create configmap
 	log.Log.Info("Creating configmap " + apexords.Spec.Ordsname + "-apexords-ords-cm")
-	if err := r.Create(ctx, ordsconfigmap); err != nil {
-		log.Log.Error(err, "unable to create Ords confimap")
-
+	if created, err := createIfNotExists(ctx, r.Client, ordsconfigmap); err != nil {
+		return RetryableError(StepOrds, ReasonCreateFailed, fmt.Errorf("unable to create configmap %s: %v", ordsconfigmap.ObjectMeta.Name, err))
+	} else if created {
+		r.Recorder.Event(apexords, corev1.EventTypeNormal, ReasonConfigMapCreated, "Created configmap "+ordsconfigmap.ObjectMeta.Name)
 	}
 
 	log.Log.Info("Creating configmap " + apexords.Spec.Ordsname + "-apexords-http-cm")
-	if err := r.Create(ctx, httpconfigmap); err != nil {
-		log.Log.Error(err, "unable to create http confimap")
-
+	if created, err := createIfNotExists(ctx, r.Client, httpconfigmap); err != nil {
+		return RetryableError(StepOrds, ReasonCreateFailed, fmt.Errorf("unable to create configmap %s: %v", httpconfigmap.ObjectMeta.Name, err))
+	} else if created {
+		r.Recorder.Event(apexords, corev1.EventTypeNormal, ReasonConfigMapCreated, "Created configmap "+httpconfigmap.ObjectMeta.Name)
 	}
 
-	//create Ords schemas in DB
-	//create ords pod
-	if err := CreateOrdsPod(r, req, apexords); err != nil {
-		log.Log.Error(err, "unable to create Ords pod")
-
+	//the files carrying passwords are projected next to the configmap from a secret
+	log.Log.Info("Creating secret " + OrdsSecretName(apexords))
+	if _, err := CreateOrdsSecret(r, req, apexords, db, ordsfiles, Dbpassword); err != nil {
+		log.Log.Error(err, "unable to create Ords secret")
+		return err
 	}
-	//run Ords installation sql in ords pod
-	log.Log.Info("Create Ords in Target DB....")
 
-	ordstext := "mv /opt/oracle/ords/config/ords/defaults.xml /tmp;cp /mnt/k8s/ords_params.properties /tmp/ords_params.properties;java -jar /opt/oracle/ords/ords.war install --parameterFile /tmp/ords_params.properties simple"
-	OrdsCommand := []string{"/bin/sh", "-c", ordstext}
-	Podname := "ordspod"
-	if err := ExecPodCmd(r, req, Podname, OrdsCommand); err != nil {
-		log.Log.Error(err, "Error to run "+strings.Join(OrdsCommand, " ")+" in ordspod")
+	//the Ords schemas of the dbservice of an OracleDatabase are installed by it once for all its ApexOrds,
+	//these only set up their extra pools
+	installSchemas := apexords.Spec.DatabaseRef == ""
+	if installSchemas || len(OrdsPools(apexords)) > 0 {
+		if err := r.runOrdsInstall(ctx, req, apexords, db, installSchemas); err != nil {
+			return err
+		}
 	}
-	//clean ords pod
-	if err := DeleteOrdsPod(r, req); err != nil {
-		log.Log.Error(err, "unable to delete Ords pod")
 
-	}
 	//create ords deployments
 	log.Log.Info("Creating ords deployment " + apexordsordsdeployname)
-	if err := r.Create(ctx, ordsdeployment); err != nil {
-		log.Log.Error(err, "unable to create Ords deployment")
-
+	if created, err := createIfNotExists(ctx, r.Client, ordsdeployment); err != nil {
+		return RetryableError(StepOrds, ReasonCreateFailed, fmt.Errorf("unable to create Ords deployment %s: %v", apexordsordsdeployname, err))
+	} else if created {
+		r.Recorder.Event(apexords, corev1.EventTypeNormal, ReasonOrdsDeploymentCreated, "Created Ords deployment "+apexordsordsdeployname)
 	}
 	//create nodeport service
 	log.Log.Info("Creating ords nodeport service " + apexords.Spec.Ordsname + "-apexords-nodeport-svc")
-	if err := r.Create(ctx, ordsnodeportsvc); err != nil {
-		log.Log.Error(err, "unable to create Ords ords nodeport service ")
-
+	if created, err := createIfNotExists(ctx, r.Client, ordsnodeportsvc); err != nil {
+		return RetryableError(StepOrds, ReasonCreateFailed, fmt.Errorf("unable to create service %s: %v", ordsnodeportsvc.ObjectMeta.Name, err))
+	} else if created {
+		r.Recorder.Event(apexords, corev1.EventTypeNormal, ReasonServiceCreated, "Created service "+ordsnodeportsvc.ObjectMeta.Name)
 	}
 
 	//create Load balancer service
 	log.Log.Info("Creating ords load balancer service " + apexords.Spec.Ordsname + "-apexords-svc")
-	if err := r.Create(ctx, ordssvc); err != nil {
-		log.Log.Error(err, "unable to create Ords ords load balancer service ")
-
+	if created, err := createIfNotExists(ctx, r.Client, ordssvc); err != nil {
+		return RetryableError(StepOrds, ReasonCreateFailed, fmt.Errorf("unable to create service %s: %v", ordssvc.ObjectMeta.Name, err))
+	} else if created {
+		r.Recorder.Event(apexords, corev1.EventTypeNormal, ReasonServiceCreated, "Created service "+ordssvc.ObjectMeta.Name)
 	}
-	log.Log.Info("DB sys Apex Ords schemas password is: " + r.Dbpassword + " users need to update it later.")
-	log.Log.Info("Apex Internal Workspace admin password: " + r.Dbpassword + "Apx1#" + " (Use apxchpwd.sql to change it)")
+	log.Log.Info("DB sys Apex Ords schemas and Apex Internal Workspace admin passwords are in secret " + CredentialsSecretName(apexords) + " users need to update them later.")
 	return nil
 }
 
-//CreateDbstsOption to create db statefulset
-func CreateDbstsOption(r *ApexOrdsReconciler, req ctrl.Request, apexords *operatorv1.ApexOrds) error {
-	ctx := context.Background()
-	_ = log.FromContext(ctx)
-
-	//check if DB stateful exists, if not create one
-	var DBstatefulset appsv1.StatefulSetList
-	if err := r.List(ctx, &DBstatefulset, client.InNamespace(req.Namespace), client.MatchingLabels(Apexordsoperatorlabel)); err != nil {
-		log.Log.Error(err, "unable to list Apexords operator DB statefulset")
+//runOrdsInstall installs the Ords schemas in dbservice when installSchemas is set and in the PDB of each extra pool,
+//all in the ords pod of the ApexOrds
+func (r *ApexOrdsReconciler) runOrdsInstall(ctx context.Context, req ctrl.Request, apexords *operatorv1.ApexOrds, db *operatorv1.OracleDatabaseSpec, installSchemas bool) error {
+	//create ords pod
+	if err := CreateOrdsPod(r, req, apexords, db); err != nil {
+		log.Log.Error(err, "unable to create Ords pod")
 		return err
 	}
-	if len(DBstatefulset.Items) == 0 {
-		log.Log.Info("unable to find Apexords operator DB statefulset Pod,going to create new one..")
-		//create a new db statefulset here
-		if err := CreateDbOption(r, req, apexords); err != nil {
-			log.Log.Error(err, "unable to create Apexords operator DB statefulset.")
-			return err
+	//clean ords pod
+	defer func() {
+		if err := DeleteOrdsPod(r, req, apexords); err != nil {
+			log.Log.Error(err, "unable to delete Ords pod")
+			r.warnf(apexords, StepOrds, ReasonPodFailed, "unable to delete ordspod: %v", err)
 		}
-	} else {
-		for i := 0; i < len(DBstatefulset.Items); i++ {
-			log.Log.Info("Found running Apexords operator DB statefulset name is " + DBstatefulset.Items[i].ObjectMeta.Name)
-			if DBstatefulset.Items[i].ObjectMeta.Name == apexords.Spec.Dbname+"-apexords-db-sts" {
-				log.Log.Info(apexords.Spec.Dbname + "-apexords-db-sts" + "exists. Do nothing")
-
-			} else {
-				log.Log.Info("unable to find " + apexords.Spec.Dbname + "-apexords-db-sts." + "going to create new one..")
-				//create a new db statefulset here
-				if err := CreateDbOption(r, req, apexords); err != nil {
-					log.Log.Error(err, "unable to create Apexords operator DB statefulsets.")
-					return err
-				}
-			}
+	}()
+	Podname := OrdsPodName(apexords)
+	if installSchemas {
+		//run Ords installation sql in ords pod
+		log.Log.Info("Create Ords in Target DB....")
+		r.Recorder.Event(apexords, corev1.EventTypeNormal, ReasonOrdsInstallStarted, "Installing Ords schemas in "+db.Dbservice)
+		output, err := ExecPodCmdOutput(ctx, r.Runner, req, Podname, StepOrds, OrdsInstallCommand())
+		SaveInstallLog(context.Background(), r.Client, r.Scheme, apexords, CredentialsSecretName(apexords), "ords-install", output)
+		if err != nil {
+			log.Log.Error(err, "Error to run ords.war install in ordspod")
+			return ExecError(StepOrds, ReasonOrdsInstallFailed, fmt.Errorf("ords.war install failed in ordspod: %w", err))
 		}
-	}
-
-	//check if DB service exists, if not create one
-	var DBsvclist corev1.ServiceList
-	if err := r.List(ctx, &DBsvclist, client.InNamespace(req.Namespace), client.MatchingLabels(Apexordsoperatorlabel)); err != nil {
-		log.Log.Error(err, "unable to list Apexords operator DB service")
-		return err
-	}
-	if len(DBsvclist.Items) == 0 {
-		log.Log.Info("unable to find Apexords operator DB service,going to create new one..")
-		//create a new db service here
-		if err := CreateDbSvcOption(r, req, apexords); err != nil {
-			log.Log.Error(err, "unable to create Apexords operator k8s service for DB")
-			return err
-		}
-	} else {
-		for i, DBsvc := range DBsvclist.Items {
-			fmt.Printf("\n%v\n", i)
-			log.Log.Info("Found running Apexords operator DB service name is " + DBsvc.ObjectMeta.Name)
-			if DBsvc.ObjectMeta.Name == apexords.Spec.Dbname+"-apexords-db-svc" {
-				log.Log.Info(apexords.Spec.Dbname + "-apexords-db-svc" + " exists. Do nothing")
-
-			} else {
-				log.Log.Info("unable to find " + apexords.Spec.Dbname + "-apexords-db-svc." + "going to create new one..")
-				//create a new db service here
-				if err := CreateDbSvcOption(r, req, apexords); err != nil {
-					log.Log.Error(err, "unable to create Apexords operator DB service")
-					return err
-				}
-			}
+		apexords.Status.OrdsVersion = ParseVersion(output)
+		r.Recorder.Event(apexords, corev1.EventTypeNormal, ReasonOrdsInstallFinished, "Installed Ords schemas in "+db.Dbservice)
+	}
+
+	//install Ords schemas in the PDB of each extra pool
+	for _, pool := range OrdsPools(apexords) {
+		log.Log.Info("Create Ords in PDB " + pool.Dbservice + " of pool " + pool.Name + "....")
+		output, err := ExecPodCmdOutput(ctx, r.Runner, req, Podname, StepOrds, OrdsPoolInstallCommand(pool))
+		SaveInstallLog(context.Background(), r.Client, r.Scheme, apexords, CredentialsSecretName(apexords), "ords-setup-"+pool.Name, output)
+		if err != nil {
+			log.Log.Error(err, "Error to set up Ords pool "+pool.Name+" in ordspod")
+			return ExecError(StepOrds, ReasonOrdsInstallFailed, fmt.Errorf("ords.war setup of pool %s failed in ordspod: %w", pool.Name, err))
 		}
+		r.Recorder.Event(apexords, corev1.EventTypeNormal, ReasonOrdsInstallFinished, "Installed Ords schemas in "+pool.Dbservice+" for pool "+pool.Name)
 	}
 	return nil
 }
 
-//CreateApexOption is to create Apex schema in DB
-func CreateApexOption(r *ApexOrdsReconciler, req ctrl.Request, apexords *operatorv1.ApexOrds) error {
-	ctx := context.Background()
-	_ = log.FromContext(ctx)
+//OrdsInstallCommand installs or upgrades the Ords schemas with /mnt/k8s/ords_params.properties and prints the Ords version
+func OrdsInstallCommand() []string {
+	ordstext := "mv /opt/oracle/ords/config/ords/defaults.xml /tmp;cp /mnt/k8s/ords_params.properties /tmp/ords_params.properties;java -jar /opt/oracle/ords/ords.war install --parameterFile /tmp/ords_params.properties simple && " + OrdsVersionCommand
+	return []string{"/bin/sh", "-c", ordstext}
+}
 
-	//verify if DB pod is up and running
-	dbpodstatus := &corev1.Pod{}
-	verifyPodState := func() bool {
-		if err := r.Get(ctx, client.ObjectKey{
-			Namespace: req.NamespacedName.Namespace,
-			Name:      apexords.Spec.Dbname + "-apexords-db-sts-0",
-		}, dbpodstatus); err != nil {
-			return false
-		}
-		if dbpodstatus.Status.Phase == corev1.PodRunning {
-			return true
-		}
-		return false
+//OrdsConfigMap returns the Ords configmap of the ApexOrds with its overrides and the files of the default pool
+//carrying passwords,they are kept in the Ords secret. publicPassword is the one of the Apex and Ords public users,
+//Dbpassword the sys password ords.war install uses
+func OrdsConfigMap(apexords *operatorv1.ApexOrds, db *operatorv1.OracleDatabaseSpec, publicPassword string, Dbpassword string) (*corev1.ConfigMap, map[string][]byte, error) {
+	ordsconfigmap, err := OrdsTemplateConfigMap(db, publicPassword, Dbpassword)
+	if err != nil {
+		return nil, nil, err
 	}
-	//30 min timeout for starting pod
-	if !verifyPodState() {
-		log.Log.Info("waiting for db pod to start.......sleep for 30 min")
-		time.Sleep(30 * time.Minute)
-
-	} else {
-		log.Log.Info("db pod is started.......")
-
+	ordsconfigmap.ObjectMeta.Name = apexords.Spec.Ordsname + "-apexords-ords-cm"
+	ordsconfigmap.ObjectMeta.Namespace = apexords.ObjectMeta.Namespace
+	SetLabels(ordsconfigmap, apexords, ComponentOrds)
+	if pools := OrdsPools(apexords); len(pools) > 0 {
+		ordsconfigmap.Data["url-mapping.xml"] = OrdsURLMapping(pools)
 	}
-
-	if !verifyPodState() {
-		log.Log.Error(nil, "30 Min timeout to start db pod")
-		return nil
+	if err := ApplyOverrides(apexords.Spec.Overrides, ordsconfigmap); err != nil {
+		return nil, nil, TerminalError(StepOrds, ReasonOverrideInvalid, err)
 	}
-	//create sqlpluspod
-	if err := CreateSqlplusPod(r, req); err != nil {
-		log.Log.Error(err, "unable to create Sqlpluspod")
+	return ordsconfigmap, splitOrdsSecretFiles(ordsconfigmap), nil
+}
 
-	}
-	// if apexords.Spec.Apexruntimeonly is true,run apex runtimeonly installation sql in sqlplispod
-	if apexords.Spec.Apexruntimeonly {
-		log.Log.Info("Create Apex runtime only in Target DB....")
-		sqltext := "sqlplus " + "sys/" + r.Dbpassword + "@" + apexords.Spec.Dbname + "-apexords-db-svc" + ":" + apexords.Spec.Dbport + "/" + apexords.Spec.Dbservice + " as sysdba " + "@createapexruntimeonly.sql"
-		SQLCommand := []string{"/bin/sh", "-c", sqltext}
-		Podname := "sqlpluspod"
-		if err := ExecPodCmd(r, req, Podname, SQLCommand); err != nil {
-			log.Log.Error(err, "Error to run "+strings.Join(SQLCommand, " ")+" in Sqlpluspod")
-		}
-	} else {
-		log.Log.Info("Create Apex in Target DB....")
-		sqltext := "sqlplus " + "sys/" + r.Dbpassword + "@" + apexords.Spec.Dbname + "-apexords-db-svc" + ":" + apexords.Spec.Dbport + "/" + apexords.Spec.Dbservice + " as sysdba " + "@createapex.sql"
-		SQLCommand := []string{"/bin/sh", "-c", sqltext}
-		Podname := "sqlpluspod"
-		if err := ExecPodCmd(r, req, Podname, SQLCommand); err != nil {
-			log.Log.Error(err, "Error to run "+strings.Join(SQLCommand, " ")+" in Sqlpluspod")
-		}
-	}
+//OrdsTemplateConfigMap returns the Ords configmap yaml filled in with the connection to the dbservice of db and the passwords
+func OrdsTemplateConfigMap(db *operatorv1.OracleDatabaseSpec, publicPassword string, Dbpassword string) (*corev1.ConfigMap, error) {
+	//update sys apex passwords, dbhost, db service in yaml
+	//work on a copy,the base manifest is shared by all ApexOrds
+	ordsconfigmapyml := strings.NewReplacer(
+		"replacepwdapexordsauto", publicPassword,
+		"ordsautodbhost", db.Dbname+"-apexords-db-svc",
+		"ordsautodbport", db.Dbport,
+		"ordsautodbservice", db.Dbservice,
+		"replacepwdsysordsauto", Dbpassword,
+	).Replace(config.Ordsconfigmapyml)
 
-	log.Log.Info("Update Apex schema password in Target DB....")
-	sqltext := "sqlplus " + "sys/" + r.Dbpassword + "@" + apexords.Spec.Dbname + "-apexords-db-svc" + ":" + apexords.Spec.Dbport + "/" + apexords.Spec.Dbservice + " as sysdba " + "@updatepass.sql " + r.Dbpassword
-	SQLCommand := []string{"/bin/sh", "-c", sqltext}
-	Podname := "sqlpluspod"
-	if err := ExecPodCmd(r, req, Podname, SQLCommand); err != nil {
-		log.Log.Error(err, "Error to run "+strings.Join(SQLCommand, " ")+" in Sqlpluspod")
+	decode := scheme.Codecs.UniversalDeserializer().Decode
+	obj, _, err := decode([]byte(ordsconfigmapyml), nil, nil)
+	if err != nil {
+		return nil, TerminalError(StepOrds, ReasonTemplateInvalid, fmt.Errorf("can't deserialize Ords configmap yaml: %v", err))
 	}
-
-	log.Log.Info("Update Apex workspace Admin password in Target DB.....")
-	sqltext = "sqlplus " + "sys/" + r.Dbpassword + "@" + apexords.Spec.Dbname + "-apexords-db-svc" + ":" + apexords.Spec.Dbport + "/" + apexords.Spec.Dbservice + " as sysdba " + "@apxchpwd-silent-admin.sql " + r.Dbpassword + "Apx1#"
-	SQLCommand = []string{"/bin/sh", "-c", sqltext}
-	Podname = "sqlpluspod"
-	if err := ExecPodCmd(r, req, Podname, SQLCommand); err != nil {
-		log.Log.Error(err, "Error to run "+strings.Join(SQLCommand, " ")+" in Sqlpluspod")
+	ordsconfigmap, ok := obj.(*corev1.ConfigMap)
+	if !ok {
+		return nil, TerminalError(StepOrds, ReasonTemplateInvalid, fmt.Errorf("Ords configmap yaml is a %T", obj))
 	}
+	OrdsTLSConfig(db, ordsconfigmap)
+	return ordsconfigmap, nil
+}
 
-	//delete sqlpluspod
-	if err := DeleteSqlplusPod(r, req); err != nil {
-		log.Log.Error(err, "unable to delete Sqlpluspod")
-	}
+//CredentialsSecretName returns the name of the secret holding the sys and Apex admin passwords
+func CredentialsSecretName(apexords *operatorv1.ApexOrds) string {
+	return apexords.Spec.Ordsname + "-apexords-credentials"
+}
 
-	return nil
+//CreateCredentialsSecret copies the passwords of the OracleDatabase to the credentials secret of an ApexOrds with databaseref,
+//its Apex and Ords share the public users of the DB
+func CreateCredentialsSecret(r *ApexOrdsReconciler, apexords *operatorv1.ApexOrds, dbcredentials *Credentials) error {
+	_, err := saveCredentials(context.Background(), r.Client, r.Scheme, apexords, CredentialsSecretName(apexords), func(cr *Credentials) {
+		*cr = Credentials{Sys: dbcredentials.Sys, ApexAdmin: dbcredentials.ApexAdmin, Public: dbcredentials.Public}
+	})
+	return err
 }
 
 //DeleteSqlplusPod function is to clean sqlpluspod
-func DeleteSqlplusPod(r *ApexOrdsReconciler, req ctrl.Request) error {
+func DeleteSqlplusPod(r client.Client, req ctrl.Request, Podname string) error {
 	ctx := context.Background()
 	_ = log.FromContext(ctx)
 
 	pod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: req.NamespacedName.Namespace,
-			Name:      "sqlpluspod",
+			Name:      Podname,
 		},
 	}
-	log.Log.Info("Deleting sqlpluspod .......")
+	log.Log.Info("Deleting " + Podname + " .......")
 	if err := r.Delete(ctx, pod); err != nil {
 		log.Log.Error(err, "unable to delete sqlplus pod")
 		return err
@@ -432,18 +841,23 @@ func DeleteSqlplusPod(r *ApexOrdsReconciler, req ctrl.Request) error {
 }
 
 //DeleteOrdsPod function is to clean ordspod
-func DeleteOrdsPod(r *ApexOrdsReconciler, req ctrl.Request) error {
+func DeleteOrdsPod(r *ApexOrdsReconciler, req ctrl.Request, apexords *operatorv1.ApexOrds) error {
+	return deleteOrdsPod(r.Client, req, OrdsPodName(apexords))
+}
+
+//deleteOrdsPod deletes the ords pod Podname
+func deleteOrdsPod(c client.Client, req ctrl.Request, Podname string) error {
 	ctx := context.Background()
 	_ = log.FromContext(ctx)
 
 	pod := &corev1.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			Namespace: req.NamespacedName.Namespace,
-			Name:      "ordspod",
+			Name:      Podname,
 		},
 	}
-	log.Log.Info("Deleting ordspod .......")
-	if err := r.Delete(ctx, pod); err != nil {
+	log.Log.Info("Deleting " + pod.ObjectMeta.Name + " .......")
+	if err := c.Delete(ctx, pod); err != nil {
 		log.Log.Error(err, "unable to delete ords pod")
 		return err
 	}
@@ -451,7 +865,12 @@ func DeleteOrdsPod(r *ApexOrdsReconciler, req ctrl.Request) error {
 }
 
 //CreateOrdsPod Function to create ords pod to run installation sql for ords schemas
-func CreateOrdsPod(r *ApexOrdsReconciler, req ctrl.Request, apexords *operatorv1.ApexOrds) error {
+func CreateOrdsPod(r *ApexOrdsReconciler, req ctrl.Request, apexords *operatorv1.ApexOrds, db *operatorv1.OracleDatabaseSpec) error {
+	return createOrdsPod(r.Client, req, OrdsPodName(apexords), OrdsConfigVolumeSource(apexords), db)
+}
+
+//createOrdsPod creates the ords pod Podname with the config files of configsource in /mnt/k8s and waits for it to run
+func createOrdsPod(c client.Client, req ctrl.Request, Podname string, configsource corev1.VolumeSource, db *operatorv1.OracleDatabaseSpec) error {
 	ctx := context.Background()
 	_ = log.FromContext(ctx)
 	var waitsec int64 = 10
@@ -461,27 +880,19 @@ func CreateOrdsPod(r *ApexOrdsReconciler, req ctrl.Request, apexords *operatorv1
 		APIVersion: "v1",
 	}
 	objectMetadata := metav1.ObjectMeta{
-		Name:      "ordspod",
+		Name:      Podname,
 		Namespace: req.NamespacedName.Namespace,
 	}
 
-	configmapvolume := &corev1.ConfigMapVolumeSource{
-		LocalObjectReference: corev1.LocalObjectReference{Name: apexords.Spec.Ordsname + "-apexords-ords-cm"},
-	}
-
 	podSpecs := corev1.PodSpec{
-		//ImagePullSecrets: []corev1.LocalObjectReference{{
-		//	Name: "repo-secret",
-		//}},
+		ImagePullSecrets: db.ImagePullSecrets,
 		Volumes: []corev1.Volume{{
-			Name: "ords-config",
-			VolumeSource: corev1.VolumeSource{
-				ConfigMap: configmapvolume,
-			},
+			Name:         "ords-config",
+			VolumeSource: configsource,
 		}},
 		Containers: []corev1.Container{{
 			Name:  "ordspod",
-			Image: "henryxie/apexords-operator-apexords:v19",
+			Image: Images.Resolve(OrdsImage),
 			VolumeMounts: []corev1.VolumeMount{{
 				Name:      "ords-config",
 				MountPath: "/mnt/k8s",
@@ -489,46 +900,38 @@ func CreateOrdsPod(r *ApexOrdsReconciler, req ctrl.Request, apexords *operatorv1
 		}},
 		TerminationGracePeriodSeconds: &waitsec,
 	}
+	MountWallet(db, &podSpecs, "ordspod")
 	pod := corev1.Pod{
 		TypeMeta:   typeMetadata,
 		ObjectMeta: objectMetadata,
 		Spec:       podSpecs,
 	}
 	log.Log.Info("Creating ords pod .......")
-	if err := r.Create(ctx, &pod); err != nil {
+	if err := c.Create(ctx, &pod); err != nil && !apierrors.IsAlreadyExists(err) {
 		log.Log.Error(err, "unable to create ords pod")
-		return err
-	}
-	podstatus := &corev1.Pod{}
-	verifyPodState := func() bool {
-		if err := r.Get(ctx, client.ObjectKey{
-			Namespace: req.NamespacedName.Namespace,
-			Name:      "ordspod",
-		}, podstatus); err != nil {
-			return false
-		}
-		if podstatus.Status.Phase == corev1.PodRunning {
-			return true
-		}
-		return false
+		return RetryableError(StepOrds, ReasonCreateFailed, fmt.Errorf("unable to create ordspod: %v", err))
 	}
-	//20 min timeout for starting pod
-	for i := 0; i < 120; i++ {
-		if !verifyPodState() {
-			log.Log.Info("waiting for ordspod to start.......")
-			time.Sleep(10 * time.Second)
+	return waitForPodRunning(ctx, c, req.NamespacedName.Namespace, Podname, StepOrds, OrdsPodStartTimeout)
+}
 
-		} else {
-			log.Log.Info("ordspod started.......")
-			return nil
-		}
-	}
-	log.Log.Error(nil, "Timeout to start ords pod")
-	return nil
+//OrdsPodName returns the name of the pod running ords.war install for the ApexOrds
+func OrdsPodName(apexords *operatorv1.ApexOrds) string {
+	return apexords.Spec.Ordsname + "-apexords-ordspod"
+}
+
+//SqlplusPodName returns the name of the pod running the sql scripts in the DB,only one runs at a time
+//as the scripts hold the lock of the DB
+func SqlplusPodName(db *operatorv1.OracleDatabaseSpec) string {
+	return db.Dbname + "-apexords-sqlpluspod"
 }
 
-//CreateSqlplusPod Function to create sqlpluspod to run installation sql
-func CreateSqlplusPod(r *ApexOrdsReconciler, req ctrl.Request) error {
+//CreateSqlplusPod Function to create sqlpluspod to run installation sql in db,the passwords come from the credentials secret Secretname
+func CreateSqlplusPod(r client.Client, req ctrl.Request, Podname string, Secretname string, db *operatorv1.OracleDatabaseSpec) error {
+	return CreateSqlplusPodEnv(r, req, Podname, SqlplusEnv(Secretname), db)
+}
+
+//CreateSqlplusPodEnv creates a sqlpluspod with env,ie RotationEnv
+func CreateSqlplusPodEnv(r client.Client, req ctrl.Request, Podname string, env []corev1.EnvVar, db *operatorv1.OracleDatabaseSpec) error {
 	ctx := context.Background()
 	_ = log.FromContext(ctx)
 	var waitsec int64 = 10
@@ -537,195 +940,103 @@ func CreateSqlplusPod(r *ApexOrdsReconciler, req ctrl.Request) error {
 		APIVersion: "v1",
 	}
 	objectMetadata := metav1.ObjectMeta{
-		Name:      "sqlpluspod",
+		Name:      Podname,
 		Namespace: req.NamespacedName.Namespace,
 	}
 	podSpecs := corev1.PodSpec{
-		//ImagePullSecrets: []corev1.LocalObjectReference{{
-		//	Name: "repo-secret",
-		//}},
+		ImagePullSecrets: db.ImagePullSecrets,
 		Containers: []corev1.Container{{
 			Name:            "sqlpluspod",
-			Image:           "henryxie/apexords-operator-instantclient-apex19:v1",
+			Image:           Images.Resolve(SqlplusImage),
 			ImagePullPolicy: "Always",
+			Env:             env,
 		}},
 		TerminationGracePeriodSeconds: &waitsec,
 	}
+	MountWallet(db, &podSpecs, "sqlpluspod")
 	pod := corev1.Pod{
 		TypeMeta:   typeMetadata,
 		ObjectMeta: objectMetadata,
 		Spec:       podSpecs,
 	}
-	log.Log.Info("Creating sqlpluspod .......")
-
-	if err := r.Create(ctx, &pod); err != nil {
+	log.Log.Info("Creating " + Podname + " .......")
+	if err := r.Create(ctx, &pod); err != nil && !apierrors.IsAlreadyExists(err) {
 		log.Log.Error(err, "unable to create sqlplus pod")
-		return err
+		return RetryableError(StepApex, ReasonCreateFailed, fmt.Errorf("unable to create %s: %v", Podname, err))
 	}
+	return waitForPodRunning(ctx, r, req.NamespacedName.Namespace, Podname, StepApex, SqlplusPodStartTimeout)
+}
+
+//waitForPodRunning polls the pod every PodPollInterval until it is running.
+//A failed pod is terminal,a pod still pending after timeout is retried by the next reconcile
+func waitForPodRunning(ctx context.Context, c client.Client, Namespace string, Podname string, step string, timeout time.Duration) error {
 	podstatus := &corev1.Pod{}
-	verifyPodState := func() bool {
-		if err := r.Get(ctx, client.ObjectKey{
-			Namespace: req.NamespacedName.Namespace,
-			Name:      "sqlpluspod",
-		}, podstatus); err != nil {
-			return false
-		}
-		if podstatus.Status.Phase == corev1.PodRunning {
-			return true
+	deadline := time.Now().Add(timeout)
+	for {
+		if err := c.Get(ctx, client.ObjectKey{Namespace: Namespace, Name: Podname}, podstatus); err == nil {
+			switch podstatus.Status.Phase {
+			case corev1.PodRunning:
+				log.Log.Info(Podname + " started.......")
+				return nil
+			case corev1.PodFailed:
+				return TerminalError(step, ReasonPodFailed, fmt.Errorf("%s failed: %s", Podname, podstatus.Status.Message))
+			}
 		}
-		return false
-	}
-	//8 min timeout for starting pod
-	for i := 0; i < 96; i++ {
-		if !verifyPodState() {
-			log.Log.Info("waiting for sqlpluspod to start.......")
-			time.Sleep(5 * time.Second)
-
-		} else {
-			log.Log.Info("sqlpluspod started.......")
-			return nil
+		if !time.Now().Before(deadline) {
+			log.Log.Error(nil, "Timeout to start "+Podname)
+			return RetryableError(step, ReasonPodTimeout, fmt.Errorf("timeout after %v to start %s", timeout, Podname))
 		}
+		log.Log.Info("waiting for " + Podname + " to start.......")
+		time.Sleep(PodPollInterval)
 	}
-	log.Log.Error(nil, "Timeout to start sqlplus pod")
-	return nil
-
 }
 
-//ExecPodCmd function is to run cmd ie sqlplus
-func ExecPodCmd(r *ApexOrdsReconciler, req ctrl.Request, Podname string, SQLCommand []string) error {
-	ctx := context.Background()
-	_ = log.FromContext(ctx)
-	//get restconfig from kubeconfig or cluster
-	cfg, err := ctrlconfig.GetConfig()
-	if err != nil {
-		log.Log.Error(err, "unable to get kubeconfig")
-		return err
-
-	}
-
-	kubeclientset, err := kubernetes.NewForConfig(cfg)
-	if err != nil {
-		return err
-	}
-	execReq := kubeclientset.CoreV1().RESTClient().Post().
-		Resource("pods").
-		Name(Podname).
-		Namespace(req.NamespacedName.Namespace).
-		SubResource("exec")
-
-	execReq.VersionedParams(&corev1.PodExecOptions{
-		Command: SQLCommand,
-		Stdin:   true,
-		Stdout:  true,
-		Stderr:  true,
-	}, scheme.ParameterCodec)
-
-	exec, err := remotecommand.NewSPDYExecutor(cfg, "POST", execReq.URL())
-	if err != nil {
-		log.Log.Error(err, "error while creating Executor:")
-		return err
-
-	}
-
-	err = exec.Stream(remotecommand.StreamOptions{
-		Stdin:  os.Stdin,
-		Stdout: os.Stdout,
-		Stderr: os.Stderr,
-		Tty:    false,
-	})
-	if err != nil {
-		log.Log.Error(err, "error in Stream")
-		return err
-	} else {
-		return nil
-	}
-
+//ExecTimeouts is how long the commands of a step may run in a pod,the exec streams are closed after it so a
+//hung command doesn't block the worker while it holds the lock of the DB. Steps not listed get DefaultExecTimeout
+var ExecTimeouts = map[string]time.Duration{
+	StepApex:        2 * time.Hour,
+	StepOrds:        30 * time.Minute,
+	StepPdb:         30 * time.Minute,
+	StepParameters:  10 * time.Minute,
+	StepPasswords:   10 * time.Minute,
+	StepCredentials: 10 * time.Minute,
 }
 
-//CreateDbSvcOption is to create DB service in K8S
-func CreateDbSvcOption(r *ApexOrdsReconciler, req ctrl.Request, apexords *operatorv1.ApexOrds) error {
-	ctx := context.Background()
-	_ = log.FromContext(ctx)
-
-	log.Log.Info("Creating DB service :" + apexords.Spec.Dbname + "-apexords-db-svc")
-
-	//Update service name
-	var oradbsvc *corev1.Service
-	var oradbselector = map[string]string{
-		"oradbsts": apexords.Spec.Dbname + "-StsSelector",
-	}
-
-	var oradbsvcownerref = []metav1.OwnerReference{{
-		Kind:       apexords.TypeMeta.Kind,
-		APIVersion: apexords.TypeMeta.APIVersion,
-		Name:       apexords.ObjectMeta.Name,
-		UID:        apexords.ObjectMeta.UID,
-	}}
+//DefaultExecTimeout is the timeout of the commands of steps without one in ExecTimeouts
+var DefaultExecTimeout = 10 * time.Minute
 
-	decode := scheme.Codecs.UniversalDeserializer().Decode
-	obj, _, err := decode([]byte(config.OradbSvcyml), nil, nil)
-	if err != nil {
-		log.Log.Error(err, "can't deserialize oradb service yaml")
-	}
-	oradbsvc = obj.(*corev1.Service)
-	oradbsvc.ObjectMeta.Name = apexords.Spec.Dbname + "-apexords-db-svc"
-	oradbsvc.ObjectMeta.Namespace = req.NamespacedName.Namespace
-	oradbsvc.ObjectMeta.OwnerReferences = oradbsvcownerref // add owner reference, so easy to clean up
-	oradbsvc.Spec.Selector = oradbselector
-
-	if err := r.Create(ctx, oradbsvc); err != nil {
-		log.Log.Error(err, "unable to create DB service")
-		return err
+//ExecTimeout returns how long a command of step may run
+func ExecTimeout(step string) time.Duration {
+	if timeout, ok := ExecTimeouts[step]; ok {
+		return timeout
 	}
+	return DefaultExecTimeout
+}
 
-	return nil
+//ExecPodCmd function is to run cmd ie sqlplus
+func ExecPodCmd(ctx context.Context, runner CommandRunner, req ctrl.Request, Podname string, step string, SQLCommand []string) error {
+	_, err := ExecPodCmdOutput(ctx, runner, req, Podname, step, SQLCommand)
+	return err
 }
 
-//CreateDbOption function to DB statefulset
-func CreateDbOption(r *ApexOrdsReconciler, req ctrl.Request, apexords *operatorv1.ApexOrds) error {
-	ctx := context.Background()
-	_ = log.FromContext(ctx)
-	apexordsdbstsname := apexords.Spec.Dbname + "-apexords-db-sts"
-	log.Log.Info("Creating DB statefulset :" + apexordsdbstsname)
-	// complete db statefulset  settings
-	decode := scheme.Codecs.UniversalDeserializer().Decode
-	obj, _, err := decode([]byte(config.OradbStsyml), nil, nil)
+//ExecPodCmdOutput function is to run cmd in the pod and return what it printed on stdout,the command is
+//stopped when ctx is done or after the exec timeout of step.
+//The output can carry credentials,ie the client secret of an Ords OAuth client,so only its size is logged
+func ExecPodCmdOutput(ctx context.Context, runner CommandRunner, req ctrl.Request, Podname string, step string, SQLCommand []string) (string, error) {
+	timeout := ExecTimeout(step)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	result, err := runner.Run(ctx, req.NamespacedName.Namespace, Podname, SQLCommand, nil)
+	log.Log.Info("Ran command in "+Podname, "stdoutbytes", len(result.Stdout), "stderrbytes", len(result.Stderr), "exitcode", result.ExitCode)
+	if errors.Is(err, context.DeadlineExceeded) {
+		log.Log.Error(err, "command timed out in "+Podname)
+		return result.Stdout, fmt.Errorf("command in %s didn't finish within %v: %w", Podname, timeout, err)
+	}
 	if err != nil {
-		log.Log.Error(err, "can't deserialize oradb sts yaml")
-	}
-	oradbsts := obj.(*appsv1.StatefulSet)
-	oradbsts.ObjectMeta.Name = apexordsdbstsname
-	oradbsts.ObjectMeta.Namespace = req.NamespacedName.Namespace
-
-	//Update selector
-	var oradbselector = map[string]string{
-		"oradbsts": apexords.Spec.Dbname + "-StsSelector",
-	}
-	var apexordsownerref = []metav1.OwnerReference{{
-		Kind:       apexords.TypeMeta.Kind,
-		APIVersion: apexords.TypeMeta.APIVersion,
-		Name:       apexords.ObjectMeta.Name,
-		UID:        apexords.ObjectMeta.UID,
-	}}
-	oradbsts.Spec.Selector.MatchLabels = oradbselector
-	//Update ORACLE_SID ,ORACLE_PDB,ORACLE_PWD
-	oradbsts.Spec.Template.Spec.Containers[0].Env[0].Value = strings.ToUpper(apexords.Spec.Dbname)
-	oradbsts.Spec.Template.Spec.Containers[0].Env[1].Value = strings.ToUpper(apexords.Spec.Dbservice)
-	oradbsts.Spec.Template.Spec.Containers[0].Env[2].Value = r.Dbpassword
-	oradbsts.Spec.Template.ObjectMeta.Labels = oradbselector
-	oradbsts.ObjectMeta.OwnerReferences = apexordsownerref // add owner reference, so easy to clean up
-	//update volume mouth and template name
-	oradbvolname := apexords.Spec.Dbname + "-db-pv-storage"
-	oradbsts.Spec.Template.Spec.Containers[0].VolumeMounts[0].Name = oradbvolname
-	oradbsts.Spec.VolumeClaimTemplates[0].ObjectMeta.Name = oradbvolname
-	//fmt.Printf("%v#\n",o.oradbsts.Spec.VolumeClaimTemplates)
-
-	if err := r.Create(ctx, oradbsts); err != nil {
-		log.Log.Error(err, "unable to create DB statefulset")
-		return err
+		log.Log.Error(err, "error in Stream")
+		return result.Stdout, fmt.Errorf("%w: %s", err, result.Stderr)
 	}
-
-	return nil
+	return result.Stdout, nil
 }
 
 //Autopasswd is to reverse dbname+ordsname for temp password for sys, apex, ords schemas, users need to change it later
@@ -741,6 +1052,63 @@ func Autopasswd(s string) string {
 // SetupWithManager sets up the controller with the Manager.
 func (r *ApexOrdsReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&operatorv1.ApexOrds{}).
+		// status updates of every step must not trigger another reconcile
+		For(&operatorv1.ApexOrds{}, builder.WithPredicates(predicate.Or(predicate.GenerationChangedPredicate{}, predicate.AnnotationChangedPredicate{}))).
+		// install Ords as soon as the referenced OracleDatabase is ready
+		Watches(&source.Kind{Type: &operatorv1.OracleDatabase{}}, handler.EnqueueRequestsFromMapFunc(r.apexordsOfDatabase)).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(r.apexordsOfSecret)).
+		// a change of a generated object,ie the Ords pods getting ready,reconciles its ApexOrds
+		Owns(&appsv1.StatefulSet{}).
+		Owns(&appsv1.Deployment{}).
+		Owns(&corev1.Service{}).
+		Owns(&corev1.ConfigMap{}).
+		Owns(&corev1.Secret{}).
+		Owns(&batchv1.Job{}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
 		Complete(r)
 }
+
+//apexordsOfSecret returns the requests of the ApexOrds whose database.credentials is the secret
+func (r *ApexOrdsReconciler) apexordsOfSecret(obj client.Object) []reconcile.Request {
+	var apexordslist operatorv1.ApexOrdsList
+	if err := r.List(context.Background(), &apexordslist, client.InNamespace(obj.GetNamespace())); err != nil {
+		log.Log.Error(err, "unable to list ApexOrds of secret "+obj.GetName())
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, apexords := range apexordslist.Items {
+		if apexords.Spec.DatabaseRef == "" && CredentialsSecretOf(&InlineDatabase(&apexords).DatabaseSpec) == obj.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&apexords)})
+		}
+	}
+	return requests
+}
+
+//apexordsOfDatabase returns the requests of the ApexOrds with databaseref to the OracleDatabase
+func (r *ApexOrdsReconciler) apexordsOfDatabase(obj client.Object) []reconcile.Request {
+	names, err := ApexOrdsOfDatabase(context.Background(), r.Client, obj)
+	if err != nil {
+		log.Log.Error(err, "unable to list ApexOrds of OracleDatabase "+obj.GetName())
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, name := range names {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKey{Namespace: obj.GetNamespace(), Name: name}})
+	}
+	return requests
+}
+
+//ApexOrdsOfDatabase returns the names of the ApexOrds with databaseref to the OracleDatabase oradb
+func ApexOrdsOfDatabase(ctx context.Context, c client.Client, oradb client.Object) ([]string, error) {
+	var apexordslist operatorv1.ApexOrdsList
+	if err := c.List(ctx, &apexordslist, client.InNamespace(oradb.GetNamespace())); err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, apexords := range apexordslist.Items {
+		if apexords.Spec.DatabaseRef == oradb.GetName() {
+			names = append(names, apexords.ObjectMeta.Name)
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,1407 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/exec"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	operatorv1 "apexords-operator/apexords-operator/api/v1"
+	config "apexords-operator/apexords-operator/controllers/config"
+)
+
+//failingCreateClient fails every Create of the given kind
+type failingCreateClient struct {
+	client.Client
+	kind string
+}
+
+func (c *failingCreateClient) Create(ctx context.Context, obj client.Object, opts ...client.CreateOption) error {
+	if fmt.Sprintf("%T", obj) == c.kind {
+		return errors.New("injected create failure")
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+var _ = Describe("ApexOrds reconcile", func() {
+	var (
+		ctx       context.Context
+		namespace string
+		recorder  *record.FakeRecorder
+		runner    *FakeCommandRunner
+	)
+
+	newReconciler := func(c client.Client) *ApexOrdsReconciler {
+		return &ApexOrdsReconciler{Client: c, Scheme: scheme.Scheme, Recorder: recorder, Runner: runner}
+	}
+
+	createApexOrds := func(spec operatorv1.ApexOrdsSpec) ctrl.Request {
+		apexords := &operatorv1.ApexOrds{
+			ObjectMeta: metav1.ObjectMeta{Name: "apexords-test", Namespace: namespace},
+			Spec:       spec,
+		}
+		Expect(k8sClient.Create(ctx, apexords)).To(Succeed())
+		return ctrl.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: apexords.Name}}
+	}
+
+	fetch := func(req ctrl.Request) *operatorv1.ApexOrds {
+		apexords := &operatorv1.ApexOrds{}
+		Expect(k8sClient.Get(ctx, req.NamespacedName, apexords)).To(Succeed())
+		return apexords
+	}
+
+	validSpec := operatorv1.ApexOrdsSpec{Dbname: "testcdb", Dbservice: "testpdb", Ordsname: "testords"}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		recorder = record.NewFakeRecorder(100)
+		runner = &FakeCommandRunner{}
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "apexords-test-"}}
+		Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+		namespace = ns.Name
+	})
+
+	It("marks an invalid spec as terminal without requeue", func() {
+		req := createApexOrds(operatorv1.ApexOrdsSpec{Dbname: "testcdb", Dbservice: "testpdb"})
+
+		_, err := newReconciler(k8sClient).Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		apexords := fetch(req)
+		Expect(apexords.Status.Phase).To(Equal(operatorv1.PhaseFailed))
+		failed := meta.FindStatusCondition(apexords.Status.Conditions, operatorv1.ConditionFailed)
+		Expect(failed).NotTo(BeNil())
+		Expect(failed.Status).To(Equal(metav1.ConditionTrue))
+		Expect(failed.Reason).To(Equal(ReasonInvalidSpec))
+		Expect(recorder.Events).To(Receive(ContainSubstring(ReasonInvalidSpec)))
+	})
+
+	It("reconciles the ApexOrds when an object it owns changes", func() {
+		spec := validSpec
+		spec.Paused = true
+		req := createApexOrds(spec)
+		apexords := fetch(req)
+		deployment := &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: "testords-apexords-ords-deployment", Namespace: namespace},
+			Spec: appsv1.DeploymentSpec{
+				Selector: &metav1.LabelSelector{MatchLabels: OrdsSelector(apexords)},
+				Template: corev1.PodTemplateSpec{
+					ObjectMeta: metav1.ObjectMeta{Labels: OrdsSelector(apexords)},
+					Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "ords", Image: "ords"}}},
+				},
+			},
+		}
+		Expect(setControllerReference(apexords, deployment, scheme.Scheme, StepOrds)).To(Succeed())
+		Expect(k8sClient.Create(ctx, deployment)).To(Succeed())
+
+		mgr, err := ctrl.NewManager(cfg, ctrl.Options{Scheme: scheme.Scheme, MetricsBindAddress: "0", Namespace: namespace})
+		Expect(err).NotTo(HaveOccurred())
+		reconciler := &ApexOrdsReconciler{Client: mgr.GetClient(), Scheme: mgr.GetScheme(), Recorder: recorder, Runner: runner}
+		Expect(reconciler.SetupWithManager(mgr)).To(Succeed())
+		stopCtx, stop := context.WithCancel(ctx)
+		defer stop()
+		go func() {
+			defer GinkgoRecover()
+			Expect(mgr.Start(stopCtx)).To(Succeed())
+		}()
+		Eventually(func() bool {
+			return meta.IsStatusConditionTrue(fetch(req).Status.Conditions, operatorv1.ConditionPaused)
+		}, 10*time.Second).Should(BeTrue())
+
+		//the paused ApexOrds is requeued after a minute,the status change of the deployment reconciles it at once
+		deployment.Status.Replicas, deployment.Status.ReadyReplicas = 2, 2
+		Expect(k8sClient.Status().Update(ctx, deployment)).To(Succeed())
+		Eventually(func() int32 {
+			return fetch(req).Status.OrdsReadyReplicas
+		}, 10*time.Second).Should(Equal(int32(2)))
+	})
+
+	It("reports a broken template as terminal instead of panicking", func() {
+		saved := config.OradbStsyml
+		config.OradbStsyml = "not: [a statefulset"
+		defer func() { config.OradbStsyml = saved }()
+		req := createApexOrds(validSpec)
+
+		_, err := newReconciler(k8sClient).Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		apexords := fetch(req)
+		Expect(apexords.Status.Phase).To(Equal(operatorv1.PhaseFailed))
+		Expect(meta.FindStatusCondition(apexords.Status.Conditions, operatorv1.ConditionFailed).Reason).To(Equal(ReasonTemplateInvalid))
+	})
+
+	It("requeues when creating the DB statefulset fails", func() {
+		req := createApexOrds(validSpec)
+
+		_, err := newReconciler(&failingCreateClient{Client: k8sClient, kind: "*v1.StatefulSet"}).Reconcile(ctx, req)
+		Expect(err).To(HaveOccurred())
+		Expect(IsRetryable(err)).To(BeTrue())
+
+		apexords := fetch(req)
+		Expect(apexords.Status.Phase).To(Equal(operatorv1.PhaseProvisioning))
+		Expect(meta.FindStatusCondition(apexords.Status.Conditions, operatorv1.ConditionFailed).Reason).To(Equal(ReasonCreateFailed))
+	})
+
+	It("requeues while the DB pod is not running and keeps the DB step done", func() {
+		req := createApexOrds(validSpec)
+
+		_, err := newReconciler(k8sClient).Reconcile(ctx, req)
+		Expect(err).To(HaveOccurred())
+		var stepErr *StepError
+		Expect(errors.As(err, &stepErr)).To(BeTrue())
+		Expect(stepErr.Reason).To(Equal(ReasonPodNotReady))
+		Expect(stepErr.Retryable).To(BeTrue())
+
+		apexords := fetch(req)
+		Expect(meta.IsStatusConditionTrue(apexords.Status.Conditions, operatorv1.ConditionDatabaseProvisioned)).To(BeTrue())
+		Expect(meta.IsStatusConditionTrue(apexords.Status.Conditions, operatorv1.ConditionFailed)).To(BeTrue())
+		Expect(apexords.Status.Phase).To(Equal(operatorv1.PhaseInstallingApex))
+
+		sts := &appsv1.StatefulSet{}
+		Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testcdb-apexords-db-sts"}, sts)).To(Succeed())
+
+		//second reconcile must not fail on the objects created by the first one
+		_, err = newReconciler(k8sClient).Reconcile(ctx, req)
+		Expect(errors.As(err, &stepErr)).To(BeTrue())
+		Expect(stepErr.Reason).To(Equal(ReasonPodNotReady))
+	})
+
+	It("creates the DB with the image, character sets, edition and archivelog mode of the spec", func() {
+		spec := validSpec
+		spec.Database = &operatorv1.DatabaseSpec{
+			Image:                "registry.example.com/oracle/database:19.3.0-ee",
+			ImagePullSecrets:     []corev1.LocalObjectReference{{Name: "registry-secret"}},
+			CharacterSet:         "al32utf8",
+			NationalCharacterSet: "UTF8",
+			Edition:              operatorv1.DbEditionSE2,
+			EnableArchiveLog:     true,
+		}
+		req := createApexOrds(spec)
+		_, err := newReconciler(k8sClient).Reconcile(ctx, req)
+		Expect(IsRetryable(err)).To(BeTrue())
+
+		sts := &appsv1.StatefulSet{}
+		Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testcdb-apexords-db-sts"}, sts)).To(Succeed())
+		podspec := sts.Spec.Template.Spec
+		Expect(podspec.Containers[0].Image).To(Equal("registry.example.com/oracle/database:19.3.0-ee"))
+		Expect(podspec.ImagePullSecrets).To(Equal([]corev1.LocalObjectReference{{Name: "registry-secret"}}))
+		Expect(podspec.Containers[0].Env).To(ContainElements(
+			corev1.EnvVar{Name: "ORACLE_SID", Value: "TESTCDB"},
+			corev1.EnvVar{Name: "ORACLE_CHARACTERSET", Value: "AL32UTF8"},
+			corev1.EnvVar{Name: "ORACLE_NATIONAL_CHARACTERSET", Value: "UTF8"},
+			corev1.EnvVar{Name: "ORACLE_EDITION", Value: "standard"},
+			corev1.EnvVar{Name: "ENABLE_ARCHIVELOG", Value: "true"},
+		))
+	})
+
+	It("keeps the image and env of the template by default", func() {
+		req := createApexOrds(validSpec)
+		_, err := newReconciler(k8sClient).Reconcile(ctx, req)
+		Expect(IsRetryable(err)).To(BeTrue())
+
+		sts := &appsv1.StatefulSet{}
+		Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testcdb-apexords-db-sts"}, sts)).To(Succeed())
+		Expect(sts.Spec.Template.Spec.Containers[0].Image).To(Equal("henryxie/apexords-operator-database:19.2"))
+		Expect(sts.Spec.Template.Spec.Containers[0].Env).To(HaveLen(3))
+		Expect(sts.Spec.Template.Spec.ImagePullSecrets).To(BeEmpty())
+	})
+
+	It("rejects edition XE without an XE image and DB names", func() {
+		spec := validSpec
+		spec.Database = &operatorv1.DatabaseSpec{Edition: operatorv1.DbEditionXE, Image: "container-registry.oracle.com/database/express:21.3.0-xe"}
+		req := createApexOrds(spec)
+		_, err := newReconciler(k8sClient).Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		apexords := fetch(req)
+		Expect(apexords.Status.Phase).To(Equal(operatorv1.PhaseFailed))
+		failed := meta.FindStatusCondition(apexords.Status.Conditions, operatorv1.ConditionFailed)
+		Expect(failed.Reason).To(Equal(ReasonInvalidSpec))
+		Expect(failed.Message).To(ContainSubstring("dbname XE and dbservice XEPDB1"))
+	})
+
+	It("rejects tls without tnsalias or host as the DB of the operator has no TCPS listener", func() {
+		spec := validSpec
+		spec.Database = &operatorv1.DatabaseSpec{TLS: &operatorv1.DatabaseTLS{WalletSecret: "testcdb-wallet"}}
+		req := createApexOrds(spec)
+		_, err := newReconciler(k8sClient).Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+
+		apexords := fetch(req)
+		Expect(apexords.Status.Phase).To(Equal(operatorv1.PhaseFailed))
+		failed := meta.FindStatusCondition(apexords.Status.Conditions, operatorv1.ConditionFailed)
+		Expect(failed.Reason).To(Equal(ReasonInvalidSpec))
+		Expect(failed.Message).To(ContainSubstring("tnsalias or host"))
+		Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testcdb-apexords-db-svc"}, &corev1.Service{})).NotTo(Succeed())
+
+		spec.Ordsname = "portords"
+		spec.Database = &operatorv1.DatabaseSpec{TLS: &operatorv1.DatabaseTLS{WalletSecret: "testcdb-wallet", Host: "db.example.com", Port: "tcps"}}
+		invalid := &operatorv1.ApexOrds{ObjectMeta: metav1.ObjectMeta{Name: "apexords-port", Namespace: namespace}, Spec: spec}
+		Expect(apierrors.IsInvalid(k8sClient.Create(ctx, invalid))).To(BeTrue())
+	})
+
+	Context("installing Apex and Ords", func() {
+		var (
+			savedInterval time.Duration
+			stopPods      func()
+			dbpassword    string
+		)
+
+		BeforeEach(func() {
+			savedInterval = PodPollInterval
+			PodPollInterval = 20 * time.Millisecond
+			stopPods = runPods(namespace, "testcdb-apexords-db-sts-0", "testcdb-apexords-sqlpluspod", "testords-apexords-ordspod")
+			dbpassword = Autopasswd("testcdb" + "testords")
+
+			dbpod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "testcdb-apexords-db-sts-0", Namespace: namespace},
+				Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "oradb", Image: "oradb"}}},
+			}
+			Expect(k8sClient.Create(ctx, dbpod)).To(Succeed())
+			Eventually(func() corev1.PodPhase {
+				_ = k8sClient.Get(ctx, client.ObjectKeyFromObject(dbpod), dbpod)
+				return dbpod.Status.Phase
+			}).Should(Equal(corev1.PodRunning))
+		})
+		AfterEach(func() {
+			stopPods()
+			PodPollInterval = savedInterval
+		})
+
+		sqlplus := func(script string) string {
+			return "{ printf 'whenever sqlerror exit failure\\nwhenever oserror exit failure\\nset verify off\\n'\n" +
+				"printf 'connect sys/\"%s\"@testcdb-apexords-db-svc:1521/testpdb as sysdba\\n' \"$SYS_PASSWORD\"\n" +
+				"printf 'define sys_password = \"%s\"\\ndefine apex_admin_password = \"%s\"\\n' \"$SYS_PASSWORD\" \"$APEX_ADMIN_PASSWORD\"\n" +
+				"cat <<'EOF'\n" +
+				script + "\n" +
+				"exit\n" +
+				"EOF\n" +
+				"} | sqlplus -s -L /nolog"
+		}
+		ordsinstall := "mv /opt/oracle/ords/config/ords/defaults.xml /tmp;cp /mnt/k8s/ords_params.properties /tmp/ords_params.properties;java -jar /opt/oracle/ords/ords.war install --parameterFile /tmp/ords_params.properties simple && echo APEXORDSVERSION:$(java -jar /opt/oracle/ords/ords.war version)"
+
+		It("runs the Apex and Ords installation and becomes Ready", func() {
+			req := createApexOrds(validSpec)
+
+			_, err := newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(runner.Scripts()).To(Equal([]string{
+				sqlplus("@createapex.sql"),
+				sqlplus("@updatepass.sql &sys_password"),
+				sqlplus("select 'APEXORDSVERSION:' || version_no from apex_release;\n@apxchpwd-silent-admin.sql &apex_admin_password"),
+				ordsinstall,
+			}))
+			Expect(runner.Commands[0].Podname).To(Equal("testcdb-apexords-sqlpluspod"))
+			Expect(runner.Commands[0].Namespace).To(Equal(namespace))
+			Expect(runner.Commands[3].Podname).To(Equal("testords-apexords-ordspod"))
+
+			apexords := fetch(req)
+			Expect(apexords.Status.Phase).To(Equal(operatorv1.PhaseReady))
+			for _, condition := range []string{operatorv1.ConditionDatabaseProvisioned, operatorv1.ConditionApexInstalled, operatorv1.ConditionOrdsInstalled} {
+				Expect(meta.IsStatusConditionTrue(apexords.Status.Conditions, condition)).To(BeTrue(), condition)
+			}
+			Expect(meta.IsStatusConditionTrue(apexords.Status.Conditions, operatorv1.ConditionFailed)).To(BeFalse())
+
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testords-apexords-ords-deployment"}, deployment)).To(Succeed())
+
+			//finished steps are not run again
+			_, err = newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(runner.Commands).To(HaveLen(4))
+		})
+
+		It("waits while another resource runs scripts in the same DB", func() {
+			key := namespace + "/testcdb"
+			_, ok := DbLocks.TryLock(key, "OracleDatabase other")
+			Expect(ok).To(BeTrue())
+			req := createApexOrds(validSpec)
+
+			result, err := newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(DatabaseLockRetryInterval))
+			Expect(runner.Commands).To(BeEmpty())
+			Expect(apierrors.IsNotFound(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testcdb-apexords-db-sts"}, &appsv1.StatefulSet{}))).To(BeTrue())
+			apexords := fetch(req)
+			waiting := meta.FindStatusCondition(apexords.Status.Conditions, operatorv1.ConditionWaitingForDatabase)
+			Expect(waiting).NotTo(BeNil())
+			Expect(waiting.Status).To(Equal(metav1.ConditionTrue))
+			Expect(waiting.Reason).To(Equal(ReasonDatabaseBusy))
+			Expect(waiting.Message).To(ContainSubstring("OracleDatabase other"))
+			Expect(recorder.Events).To(Receive(ContainSubstring(ReasonDatabaseBusy)))
+
+			DbLocks.Unlock(key, "OracleDatabase other")
+			_, err = newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(runner.Commands).To(HaveLen(4))
+			apexords = fetch(req)
+			Expect(apexords.Status.Phase).To(Equal(operatorv1.PhaseReady))
+			Expect(meta.IsStatusConditionFalse(apexords.Status.Conditions, operatorv1.ConditionWaitingForDatabase)).To(BeTrue())
+
+			//the reconcile released the lock
+			_, ok = DbLocks.TryLock(key, "OracleDatabase other")
+			Expect(ok).To(BeTrue())
+			DbLocks.Unlock(key, "OracleDatabase other")
+		})
+
+		It("keeps the output of the install steps with the passwords masked", func() {
+			runner.Results = func(cmd FakeCommand) (CommandResult, error) {
+				secret := &corev1.Secret{}
+				Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testords-apexords-credentials"}, secret)).To(Succeed())
+				return CommandResult{Stdout: "ran in " + cmd.Podname + " with " + string(secret.Data[CredentialsSysPasswordKey]) + "\n"}, nil
+			}
+			req := createApexOrds(validSpec)
+			_, err := newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			cm := &corev1.ConfigMap{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testords-apexords-install-log"}, cm)).To(Succeed())
+			Expect(InstallLogKeys(cm.Data)).To(Equal([]string{"01-createapex.sql.log", "02-updatepass.sql.log", "03-apxchpwd-silent-admin.sql.log", "04-ords-install.log"}))
+			Expect(cm.Data["01-createapex.sql.log"]).To(Equal("ran in testcdb-apexords-sqlpluspod with ********\n"))
+			Expect(cm.Data["04-ords-install.log"]).To(Equal("ran in testords-apexords-ordspod with ********\n"))
+			Expect(cm.OwnerReferences[0].Kind).To(Equal("ApexOrds"))
+			Expect(cm.Labels).To(HaveKeyWithValue(LabelComponent, ComponentInstall))
+		})
+
+		It("records the generated objects and rejects a new ordsname or dbname", func() {
+			req := createApexOrds(validSpec)
+			_, err := newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			apexords := fetch(req)
+			Expect(apexords.Status.Dbname).To(Equal("testcdb"))
+			Expect(apexords.Status.Ordsname).To(Equal("testords"))
+			Expect(apexords.Status.Objects).To(ContainElement(operatorv1.GeneratedObject{Kind: "StatefulSet", Name: "testcdb-apexords-db-sts"}))
+			Expect(apexords.Status.Objects).To(ContainElement(operatorv1.GeneratedObject{Kind: "Deployment", Name: "testords-apexords-ords-deployment"}))
+			Expect(apexords.Status.Objects).To(ContainElement(operatorv1.GeneratedObject{Kind: "Secret", Name: "testords-apexords-credentials"}))
+			for _, object := range apexords.Status.Objects {
+				obj := map[string]client.Object{"StatefulSet": &appsv1.StatefulSet{}, "Deployment": &appsv1.Deployment{},
+					"Service": &corev1.Service{}, "ConfigMap": &corev1.ConfigMap{}, "Secret": &corev1.Secret{}}[object.Kind]
+				Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: object.Name}, obj)).To(Succeed(), object.Name)
+			}
+
+			apexords.Spec.Ordsname = "newords"
+			Expect(k8sClient.Update(ctx, apexords)).To(Succeed())
+			result, err := newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Requeue).To(BeFalse())
+			Expect(runner.Commands).To(HaveLen(4))
+			Expect(apierrors.IsNotFound(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "newords-apexords-ords-deployment"}, &appsv1.Deployment{}))).To(BeTrue())
+			apexords = fetch(req)
+			Expect(apexords.Status.Phase).To(Equal(operatorv1.PhaseFailed))
+			failed := meta.FindStatusCondition(apexords.Status.Conditions, operatorv1.ConditionFailed)
+			Expect(failed.Reason).To(Equal(ReasonNameChanged))
+			Expect(failed.Message).To(ContainSubstring("spec.ordsname can't change from testords to newords"))
+			Expect(apexords.Status.Ordsname).To(Equal("testords"))
+
+			apexords.Spec.Ordsname = "testords"
+			apexords.Spec.Dbname = "newcdb"
+			Expect(k8sClient.Update(ctx, apexords)).To(Succeed())
+			_, err = newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			failed = meta.FindStatusCondition(fetch(req).Status.Conditions, operatorv1.ConditionFailed)
+			Expect(failed.Message).To(ContainSubstring("spec.dbname can't change from testcdb to newcdb"))
+
+			//setting the names back is reconciled as before
+			apexords = fetch(req)
+			apexords.Spec.Dbname = "testcdb"
+			Expect(k8sClient.Update(ctx, apexords)).To(Succeed())
+			_, err = newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			apexords = fetch(req)
+			Expect(apexords.Status.Phase).To(Equal(operatorv1.PhaseReady))
+			Expect(meta.IsStatusConditionTrue(apexords.Status.Conditions, operatorv1.ConditionFailed)).To(BeFalse())
+			Expect(runner.Commands).To(HaveLen(4))
+		})
+
+		It("rejects a change of the overrides once the objects are created with them", func() {
+			spec := validSpec
+			spec.Overrides = []operatorv1.ObjectOverride{{Kind: "Deployment", Patch: "metadata: {annotations: {team: apex}}"}}
+			req := createApexOrds(spec)
+			_, err := newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			apexords := fetch(req)
+			Expect(apexords.Status.Phase).To(Equal(operatorv1.PhaseReady))
+			Expect(apexords.Status.OverridesHash).To(Equal(OverridesHash(spec.Overrides)))
+
+			apexords.Spec.Overrides[0].Patch = "metadata: {annotations: {team: ords}}"
+			Expect(k8sClient.Update(ctx, apexords)).To(Succeed())
+			result, err := newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Requeue).To(BeFalse())
+			apexords = fetch(req)
+			Expect(apexords.Status.Phase).To(Equal(operatorv1.PhaseFailed))
+			failed := meta.FindStatusCondition(apexords.Status.Conditions, operatorv1.ConditionFailed)
+			Expect(failed.Status).To(Equal(metav1.ConditionTrue))
+			Expect(failed.Reason).To(Equal(ReasonOverridesChanged))
+			Expect(failed.Message).To(ContainSubstring("spec.overrides can't change"))
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testords-apexords-ords-deployment"}, deployment)).To(Succeed())
+			Expect(deployment.Annotations).To(HaveKeyWithValue("team", "apex"))
+
+			//setting them back is reconciled as before
+			apexords.Spec.Overrides[0].Patch = "metadata: {annotations: {team: apex}}"
+			Expect(k8sClient.Update(ctx, apexords)).To(Succeed())
+			_, err = newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			apexords = fetch(req)
+			Expect(apexords.Status.Phase).To(Equal(operatorv1.PhaseReady))
+			Expect(meta.IsStatusConditionTrue(apexords.Status.Conditions, operatorv1.ConditionFailed)).To(BeFalse())
+			Expect(runner.Commands).To(HaveLen(4))
+		})
+
+		It("rejects a change of the overrides after a failed install", func() {
+			runner.Results = func(cmd FakeCommand) (CommandResult, error) {
+				if strings.Contains(cmd.Command[2], "@createapex.sql\n") {
+					return CommandResult{Stderr: "ORA-01017", ExitCode: 1}, exec.CodeExitError{Err: errors.New("command terminated with exit code 1"), Code: 1}
+				}
+				return CommandResult{}, nil
+			}
+			spec := validSpec
+			spec.Overrides = []operatorv1.ObjectOverride{{Kind: "StatefulSet", Patch: "metadata: {annotations: {team: apex}}"}}
+			req := createApexOrds(spec)
+			_, err := newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			apexords := fetch(req)
+			Expect(meta.FindStatusCondition(apexords.Status.Conditions, operatorv1.ConditionFailed).Reason).To(Equal(ReasonApexInstallFailed))
+			Expect(apexords.Status.OverridesHash).To(Equal(OverridesHash(spec.Overrides)))
+
+			//the statefulset has the first overrides,the new ones would never reach it
+			apexords.Spec.Overrides[0].Patch = "metadata: {annotations: {team: ords}}"
+			Expect(k8sClient.Update(ctx, apexords)).To(Succeed())
+			_, err = newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			apexords = fetch(req)
+			Expect(apexords.Status.Phase).To(Equal(operatorv1.PhaseFailed))
+			Expect(meta.FindStatusCondition(apexords.Status.Conditions, operatorv1.ConditionFailed).Reason).To(Equal(ReasonOverridesChanged))
+			Expect(runner.Commands).To(HaveLen(1))
+		})
+
+		It("stops a hung command after the exec timeout of its step and releases the DB", func() {
+			saved := ExecTimeouts[StepApex]
+			ExecTimeouts[StepApex] = 200 * time.Millisecond
+			defer func() { ExecTimeouts[StepApex] = saved }()
+			runner.Block = func(cmd FakeCommand) bool {
+				return strings.Contains(cmd.Command[2], "@createapex.sql\n")
+			}
+			req := createApexOrds(validSpec)
+			done := make(chan error, 1)
+			go func() {
+				defer GinkgoRecover()
+				_, err := newReconciler(k8sClient).Reconcile(ctx, req)
+				done <- err
+			}()
+			var err error
+			Eventually(done, 5*time.Second).Should(Receive(&err))
+			Expect(errors.Is(err, context.DeadlineExceeded)).To(BeTrue())
+			Expect(IsRetryable(err)).To(BeTrue())
+			apexords := fetch(req)
+			failed := meta.FindStatusCondition(apexords.Status.Conditions, operatorv1.ConditionFailed)
+			Expect(failed.Reason).To(Equal(ReasonApexInstallFailed))
+			Expect(failed.Message).To(ContainSubstring("command in testcdb-apexords-sqlpluspod didn't finish within 200ms"))
+
+			By("stopping a hung command when the reconcile is cancelled")
+			ExecTimeouts[StepApex] = time.Hour
+			cancelCtx, cancel := context.WithCancel(ctx)
+			go func() {
+				defer GinkgoRecover()
+				_, err := newReconciler(k8sClient).Reconcile(cancelCtx, req)
+				done <- err
+			}()
+			Eventually(func() int {
+				runner.mu.Lock()
+				defer runner.mu.Unlock()
+				return len(runner.Commands)
+			}).Should(Equal(2))
+			cancel()
+			Eventually(done, 5*time.Second).Should(Receive(&err))
+			Expect(errors.Is(err, context.Canceled)).To(BeTrue())
+
+			By("running the install once the command returns,the DB is not locked anymore")
+			runner.Block = nil
+			_, err = newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fetch(req).Status.Phase).To(Equal(operatorv1.PhaseReady))
+		})
+
+		It("rejects a change of the settings of the DB after a failed install", func() {
+			runner.Results = func(cmd FakeCommand) (CommandResult, error) {
+				if strings.Contains(cmd.Command[2], "@createapex.sql\n") {
+					return CommandResult{Stderr: "ORA-01017", ExitCode: 1}, exec.CodeExitError{Err: errors.New("command terminated with exit code 1"), Code: 1}
+				}
+				return CommandResult{}, nil
+			}
+			spec := validSpec
+			spec.Database = &operatorv1.DatabaseSpec{EnableArchiveLog: true}
+			req := createApexOrds(spec)
+			_, err := newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			apexords := fetch(req)
+			Expect(apexords.Status.DatabaseCreation).To(Equal(&operatorv1.DatabaseCreation{EnableArchiveLog: true}))
+
+			apexords.Spec.Database.EnableArchiveLog = false
+			Expect(k8sClient.Update(ctx, apexords)).To(Succeed())
+			_, err = newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			apexords = fetch(req)
+			failed := meta.FindStatusCondition(apexords.Status.Conditions, operatorv1.ConditionFailed)
+			Expect(failed.Reason).To(Equal(ReasonInvalidSpec))
+			Expect(failed.Message).To(ContainSubstring("database enablearchivelog can't change"))
+			Expect(runner.Commands).To(HaveLen(1))
+		})
+
+		It("rejects a change of the settings the DB was created with", func() {
+			spec := validSpec
+			spec.Database = &operatorv1.DatabaseSpec{CharacterSet: "al32utf8", Edition: operatorv1.DbEditionSE2}
+			req := createApexOrds(spec)
+			_, err := newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			apexords := fetch(req)
+			Expect(apexords.Status.Phase).To(Equal(operatorv1.PhaseReady))
+			Expect(apexords.Status.DatabaseCreation).To(Equal(&operatorv1.DatabaseCreation{CharacterSet: "al32utf8", Edition: operatorv1.DbEditionSE2}))
+
+			//the image takes the character set in any case
+			apexords.Spec.Database.CharacterSet = "AL32UTF8"
+			Expect(k8sClient.Update(ctx, apexords)).To(Succeed())
+			_, err = newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			apexords = fetch(req)
+			Expect(apexords.Status.Phase).To(Equal(operatorv1.PhaseReady))
+
+			apexords.Spec.Database.Edition = operatorv1.DbEditionEE
+			apexords.Spec.Database.EnableArchiveLog = true
+			Expect(k8sClient.Update(ctx, apexords)).To(Succeed())
+			_, err = newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			apexords = fetch(req)
+			Expect(apexords.Status.Phase).To(Equal(operatorv1.PhaseFailed))
+			failed := meta.FindStatusCondition(apexords.Status.Conditions, operatorv1.ConditionFailed)
+			Expect(failed.Reason).To(Equal(ReasonInvalidSpec))
+			Expect(failed.Message).To(ContainSubstring("database edition,enablearchivelog can't change"))
+			sts := &appsv1.StatefulSet{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testcdb-apexords-db-sts"}, sts)).To(Succeed())
+			Expect(sts.Spec.Template.Spec.Containers[0].Env).To(ContainElement(corev1.EnvVar{Name: "ORACLE_EDITION", Value: "standard"}))
+
+			//setting them back is reconciled as before
+			apexords.Spec.Database.Edition = operatorv1.DbEditionSE2
+			apexords.Spec.Database.EnableArchiveLog = false
+			Expect(k8sClient.Update(ctx, apexords)).To(Succeed())
+			_, err = newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fetch(req).Status.Phase).To(Equal(operatorv1.PhaseReady))
+		})
+
+		It("only observes a paused ApexOrds", func() {
+			req := createApexOrds(validSpec)
+			_, err := newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testords-apexords-ords-deployment"}, deployment)).To(Succeed())
+			deployment.Status.Replicas, deployment.Status.ReadyReplicas = 1, 1
+			Expect(k8sClient.Status().Update(ctx, deployment)).To(Succeed())
+			for len(recorder.Events) > 0 {
+				<-recorder.Events
+			}
+
+			apexords := fetch(req)
+			apexords.ObjectMeta.Annotations = map[string]string{operatorv1.PausedAnnotation: "true", operatorv1.RotatePasswordsAnnotation: "2026-10-19"}
+			apexords.Spec.Maintenance = true
+			Expect(k8sClient.Update(ctx, apexords)).To(Succeed())
+			result, err := newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(PausedResyncInterval))
+
+			Expect(runner.Commands).To(HaveLen(4))
+			Expect(apierrors.IsNotFound(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testords-apexords-maintenance-deployment"}, &appsv1.Deployment{}))).To(BeTrue())
+			apexords = fetch(req)
+			Expect(meta.IsStatusConditionTrue(apexords.Status.Conditions, operatorv1.ConditionPaused)).To(BeTrue())
+			Expect(apexords.Status.OrdsReadyReplicas).To(Equal(int32(1)))
+			Expect(apexords.Status.PasswordsRotation).To(BeEmpty())
+			Expect(recorder.Events).To(Receive(ContainSubstring(ReasonPaused)))
+
+			//spec.paused pauses as well,removing both resumes
+			apexords.ObjectMeta.Annotations = map[string]string{operatorv1.RotatePasswordsAnnotation: "2026-10-19"}
+			apexords.Spec.Paused = true
+			apexords.Spec.Maintenance = false
+			Expect(k8sClient.Update(ctx, apexords)).To(Succeed())
+			_, err = newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(runner.Commands).To(HaveLen(4))
+
+			apexords = fetch(req)
+			apexords.Spec.Paused = false
+			Expect(k8sClient.Update(ctx, apexords)).To(Succeed())
+			_, err = newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(runner.Commands).To(HaveLen(5))
+			apexords = fetch(req)
+			paused := meta.FindStatusCondition(apexords.Status.Conditions, operatorv1.ConditionPaused)
+			Expect(paused.Status).To(Equal(metav1.ConditionFalse))
+			Expect(paused.Reason).To(Equal(ReasonResumed))
+			Expect(apexords.Status.PasswordsRotation).To(Equal("2026-10-19"))
+		})
+
+		It("serves the maintenance page while Ords is scaled to zero and switches back once Ords is ready", func() {
+			spec := validSpec
+			spec.Maintenance = true
+			spec.MaintenancePage = "<h1>Back at 10</h1>"
+			req := createApexOrds(spec)
+			result, err := newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(MaintenancePollInterval))
+
+			configmap := &corev1.ConfigMap{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testords-apexords-maintenance-cm"}, configmap)).To(Succeed())
+			Expect(configmap.Data).To(HaveKeyWithValue("maintenance.html", "<h1>Back at 10</h1>"))
+			Expect(configmap.Data["users-define.conf"]).To(ContainSubstring("ErrorDocument 503 /maintenance.html"))
+			Expect(configmap.Data["users-define.conf"]).NotTo(ContainSubstring("ProxyPass"))
+			maintenance := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testords-apexords-maintenance-deployment"}, maintenance)).To(Succeed())
+			Expect(maintenance.Spec.Template.Spec.Containers).To(HaveLen(1))
+			Expect(maintenance.Spec.Template.Spec.Containers[0].Name).To(Equal("httpd"))
+			Expect(maintenance.Spec.Template.Spec.Volumes).To(HaveLen(1))
+			Expect(maintenance.Spec.Template.Spec.Volumes[0].ConfigMap.Name).To(Equal("testords-apexords-maintenance-cm"))
+			Expect(maintenance.ObjectMeta.OwnerReferences).To(HaveLen(1))
+
+			//the services keep Ords until the maintenance pods are ready
+			service := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testords-apexords-svc"}, service)).To(Succeed())
+			Expect(service.Spec.Selector).To(Equal(OrdsSelector(fetch(req))))
+			maintenance.Status.Replicas, maintenance.Status.ReadyReplicas = 1, 1
+			Expect(k8sClient.Status().Update(ctx, maintenance)).To(Succeed())
+			result, err = newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeZero())
+
+			for _, name := range []string{"testords-apexords-svc", "testords-apexords-nodeport-svc"} {
+				Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, service)).To(Succeed())
+				Expect(service.Spec.Selector).To(Equal(maintenance.Spec.Selector.MatchLabels), name)
+			}
+			ords := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testords-apexords-ords-deployment"}, ords)).To(Succeed())
+			Expect(*ords.Spec.Replicas).To(BeZero())
+			Expect(ords.ObjectMeta.Annotations).To(HaveKeyWithValue(OrdsReplicasAnnotation, "1"))
+			apexords := fetch(req)
+			Expect(meta.IsStatusConditionTrue(apexords.Status.Conditions, operatorv1.ConditionMaintenance)).To(BeTrue())
+			Expect(apexords.Status.Phase).To(Equal(operatorv1.PhaseReady))
+
+			//a new page rolls the maintenance pods
+			oldhash := maintenance.Spec.Template.ObjectMeta.Annotations[MaintenancePageHashAnnotation]
+			apexords.Spec.MaintenancePage = "<h1>Back at 11</h1>"
+			Expect(k8sClient.Update(ctx, apexords)).To(Succeed())
+			_, err = newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(configmap), configmap)).To(Succeed())
+			Expect(configmap.Data).To(HaveKeyWithValue("maintenance.html", "<h1>Back at 11</h1>"))
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(maintenance), maintenance)).To(Succeed())
+			Expect(maintenance.Spec.Template.ObjectMeta.Annotations[MaintenancePageHashAnnotation]).NotTo(Equal(oldhash))
+
+			//Ords is scaled back and serves the services once its pods are ready
+			apexords = fetch(req)
+			apexords.Spec.Maintenance = false
+			Expect(k8sClient.Update(ctx, apexords)).To(Succeed())
+			result, err = newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(MaintenancePollInterval))
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(ords), ords)).To(Succeed())
+			Expect(*ords.Spec.Replicas).To(Equal(int32(1)))
+			Expect(ords.ObjectMeta.Annotations).NotTo(HaveKey(OrdsReplicasAnnotation))
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testords-apexords-svc"}, service)).To(Succeed())
+			Expect(service.Spec.Selector).To(Equal(maintenance.Spec.Selector.MatchLabels))
+
+			ords.Status.Replicas, ords.Status.ReadyReplicas = 1, 1
+			Expect(k8sClient.Status().Update(ctx, ords)).To(Succeed())
+			result, err = newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeZero())
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testords-apexords-svc"}, service)).To(Succeed())
+			Expect(service.Spec.Selector).To(Equal(OrdsSelector(apexords)))
+			Expect(apierrors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(maintenance), &appsv1.Deployment{}))).To(BeTrue())
+			Expect(apierrors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(configmap), &corev1.ConfigMap{}))).To(BeTrue())
+			apexords = fetch(req)
+			finished := meta.FindStatusCondition(apexords.Status.Conditions, operatorv1.ConditionMaintenance)
+			Expect(finished.Status).To(Equal(metav1.ConditionFalse))
+			Expect(finished.Reason).To(Equal(ReasonMaintenanceFinished))
+			Expect(apexords.Status.OrdsReadyReplicas).To(Equal(int32(1)))
+			Expect(runner.Commands).To(HaveLen(4))
+		})
+
+		It("records the Apex and Ords versions", func() {
+			runner.Results = func(cmd FakeCommand) (CommandResult, error) {
+				switch {
+				case strings.Contains(cmd.Command[2], "apex_release"):
+					return CommandResult{Stdout: "APEXORDSVERSION:19.1.0.00.15\n"}, nil
+				case strings.Contains(cmd.Command[2], "ords.war version"):
+					return CommandResult{Stdout: "Completed\nAPEXORDSVERSION:Oracle REST Data Services 19.4.0.r3521226\n"}, nil
+				}
+				return CommandResult{}, nil
+			}
+			req := createApexOrds(validSpec)
+			_, err := newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			apexords := fetch(req)
+			Expect(apexords.Status.ApexVersion).To(Equal("19.1.0.00.15"))
+			Expect(apexords.Status.OrdsVersion).To(Equal("19.4.0.r3521226"))
+		})
+
+		It("pulls every image from the private registry with the pull secrets of the ApexOrds", func() {
+			saved := Images
+			Images = ImageConfig{
+				Registry: "registry.example.com/mirror",
+				Digests:  map[string]string{OrdsImage: "sha256:0123"},
+			}
+			defer func() { Images = saved }()
+			pods := map[string]*corev1.Pod{}
+			runner.Results = func(cmd FakeCommand) (CommandResult, error) {
+				pod := &corev1.Pod{}
+				Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: cmd.Namespace, Name: cmd.Podname}, pod)).To(Succeed())
+				pods[cmd.Podname] = pod
+				return CommandResult{}, nil
+			}
+			spec := validSpec
+			spec.ImagePullSecrets = []corev1.LocalObjectReference{{Name: "mirror-secret"}}
+			spec.Database = &operatorv1.DatabaseSpec{
+				Image:            "container-registry.oracle.com/database/enterprise:19.3.0.0",
+				ImagePullSecrets: []corev1.LocalObjectReference{{Name: "oracle-secret"}, {Name: "mirror-secret"}},
+			}
+			req := createApexOrds(spec)
+			_, err := newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			secrets := []corev1.LocalObjectReference{{Name: "oracle-secret"}, {Name: "mirror-secret"}}
+			sts := &appsv1.StatefulSet{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testcdb-apexords-db-sts"}, sts)).To(Succeed())
+			Expect(sts.Spec.Template.Spec.Containers[0].Image).To(Equal("registry.example.com/mirror/database/enterprise:19.3.0.0"))
+			Expect(sts.Spec.Template.Spec.ImagePullSecrets).To(Equal(secrets))
+
+			Expect(pods["testcdb-apexords-sqlpluspod"].Spec.Containers[0].Image).To(Equal("registry.example.com/mirror/henryxie/apexords-operator-instantclient-apex19:v1"))
+			Expect(pods["testcdb-apexords-sqlpluspod"].Spec.ImagePullSecrets).To(Equal(secrets))
+			Expect(pods["testords-apexords-ordspod"].Spec.Containers[0].Image).To(Equal("registry.example.com/mirror/henryxie/apexords-operator-apexords@sha256:0123"))
+			Expect(pods["testords-apexords-ordspod"].Spec.ImagePullSecrets).To(Equal(secrets))
+
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testords-apexords-ords-deployment"}, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.Spec.Containers[0].Image).To(Equal("registry.example.com/mirror/henryxie/apexords-operator-apexords@sha256:0123"))
+			Expect(deployment.Spec.Template.Spec.Containers[1].Image).To(Equal("registry.example.com/mirror/henryxie/apexords-operator-oel-httpd:v4"))
+			Expect(deployment.Spec.Template.Spec.ImagePullSecrets).To(Equal(secrets))
+		})
+
+		It("keeps the passwords in a secret instead of the commands", func() {
+			var sqlplusenv []corev1.EnvVar
+			runner.Results = func(cmd FakeCommand) (CommandResult, error) {
+				pod := &corev1.Pod{}
+				if err := k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: cmd.Podname}, pod); err == nil && cmd.Podname == "testcdb-apexords-sqlpluspod" {
+					sqlplusenv = pod.Spec.Containers[0].Env
+				}
+				return CommandResult{}, nil
+			}
+			req := createApexOrds(validSpec)
+
+			_, err := newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			for _, cmd := range runner.Commands {
+				Expect(strings.Join(cmd.Command, " ")).NotTo(ContainSubstring(dbpassword))
+			}
+			for len(recorder.Events) > 0 {
+				Expect(<-recorder.Events).NotTo(ContainSubstring(dbpassword))
+			}
+
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testords-apexords-credentials"}, secret)).To(Succeed())
+			Expect(secret.Data).To(HaveKeyWithValue(CredentialsSysPasswordKey, []byte(dbpassword)))
+			Expect(secret.Data).To(HaveKeyWithValue(CredentialsPublicPasswordKey, []byte(dbpassword)))
+			//the admin password is random,not derived from the names
+			adminpassword := string(secret.Data[CredentialsApexAdminPasswordKey])
+			Expect(adminpassword).To(HaveLen(17))
+			Expect(adminpassword).To(HaveSuffix("#"))
+			Expect(adminpassword).NotTo(ContainSubstring(dbpassword))
+			Expect(secret.OwnerReferences).To(HaveLen(1))
+			Expect(secret.OwnerReferences[0].Name).To(Equal("apexords-test"))
+
+			Expect(sqlplusenv).To(HaveLen(2))
+			Expect(sqlplusenv[0].Name).To(Equal("SYS_PASSWORD"))
+			Expect(sqlplusenv[0].Value).To(BeEmpty())
+			Expect(sqlplusenv[0].ValueFrom.SecretKeyRef.Name).To(Equal("testords-apexords-credentials"))
+			Expect(sqlplusenv[1].ValueFrom.SecretKeyRef.Key).To(Equal(CredentialsApexAdminPasswordKey))
+		})
+
+		It("keeps an Apex admin password set in the credentials secret", func() {
+			Expect(k8sClient.Create(ctx, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "testords-apexords-credentials", Namespace: namespace},
+				StringData: map[string]string{CredentialsApexAdminPasswordKey: "Chosen#Admin1"},
+			})).To(Succeed())
+			req := createApexOrds(validSpec)
+
+			_, err := newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testords-apexords-credentials"}, secret)).To(Succeed())
+			Expect(secret.Data).To(HaveKeyWithValue(CredentialsApexAdminPasswordKey, []byte("Chosen#Admin1")))
+			Expect(secret.Data).To(HaveKeyWithValue(CredentialsSysPasswordKey, []byte(dbpassword)))
+		})
+
+		It("creates the DB with the sys password of database.credentials and follows its new versions", func() {
+			usersecret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "oradb-sys", Namespace: namespace},
+				StringData: map[string]string{"password": "Vaulted#Sys1"},
+			}
+			Expect(k8sClient.Create(ctx, usersecret)).To(Succeed())
+			spec := validSpec
+			spec.Database = &operatorv1.DatabaseSpec{
+				Credentials: &operatorv1.DatabaseCredentials{SecretName: "oradb-sys", Key: "password"},
+			}
+			req := createApexOrds(spec)
+
+			_, err := newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(runner.Commands).To(HaveLen(4))
+
+			sts := &appsv1.StatefulSet{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testcdb-apexords-db-sts"}, sts)).To(Succeed())
+			var oraclepwd *corev1.EnvVar
+			for i, env := range sts.Spec.Template.Spec.Containers[0].Env {
+				if env.Name == "ORACLE_PWD" {
+					oraclepwd = &sts.Spec.Template.Spec.Containers[0].Env[i]
+				}
+			}
+			Expect(oraclepwd).NotTo(BeNil())
+			Expect(oraclepwd.Value).To(BeEmpty())
+			Expect(oraclepwd.ValueFrom.SecretKeyRef.Name).To(Equal("testords-apexords-credentials"))
+			Expect(oraclepwd.ValueFrom.SecretKeyRef.Key).To(Equal(CredentialsSysPasswordKey))
+
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testords-apexords-credentials"}, secret)).To(Succeed())
+			Expect(secret.Data).To(HaveKeyWithValue(CredentialsSysPasswordKey, []byte("Vaulted#Sys1")))
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(usersecret), usersecret)).To(Succeed())
+			apexords := fetch(req)
+			Expect(apexords.Status.CredentialsVersion).To(Equal(usersecret.ObjectMeta.ResourceVersion))
+			Expect(apexords.Status.Phase).To(Equal(operatorv1.PhaseReady))
+
+			usersecret.Data = map[string][]byte{"password": []byte("Vaulted#Sys2")}
+			Expect(k8sClient.Update(ctx, usersecret)).To(Succeed())
+			_, err = newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(runner.Commands).To(HaveLen(5))
+			script := runner.Scripts()[4]
+			Expect(script).To(ContainSubstring("alter user sys identified by \"&new_sys_password\" container=all;"))
+			Expect(script).To(ContainSubstring("@testcdb-apexords-db-svc:1521/testcdb as sysdba"))
+			Expect(script).NotTo(ContainSubstring("Vaulted#Sys"))
+			secret = &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testords-apexords-credentials"}, secret)).To(Succeed())
+			Expect(secret.Data).To(HaveKeyWithValue(CredentialsSysPasswordKey, []byte("Vaulted#Sys2")))
+			Expect(secret.Data).NotTo(HaveKey(CredentialsNewSysPasswordKey))
+			apexords = fetch(req)
+			Expect(apexords.Status.CredentialsVersion).To(Equal(usersecret.ObjectMeta.ResourceVersion))
+
+			//the same version does not change the password again
+			_, err = newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(runner.Commands).To(HaveLen(5))
+		})
+
+		It("rotates the passwords once per annotation value and rolls Ords with the new public password", func() {
+			var rotationenv []corev1.EnvVar
+			runner.Results = func(cmd FakeCommand) (CommandResult, error) {
+				pod := &corev1.Pod{}
+				if strings.Contains(cmd.Command[2], "&new_apex_admin_password") && k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: cmd.Podname}, pod) == nil {
+					rotationenv = pod.Spec.Containers[0].Env
+				}
+				return CommandResult{}, nil
+			}
+			req := createApexOrds(validSpec)
+			_, err := newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(runner.Commands).To(HaveLen(4))
+
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testords-apexords-credentials"}, secret)).To(Succeed())
+			oldadmin := string(secret.Data[CredentialsApexAdminPasswordKey])
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testords-apexords-ords-deployment"}, deployment)).To(Succeed())
+			oldhash := deployment.Spec.Template.ObjectMeta.Annotations[OrdsPasswordHashAnnotation]
+			Expect(oldhash).NotTo(BeEmpty())
+			Expect(*deployment.Spec.Strategy.RollingUpdate.MaxUnavailable).To(Equal(intstr.FromInt(0)))
+			Expect(deployment.Spec.Template.Spec.Containers[0].ReadinessProbe).NotTo(BeNil())
+
+			apexords := fetch(req)
+			apexords.ObjectMeta.Annotations = map[string]string{operatorv1.RotatePasswordsAnnotation: "2026-10-19"}
+			Expect(k8sClient.Update(ctx, apexords)).To(Succeed())
+			_, err = newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(runner.Commands).To(HaveLen(5))
+			script := runner.Scripts()[4]
+			Expect(script).To(ContainSubstring("alter user ' || u.username || ' identified by \"&new_public_password\" account unlock"))
+			Expect(script).To(ContainSubstring("'APEX_PUBLIC_USER', 'APEX_LISTENER', 'APEX_REST_PUBLIC_USER', 'ORDS_PUBLIC_USER'"))
+			Expect(script).To(ContainSubstring("alter user ' || u.username || ' profile APEXORDS_PUBLIC"))
+			Expect(script).To(ContainSubstring("alter profile APEXORDS_PUBLIC limit password_rollover_time 1"))
+			Expect(script).To(ContainSubstring("@apxchpwd-silent-admin.sql &new_apex_admin_password"))
+			Expect(script).To(ContainSubstring("\"$NEW_PUBLIC_PASSWORD\""))
+			Expect(rotationenv).To(HaveLen(4))
+			Expect(rotationenv[3].Name).To(Equal("NEW_PUBLIC_PASSWORD"))
+			Expect(rotationenv[3].ValueFrom.SecretKeyRef.Key).To(Equal(CredentialsNewPublicPasswordKey))
+
+			secret = &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testords-apexords-credentials"}, secret)).To(Succeed())
+			Expect(secret.Data).NotTo(HaveKey(CredentialsNewApexAdminPasswordKey))
+			Expect(secret.Data).NotTo(HaveKey(CredentialsNewPublicPasswordKey))
+			Expect(secret.Data).To(HaveKeyWithValue(CredentialsSysPasswordKey, []byte(dbpassword)))
+			Expect(string(secret.Data[CredentialsApexAdminPasswordKey])).NotTo(Equal(oldadmin))
+			public := string(secret.Data[CredentialsPublicPasswordKey])
+			Expect(public).NotTo(Equal(dbpassword))
+			for _, script := range runner.Scripts() {
+				Expect(script).NotTo(ContainSubstring(public))
+			}
+
+			ordssecret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testords-apexords-ords-secret"}, ordssecret)).To(Succeed())
+			Expect(string(ordssecret.Data["apex_pu.xml"])).To(ContainSubstring(`<entry key="db.password">` + public + `</entry>`))
+			Expect(string(ordssecret.Data["ords_params.properties"])).To(ContainSubstring("sys.password=" + dbpassword + "\n"))
+			deployment = &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testords-apexords-ords-deployment"}, deployment)).To(Succeed())
+			Expect(deployment.Spec.Template.ObjectMeta.Annotations[OrdsPasswordHashAnnotation]).NotTo(Equal(oldhash))
+
+			apexords = fetch(req)
+			Expect(apexords.Status.PasswordsRotation).To(Equal("2026-10-19"))
+			Expect(apexords.Status.PasswordsRotatedAt).NotTo(BeNil())
+			Expect(apexords.Status.PasswordsRollover).To(Equal("2026-10-19"))
+			Expect(apexords.Status.Phase).To(Equal(operatorv1.PhaseReady))
+
+			//the same annotation value does not rotate again
+			_, err = newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(runner.Commands).To(HaveLen(5))
+		})
+
+		It("keeps the old public password until the Ords pods use the new one and leaves no public user locked", func() {
+			//ORDS_PUBLIC_USER of a DB before 19.12,the old Ords pods fail to log in once it has the new password
+			failed, unlimited, locked := 0, false, false
+			oldLogin := func() {
+				failed++
+				if !unlimited && failed >= 10 {
+					locked = true
+				}
+			}
+			runner.Results = func(cmd FakeCommand) (CommandResult, error) {
+				script := cmd.Command[2]
+				if strings.Contains(script, "limit failed_login_attempts unlimited") {
+					unlimited = true
+				}
+				if strings.Contains(script, "' account unlock'") || strings.Contains(script, "\" account unlock'") {
+					failed, locked = 0, false
+				}
+				if strings.Contains(script, "expire password rollover period") && strings.Contains(script, "limit failed_login_attempts 10'") {
+					unlimited = false
+				}
+				return CommandResult{}, nil
+			}
+			req := createApexOrds(validSpec)
+			_, err := newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(runner.Commands).To(HaveLen(4))
+			//as after a rotation without rollover,ORA-28000
+			for i := 0; i < 10; i++ {
+				oldLogin()
+			}
+			Expect(locked).To(BeTrue())
+
+			By("unlocking the user and counting no failed logins while the old Ords pods run")
+			apexords := fetch(req)
+			apexords.ObjectMeta.Annotations = map[string]string{operatorv1.RotatePasswordsAnnotation: "2026-10-19"}
+			Expect(k8sClient.Update(ctx, apexords)).To(Succeed())
+			result, err := newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(RolloverPollInterval))
+			Expect(runner.Commands).To(HaveLen(5))
+			Expect(locked).To(BeFalse())
+			for i := 0; i < 20; i++ {
+				oldLogin()
+			}
+			Expect(locked).To(BeFalse())
+
+			By("keeping the old password until the new ReplicaSet is available")
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testords-apexords-ords-deployment"}, deployment)).To(Succeed())
+			deployment.Status.ObservedGeneration = deployment.ObjectMeta.Generation
+			deployment.Status.Replicas, deployment.Status.UpdatedReplicas = 2, 1
+			deployment.Status.ReadyReplicas, deployment.Status.AvailableReplicas = 2, 1
+			Expect(k8sClient.Status().Update(ctx, deployment)).To(Succeed())
+			result, err = newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(RolloverPollInterval))
+			Expect(runner.Commands).To(HaveLen(5))
+			Expect(fetch(req).Status.PasswordsRollover).To(Equal("2026-10-19"))
+
+			By("expiring the old password and unlocking the users once the old pods are gone")
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testords-apexords-ords-deployment"}, deployment)).To(Succeed())
+			rollOut(deployment)
+			//locked anyway,ie by another client with the old password
+			locked = true
+			result, err = newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(BeZero())
+			Expect(runner.Commands).To(HaveLen(6))
+			script := runner.Scripts()[5]
+			Expect(script).To(ContainSubstring("alter user ' || u.username || ' expire password rollover period"))
+			Expect(script).To(ContainSubstring("if sqlcode != -922 then"))
+			Expect(script).To(ContainSubstring("alter user ' || u.username || ' account unlock"))
+			Expect(script).To(ContainSubstring("alter profile APEXORDS_PUBLIC limit failed_login_attempts 10"))
+			Expect(locked).To(BeFalse())
+			Expect(unlimited).To(BeFalse())
+			apexords = fetch(req)
+			Expect(apexords.Status.PasswordsRollover).To(BeEmpty())
+			Expect(apexords.Status.Phase).To(Equal(operatorv1.PhaseReady))
+			var events []string
+			for len(recorder.Events) > 0 {
+				events = append(events, <-recorder.Events)
+			}
+			Expect(events).To(ContainElement(ContainSubstring(ReasonPasswordsRolledOver)))
+
+			//the rollover is finished once
+			_, err = newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(runner.Commands).To(HaveLen(6))
+		})
+
+		It("keeps the current passwords and retries with the same new ones when a rotation fails", func() {
+			req := createApexOrds(validSpec)
+			_, err := newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			runner.Results = func(cmd FakeCommand) (CommandResult, error) {
+				if strings.Contains(cmd.Command[2], "&new_apex_admin_password") {
+					return CommandResult{Stdout: "ORA-12541: TNS:no listener\n"}, exec.CodeExitError{Err: errors.New("command terminated with exit code 1"), Code: 1}
+				}
+				return CommandResult{}, nil
+			}
+			apexords := fetch(req)
+			apexords.ObjectMeta.Annotations = map[string]string{operatorv1.RotatePasswordsAnnotation: "now"}
+			Expect(k8sClient.Update(ctx, apexords)).To(Succeed())
+			_, err = newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(IsRetryable(err)).To(BeTrue())
+
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testords-apexords-credentials"}, secret)).To(Succeed())
+			Expect(secret.Data).To(HaveKeyWithValue(CredentialsPublicPasswordKey, []byte(dbpassword)))
+			newpublic := secret.Data[CredentialsNewPublicPasswordKey]
+			Expect(newpublic).NotTo(BeEmpty())
+			Expect(fetch(req).Status.PasswordsRotation).To(BeEmpty())
+
+			runner.Results = nil
+			_, err = newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			secret = &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testords-apexords-credentials"}, secret)).To(Succeed())
+			Expect(secret.Data).To(HaveKeyWithValue(CredentialsPublicPasswordKey, newpublic))
+			Expect(fetch(req).Status.PasswordsRotation).To(Equal("now"))
+		})
+
+		It("connects over TCPS with the wallet", func() {
+			var sqlpluspod corev1.PodSpec
+			runner.Results = func(cmd FakeCommand) (CommandResult, error) {
+				pod := &corev1.Pod{}
+				if err := k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: cmd.Podname}, pod); err == nil && cmd.Podname == "testcdb-apexords-sqlpluspod" {
+					sqlpluspod = pod.Spec
+				}
+				return CommandResult{}, nil
+			}
+			spec := validSpec
+			spec.Database = &operatorv1.DatabaseSpec{TLS: &operatorv1.DatabaseTLS{WalletSecret: "testcdb-wallet", Host: "db.example.com"}}
+			req := createApexOrds(spec)
+
+			_, err := newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+
+			descriptor := "(DESCRIPTION=(ADDRESS=(PROTOCOL=TCPS)(HOST=db.example.com)(PORT=2484))(CONNECT_DATA=(SERVICE_NAME=testpdb)))"
+			Expect(runner.Commands[0].Command[2]).To(ContainSubstring("connect sys/\"%s\"@" + descriptor + " as sysdba"))
+			Expect(sqlpluspod.Volumes).To(HaveLen(1))
+			Expect(sqlpluspod.Volumes[0].Secret.SecretName).To(Equal("testcdb-wallet"))
+			Expect(sqlpluspod.Containers[0].Env).To(ContainElement(corev1.EnvVar{Name: "TNS_ADMIN", Value: WalletMountPath}))
+
+			dbsvc := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testcdb-apexords-db-svc"}, dbsvc)).To(Succeed())
+			Expect(dbsvc.Spec.Ports).To(HaveLen(1))
+
+			ordscm := &corev1.ConfigMap{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testords-apexords-ords-cm"}, ordscm)).To(Succeed())
+			Expect(ordscm.Data["defaults.xml"]).To(ContainSubstring(`<entry key="db.customURL">jdbc:oracle:thin:@` + descriptor + `</entry>`))
+			ordssecret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testords-apexords-ords-secret"}, ordssecret)).To(Succeed())
+			Expect(string(ordssecret.Data["ords_params.properties"])).To(ContainSubstring("db.connectionType=customurl\n"))
+
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testords-apexords-ords-deployment"}, deployment)).To(Succeed())
+			ords := deployment.Spec.Template.Spec.Containers[0]
+			Expect(ords.Name).To(Equal("ords"))
+			Expect(ords.VolumeMounts).To(ContainElement(corev1.VolumeMount{Name: "db-wallet", MountPath: WalletMountPath, ReadOnly: true}))
+			Expect(deployment.Spec.Template.Spec.Containers[1].VolumeMounts).To(HaveLen(1))
+		})
+
+		It("installs Ords in the PDB of each pool and routes requests to them", func() {
+			var ordspod corev1.PodSpec
+			runner.Results = func(cmd FakeCommand) (CommandResult, error) {
+				pod := &corev1.Pod{}
+				if err := k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: cmd.Podname}, pod); err == nil && cmd.Podname == "testords-apexords-ordspod" {
+					ordspod = pod.Spec
+				}
+				return CommandResult{}, nil
+			}
+			Expect(k8sClient.Create(ctx, &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "sales-pool", Namespace: namespace},
+				StringData: map[string]string{OrdsPoolPasswordKey: "Sales#Pool1"},
+			})).To(Succeed())
+			spec := validSpec
+			spec.Ords = &operatorv1.OrdsSpec{Pools: []operatorv1.OrdsPool{
+				{Name: "sales", Dbservice: "salespdb", CredentialsSecret: "sales-pool", PathPrefix: "/sales"},
+				{Name: "hr", Dbservice: "hrpdb", Host: "hr.example.com"},
+			}}
+			req := createApexOrds(spec)
+
+			_, err := newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(fetch(req).Status.Phase).To(Equal(operatorv1.PhaseReady))
+
+			scripts := runner.Scripts()
+			Expect(scripts).To(HaveLen(6))
+			Expect(scripts[3]).To(Equal(ordsinstall))
+			Expect(scripts[4]).To(Equal("cp /mnt/k8s/sales_params.properties /tmp/sales_params.properties;java -jar /opt/oracle/ords/ords.war setup --database sales --parameterFile /tmp/sales_params.properties --silent"))
+			Expect(scripts[5]).To(ContainSubstring("setup --database hr "))
+			for _, script := range scripts {
+				Expect(script).NotTo(ContainSubstring("Sales#Pool1"))
+			}
+			Expect(ordspod.Volumes[0].Projected.Sources[1].Secret.Name).To(Equal("testords-apexords-ords-secret"))
+
+			pools := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testords-apexords-ords-secret"}, pools)).To(Succeed())
+			Expect(pools.Data).To(HaveLen(15))
+			Expect(string(pools.Data["sales_pu.xml"])).To(ContainSubstring(`<entry key="db.password">Sales#Pool1</entry>`))
+			Expect(string(pools.Data["sales_pu.xml"])).To(ContainSubstring(`<entry key="db.servicename">salespdb</entry>`))
+			Expect(string(pools.Data["sales_params.properties"])).To(ContainSubstring("db.servicename=salespdb\n"))
+			Expect(string(pools.Data["sales_params.properties"])).To(ContainSubstring("sys.password=" + dbpassword + "\n"))
+			Expect(string(pools.Data["hr.xml"])).To(ContainSubstring(`<entry key="db.password">` + dbpassword + `</entry>`))
+
+			ordscm := &corev1.ConfigMap{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testords-apexords-ords-cm"}, ordscm)).To(Succeed())
+			Expect(ordscm.Data["url-mapping.xml"]).To(ContainSubstring(`<pool name="sales" base-path="/sales"/>`))
+			Expect(ordscm.Data["url-mapping.xml"]).To(ContainSubstring(`<pool name="hr" base-url="https://hr.example.com/apex/"/>`))
+
+			deployment := &appsv1.Deployment{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testords-apexords-ords-deployment"}, deployment)).To(Succeed())
+			ordsconfig := deployment.Spec.Template.Spec.Volumes[1]
+			Expect(ordsconfig.ConfigMap).To(BeNil())
+			Expect(ordsconfig.Projected.Sources[0].ConfigMap.Name).To(Equal("testords-apexords-ords-cm"))
+			Expect(ordsconfig.Projected.Sources[1].Secret.Name).To(Equal("testords-apexords-ords-secret"))
+		})
+
+		It("requeues while the credentials secret of a pool is missing", func() {
+			spec := validSpec
+			spec.Ords = &operatorv1.OrdsSpec{Pools: []operatorv1.OrdsPool{
+				{Name: "sales", Dbservice: "salespdb", CredentialsSecret: "sales-pool", PathPrefix: "/sales"},
+			}}
+			req := createApexOrds(spec)
+
+			_, err := newReconciler(k8sClient).Reconcile(ctx, req)
+			var stepErr *StepError
+			Expect(errors.As(err, &stepErr)).To(BeTrue())
+			Expect(stepErr.Reason).To(Equal(ReasonSecretNotFound))
+			Expect(stepErr.Retryable).To(BeTrue())
+			Expect(runner.Scripts()).NotTo(ContainElement(ordsinstall))
+		})
+
+		It("connects to a tnsnames.ora alias of the wallet", func() {
+			spec := validSpec
+			spec.Database = &operatorv1.DatabaseSpec{TLS: &operatorv1.DatabaseTLS{WalletSecret: "adb-wallet", TNSAlias: "apexadb_high"}}
+			req := createApexOrds(spec)
+
+			_, err := newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(runner.Commands[0].Command[2]).To(ContainSubstring("connect sys/\"%s\"@apexadb_high as sysdba"))
+
+			dbsvc := &corev1.Service{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testcdb-apexords-db-svc"}, dbsvc)).To(Succeed())
+			Expect(dbsvc.Spec.Ports).To(HaveLen(1))
+		})
+
+		It("installs the Apex runtime only", func() {
+			spec := validSpec
+			spec.Apexruntimeonly = true
+			req := createApexOrds(spec)
+
+			_, err := newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(runner.Scripts()[0]).To(Equal(sqlplus("@createapexruntimeonly.sql")))
+		})
+
+		It("stops at a failed Apex script and removes the sqlplus pod", func() {
+			runner.Results = func(cmd FakeCommand) (CommandResult, error) {
+				if strings.Contains(cmd.Command[2], "@createapex.sql\n") {
+					return CommandResult{Stderr: "ORA-01017", ExitCode: 1}, exec.CodeExitError{Err: errors.New("command terminated with exit code 1"), Code: 1}
+				}
+				return CommandResult{}, nil
+			}
+			req := createApexOrds(validSpec)
+
+			_, err := newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(runner.Commands).To(HaveLen(1))
+
+			apexords := fetch(req)
+			Expect(apexords.Status.Phase).To(Equal(operatorv1.PhaseFailed))
+			Expect(meta.FindStatusCondition(apexords.Status.Conditions, operatorv1.ConditionFailed).Reason).To(Equal(ReasonApexInstallFailed))
+			Expect(meta.IsStatusConditionTrue(apexords.Status.Conditions, operatorv1.ConditionApexInstalled)).To(BeFalse())
+
+			Eventually(func() bool {
+				return apierrors.IsNotFound(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "testcdb-apexords-sqlpluspod"}, &corev1.Pod{}))
+			}).Should(BeTrue())
+		})
+
+		It("fails on ORA- errors printed by a script which exited 0", func() {
+			runner.Results = func(cmd FakeCommand) (CommandResult, error) {
+				if strings.Contains(cmd.Command[2], "@updatepass.sql") {
+					return CommandResult{Stdout: "User altered.\nERROR at line 1:\nORA-01918: user 'APEX_190100' does not exist\nORA-06512: at line 5\n"}, nil
+				}
+				return CommandResult{}, nil
+			}
+			req := createApexOrds(validSpec)
+
+			_, err := newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(runner.Commands).To(HaveLen(2))
+
+			failed := meta.FindStatusCondition(fetch(req).Status.Conditions, operatorv1.ConditionFailed)
+			Expect(failed.Reason).To(Equal(ReasonApexInstallFailed))
+			Expect(failed.Message).To(ContainSubstring("updatepass.sql failed: ORA-01918: user 'APEX_190100' does not exist"))
+			Expect(failed.Message).NotTo(ContainSubstring("ORA-06512"))
+
+			var warning string
+			for len(recorder.Events) > 0 {
+				if event := <-recorder.Events; strings.HasPrefix(event, corev1.EventTypeWarning) {
+					warning = event
+				}
+			}
+			Expect(warning).To(ContainSubstring("ORA-01918"))
+		})
+
+		It("retries while the DB is not open", func() {
+			runner.Results = func(cmd FakeCommand) (CommandResult, error) {
+				return CommandResult{Stdout: "ERROR:\nORA-01033: ORACLE initialization or shutdown in progress\n"}, exec.CodeExitError{Err: errors.New("command terminated with exit code 1"), Code: 1}
+			}
+			req := createApexOrds(validSpec)
+
+			_, err := newReconciler(k8sClient).Reconcile(ctx, req)
+			Expect(err).To(HaveOccurred())
+			Expect(IsRetryable(err)).To(BeTrue())
+			Expect(err.Error()).To(ContainSubstring("ORA-01033"))
+		})
+	})
+
+	Context("waiting for helper pods", func() {
+		var savedTimeout, savedInterval time.Duration
+
+		BeforeEach(func() {
+			savedTimeout, savedInterval = SqlplusPodStartTimeout, PodPollInterval
+			SqlplusPodStartTimeout, PodPollInterval = 300*time.Millisecond, 50*time.Millisecond
+		})
+		AfterEach(func() {
+			SqlplusPodStartTimeout, PodPollInterval = savedTimeout, savedInterval
+		})
+
+		It("returns a retryable timeout when the pod does not start", func() {
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: "unused"}}
+			err := CreateSqlplusPod(k8sClient, req, "sqlpluspod", "testords-apexords-credentials", InlineDatabase(&operatorv1.ApexOrds{Spec: validSpec}))
+			Expect(err).To(HaveOccurred())
+			Expect(AsStepError(StepApex, err).Reason).To(Equal(ReasonPodTimeout))
+			Expect(IsRetryable(err)).To(BeTrue())
+		})
+
+		It("returns a terminal error when the pod failed", func() {
+			req := ctrl.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: "unused"}}
+			Expect(CreateSqlplusPod(k8sClient, req, "sqlpluspod", "testords-apexords-credentials", InlineDatabase(&operatorv1.ApexOrds{Spec: validSpec}))).NotTo(Succeed())
+
+			pod := &corev1.Pod{}
+			Expect(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "sqlpluspod"}, pod)).To(Succeed())
+			pod.Status.Phase = corev1.PodFailed
+			pod.Status.Message = "image pull failed"
+			Expect(k8sClient.Status().Update(ctx, pod)).To(Succeed())
+
+			//the existing pod is reused
+			err := CreateSqlplusPod(k8sClient, req, "sqlpluspod", "testords-apexords-credentials", InlineDatabase(&operatorv1.ApexOrds{Spec: validSpec}))
+			Expect(err).To(HaveOccurred())
+			Expect(AsStepError(StepApex, err).Reason).To(Equal(ReasonPodFailed))
+			Expect(IsRetryable(err)).To(BeFalse())
+		})
+	})
+})
+
+var _ = Describe("ExecError", func() {
+	It("treats a non zero exit code of the script as terminal", func() {
+		err := ExecError(StepApex, ReasonApexInstallFailed, fmt.Errorf("sqlplus: %w", exec.CodeExitError{Err: errors.New("exit 1"), Code: 1}))
+		Expect(err.Retryable).To(BeFalse())
+	})
+
+	It("retries stream and connection errors", func() {
+		err := ExecError(StepApex, ReasonApexInstallFailed, errors.New("connection reset"))
+		Expect(err.Retryable).To(BeTrue())
+		Expect(AsStepError(StepOrds, err)).To(BeIdenticalTo(err))
+	})
+})
+
+var _ = Describe("sqlplus output", func() {
+	It("finds no error in a clean run", func() {
+		Expect(FirstSqlplusError("Session altered.\n\nPL/SQL procedure successfully completed.\n")).To(BeNil())
+	})
+
+	It("parses ORA-, SP2- and PLS- codes in order", func() {
+		output := "SP2-0310: unable to open file \"createapex.sql\"\nORA-06550: line 2, column 3:\nPLS-00201: identifier 'OAUTH.CREATE_CLIENT' must be declared\n"
+		sqlErrs := ParseSqlplusErrors(output)
+		Expect(sqlErrs).To(HaveLen(3))
+		Expect([]string{sqlErrs[0].Code, sqlErrs[1].Code, sqlErrs[2].Code}).To(Equal([]string{"SP2-0310", "ORA-06550", "PLS-00201"}))
+		Expect(sqlErrs[2].Message).To(Equal("PLS-00201: identifier 'OAUTH.CREATE_CLIENT' must be declared"))
+	})
+
+	It("skips errors which only give the location", func() {
+		Expect(FirstSqlplusError("ORA-06550: line 2, column 3:\nPLS-00201: identifier 'X' must be declared\n").Code).To(Equal("PLS-00201"))
+		Expect(FirstSqlplusError("ORA-06512: at line 5\n").Code).To(Equal("ORA-06512"))
+	})
+
+	It("classifies DB startup errors as retryable", func() {
+		Expect(ExecError(StepApex, ReasonApexInstallFailed, &SqlplusError{Code: "ORA-12541"}).Retryable).To(BeTrue())
+		Expect(ExecError(StepApex, ReasonApexInstallFailed, &SqlplusError{Code: "ORA-01017", Err: exec.CodeExitError{Code: 1}}).Retryable).To(BeFalse())
+	})
+})
@@ -0,0 +1,508 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	operatorv1 "apexords-operator/apexords-operator/api/v1"
+)
+
+//PublicUsers share the public password,Ords connects with them
+var PublicUsers = []string{"APEX_PUBLIC_USER", "APEX_LISTENER", "APEX_REST_PUBLIC_USER", "ORDS_PUBLIC_USER"}
+
+//OrdsPasswordHashAnnotation on the Ords pod template changes with the public password,so the pods roll when it does
+const OrdsPasswordHashAnnotation = "operator.apexords-operator/public-password-hash"
+
+//Credentials are the passwords of a credentials secret
+type Credentials struct {
+	Sys       string
+	ApexAdmin string
+	Public    string
+	//passwords of a rotation or a sys password change which the DB may not have yet
+	NewApexAdmin string
+	NewPublic    string
+	NewSys       string
+}
+
+func credentialsFromData(data map[string][]byte) *Credentials {
+	return &Credentials{
+		Sys:          string(data[CredentialsSysPasswordKey]),
+		ApexAdmin:    string(data[CredentialsApexAdminPasswordKey]),
+		Public:       string(data[CredentialsPublicPasswordKey]),
+		NewApexAdmin: string(data[CredentialsNewApexAdminPasswordKey]),
+		NewPublic:    string(data[CredentialsNewPublicPasswordKey]),
+		NewSys:       string(data[CredentialsNewSysPasswordKey]),
+	}
+}
+
+func (cr *Credentials) data() map[string][]byte {
+	data := map[string][]byte{}
+	for key, value := range map[string]string{
+		CredentialsSysPasswordKey:          cr.Sys,
+		CredentialsApexAdminPasswordKey:    cr.ApexAdmin,
+		CredentialsPublicPasswordKey:       cr.Public,
+		CredentialsNewApexAdminPasswordKey: cr.NewApexAdmin,
+		CredentialsNewPublicPasswordKey:    cr.NewPublic,
+		CredentialsNewSysPasswordKey:       cr.NewSys,
+	} {
+		if value != "" {
+			data[key] = []byte(value)
+		}
+	}
+	return data
+}
+
+//ReadCredentials returns the passwords of the credentials secret Secretname.
+//The public password of a secret written before it was kept is Dbpassword,which the install set.
+func ReadCredentials(ctx context.Context, c client.Client, Namespace string, Secretname string, Dbpassword string) (*Credentials, error) {
+	var secret corev1.Secret
+	if err := c.Get(ctx, client.ObjectKey{Namespace: Namespace, Name: Secretname}, &secret); err != nil {
+		return nil, err
+	}
+	cr := credentialsFromData(secret.Data)
+	if cr.Public == "" {
+		cr.Public = Dbpassword
+	}
+	return cr, nil
+}
+
+//saveCredentials applies mutate to the passwords of the secret Secretname owned by owner,
+//passwords already in the secret are kept unless mutate changes them
+func saveCredentials(ctx context.Context, c client.Client, s *runtime.Scheme, owner client.Object, Secretname string, mutate func(cr *Credentials)) (*Credentials, error) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      Secretname,
+			Namespace: owner.GetNamespace(),
+		},
+	}
+	var cr *Credentials
+	if _, err := controllerutil.CreateOrUpdate(ctx, c, secret, func() error {
+		secret.ObjectMeta.Labels = mergeLabels(Apexordsoperatorlabel, ComponentLabels(owner, ComponentCredentials))
+		secret.Type = corev1.SecretTypeOpaque
+		cr = credentialsFromData(secret.Data)
+		mutate(cr)
+		secret.Data = cr.data()
+		return controllerutil.SetControllerReference(owner, secret, s)
+	}); err != nil {
+		return nil, RetryableError(StepApex, ReasonCreateFailed, fmt.Errorf("unable to write secret %s: %v", secret.ObjectMeta.Name, err))
+	}
+	return cr, nil
+}
+
+//GeneratePassword returns a random password of n letters and digits with at least one upper case letter,
+//lower case letter and digit,plus # when punctuation is set,as the Apex admin password needs one
+func GeneratePassword(n int, punctuation bool) (string, error) {
+	const upper, lower, digits = "ABCDEFGHJKLMNPQRSTUVWXYZ", "abcdefghijkmnopqrstuvwxyz", "23456789"
+	pick := func(chars string) (byte, error) {
+		i, err := rand.Int(rand.Reader, big.NewInt(int64(len(chars))))
+		if err != nil {
+			return 0, err
+		}
+		return chars[i.Int64()], nil
+	}
+	//a letter first,Oracle passwords can't start with a digit
+	classes := []string{upper, lower, digits}
+	password := make([]byte, 0, n+1)
+	for i := 0; i < n; i++ {
+		chars := upper + lower + digits
+		if i < len(classes) {
+			chars = classes[i]
+		}
+		b, err := pick(chars)
+		if err != nil {
+			return "", err
+		}
+		password = append(password, b)
+	}
+	if punctuation {
+		password = append(password, '#')
+	}
+	return string(password), nil
+}
+
+//PublicProfile is the profile of the PublicUsers,it keeps their old password working during a rotation
+const PublicProfile = "APEXORDS_PUBLIC"
+
+//RolloverPollInterval is how often a rotation checks whether the Ords pods use the new public password
+var RolloverPollInterval = 15 * time.Second
+
+//publicUsersQuery selects the PublicUsers which exist in the PDB
+func publicUsersQuery() string {
+	var quoted []string
+	for _, user := range PublicUsers {
+		quoted = append(quoted, "'"+user+"'")
+	}
+	return "select username from dba_users where username in (" + strings.Join(quoted, ", ") + ")"
+}
+
+//RotatePasswordsScript sets the new public password of the public users which exist in the PDB,
+//then the new Apex admin password. apxchpwd-silent-admin.sql may exit sqlplus,so it is last.
+//The users get PublicProfile first,on 19.12 or later its password_rollover_time keeps the old password
+//working until FinishRolloverScript. Older releases don't know the limit and have one password only,
+//so the old Ords pods fail to log in until they are replaced,failed_login_attempts is unlimited
+//meanwhile to keep them from locking the users.
+func RotatePasswordsScript() string {
+	return "declare\n" +
+		"  profiles number;\n" +
+		"begin\n" +
+		"  select count(*) into profiles from dba_profiles where profile = '" + PublicProfile + "';\n" +
+		"  if profiles = 0 then\n" +
+		"    execute immediate 'create profile " + PublicProfile + " limit failed_login_attempts 10';\n" +
+		"  end if;\n" +
+		"  begin\n" +
+		"    execute immediate 'alter profile " + PublicProfile + " limit password_rollover_time 1';\n" +
+		"  exception\n" +
+		"    when others then\n" +
+		"      --ORA-02376 and ORA-00922 before 19.12,which has no password rollover\n" +
+		"      if sqlcode not in (-2376, -922) then\n" +
+		"        raise;\n" +
+		"      end if;\n" +
+		"  end;\n" +
+		"  execute immediate 'alter profile " + PublicProfile + " limit failed_login_attempts unlimited';\n" +
+		"  for u in (" + publicUsersQuery() + ") loop\n" +
+		"    execute immediate 'alter user ' || u.username || ' profile " + PublicProfile + "';\n" +
+		"    execute immediate 'alter user ' || u.username || ' identified by \"&" + CredentialsNewPublicPasswordKey + "\" account unlock';\n" +
+		"  end loop;\n" +
+		"end;\n" +
+		"/\n" +
+		"@apxchpwd-silent-admin.sql &" + CredentialsNewApexAdminPasswordKey
+}
+
+//FinishRolloverScript expires the old public password once no Ords pod uses it and sets failed_login_attempts back.
+//It unlocks the users too,old Ords pods may have locked them (ORA-28000) before the rotation.
+func FinishRolloverScript() string {
+	return "begin\n" +
+		"  for u in (" + publicUsersQuery() + ") loop\n" +
+		"    begin\n" +
+		"      execute immediate 'alter user ' || u.username || ' expire password rollover period';\n" +
+		"    exception\n" +
+		"      when others then\n" +
+		"        --ORA-00922 before 19.12,the old password is gone already\n" +
+		"        if sqlcode != -922 then\n" +
+		"          raise;\n" +
+		"        end if;\n" +
+		"    end;\n" +
+		"    execute immediate 'alter user ' || u.username || ' account unlock';\n" +
+		"  end loop;\n" +
+		"  execute immediate 'alter profile " + PublicProfile + " limit failed_login_attempts 10';\n" +
+		"end;\n" +
+		"/"
+}
+
+//RotatePasswords sets new Apex admin and public passwords in the DB and the credentials secret,Ords rolls to the
+//new public password afterwards and FinishPasswordsRollover expires the old one.
+//The new passwords are saved in the secret first and kept until the DB has them,so a failed rotation
+//is retried with the same passwords and the secret never holds passwords the DB does not have.
+func (d *DatabaseInstaller) RotatePasswords(ctx context.Context, req ctrl.Request) error {
+	if err := d.dbPodRunning(ctx, req); err != nil {
+		return err
+	}
+	var genErr error
+	if _, err := saveCredentials(ctx, d.Client, d.Scheme, d.Owner, d.Secretname, func(cr *Credentials) {
+		if cr.Public == "" {
+			cr.Public = d.Dbpassword
+		}
+		if cr.NewApexAdmin == "" {
+			cr.NewApexAdmin, genErr = GeneratePassword(16, true)
+		}
+		if cr.NewPublic == "" && genErr == nil {
+			cr.NewPublic, genErr = GeneratePassword(16, false)
+		}
+	}); err != nil {
+		return AsStepError(StepPasswords, err)
+	}
+	if genErr != nil {
+		return RetryableError(StepPasswords, ReasonPasswordsFailed, fmt.Errorf("unable to generate passwords: %v", genErr))
+	}
+
+	Podname := SqlplusPodName(d.Database)
+	if err := CreateSqlplusPodEnv(d.Client, req, Podname, RotationEnv(d.Secretname), d.Database); err != nil {
+		log.Log.Error(err, "unable to create Sqlpluspod")
+		return AsStepError(StepPasswords, err)
+	}
+	defer func() {
+		if err := DeleteSqlplusPod(d.Client, req, Podname); err != nil {
+			log.Log.Error(err, "unable to delete Sqlpluspod")
+			d.warnf(StepPasswords, ReasonPodFailed, "unable to delete sqlpluspod: %v", err)
+		}
+	}()
+
+	log.Log.Info("Rotate Apex admin and " + strings.Join(PublicUsers, ",") + " passwords in " + d.Database.Dbservice)
+	if _, err := RunSqlplusDefines(ctx, d.Runner, req, Podname, StepPasswords, DbConnectString(d.Database), "password rotation", RotatePasswordsScript(), RotationDefines); err != nil {
+		log.Log.Error(err, "Error to rotate passwords in Sqlpluspod")
+		return ExecError(StepPasswords, ReasonPasswordsFailed, fmt.Errorf("rotating passwords failed in sqlpluspod: %w", err))
+	}
+
+	if _, err := saveCredentials(ctx, d.Client, d.Scheme, d.Owner, d.Secretname, func(cr *Credentials) {
+		cr.ApexAdmin, cr.NewApexAdmin = cr.NewApexAdmin, ""
+		cr.Public, cr.NewPublic = cr.NewPublic, ""
+	}); err != nil {
+		return AsStepError(StepPasswords, err)
+	}
+	d.Recorder.Event(d.Owner, corev1.EventTypeNormal, ReasonPasswordsRotated,
+		"Rotated the Apex admin and "+strings.Join(PublicUsers, ",")+" passwords in "+d.Database.Dbservice+",they are in secret "+d.Secretname)
+	return nil
+}
+
+//FinishPasswordsRollover expires the old public password of a rotation,once the Ords pods use the new one
+func (d *DatabaseInstaller) FinishPasswordsRollover(ctx context.Context, req ctrl.Request) error {
+	if err := d.dbPodRunning(ctx, req); err != nil {
+		return err
+	}
+	Podname := SqlplusPodName(d.Database)
+	if err := CreateSqlplusPod(d.Client, req, Podname, d.Secretname, d.Database); err != nil {
+		log.Log.Error(err, "unable to create Sqlpluspod")
+		return AsStepError(StepPasswords, err)
+	}
+	defer func() {
+		if err := DeleteSqlplusPod(d.Client, req, Podname); err != nil {
+			log.Log.Error(err, "unable to delete Sqlpluspod")
+			d.warnf(StepPasswords, ReasonPodFailed, "unable to delete sqlpluspod: %v", err)
+		}
+	}()
+
+	log.Log.Info("Expire the old " + strings.Join(PublicUsers, ",") + " password in " + d.Database.Dbservice)
+	if _, err := RunSqlplus(ctx, d.Runner, req, Podname, StepPasswords, DbConnectString(d.Database), "password rollover", FinishRolloverScript()); err != nil {
+		log.Log.Error(err, "Error to expire the old passwords in Sqlpluspod")
+		return ExecError(StepPasswords, ReasonPasswordsFailed, fmt.Errorf("expiring the old passwords failed in sqlpluspod: %w", err))
+	}
+	d.Recorder.Event(d.Owner, corev1.EventTypeNormal, ReasonPasswordsRolledOver,
+		"The Ords pods use the new public password,expired the old "+strings.Join(PublicUsers, ",")+" password in "+d.Database.Dbservice)
+	return nil
+}
+
+//UpdateSysPassword changes the sys password of the DB to Dbpassword when the credentials secret has another one,
+//ie after a new version of the database.credentials secret. The sqlpluspod connects to the CDB root with the
+//password of the credentials secret,which becomes Dbpassword once the DB has it.
+func (d *DatabaseInstaller) UpdateSysPassword(ctx context.Context, req ctrl.Request) error {
+	current, err := ReadCredentials(ctx, d.Client, req.NamespacedName.Namespace, d.Secretname, d.Dbpassword)
+	if err != nil {
+		return RetryableError(StepCredentials, ReasonSecretNotFound, fmt.Errorf("unable to get secret %s: %v", d.Secretname, err))
+	}
+	if current.Sys == d.Dbpassword {
+		return nil
+	}
+	if err := d.dbPodRunning(ctx, req); err != nil {
+		return err
+	}
+	if _, err := saveCredentials(ctx, d.Client, d.Scheme, d.Owner, d.Secretname, func(cr *Credentials) {
+		cr.NewSys = d.Dbpassword
+	}); err != nil {
+		return AsStepError(StepCredentials, err)
+	}
+
+	Podname := SqlplusPodName(d.Database)
+	if err := CreateSqlplusPodEnv(d.Client, req, Podname, CredentialsEnv(d.Secretname, SysPasswordDefines), d.Database); err != nil {
+		log.Log.Error(err, "unable to create Sqlpluspod")
+		return AsStepError(StepCredentials, err)
+	}
+	defer func() {
+		if err := DeleteSqlplusPod(d.Client, req, Podname); err != nil {
+			log.Log.Error(err, "unable to delete Sqlpluspod")
+			d.warnf(StepCredentials, ReasonPodFailed, "unable to delete sqlpluspod: %v", err)
+		}
+	}()
+
+	log.Log.Info("Change the sys password of " + d.Database.Dbname)
+	script := "alter user sys identified by \"&" + CredentialsNewSysPasswordKey + "\" container=all;"
+	if _, err := RunSqlplusDefines(ctx, d.Runner, req, Podname, StepCredentials, DbConnectString(CdbDatabase(d.Database)), "sys password", script, SysPasswordDefines); err != nil {
+		log.Log.Error(err, "Error to change the sys password in Sqlpluspod")
+		return ExecError(StepCredentials, ReasonCredentialsUnavailable, fmt.Errorf("changing the sys password failed in sqlpluspod: %w", err))
+	}
+
+	if _, err := saveCredentials(ctx, d.Client, d.Scheme, d.Owner, d.Secretname, func(cr *Credentials) {
+		cr.Sys, cr.NewSys = d.Dbpassword, ""
+	}); err != nil {
+		return AsStepError(StepCredentials, err)
+	}
+	d.Recorder.Event(d.Owner, corev1.EventTypeNormal, ReasonSysPasswordChanged,
+		"Changed the sys password of "+d.Database.Dbname+" to the one of the database.credentials secret")
+	return nil
+}
+
+//RotationRequested returns the value of the rotate-passwords annotation of obj if it asks for a rotation not done yet
+func RotationRequested(obj metav1.Object, done string) string {
+	if value := obj.GetAnnotations()[operatorv1.RotatePasswordsAnnotation]; value != "" && value != done {
+		return value
+	}
+	return ""
+}
+
+//passwordHash returns the value of OrdsPasswordHashAnnotation,salted with the uid of the ApexOrds
+func passwordHash(apexords *operatorv1.ApexOrds, password string) string {
+	sum := sha256.Sum256([]byte(string(apexords.ObjectMeta.UID) + ":" + password))
+	return hex.EncodeToString(sum[:8])
+}
+
+//syncOrdsCredentials rewrites the Ords secret when the public password in the credentials secret changed
+//and rolls the Ords pods. The old password keeps working until the rollout is done,see RotatePasswordsScript.
+func (r *ApexOrdsReconciler) syncOrdsCredentials(ctx context.Context, apexords *operatorv1.ApexOrds, db *operatorv1.OracleDatabaseSpec, Dbpassword string) error {
+	credentials, err := ReadCredentials(ctx, r.Client, apexords.ObjectMeta.Namespace, CredentialsSecretName(apexords), Dbpassword)
+	if err != nil {
+		return RetryableError(StepOrds, ReasonSecretNotFound, fmt.Errorf("unable to get secret %s: %v", CredentialsSecretName(apexords), err))
+	}
+	var deployment appsv1.Deployment
+	if err := r.Get(ctx, client.ObjectKey{Namespace: apexords.ObjectMeta.Namespace, Name: OrdsDeploymentName(apexords)}, &deployment); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return RetryableError(StepOrds, ReasonCreateFailed, err)
+	}
+	hash := passwordHash(apexords, credentials.Public)
+	deployed := deployment.Spec.Template.ObjectMeta.Annotations[OrdsPasswordHashAnnotation]
+	if deployed == hash {
+		return nil
+	}
+
+	ordsconfigmap, ordsfiles, err := OrdsConfigMap(apexords, db, credentials.Public, Dbpassword)
+	if err != nil {
+		return err
+	}
+	var current corev1.ConfigMap
+	if err := r.Get(ctx, client.ObjectKeyFromObject(ordsconfigmap), &current); err != nil {
+		return RetryableError(StepOrds, ReasonCreateFailed, fmt.Errorf("unable to get configmap %s: %v", ordsconfigmap.ObjectMeta.Name, err))
+	}
+	changed, err := CreateOrdsSecret(r, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(apexords)}, apexords, db, ordsfiles, Dbpassword)
+	if err != nil {
+		return err
+	}
+	if reflect.DeepEqual(current.Data, ordsconfigmap.Data) && !changed && deployed == "" {
+		//deployed before the hash was kept,its pods have the password already
+		return nil
+	}
+	//configmaps written before the Ords secret existed carry the passwords,they are dropped from them
+	if !reflect.DeepEqual(current.Data, ordsconfigmap.Data) {
+		current.Data = ordsconfigmap.Data
+		if err := r.Update(ctx, &current); err != nil {
+			return RetryableError(StepOrds, ReasonCreateFailed, fmt.Errorf("unable to update configmap %s: %v", current.ObjectMeta.Name, err))
+		}
+	}
+	for i := range deployment.Spec.Template.Spec.Volumes {
+		if deployment.Spec.Template.Spec.Volumes[i].Name == "ords-config" {
+			deployment.Spec.Template.Spec.Volumes[i].VolumeSource = OrdsConfigVolumeSource(apexords)
+		}
+	}
+	if deployment.Spec.Template.ObjectMeta.Annotations == nil {
+		deployment.Spec.Template.ObjectMeta.Annotations = map[string]string{}
+	}
+	deployment.Spec.Template.ObjectMeta.Annotations[OrdsPasswordHashAnnotation] = hash
+	if err := r.Update(ctx, &deployment); err != nil {
+		return RetryableError(StepOrds, ReasonCreateFailed, fmt.Errorf("unable to update deployment %s: %v", deployment.ObjectMeta.Name, err))
+	}
+	log.Log.Info("Updated the Ords passwords of " + deployment.ObjectMeta.Name)
+	r.Recorder.Event(apexords, corev1.EventTypeNormal, ReasonOrdsConfigUpdated,
+		"Updated secret "+OrdsSecretName(apexords)+" with the new public password,rolling deployment "+deployment.ObjectMeta.Name)
+	return nil
+}
+
+//OrdsRolledOut tells whether all Ords pods of the ApexOrds use the public password,ie the new ReplicaSet is available
+//and the pods of the old one are gone. Without a deployment no pod uses an old password either.
+func OrdsRolledOut(ctx context.Context, c client.Client, apexords *operatorv1.ApexOrds, password string) (bool, error) {
+	var deployment appsv1.Deployment
+	if err := c.Get(ctx, client.ObjectKey{Namespace: apexords.ObjectMeta.Namespace, Name: OrdsDeploymentName(apexords)}, &deployment); err != nil {
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	if deployment.Spec.Template.ObjectMeta.Annotations[OrdsPasswordHashAnnotation] != passwordHash(apexords, password) {
+		return false, nil
+	}
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	status := deployment.Status
+	return status.ObservedGeneration >= deployment.ObjectMeta.Generation && status.UpdatedReplicas == replicas &&
+		status.AvailableReplicas == replicas && status.Replicas == replicas, nil
+}
+
+//finishPasswordsRollover expires the old public password of a rotation of the inline DB once the Ords pods use
+//the new one,it returns true while they don't
+func (r *ApexOrdsReconciler) finishPasswordsRollover(ctx context.Context, req ctrl.Request, apexords *operatorv1.ApexOrds, dbinstaller *DatabaseInstaller) (bool, error) {
+	credentials, err := ReadCredentials(ctx, r.Client, apexords.ObjectMeta.Namespace, CredentialsSecretName(apexords), dbinstaller.Dbpassword)
+	if err != nil {
+		return false, RetryableError(StepPasswords, ReasonSecretNotFound, fmt.Errorf("unable to get secret %s: %v", CredentialsSecretName(apexords), err))
+	}
+	rolledOut, err := OrdsRolledOut(ctx, r.Client, apexords, credentials.Public)
+	if err != nil {
+		return false, RetryableError(StepPasswords, ReasonPasswordsFailed, fmt.Errorf("unable to get deployment %s: %v", OrdsDeploymentName(apexords), err))
+	}
+	if !rolledOut {
+		log.Log.Info("waiting for the Ords pods of " + apexords.ObjectMeta.Name + " to use the new public password.......")
+		return true, nil
+	}
+	if err := dbinstaller.FinishPasswordsRollover(ctx, req); err != nil {
+		return false, err
+	}
+	apexords.Status.PasswordsRollover = ""
+	return false, r.Status().Update(ctx, apexords)
+}
+
+//finishPasswordsRollover expires the old public password of a rotation once the Ords pods of all ApexOrds of the DB
+//use the new one,it returns true while they don't
+func (r *OracleDatabaseReconciler) finishPasswordsRollover(ctx context.Context, req ctrl.Request, oradb *operatorv1.OracleDatabase, dbinstaller *DatabaseInstaller) (bool, error) {
+	credentials, err := ReadCredentials(ctx, r.Client, oradb.ObjectMeta.Namespace, DbCredentialsSecretName(oradb), dbinstaller.Dbpassword)
+	if err != nil {
+		return false, RetryableError(StepPasswords, ReasonSecretNotFound, fmt.Errorf("unable to get secret %s: %v", DbCredentialsSecretName(oradb), err))
+	}
+	names, err := ApexOrdsOfDatabase(ctx, r.Client, oradb)
+	if err != nil {
+		return false, RetryableError(StepPasswords, ReasonPasswordsFailed, fmt.Errorf("unable to list the ApexOrds of %s: %v", oradb.ObjectMeta.Name, err))
+	}
+	for _, name := range names {
+		var apexords operatorv1.ApexOrds
+		if err := r.Get(ctx, client.ObjectKey{Namespace: oradb.ObjectMeta.Namespace, Name: name}, &apexords); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return false, RetryableError(StepPasswords, ReasonPasswordsFailed, fmt.Errorf("unable to get ApexOrds %s: %v", name, err))
+		}
+		rolledOut, err := OrdsRolledOut(ctx, r.Client, &apexords, credentials.Public)
+		if err != nil {
+			return false, RetryableError(StepPasswords, ReasonPasswordsFailed, fmt.Errorf("unable to get deployment %s: %v", OrdsDeploymentName(&apexords), err))
+		}
+		if !rolledOut {
+			log.Log.Info("waiting for the Ords pods of " + name + " to use the new public password.......")
+			return true, nil
+		}
+	}
+	if err := dbinstaller.FinishPasswordsRollover(ctx, req); err != nil {
+		return false, err
+	}
+	oradb.Status.PasswordsRollover = ""
+	return false, r.Status().Update(ctx, oradb)
+}
@@ -0,0 +1,395 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	operatorv1 "apexords-operator/apexords-operator/api/v1"
+)
+
+//ServiceAccountTokenPath is the token of the operator service account the Vault Kubernetes auth method logs in with
+const ServiceAccountTokenPath = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+//DefaultVaultRefreshInterval is how often a Vault secret is read without refreshinterval
+var DefaultVaultRefreshInterval = 5 * time.Minute
+
+//ResolvedPassword is a password read from a secret store
+type ResolvedPassword struct {
+	Password string
+	//Version of the secret,a new one may hold another password
+	Version string
+	//RefreshAfter is when to read the secret again,zero when a watch reports its changes
+	RefreshAfter time.Duration
+}
+
+//CredentialsProvider reads the sys password of database.credentials from a secret store
+type CredentialsProvider interface {
+	SysPassword(ctx context.Context, c client.Client, Namespace string, credentials *operatorv1.DatabaseCredentials) (*ResolvedPassword, error)
+}
+
+//CredentialsProviders by the provider names of database.credentials
+var CredentialsProviders = map[string]CredentialsProvider{
+	operatorv1.CredentialsProviderSecret: &SecretCredentialsProvider{},
+	operatorv1.CredentialsProviderVault:  &VaultCredentialsProvider{TokenPath: ServiceAccountTokenPath},
+}
+
+func credentialsProvider(credentials *operatorv1.DatabaseCredentials) string {
+	if credentials.Provider == "" {
+		return operatorv1.CredentialsProviderSecret
+	}
+	return credentials.Provider
+}
+
+func credentialsKey(credentials *operatorv1.DatabaseCredentials) string {
+	if credentials.Key == "" {
+		return CredentialsSysPasswordKey
+	}
+	return credentials.Key
+}
+
+//CredentialsSecretOf returns the Kubernetes secret database.credentials reads,empty for other providers
+func CredentialsSecretOf(db *operatorv1.DatabaseSpec) string {
+	if db.Credentials == nil || credentialsProvider(db.Credentials) != operatorv1.CredentialsProviderSecret {
+		return ""
+	}
+	return db.Credentials.SecretName
+}
+
+//ValidateCredentials checks that database.credentials has the fields of its provider
+func ValidateCredentials(credentials *operatorv1.DatabaseCredentials) error {
+	if credentials == nil {
+		return nil
+	}
+	switch credentialsProvider(credentials) {
+	case operatorv1.CredentialsProviderSecret:
+		if credentials.SecretName == "" {
+			return fmt.Errorf("database.credentials.secretname is required with provider Secret")
+		}
+	case operatorv1.CredentialsProviderVault:
+		vault := credentials.Vault
+		if vault == nil || vault.Address == "" || vault.Path == "" {
+			return fmt.Errorf("database.credentials.vault.address and path are required with provider Vault")
+		}
+		if vault.Role == "" && vault.TokenSecret == "" {
+			return fmt.Errorf("database.credentials.vault needs role or tokensecret to log in to Vault")
+		}
+	}
+	return nil
+}
+
+//ResolveSysPassword returns the sys password of database.credentials of the DB,nil without database.credentials
+func ResolveSysPassword(ctx context.Context, c client.Client, Namespace string, db *operatorv1.OracleDatabaseSpec) (*ResolvedPassword, error) {
+	if db.Credentials == nil {
+		return nil, nil
+	}
+	provider, ok := CredentialsProviders[credentialsProvider(db.Credentials)]
+	if !ok {
+		return nil, TerminalError(StepCredentials, ReasonInvalidSpec, fmt.Errorf("unknown credentials provider %s", db.Credentials.Provider))
+	}
+	resolved, err := provider.SysPassword(ctx, c, Namespace, db.Credentials)
+	if err != nil {
+		return nil, AsStepError(StepCredentials, err)
+	}
+	return resolved, nil
+}
+
+//SecretCredentialsProvider reads the sys password from a Kubernetes secret,its resourceVersion is the version.
+//The controllers watch secrets,so a change is reconciled at once.
+type SecretCredentialsProvider struct{}
+
+func (p *SecretCredentialsProvider) SysPassword(ctx context.Context, c client.Client, Namespace string, credentials *operatorv1.DatabaseCredentials) (*ResolvedPassword, error) {
+	var secret corev1.Secret
+	if err := c.Get(ctx, client.ObjectKey{Namespace: Namespace, Name: credentials.SecretName}, &secret); err != nil {
+		return nil, RetryableError(StepCredentials, ReasonSecretNotFound, fmt.Errorf("unable to get secret %s: %v", credentials.SecretName, err))
+	}
+	password := string(secret.Data[credentialsKey(credentials)])
+	if password == "" {
+		return nil, RetryableError(StepCredentials, ReasonSecretNotFound, fmt.Errorf("secret %s has no %s", credentials.SecretName, credentialsKey(credentials)))
+	}
+	return &ResolvedPassword{Password: password, Version: secret.ObjectMeta.ResourceVersion}, nil
+}
+
+//VaultCredentialsProvider reads the sys password from a KV v2 secret of HashiCorp Vault,the version of the
+//secret is the version. Vault can't notify the operator,the secret is read again after refreshinterval.
+type VaultCredentialsProvider struct {
+	//TokenPath is the JWT the Kubernetes auth method logs in with
+	TokenPath string
+	//HTTPClient talks to a Vault without casecret,default is a client with a 30s timeout. Its redirects are not followed
+	HTTPClient *http.Client
+	//AllowedAddresses are the Vaults the service account token of the operator may be sent to,ie https://vault.example.com:8200.
+	//The Kubernetes auth method is refused for other addresses,so a resource can't make the operator send its token anywhere.
+	//Any namespace can name any role of these Vaults,the policy of a role must only cover the secrets of the namespaces using it
+	AllowedAddresses []string
+
+	mu sync.Mutex
+	//tokens of the Kubernetes auth method by namespace,address,auth mount and role,kept until their lease is mostly over
+	tokens map[string]vaultToken
+}
+
+//vaultToken is a Vault token and when to log in again
+type vaultToken struct {
+	token   string
+	expires time.Time
+}
+
+func (p *VaultCredentialsProvider) SysPassword(ctx context.Context, c client.Client, Namespace string, credentials *operatorv1.DatabaseCredentials) (*ResolvedPassword, error) {
+	vault := credentials.Vault
+	if vault == nil {
+		return nil, TerminalError(StepCredentials, ReasonInvalidSpec, fmt.Errorf("database.credentials.vault is not set"))
+	}
+	httpClient, err := p.httpClient(ctx, c, Namespace, vault)
+	if err != nil {
+		return nil, err
+	}
+	token, cached, err := p.login(ctx, c, Namespace, httpClient, vault)
+	if err != nil {
+		return nil, err
+	}
+
+	mount := vault.Mount
+	if mount == "" {
+		mount = "secret"
+	}
+	url := strings.TrimRight(vault.Address, "/") + "/v1/" + strings.Trim(mount, "/") + "/data/" + strings.Trim(vault.Path, "/")
+	if vault.Version > 0 {
+		url += "?version=" + strconv.Itoa(vault.Version)
+	}
+	var body struct {
+		Data struct {
+			Data     map[string]interface{} `json:"data"`
+			Metadata struct {
+				Version int `json:"version"`
+			} `json:"metadata"`
+		} `json:"data"`
+	}
+	if err := vaultRequest(ctx, httpClient, http.MethodGet, url, token, nil, &body); err != nil {
+		if !cached {
+			return nil, err
+		}
+		//the cached token may be revoked,log in once more
+		p.forgetToken(Namespace, vault)
+		if token, _, err = p.login(ctx, c, Namespace, httpClient, vault); err != nil {
+			return nil, err
+		}
+		if err := vaultRequest(ctx, httpClient, http.MethodGet, url, token, nil, &body); err != nil {
+			return nil, err
+		}
+	}
+	password, _ := body.Data.Data[credentialsKey(credentials)].(string)
+	if password == "" {
+		return nil, RetryableError(StepCredentials, ReasonSecretNotFound, fmt.Errorf("Vault secret %s has no %s", vault.Path, credentialsKey(credentials)))
+	}
+
+	refresh := DefaultVaultRefreshInterval
+	if vault.RefreshInterval != nil && vault.RefreshInterval.Duration > 0 {
+		refresh = vault.RefreshInterval.Duration
+	}
+	return &ResolvedPassword{Password: password, Version: strconv.Itoa(body.Data.Metadata.Version), RefreshAfter: refresh}, nil
+}
+
+//httpClient trusts the CA of casecret besides the system ones. It doesn't follow redirects
+func (p *VaultCredentialsProvider) httpClient(ctx context.Context, c client.Client, Namespace string, vault *operatorv1.VaultSecret) (*http.Client, error) {
+	if vault.CASecret == "" {
+		if p.HTTPClient != nil {
+			httpClient := *p.HTTPClient
+			httpClient.CheckRedirect = vaultNoRedirect
+			return &httpClient, nil
+		}
+		return &http.Client{Timeout: 30 * time.Second, CheckRedirect: vaultNoRedirect}, nil
+	}
+	var secret corev1.Secret
+	if err := c.Get(ctx, client.ObjectKey{Namespace: Namespace, Name: vault.CASecret}, &secret); err != nil {
+		return nil, RetryableError(StepCredentials, ReasonSecretNotFound, fmt.Errorf("unable to get secret %s: %v", vault.CASecret, err))
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(secret.Data["ca.crt"]) {
+		return nil, RetryableError(StepCredentials, ReasonSecretNotFound, fmt.Errorf("secret %s has no PEM certificate in ca.crt", vault.CASecret))
+	}
+	return &http.Client{
+		Timeout:       30 * time.Second,
+		Transport:     &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}},
+		CheckRedirect: vaultNoRedirect,
+	}, nil
+}
+
+//vaultNoRedirect returns the redirect as response,following it would send the Vault token or the service account
+//token in the login to the address of the redirect
+func vaultNoRedirect(req *http.Request, via []*http.Request) error {
+	return http.ErrUseLastResponse
+}
+
+//login returns the token of tokensecret,or logs in with the Kubernetes auth method to an allowed address.
+//The token of a login is kept until 90% of its lease is over,cached tells whether it was.
+func (p *VaultCredentialsProvider) login(ctx context.Context, c client.Client, Namespace string, httpClient *http.Client, vault *operatorv1.VaultSecret) (string, bool, error) {
+	if vault.TokenSecret != "" {
+		var secret corev1.Secret
+		if err := c.Get(ctx, client.ObjectKey{Namespace: Namespace, Name: vault.TokenSecret}, &secret); err != nil {
+			return "", false, RetryableError(StepCredentials, ReasonSecretNotFound, fmt.Errorf("unable to get secret %s: %v", vault.TokenSecret, err))
+		}
+		token := strings.TrimSpace(string(secret.Data["token"]))
+		if token == "" {
+			return "", false, RetryableError(StepCredentials, ReasonSecretNotFound, fmt.Errorf("secret %s has no token", vault.TokenSecret))
+		}
+		return token, false, nil
+	}
+
+	if !p.addressAllowed(vault.Address) {
+		return "", false, TerminalError(StepCredentials, ReasonInvalidSpec, fmt.Errorf("the operator doesn't send its service account token to Vault %s,"+
+			"add it to --vault-addresses of the operator or set tokensecret", vault.Address))
+	}
+	if token, ok := p.cachedToken(Namespace, vault); ok {
+		return token, true, nil
+	}
+	jwt, err := ioutil.ReadFile(p.TokenPath)
+	if err != nil {
+		return "", false, TerminalError(StepCredentials, ReasonCredentialsUnavailable, fmt.Errorf("unable to read the service account token: %v", err))
+	}
+	var body struct {
+		Auth struct {
+			ClientToken   string `json:"client_token"`
+			LeaseDuration int    `json:"lease_duration"`
+		} `json:"auth"`
+	}
+	url := strings.TrimRight(vault.Address, "/") + "/v1/auth/" + strings.Trim(vaultAuthMount(vault), "/") + "/login"
+	login := map[string]string{"role": vault.Role, "jwt": strings.TrimSpace(string(jwt))}
+	if err := vaultRequest(ctx, httpClient, http.MethodPost, url, "", login, &body); err != nil {
+		return "", false, err
+	}
+	if body.Auth.ClientToken == "" {
+		return "", false, RetryableError(StepCredentials, ReasonCredentialsUnavailable, fmt.Errorf("Vault login with role %s returned no token", vault.Role))
+	}
+	//a token without lease is not kept,its TTL is unknown
+	if body.Auth.LeaseDuration > 0 {
+		p.keepToken(Namespace, vault, body.Auth.ClientToken, time.Duration(body.Auth.LeaseDuration)*time.Second*9/10)
+	}
+	return body.Auth.ClientToken, false, nil
+}
+
+//addressAllowed tells whether address has the scheme and host of one of AllowedAddresses
+func (p *VaultCredentialsProvider) addressAllowed(address string) bool {
+	requested, err := url.Parse(address)
+	if err != nil || requested.Host == "" {
+		return false
+	}
+	for _, allowed := range p.AllowedAddresses {
+		if u, err := url.Parse(strings.TrimSpace(allowed)); err == nil &&
+			strings.EqualFold(u.Scheme, requested.Scheme) && strings.EqualFold(u.Host, requested.Host) {
+			return true
+		}
+	}
+	return false
+}
+
+func vaultAuthMount(vault *operatorv1.VaultSecret) string {
+	if vault.AuthMount == "" {
+		return "kubernetes"
+	}
+	return vault.AuthMount
+}
+
+//vaultTokenKey keeps the tokens of each namespace apart,a namespace only uses the tokens of its own logins
+func vaultTokenKey(Namespace string, vault *operatorv1.VaultSecret) string {
+	return Namespace + "|" + strings.TrimRight(vault.Address, "/") + "|" + vaultAuthMount(vault) + "|" + vault.Role
+}
+
+func (p *VaultCredentialsProvider) cachedToken(Namespace string, vault *operatorv1.VaultSecret) (string, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	cached, ok := p.tokens[vaultTokenKey(Namespace, vault)]
+	if !ok || !time.Now().Before(cached.expires) {
+		return "", false
+	}
+	return cached.token, true
+}
+
+func (p *VaultCredentialsProvider) keepToken(Namespace string, vault *operatorv1.VaultSecret, token string, ttl time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.tokens == nil {
+		p.tokens = map[string]vaultToken{}
+	}
+	p.tokens[vaultTokenKey(Namespace, vault)] = vaultToken{token: token, expires: time.Now().Add(ttl)}
+}
+
+func (p *VaultCredentialsProvider) forgetToken(Namespace string, vault *operatorv1.VaultSecret) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.tokens, vaultTokenKey(Namespace, vault))
+}
+
+//vaultRequest sends payload as JSON and decodes the JSON response into out,the errors Vault returns are in the error
+func vaultRequest(ctx context.Context, httpClient *http.Client, method string, url string, token string, payload interface{}, out interface{}) error {
+	var reader io.Reader
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return TerminalError(StepCredentials, ReasonCredentialsUnavailable, err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return TerminalError(StepCredentials, ReasonInvalidSpec, fmt.Errorf("invalid Vault address: %v", err))
+	}
+	if token != "" {
+		request.Header.Set("X-Vault-Token", token)
+	}
+	if payload != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	response, err := httpClient.Do(request)
+	if err != nil {
+		return RetryableError(StepCredentials, ReasonCredentialsUnavailable, fmt.Errorf("Vault request failed: %v", err))
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 300 && response.StatusCode < 400 {
+		return RetryableError(StepCredentials, ReasonCredentialsUnavailable, fmt.Errorf("Vault redirected %s %s to %s,redirects are not followed,set the address of the active Vault",
+			method, request.URL.Path, response.Header.Get("Location")))
+	}
+	if response.StatusCode != http.StatusOK {
+		var vaultErr struct {
+			Errors []string `json:"errors"`
+		}
+		_ = json.NewDecoder(response.Body).Decode(&vaultErr)
+		return RetryableError(StepCredentials, ReasonCredentialsUnavailable, fmt.Errorf("Vault returned %s for %s %s: %s",
+			response.Status, method, request.URL.Path, strings.Join(vaultErr.Errors, ",")))
+	}
+	if err := json.NewDecoder(response.Body).Decode(out); err != nil {
+		return RetryableError(StepCredentials, ReasonCredentialsUnavailable, fmt.Errorf("invalid Vault response: %v", err))
+	}
+	return nil
+}
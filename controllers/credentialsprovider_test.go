@@ -0,0 +1,366 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	operatorv1 "apexords-operator/apexords-operator/api/v1"
+)
+
+//fakeVault serves the Kubernetes auth login and the KV v2 reads of a Vault dev server
+type fakeVault struct {
+	mu       sync.Mutex
+	token    string
+	role     string
+	jwt      string
+	versions []map[string]interface{}
+	paths    []string
+	//lease of the login tokens in seconds and the number of logins
+	lease  int
+	logins int
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	fail := func(status int, msg string) {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(map[string][]string{"errors": {msg}})
+	}
+	switch r.URL.Path {
+	case "/v1/auth/kubernetes/login":
+		var login map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&login)
+		if login["role"] != v.role || login["jwt"] != v.jwt {
+			fail(http.StatusBadRequest, "invalid role or jwt")
+			return
+		}
+		v.logins++
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"auth": map[string]interface{}{"client_token": v.token, "lease_duration": v.lease}})
+	case "/v1/secret/data/oracle/sys":
+		if r.Header.Get("X-Vault-Token") != v.token {
+			fail(http.StatusForbidden, "permission denied")
+			return
+		}
+		v.paths = append(v.paths, r.URL.RequestURI())
+		version := len(v.versions)
+		if requested := r.URL.Query().Get("version"); requested != "" {
+			version, _ = strconv.Atoi(requested)
+		}
+		if version < 1 || version > len(v.versions) {
+			fail(http.StatusNotFound, "")
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+			"data":     v.versions[version-1],
+			"metadata": map[string]int{"version": version},
+		}})
+	default:
+		fail(http.StatusNotFound, "")
+	}
+}
+
+var _ = Describe("CredentialsProvider", func() {
+	var (
+		ctx       context.Context
+		namespace string
+		vault     *fakeVault
+		server    *httptest.Server
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "credentials-test-"}}
+		Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+		namespace = ns.Name
+		vault = &fakeVault{token: "s.test", role: "apexords", jwt: "service-account-jwt",
+			versions: []map[string]interface{}{{"sys_password": "First#Sys1"}, {"sys_password": "Second#Sys2"}}}
+		server = httptest.NewServer(vault)
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+
+	credentialsOf := func(vaultSecret *operatorv1.VaultSecret) *operatorv1.OracleDatabaseSpec {
+		return &operatorv1.OracleDatabaseSpec{DatabaseSpec: operatorv1.DatabaseSpec{Credentials: &operatorv1.DatabaseCredentials{
+			Provider: operatorv1.CredentialsProviderVault,
+			Vault:    vaultSecret,
+		}}}
+	}
+
+	createTokenSecret := func() {
+		Expect(k8sClient.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "vault-token", Namespace: namespace},
+			StringData: map[string]string{"token": "s.test\n"},
+		})).To(Succeed())
+	}
+
+	It("returns nil without database.credentials", func() {
+		resolved, err := ResolveSysPassword(ctx, k8sClient, namespace, &operatorv1.OracleDatabaseSpec{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resolved).To(BeNil())
+	})
+
+	It("reads the Kubernetes secret with its resourceVersion as version", func() {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "oradb-sys", Namespace: namespace},
+			StringData: map[string]string{CredentialsSysPasswordKey: "Secret#Sys1"},
+		}
+		Expect(k8sClient.Create(ctx, secret)).To(Succeed())
+		db := &operatorv1.OracleDatabaseSpec{DatabaseSpec: operatorv1.DatabaseSpec{
+			Credentials: &operatorv1.DatabaseCredentials{SecretName: "oradb-sys"},
+		}}
+
+		resolved, err := ResolveSysPassword(ctx, k8sClient, namespace, db)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resolved.Password).To(Equal("Secret#Sys1"))
+		Expect(resolved.Version).To(Equal(secret.ObjectMeta.ResourceVersion))
+		Expect(resolved.RefreshAfter).To(BeZero())
+
+		db.Credentials.Key = "password"
+		_, err = ResolveSysPassword(ctx, k8sClient, namespace, db)
+		Expect(err).To(HaveOccurred())
+		Expect(IsRetryable(err)).To(BeTrue())
+	})
+
+	It("reads the latest version of a Vault KV v2 secret with the token of tokensecret", func() {
+		createTokenSecret()
+		db := credentialsOf(&operatorv1.VaultSecret{Address: server.URL, Path: "oracle/sys", TokenSecret: "vault-token",
+			RefreshInterval: &metav1.Duration{Duration: time.Minute}})
+
+		resolved, err := ResolveSysPassword(ctx, k8sClient, namespace, db)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(*resolved).To(Equal(ResolvedPassword{Password: "Second#Sys2", Version: "2", RefreshAfter: time.Minute}))
+
+		db.Credentials.Vault.Version = 1
+		resolved, err = ResolveSysPassword(ctx, k8sClient, namespace, db)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resolved.Password).To(Equal("First#Sys1"))
+		Expect(resolved.Version).To(Equal("1"))
+		Expect(resolved.RefreshAfter).To(Equal(time.Minute))
+		Expect(vault.paths).To(Equal([]string{"/v1/secret/data/oracle/sys", "/v1/secret/data/oracle/sys?version=1"}))
+	})
+
+	It("logs in with the Kubernetes auth method and the service account token", func() {
+		dir, err := ioutil.TempDir("", "vault")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+		tokenpath := filepath.Join(dir, "token")
+		Expect(ioutil.WriteFile(tokenpath, []byte("service-account-jwt"), 0600)).To(Succeed())
+		provider := &VaultCredentialsProvider{TokenPath: tokenpath, AllowedAddresses: []string{server.URL + "/"}}
+		credentials := credentialsOf(&operatorv1.VaultSecret{Address: server.URL, Path: "oracle/sys", Role: "apexords"}).Credentials
+
+		resolved, err := provider.SysPassword(ctx, k8sClient, namespace, credentials)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resolved.Password).To(Equal("Second#Sys2"))
+		Expect(resolved.RefreshAfter).To(Equal(DefaultVaultRefreshInterval))
+
+		credentials.Vault.Role = "other"
+		_, err = provider.SysPassword(ctx, k8sClient, namespace, credentials)
+		Expect(IsRetryable(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("invalid role or jwt"))
+	})
+
+	It("sends the service account token only to the allowed Vault addresses", func() {
+		dir, err := ioutil.TempDir("", "vault")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+		tokenpath := filepath.Join(dir, "token")
+		Expect(ioutil.WriteFile(tokenpath, []byte("service-account-jwt"), 0600)).To(Succeed())
+		credentials := credentialsOf(&operatorv1.VaultSecret{Address: server.URL, Path: "oracle/sys", Role: "apexords"}).Credentials
+
+		for _, allowed := range [][]string{nil, {"https://vault.example.com:8200"}, {strings.Replace(server.URL, "http:", "https:", 1)}} {
+			provider := &VaultCredentialsProvider{TokenPath: tokenpath, AllowedAddresses: allowed}
+			_, err = provider.SysPassword(ctx, k8sClient, namespace, credentials)
+			var stepErr *StepError
+			Expect(errors.As(err, &stepErr)).To(BeTrue())
+			Expect(stepErr.Retryable).To(BeFalse())
+			Expect(stepErr.Reason).To(Equal(ReasonInvalidSpec))
+			Expect(err.Error()).To(ContainSubstring("--vault-addresses"))
+		}
+		Expect(vault.logins).To(BeZero())
+
+		//the token of tokensecret goes to any address
+		createTokenSecret()
+		credentials.Vault.TokenSecret = "vault-token"
+		provider := &VaultCredentialsProvider{TokenPath: tokenpath}
+		_, err = provider.SysPassword(ctx, k8sClient, namespace, credentials)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vault.logins).To(BeZero())
+	})
+
+	It("logs in again only when the lease of the token is mostly over or the token is refused", func() {
+		dir, err := ioutil.TempDir("", "vault")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+		tokenpath := filepath.Join(dir, "token")
+		Expect(ioutil.WriteFile(tokenpath, []byte("service-account-jwt"), 0600)).To(Succeed())
+		provider := &VaultCredentialsProvider{TokenPath: tokenpath, AllowedAddresses: []string{server.URL}}
+		credentials := credentialsOf(&operatorv1.VaultSecret{Address: server.URL, Path: "oracle/sys", Role: "apexords"}).Credentials
+
+		vault.lease = 3600
+		for i := 0; i < 3; i++ {
+			_, err = provider.SysPassword(ctx, k8sClient, namespace, credentials)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(vault.logins).To(Equal(1))
+
+		//a revoked token is replaced at once
+		vault.token = "s.renewed"
+		resolved, err := provider.SysPassword(ctx, k8sClient, namespace, credentials)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resolved.Password).To(Equal("Second#Sys2"))
+		Expect(vault.logins).To(Equal(2))
+
+		//90% of a one second lease is over after a second
+		provider = &VaultCredentialsProvider{TokenPath: tokenpath, AllowedAddresses: []string{server.URL}}
+		vault.lease = 1
+		_, err = provider.SysPassword(ctx, k8sClient, namespace, credentials)
+		Expect(err).NotTo(HaveOccurred())
+		time.Sleep(time.Second)
+		_, err = provider.SysPassword(ctx, k8sClient, namespace, credentials)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vault.logins).To(Equal(4))
+
+		//a token without lease is not kept
+		provider = &VaultCredentialsProvider{TokenPath: tokenpath, AllowedAddresses: []string{server.URL}}
+		vault.lease = 0
+		_, err = provider.SysPassword(ctx, k8sClient, namespace, credentials)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = provider.SysPassword(ctx, k8sClient, namespace, credentials)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(vault.logins).To(Equal(6))
+	})
+
+	It("doesn't follow the redirects of Vault with the token or the login", func() {
+		redirects := 0
+		redirecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			redirects++
+			http.Redirect(w, r, server.URL+r.URL.RequestURI(), http.StatusTemporaryRedirect)
+		}))
+		defer redirecting.Close()
+		dir, err := ioutil.TempDir("", "vault")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+		tokenpath := filepath.Join(dir, "token")
+		Expect(ioutil.WriteFile(tokenpath, []byte("service-account-jwt"), 0600)).To(Succeed())
+		createTokenSecret()
+
+		for _, provider := range []*VaultCredentialsProvider{
+			{TokenPath: tokenpath, AllowedAddresses: []string{redirecting.URL}},
+			{TokenPath: tokenpath, AllowedAddresses: []string{redirecting.URL}, HTTPClient: http.DefaultClient},
+		} {
+			for _, vaultSecret := range []*operatorv1.VaultSecret{
+				{Address: redirecting.URL, Path: "oracle/sys", TokenSecret: "vault-token"},
+				{Address: redirecting.URL, Path: "oracle/sys", Role: "apexords"},
+			} {
+				_, err := provider.SysPassword(ctx, k8sClient, namespace, credentialsOf(vaultSecret).Credentials)
+				Expect(IsRetryable(err)).To(BeTrue())
+				Expect(err.Error()).To(ContainSubstring("redirects are not followed"))
+				Expect(err.Error()).To(ContainSubstring(server.URL))
+			}
+		}
+		Expect(redirects).To(Equal(4))
+		Expect(vault.paths).To(BeEmpty())
+		Expect(vault.logins).To(BeZero())
+		Expect(http.DefaultClient.CheckRedirect).To(BeNil())
+	})
+
+	It("keeps the token of a login for the namespace which logged in", func() {
+		dir, err := ioutil.TempDir("", "vault")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+		tokenpath := filepath.Join(dir, "token")
+		Expect(ioutil.WriteFile(tokenpath, []byte("service-account-jwt"), 0600)).To(Succeed())
+		provider := &VaultCredentialsProvider{TokenPath: tokenpath, AllowedAddresses: []string{server.URL}}
+		credentials := credentialsOf(&operatorv1.VaultSecret{Address: server.URL, Path: "oracle/sys", Role: "apexords"}).Credentials
+
+		vault.lease = 3600
+		for _, ns := range []string{namespace, "other", namespace, "other"} {
+			_, err = provider.SysPassword(ctx, k8sClient, ns, credentials)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(vault.logins).To(Equal(2))
+	})
+
+	It("retries when Vault denies the read or the secret has no key", func() {
+		Expect(k8sClient.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "vault-token", Namespace: namespace},
+			StringData: map[string]string{"token": "s.revoked"},
+		})).To(Succeed())
+		db := credentialsOf(&operatorv1.VaultSecret{Address: server.URL, Path: "oracle/sys", TokenSecret: "vault-token"})
+
+		_, err := ResolveSysPassword(ctx, k8sClient, namespace, db)
+		Expect(IsRetryable(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("403"))
+		Expect(err.Error()).To(ContainSubstring("permission denied"))
+
+		vault.token = "s.revoked"
+		db.Credentials.Key = "password"
+		_, err = ResolveSysPassword(ctx, k8sClient, namespace, db)
+		Expect(IsRetryable(err)).To(BeTrue())
+		Expect(err.Error()).To(ContainSubstring("has no password"))
+	})
+
+	It("trusts the CA of casecret", func() {
+		tlsserver := httptest.NewTLSServer(vault)
+		defer tlsserver.Close()
+		createTokenSecret()
+		ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsserver.Certificate().Raw})
+		Expect(k8sClient.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "vault-ca", Namespace: namespace},
+			Data:       map[string][]byte{"ca.crt": ca},
+		})).To(Succeed())
+		db := credentialsOf(&operatorv1.VaultSecret{Address: tlsserver.URL, Path: "oracle/sys", TokenSecret: "vault-token"})
+
+		_, err := ResolveSysPassword(ctx, k8sClient, namespace, db)
+		Expect(IsRetryable(err)).To(BeTrue())
+
+		db.Credentials.Vault.CASecret = "vault-ca"
+		resolved, err := ResolveSysPassword(ctx, k8sClient, namespace, db)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resolved.Password).To(Equal("Second#Sys2"))
+	})
+
+	It("validates the fields of each provider", func() {
+		Expect(ValidateCredentials(nil)).To(Succeed())
+		Expect(ValidateCredentials(&operatorv1.DatabaseCredentials{})).NotTo(Succeed())
+		Expect(ValidateCredentials(&operatorv1.DatabaseCredentials{SecretName: "oradb-sys"})).To(Succeed())
+		Expect(ValidateCredentials(&operatorv1.DatabaseCredentials{Provider: operatorv1.CredentialsProviderVault,
+			Vault: &operatorv1.VaultSecret{Address: server.URL, Path: "oracle/sys"}})).NotTo(Succeed())
+		Expect(ValidateCredentials(&operatorv1.DatabaseCredentials{Provider: operatorv1.CredentialsProviderVault,
+			Vault: &operatorv1.VaultSecret{Address: server.URL, Path: "oracle/sys", Role: "apexords"}})).To(Succeed())
+	})
+})
@@ -0,0 +1,586 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	operatorv1 "apexords-operator/apexords-operator/api/v1"
+	config "apexords-operator/apexords-operator/controllers/config"
+)
+
+//DatabaseInstaller provisions the DB statefulset and service and installs Apex in the DB.
+//Owner is an OracleDatabase,or an ApexOrds with the DB settings inline. The created objects
+//belong to it and the events are recorded on it.
+type DatabaseInstaller struct {
+	Client   client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	Runner   CommandRunner
+	Owner    client.Object
+	Database *operatorv1.OracleDatabaseSpec
+	//sys password of the DB,also used for the Apex and Ords schemas
+	Dbpassword string
+	//secret the sqlpluspod reads the passwords from
+	Secretname string
+	//the DB reads the sys password from the credentials secret instead of the statefulset
+	SecretSysPassword bool
+	//Apex version found by CreateApexOption
+	ApexVersion string
+	//Ords version found by CreateOrdsSchemaOption
+	OrdsVersion string
+	//Creating is called before a DB object is created,the owner records the overrides and settings it is created with
+	Creating func() error
+}
+
+//InlineDatabase returns the DB settings of an ApexOrds without databaseref
+func InlineDatabase(apexords *operatorv1.ApexOrds) *operatorv1.OracleDatabaseSpec {
+	db := &operatorv1.OracleDatabaseSpec{
+		Dbname:          apexords.Spec.Dbname,
+		Dbservice:       apexords.Spec.Dbservice,
+		Dbport:          apexords.Spec.Dbport,
+		Apexruntimeonly: apexords.Spec.Apexruntimeonly,
+		Overrides:       apexords.Spec.Overrides,
+	}
+	if apexords.Spec.Database != nil {
+		db.DatabaseSpec = *apexords.Spec.Database
+	}
+	return db
+}
+
+//ApexOrdsDatabase returns the OracleDatabase of spec.databaseref,or one holding the inline DB settings of the ApexOrds
+func ApexOrdsDatabase(ctx context.Context, c client.Client, apexords *operatorv1.ApexOrds) (*operatorv1.OracleDatabase, error) {
+	oradb := &operatorv1.OracleDatabase{}
+	if apexords.Spec.DatabaseRef == "" {
+		oradb.Spec = *InlineDatabase(apexords)
+	} else if err := c.Get(ctx, client.ObjectKey{Namespace: apexords.ObjectMeta.Namespace, Name: apexords.Spec.DatabaseRef}, oradb); err != nil {
+		return nil, err
+	}
+	// set default db port to 1521
+	if oradb.Spec.Dbport == "" {
+		oradb.Spec.Dbport = "1521"
+	}
+	//the pods of the ApexOrds also pull with its own secrets
+	oradb.Spec.ImagePullSecrets = mergeImagePullSecrets(oradb.Spec.ImagePullSecrets, apexords.Spec.ImagePullSecrets)
+	return oradb, nil
+}
+
+//ValidateDatabase checks the DB settings the CRD schema can't
+func ValidateDatabase(db *operatorv1.OracleDatabaseSpec) error {
+	if err := ValidateDbParameters(db.Parameters); err != nil {
+		return err
+	}
+	if err := ValidateCredentials(db.Credentials); err != nil {
+		return err
+	}
+	if err := ValidateDbTLS(db.TLS); err != nil {
+		return err
+	}
+	if db.Edition == operatorv1.DbEditionXE {
+		if db.Image == "" {
+			return fmt.Errorf("database.edition XE needs database.image of an Oracle XE image")
+		}
+		//XE images always create CDB XE with PDB XEPDB1
+		if !strings.EqualFold(db.Dbname, "XE") || !strings.EqualFold(db.Dbservice, "XEPDB1") {
+			return fmt.Errorf("database.edition XE needs dbname XE and dbservice XEPDB1")
+		}
+	}
+	return nil
+}
+
+//DatabaseCreationOf returns the settings of db the DB image reads when it creates the DB
+func DatabaseCreationOf(db *operatorv1.OracleDatabaseSpec) *operatorv1.DatabaseCreation {
+	return &operatorv1.DatabaseCreation{
+		CharacterSet:         db.CharacterSet,
+		NationalCharacterSet: db.NationalCharacterSet,
+		Edition:              db.Edition,
+		EnableArchiveLog:     db.EnableArchiveLog,
+	}
+}
+
+//checkDatabaseCreation returns a terminal error when a setting of db changed since the DB was created with recorded.
+//The DB image reads them at first boot only,a change would never reach the DB
+func checkDatabaseCreation(recorded *operatorv1.DatabaseCreation, db *operatorv1.OracleDatabaseSpec) *StepError {
+	if recorded == nil {
+		return nil
+	}
+	current := DatabaseCreationOf(db)
+	var changed []string
+	if !strings.EqualFold(recorded.CharacterSet, current.CharacterSet) {
+		changed = append(changed, "characterset")
+	}
+	if recorded.NationalCharacterSet != current.NationalCharacterSet {
+		changed = append(changed, "nationalcharacterset")
+	}
+	if recorded.Edition != current.Edition {
+		changed = append(changed, "edition")
+	}
+	if recorded.EnableArchiveLog != current.EnableArchiveLog {
+		changed = append(changed, "enablearchivelog")
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	return TerminalError(StepSpec, ReasonInvalidSpec, fmt.Errorf("database %s can't change once the DB is created,they are used at its first boot only. Set them back or create a new DB", strings.Join(changed, ",")))
+}
+
+//DbImageEnv returns the env of the DB container for the character sets,edition and archivelog mode of a new DB,
+//as the Oracle database container images read them
+func DbImageEnv(db *operatorv1.OracleDatabaseSpec) []corev1.EnvVar {
+	var env []corev1.EnvVar
+	if db.CharacterSet != "" {
+		env = append(env, corev1.EnvVar{Name: "ORACLE_CHARACTERSET", Value: strings.ToUpper(db.CharacterSet)})
+	}
+	if db.NationalCharacterSet != "" {
+		env = append(env, corev1.EnvVar{Name: "ORACLE_NATIONAL_CHARACTERSET", Value: db.NationalCharacterSet})
+	}
+	switch db.Edition {
+	case operatorv1.DbEditionEE:
+		env = append(env, corev1.EnvVar{Name: "ORACLE_EDITION", Value: "enterprise"})
+	case operatorv1.DbEditionSE2:
+		env = append(env, corev1.EnvVar{Name: "ORACLE_EDITION", Value: "standard"})
+	}
+	if db.EnableArchiveLog {
+		env = append(env, corev1.EnvVar{Name: "ENABLE_ARCHIVELOG", Value: "true"})
+	}
+	return env
+}
+
+//DbCredentialsSecretName returns the name of the secret holding the sys and Apex admin passwords of an OracleDatabase
+func DbCredentialsSecretName(oradb *operatorv1.OracleDatabase) string {
+	return oradb.Spec.Dbname + "-apexords-db-credentials"
+}
+
+//CdbDatabase returns the settings to connect to the root container of the DB,its service is the CDB name
+func CdbDatabase(db *operatorv1.OracleDatabaseSpec) *operatorv1.OracleDatabaseSpec {
+	cdb := *db
+	cdb.Dbservice = cdb.Dbname
+	if cdb.TLS != nil {
+		//a tnsnames.ora alias names the PDB service,connect to the root with a TCPS descriptor
+		cdbtls := *cdb.TLS
+		cdbtls.TNSAlias = ""
+		cdb.TLS = &cdbtls
+	}
+	return &cdb
+}
+
+//setControllerReference makes owner the controller of obj,so obj is garbage collected with owner and
+//its changes reconcile owner. The kind of owner comes from the scheme,objects read from the cache have none
+func setControllerReference(owner client.Object, obj client.Object, s *runtime.Scheme, step string) error {
+	if err := controllerutil.SetControllerReference(owner, obj, s); err != nil {
+		return TerminalError(step, ReasonCreateFailed, fmt.Errorf("unable to set the owner of %s: %v", obj.GetName(), err))
+	}
+	return nil
+}
+
+//writeCredentialsSecret writes the sys password to the secret Secretname owned by owner unless it has one. An Apex Internal
+//Workspace admin password in the secret is kept,ie one set before the install,otherwise a random one is written.
+func writeCredentialsSecret(ctx context.Context, c client.Client, s *runtime.Scheme, owner client.Object, Secretname string, Dbpassword string) error {
+	var genErr error
+	_, err := saveCredentials(ctx, c, s, owner, Secretname, func(cr *Credentials) {
+		//the DB statefulset may have been created with the sys password of the secret already,
+		//a new one of database.credentials is set by UpdateSysPassword once Apex is installed
+		if cr.Sys == "" {
+			cr.Sys = Dbpassword
+		}
+		//updatepass.sql sets the sys password for the public users,a rotation changes it later
+		if cr.Public == "" {
+			cr.Public = cr.Sys
+		}
+		if cr.ApexAdmin == "" {
+			cr.ApexAdmin, genErr = GeneratePassword(16, true)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if genErr != nil {
+		return RetryableError(StepApex, ReasonCreateFailed, fmt.Errorf("unable to generate the Apex admin password: %v", genErr))
+	}
+	return nil
+}
+
+//warnf records a warning event on the owner and counts the failure of the step
+func (d *DatabaseInstaller) warnf(step string, reason string, messageFmt string, args ...interface{}) {
+	StepFailures.WithLabelValues(step, reason).Inc()
+	d.Recorder.Eventf(d.Owner, corev1.EventTypeWarning, reason, messageFmt, args...)
+}
+
+//CreateDbstsOption to create db statefulset and service,each is looked up by its name
+func (d *DatabaseInstaller) CreateDbstsOption(req ctrl.Request) error {
+	ctx := context.Background()
+	_ = log.FromContext(ctx)
+	db := d.Database
+
+	//check if DB stateful exists, if not create one
+	found, err := d.findDbObject(ctx, req, &appsv1.StatefulSet{}, db.Dbname+"-apexords-db-sts")
+	if err != nil {
+		return err
+	}
+	if !found {
+		if err := d.CreateDbOption(req); err != nil {
+			log.Log.Error(err, "unable to create Apexords operator DB statefulset.")
+			return err
+		}
+	}
+
+	//check if DB service exists, if not create one
+	found, err = d.findDbObject(ctx, req, &corev1.Service{}, db.Dbname+"-apexords-db-svc")
+	if err != nil {
+		return err
+	}
+	if !found {
+		if err := d.CreateDbSvcOption(req); err != nil {
+			log.Log.Error(err, "unable to create Apexords operator k8s service for DB")
+			return err
+		}
+	}
+	return nil
+}
+
+//findDbObject gets the DB object name into obj,it returns false when it does not exist.
+//An object of another resource with the same dbname is an error,a DB is shared through spec.databaseref only
+func (d *DatabaseInstaller) findDbObject(ctx context.Context, req ctrl.Request, obj client.Object, name string) (bool, error) {
+	if err := d.Client.Get(ctx, client.ObjectKey{Namespace: req.Namespace, Name: name}, obj); err != nil {
+		if apierrors.IsNotFound(err) {
+			log.Log.Info("unable to find " + name + ",going to create new one..")
+			return false, nil
+		}
+		log.Log.Error(err, "unable to get "+name)
+		return false, RetryableError(StepDatabase, ReasonDbFailed, err)
+	}
+	if !isOwnedBy(obj, d.Owner) {
+		return false, TerminalError(StepDatabase, ReasonDatabaseInUse, fmt.Errorf("%s belongs to %s %s,dbname %s is taken,reference its OracleDatabase with spec.databaseref to share the DB",
+			name, obj.GetLabels()[LabelName], obj.GetLabels()[LabelInstance], d.Database.Dbname))
+	}
+	log.Log.Info(name + " exists. Do nothing")
+	return true, nil
+}
+
+//creating runs Creating before a DB object is created
+func (d *DatabaseInstaller) creating() error {
+	if d.Creating == nil {
+		return nil
+	}
+	if err := d.Creating(); err != nil {
+		return RetryableError(StepDatabase, ReasonCreateFailed, fmt.Errorf("unable to record the settings of the DB objects: %v", err))
+	}
+	return nil
+}
+
+//DbPodName returns the name of the pod of the DB statefulset
+func DbPodName(db *operatorv1.OracleDatabaseSpec) string {
+	return db.Dbname + "-apexords-db-sts-0"
+}
+
+//dbPodRunning returns a retryable error until the DB pod runs,a pod being deleted for a restart is not running
+func (d *DatabaseInstaller) dbPodRunning(ctx context.Context, req ctrl.Request) error {
+	dbpodname := DbPodName(d.Database)
+	dbpodstatus := &corev1.Pod{}
+	if err := d.Client.Get(ctx, client.ObjectKey{
+		Namespace: req.NamespacedName.Namespace,
+		Name:      dbpodname,
+	}, dbpodstatus); err != nil {
+		log.Log.Info("waiting for db pod " + dbpodname + " to be created.......")
+		return RetryableError(StepDatabase, ReasonPodNotReady, fmt.Errorf("db pod %s not found: %v", dbpodname, err))
+	}
+	if dbpodstatus.Status.Phase != corev1.PodRunning || !dbpodstatus.ObjectMeta.DeletionTimestamp.IsZero() {
+		log.Log.Info("waiting for db pod " + dbpodname + " to start.......")
+		return RetryableError(StepDatabase, ReasonPodNotReady, fmt.Errorf("db pod %s is %s", dbpodname, dbpodstatus.Status.Phase))
+	}
+	return nil
+}
+
+//CreateApexOption is to create Apex schema in DB
+func (d *DatabaseInstaller) CreateApexOption(ctx context.Context, req ctrl.Request) error {
+	_ = log.FromContext(ctx)
+	db := d.Database
+
+	//verify if DB pod is up and running,if not requeue and check again later instead of blocking the worker
+	if err := d.dbPodRunning(ctx, req); err != nil {
+		return err
+	}
+	log.Log.Info("db pod is started.......")
+	d.Recorder.Event(d.Owner, corev1.EventTypeNormal, ReasonPodReady, "DB pod "+DbPodName(db)+" is running")
+
+	//keep the passwords in a secret,the sqlpluspod reads them from env
+	if err := writeCredentialsSecret(ctx, d.Client, d.Scheme, d.Owner, d.Secretname, d.Dbpassword); err != nil {
+		log.Log.Error(err, "unable to create credentials secret")
+		return err
+	}
+
+	//create sqlpluspod
+	Podname := SqlplusPodName(db)
+	if err := CreateSqlplusPod(d.Client, req, Podname, d.Secretname, db); err != nil {
+		log.Log.Error(err, "unable to create Sqlpluspod")
+		return AsStepError(StepApex, err)
+	}
+	//delete sqlpluspod
+	defer func() {
+		if err := DeleteSqlplusPod(d.Client, req, Podname); err != nil {
+			log.Log.Error(err, "unable to delete Sqlpluspod")
+			d.warnf(StepApex, ReasonPodFailed, "unable to delete sqlpluspod: %v", err)
+		}
+	}()
+	d.Recorder.Event(d.Owner, corev1.EventTypeNormal, ReasonApexInstallStarted, "Installing Apex in "+db.Dbservice)
+	// if Apexruntimeonly is true,run apex runtimeonly installation sql in sqlplispod
+	installsql := "createapex.sql"
+	if db.Apexruntimeonly {
+		log.Log.Info("Create Apex runtime only in Target DB....")
+		installsql = "createapexruntimeonly.sql"
+	} else {
+		log.Log.Info("Create Apex in Target DB....")
+	}
+	connect := DbConnectString(db)
+	output, err := RunSqlplus(ctx, d.Runner, req, Podname, StepApex, connect, installsql, "@"+installsql)
+	d.saveInstallLog(req, installsql, output)
+	if err != nil {
+		log.Log.Error(err, "Error to run Apex installation sql in Sqlpluspod")
+		return ExecError(StepApex, ReasonApexInstallFailed, fmt.Errorf("Apex installation failed in sqlpluspod: %w", err))
+	}
+
+	log.Log.Info("Update Apex schema password in Target DB....")
+	output, err = RunSqlplus(ctx, d.Runner, req, Podname, StepApex, connect, "updatepass.sql", "@updatepass.sql &sys_password")
+	d.saveInstallLog(req, "updatepass.sql", output)
+	if err != nil {
+		log.Log.Error(err, "Error to run updatepass.sql in Sqlpluspod")
+		return ExecError(StepApex, ReasonApexInstallFailed, fmt.Errorf("updating Apex schema passwords failed in sqlpluspod: %w", err))
+	}
+
+	log.Log.Info("Update Apex workspace Admin password in Target DB.....")
+	//the version is queried first,apxchpwd-silent-admin.sql may exit sqlplus
+	output, err = RunSqlplus(ctx, d.Runner, req, Podname, StepApex, connect, "apxchpwd-silent-admin.sql", ApexVersionQuery+"\n@apxchpwd-silent-admin.sql &apex_admin_password")
+	d.saveInstallLog(req, "apxchpwd-silent-admin.sql", output)
+	if err != nil {
+		log.Log.Error(err, "Error to run apxchpwd-silent-admin.sql in Sqlpluspod")
+		return ExecError(StepApex, ReasonApexInstallFailed, fmt.Errorf("updating Apex workspace admin password failed in sqlpluspod: %w", err))
+	}
+	d.ApexVersion = ParseVersion(output)
+	d.Recorder.Event(d.Owner, corev1.EventTypeNormal, ReasonApexInstallFinished, "Apex installation finished in "+db.Dbservice)
+
+	return nil
+}
+
+//DbOrdsPodName returns the name of the ords pod installing the Ords schemas in the dbservice of an OracleDatabase
+func DbOrdsPodName(db *operatorv1.OracleDatabaseSpec) string {
+	return db.Dbname + "-apexords-db-ordspod"
+}
+
+//CreateOrdsSchemaOption installs the Ords schemas in dbservice once for all ApexOrds of the DB,they connect with
+//the public password of the credentials secret. The parameters file carries passwords,it is kept in a secret
+//which is deleted with the ords pod.
+func (d *DatabaseInstaller) CreateOrdsSchemaOption(ctx context.Context, req ctrl.Request) error {
+	_ = log.FromContext(ctx)
+	db := d.Database
+
+	credentials, err := ReadCredentials(ctx, d.Client, req.NamespacedName.Namespace, d.Secretname, d.Dbpassword)
+	if err != nil {
+		return RetryableError(StepOrds, ReasonSecretNotFound, fmt.Errorf("unable to get secret %s: %v", d.Secretname, err))
+	}
+	ordsconfigmap, err := OrdsTemplateConfigMap(db, credentials.Public, d.Dbpassword)
+	if err != nil {
+		return err
+	}
+	Podname := DbOrdsPodName(db)
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      Podname,
+			Namespace: req.NamespacedName.Namespace,
+		},
+	}
+	if _, err := controllerutil.CreateOrUpdate(ctx, d.Client, secret, func() error {
+		secret.ObjectMeta.Labels = mergeLabels(Apexordsoperatorlabel, ComponentLabels(d.Owner, ComponentOrds))
+		secret.Type = corev1.SecretTypeOpaque
+		secret.Data = map[string][]byte{"ords_params.properties": []byte(ordsconfigmap.Data["ords_params.properties"])}
+		return controllerutil.SetControllerReference(d.Owner, secret, d.Scheme)
+	}); err != nil {
+		return RetryableError(StepOrds, ReasonCreateFailed, fmt.Errorf("unable to write secret %s: %v", secret.ObjectMeta.Name, err))
+	}
+	defer func() {
+		if err := d.Client.Delete(ctx, secret); err != nil && !apierrors.IsNotFound(err) {
+			log.Log.Error(err, "unable to delete secret "+secret.ObjectMeta.Name)
+		}
+	}()
+
+	configsource := corev1.VolumeSource{Secret: &corev1.SecretVolumeSource{SecretName: secret.ObjectMeta.Name}}
+	if err := createOrdsPod(d.Client, req, Podname, configsource, db); err != nil {
+		log.Log.Error(err, "unable to create Ords pod")
+		return err
+	}
+	defer func() {
+		if err := deleteOrdsPod(d.Client, req, Podname); err != nil {
+			log.Log.Error(err, "unable to delete Ords pod")
+			d.warnf(StepOrds, ReasonPodFailed, "unable to delete ordspod: %v", err)
+		}
+	}()
+
+	log.Log.Info("Create Ords in Target DB....")
+	d.Recorder.Event(d.Owner, corev1.EventTypeNormal, ReasonOrdsInstallStarted, "Installing Ords schemas in "+db.Dbservice)
+	output, err := ExecPodCmdOutput(ctx, d.Runner, req, Podname, StepOrds, OrdsInstallCommand())
+	d.saveInstallLog(req, "ords-install", output)
+	if err != nil {
+		log.Log.Error(err, "Error to run ords.war install in ordspod")
+		return ExecError(StepOrds, ReasonOrdsInstallFailed, fmt.Errorf("ords.war install failed in ordspod: %w", err))
+	}
+	d.OrdsVersion = ParseVersion(output)
+	d.Recorder.Event(d.Owner, corev1.EventTypeNormal, ReasonOrdsInstallFinished, "Installed Ords schemas in "+db.Dbservice)
+	return nil
+}
+
+//saveInstallLog keeps the output of an install step in the install log of the owner
+func (d *DatabaseInstaller) saveInstallLog(req ctrl.Request, step string, output string) {
+	SaveInstallLog(context.Background(), d.Client, d.Scheme, d.Owner, d.Secretname, step, output)
+}
+
+//CreateDbSvcOption is to create DB service in K8S
+func (d *DatabaseInstaller) CreateDbSvcOption(req ctrl.Request) error {
+	ctx := context.Background()
+	_ = log.FromContext(ctx)
+	db := d.Database
+
+	log.Log.Info("Creating DB service :" + db.Dbname + "-apexords-db-svc")
+
+	//Update service name
+	var oradbselector = map[string]string{
+		"oradbsts": db.Dbname + "-StsSelector",
+	}
+
+	decode := scheme.Codecs.UniversalDeserializer().Decode
+	obj, _, err := decode([]byte(config.OradbSvcyml), nil, nil)
+	if err != nil {
+		log.Log.Error(err, "can't deserialize oradb service yaml")
+		return TerminalError(StepDatabase, ReasonTemplateInvalid, fmt.Errorf("can't deserialize oradb service yaml: %v", err))
+	}
+	oradbsvc, ok := obj.(*corev1.Service)
+	if !ok {
+		return TerminalError(StepDatabase, ReasonTemplateInvalid, fmt.Errorf("oradb service yaml is a %T", obj))
+	}
+	oradbsvc.ObjectMeta.Name = db.Dbname + "-apexords-db-svc"
+	oradbsvc.ObjectMeta.Namespace = req.NamespacedName.Namespace
+	// add owner reference, so easy to clean up
+	if err := setControllerReference(d.Owner, oradbsvc, d.Scheme, StepDatabase); err != nil {
+		return err
+	}
+	oradbsvc.Spec.Selector = oradbselector
+	SetLabels(oradbsvc, d.Owner, ComponentDatabase)
+
+	if err := ApplyOverrides(db.Overrides, oradbsvc); err != nil {
+		return TerminalError(StepDatabase, ReasonOverrideInvalid, err)
+	}
+	if err := d.creating(); err != nil {
+		return err
+	}
+	if created, err := createIfNotExists(ctx, d.Client, oradbsvc); err != nil {
+		log.Log.Error(err, "unable to create DB service")
+		return RetryableError(StepDatabase, ReasonCreateFailed, fmt.Errorf("unable to create DB service %s: %v", oradbsvc.ObjectMeta.Name, err))
+	} else if created {
+		d.Recorder.Event(d.Owner, corev1.EventTypeNormal, ReasonDbServiceCreated, "Created DB service "+oradbsvc.ObjectMeta.Name)
+	}
+
+	return nil
+}
+
+//CreateDbOption function to DB statefulset
+func (d *DatabaseInstaller) CreateDbOption(req ctrl.Request) error {
+	ctx := context.Background()
+	_ = log.FromContext(ctx)
+	db := d.Database
+	apexordsdbstsname := db.Dbname + "-apexords-db-sts"
+	log.Log.Info("Creating DB statefulset :" + apexordsdbstsname)
+	// complete db statefulset  settings
+	decode := scheme.Codecs.UniversalDeserializer().Decode
+	obj, _, err := decode([]byte(config.OradbStsyml), nil, nil)
+	if err != nil {
+		log.Log.Error(err, "can't deserialize oradb sts yaml")
+		return TerminalError(StepDatabase, ReasonTemplateInvalid, fmt.Errorf("can't deserialize oradb sts yaml: %v", err))
+	}
+	oradbsts, ok := obj.(*appsv1.StatefulSet)
+	if !ok {
+		return TerminalError(StepDatabase, ReasonTemplateInvalid, fmt.Errorf("oradb sts yaml is a %T", obj))
+	}
+	oradbsts.ObjectMeta.Name = apexordsdbstsname
+	oradbsts.ObjectMeta.Namespace = req.NamespacedName.Namespace
+
+	//Update selector
+	var oradbselector = map[string]string{
+		"oradbsts": db.Dbname + "-StsSelector",
+	}
+	oradbsts.Spec.Selector.MatchLabels = oradbselector
+	//Update ORACLE_SID ,ORACLE_PDB,ORACLE_PWD
+	oradbsts.Spec.Template.Spec.Containers[0].Env[0].Value = strings.ToUpper(db.Dbname)
+	oradbsts.Spec.Template.Spec.Containers[0].Env[1].Value = strings.ToUpper(db.Dbservice)
+	oradbsts.Spec.Template.Spec.Containers[0].Env[2].Value = d.Dbpassword
+	if db.Credentials != nil || d.SecretSysPassword {
+		//a password of a secret store or a generated one is not written to the statefulset,the DB reads it from the credentials secret
+		if err := writeCredentialsSecret(ctx, d.Client, d.Scheme, d.Owner, d.Secretname, d.Dbpassword); err != nil {
+			return err
+		}
+		oradbsts.Spec.Template.Spec.Containers[0].Env[2] = corev1.EnvVar{
+			Name: "ORACLE_PWD",
+			ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: d.Secretname},
+				Key:                  CredentialsSysPasswordKey,
+			}},
+		}
+	}
+	oradbsts.Spec.Template.Spec.Containers[0].Env = append(oradbsts.Spec.Template.Spec.Containers[0].Env, DbImageEnv(db)...)
+	if db.Image != "" {
+		oradbsts.Spec.Template.Spec.Containers[0].Image = db.Image
+	}
+	Images.ResolveImages(&oradbsts.Spec.Template.Spec)
+	AddImagePullSecrets(&oradbsts.Spec.Template.Spec, db.ImagePullSecrets)
+	oradbsts.Spec.Template.ObjectMeta.Labels = mergeLabels(oradbselector, ComponentLabels(d.Owner, ComponentDatabase))
+	SetLabels(oradbsts, d.Owner, ComponentDatabase)
+	// add owner reference, so easy to clean up
+	if err := setControllerReference(d.Owner, oradbsts, d.Scheme, StepDatabase); err != nil {
+		return err
+	}
+	//update volume mouth and template name
+	oradbvolname := db.Dbname + "-db-pv-storage"
+	oradbsts.Spec.Template.Spec.Containers[0].VolumeMounts[0].Name = oradbvolname
+	oradbsts.Spec.VolumeClaimTemplates[0].ObjectMeta.Name = oradbvolname
+	//fmt.Printf("%v#\n",o.oradbsts.Spec.VolumeClaimTemplates)
+
+	if err := ApplyOverrides(db.Overrides, oradbsts); err != nil {
+		return TerminalError(StepDatabase, ReasonOverrideInvalid, err)
+	}
+	if err := d.creating(); err != nil {
+		return err
+	}
+	if created, err := createIfNotExists(ctx, d.Client, oradbsts); err != nil {
+		log.Log.Error(err, "unable to create DB statefulset")
+		return RetryableError(StepDatabase, ReasonCreateFailed, fmt.Errorf("unable to create DB statefulset %s: %v", apexordsdbstsname, err))
+	} else if created {
+		d.Recorder.Event(d.Owner, corev1.EventTypeNormal, ReasonDbStatefulSetCreated, "Created DB statefulset "+apexordsdbstsname)
+	}
+
+	return nil
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	operatorv1 "apexords-operator/apexords-operator/api/v1"
+)
+
+//DatabaseLockRetryInterval is how soon a reconcile waiting for the lock of its DB is retried
+var DatabaseLockRetryInterval = 15 * time.Second
+
+//DatabaseLocks serializes the scripts run in a DB. ApexOrds,OracleDatabase,PluggableDatabase and OrdsOAuthClient reconciles take
+//the lock of their DB before they run scripts,a reconcile finding it taken requeues instead of blocking a worker.
+//The locks live in the operator process,with leader election only one process reconciles.
+type DatabaseLocks struct {
+	mu      sync.Mutex
+	holders map[string]string
+}
+
+//DbLocks are the DB locks shared by all controllers of the manager
+var DbLocks = &DatabaseLocks{}
+
+//DatabaseLockKey returns the lock of the DB,ApexOrds and OracleDatabases with the same dbname share the DB statefulset
+func DatabaseLockKey(Namespace string, db *operatorv1.OracleDatabaseSpec) string {
+	return Namespace + "/" + strings.ToLower(db.Dbname)
+}
+
+//TryLock takes the lock of key for holder,else it returns the holder of the lock.
+//The holder of the lock takes it again.
+func (l *DatabaseLocks) TryLock(key string, holder string) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if current, ok := l.holders[key]; ok && current != holder {
+		return current, false
+	}
+	if l.holders == nil {
+		l.holders = map[string]string{}
+	}
+	l.holders[key] = holder
+	return holder, true
+}
+
+//Unlock releases the lock of key if holder has it
+func (l *DatabaseLocks) Unlock(key string, holder string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.holders[key] == holder {
+		delete(l.holders, key)
+	}
+}
+
+//lockDatabase takes the lock of the DB for owner,its kind and name are the holder. While another resource holds
+//the lock the WaitingForDatabase condition of owner is set and unlock is nil. changed tells to save the status.
+func lockDatabase(recorder record.EventRecorder, owner client.Object, kind string, conditions *[]metav1.Condition, db *operatorv1.OracleDatabaseSpec) (unlock func(), changed bool) {
+	key := DatabaseLockKey(owner.GetNamespace(), db)
+	holder := kind + " " + owner.GetName()
+	current, ok := DbLocks.TryLock(key, holder)
+	if !ok {
+		message := "waiting for " + current + " to finish its scripts in DB " + db.Dbname
+		if !meta.IsStatusConditionTrue(*conditions, operatorv1.ConditionWaitingForDatabase) {
+			log.Log.Info(holder + " is " + message)
+			recorder.Event(owner, corev1.EventTypeNormal, ReasonDatabaseBusy, message)
+		}
+		return nil, setWaitingCondition(conditions, owner.GetGeneration(), metav1.ConditionTrue, ReasonDatabaseBusy, message)
+	}
+	unlock = func() { DbLocks.Unlock(key, holder) }
+	if meta.FindStatusCondition(*conditions, operatorv1.ConditionWaitingForDatabase) == nil {
+		return unlock, false
+	}
+	return unlock, setWaitingCondition(conditions, owner.GetGeneration(), metav1.ConditionFalse, ReasonDatabaseLocked, "runs its scripts in DB "+db.Dbname)
+}
+
+//setWaitingCondition sets the WaitingForDatabase condition,it returns whether it changed
+func setWaitingCondition(conditions *[]metav1.Condition, generation int64, status metav1.ConditionStatus, reason string, message string) bool {
+	if current := meta.FindStatusCondition(*conditions, operatorv1.ConditionWaitingForDatabase); current != nil &&
+		current.Status == status && current.Reason == reason && current.Message == message {
+		return false
+	}
+	meta.SetStatusCondition(conditions, metav1.Condition{
+		Type:               operatorv1.ConditionWaitingForDatabase,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: generation,
+	})
+	return true
+}
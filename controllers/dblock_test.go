@@ -0,0 +1,75 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sync"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	operatorv1 "apexords-operator/apexords-operator/api/v1"
+)
+
+var _ = Describe("DatabaseLocks", func() {
+	It("keys the locks by namespace and dbname", func() {
+		Expect(DatabaseLockKey("tenant-a", &operatorv1.OracleDatabaseSpec{Dbname: "DevCdb"})).To(Equal("tenant-a/devcdb"))
+	})
+
+	It("gives the lock to one holder at a time", func() {
+		locks := &DatabaseLocks{}
+		holder, ok := locks.TryLock("ns/devcdb", "ApexOrds first")
+		Expect(ok).To(BeTrue())
+		Expect(holder).To(Equal("ApexOrds first"))
+
+		holder, ok = locks.TryLock("ns/devcdb", "ApexOrds second")
+		Expect(ok).To(BeFalse())
+		Expect(holder).To(Equal("ApexOrds first"))
+		_, ok = locks.TryLock("ns/testcdb", "ApexOrds second")
+		Expect(ok).To(BeTrue())
+		_, ok = locks.TryLock("ns/devcdb", "ApexOrds first")
+		Expect(ok).To(BeTrue())
+
+		//only the holder releases the lock
+		locks.Unlock("ns/devcdb", "ApexOrds second")
+		_, ok = locks.TryLock("ns/devcdb", "ApexOrds second")
+		Expect(ok).To(BeFalse())
+		locks.Unlock("ns/devcdb", "ApexOrds first")
+		_, ok = locks.TryLock("ns/devcdb", "ApexOrds second")
+		Expect(ok).To(BeTrue())
+	})
+
+	It("lets only one of concurrent holders in", func() {
+		locks := &DatabaseLocks{}
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		var winners []string
+		for _, holder := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+			wg.Add(1)
+			go func(holder string) {
+				defer wg.Done()
+				if _, ok := locks.TryLock("ns/devcdb", holder); ok {
+					mu.Lock()
+					winners = append(winners, holder)
+					mu.Unlock()
+				}
+			}(holder)
+		}
+		wg.Wait()
+		Expect(winners).To(HaveLen(1))
+	})
+})
@@ -0,0 +1,197 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	operatorv1 "apexords-operator/apexords-operator/api/v1"
+)
+
+//marker printed in front of the parameters waiting for a restart by the sqlplus script
+const dbParameterMarker = "APEXORDSPARAM:"
+
+var dbParameterName = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+//a value is a list of numbers with an optional size unit,names and 'quoted strings',so it can't add clauses
+//like scope= or sid= of its own to ALTER SYSTEM
+var dbParameterValue = regexp.MustCompile(`^\s*` + dbParameterItem + `(\s*,\s*` + dbParameterItem + `)*\s*$`)
+
+const dbParameterItem = `(\d+(\.\d+)?[KMGTPkmgtp]?|[A-Za-z_][A-Za-z0-9_$#]*|'([^'\n\r;]|'')*')`
+
+//DbParameterNames returns the names of the DB parameters of the spec in lower case and sorted
+func DbParameterNames(db *operatorv1.OracleDatabaseSpec) []string {
+	var names []string
+	for name := range db.Parameters {
+		names = append(names, strings.ToLower(name))
+	}
+	sort.Strings(names)
+	return names
+}
+
+//ValidateDbParameters checks the names and values of the DB parameters can go into ALTER SYSTEM
+func ValidateDbParameters(params map[string]string) error {
+	for name, value := range params {
+		if !dbParameterName.MatchString(strings.ToLower(name)) {
+			return fmt.Errorf("database.parameters: %s is no parameter name", name)
+		}
+		if strings.ContainsAny(value, ";\n\r") || !dbParameterValue.MatchString(value) {
+			return fmt.Errorf("database.parameters: value %q of %s is invalid,use numbers,names or 'quoted strings' separated by commas", value, name)
+		}
+	}
+	return nil
+}
+
+//DbParametersScript sets the parameters in the CDB,dynamic ones with scope both,static ones in the spfile.
+//It prints the parameters whose spfile value differs from the value the instance runs with,which wait for a restart
+func DbParametersScript(db *operatorv1.OracleDatabaseSpec) string {
+	values := map[string]string{}
+	for name, value := range db.Parameters {
+		values[strings.ToLower(name)] = strings.TrimSpace(value)
+	}
+	names := DbParameterNames(db)
+
+	script := "set heading off feedback off pagesize 0 linesize 400 serveroutput on\n" +
+		"declare\n" +
+		"  procedure set_parameter(p_name varchar2, p_value varchar2) is\n" +
+		"    l_modifiable varchar2(9);\n" +
+		"  begin\n" +
+		"    select issys_modifiable into l_modifiable from v$parameter where name = p_name;\n" +
+		"    if l_modifiable = 'FALSE' then\n" +
+		"      execute immediate 'alter system set ' || p_name || ' = ' || p_value || ' scope = spfile';\n" +
+		"    else\n" +
+		"      execute immediate 'alter system set ' || p_name || ' = ' || p_value || ' scope = both';\n" +
+		"    end if;\n" +
+		"  exception\n" +
+		"    when no_data_found then\n" +
+		"      raise_application_error(-20001, 'unknown parameter ' || p_name);\n" +
+		"  end;\n" +
+		"begin\n"
+	var quoted []string
+	for _, name := range names {
+		script += "  set_parameter(" + sqlQuote(name) + ", " + sqlQuote(values[name]) + ");\n"
+		quoted = append(quoted, sqlQuote(name))
+	}
+	script += "end;\n" +
+		"/\n" +
+		"select '" + dbParameterMarker + "' || p.name from v$parameter p, v$spparameter s\n" +
+		" where s.name = p.name and s.sid = '*' and p.name in (" + strings.Join(quoted, ", ") + ")\n" +
+		"   and nvl(upper(s.display_value), '-') <> nvl(upper(p.display_value), '-')\n" +
+		" order by p.name;\n"
+	return script
+}
+
+//ApplyDbParameters sets the DB parameters from a sqlpluspod connected to the CDB root and returns the ones waiting for a restart
+func (d *DatabaseInstaller) ApplyDbParameters(ctx context.Context, req ctrl.Request) ([]string, error) {
+	if err := d.dbPodRunning(ctx, req); err != nil {
+		return nil, err
+	}
+	cdb := CdbDatabase(d.Database)
+
+	Podname := SqlplusPodName(d.Database)
+	if err := CreateSqlplusPod(d.Client, req, Podname, d.Secretname, cdb); err != nil {
+		log.Log.Error(err, "unable to create Sqlpluspod")
+		return nil, AsStepError(StepParameters, err)
+	}
+	defer func() {
+		if err := DeleteSqlplusPod(d.Client, req, Podname); err != nil {
+			log.Log.Error(err, "unable to delete Sqlpluspod")
+			d.warnf(StepParameters, ReasonPodFailed, "unable to delete sqlpluspod: %v", err)
+		}
+	}()
+
+	log.Log.Info("Set DB parameters " + strings.Join(DbParameterNames(d.Database), ",") + " in " + d.Database.Dbname)
+	output, err := RunSqlplus(ctx, d.Runner, req, Podname, StepParameters, DbConnectString(cdb), "DB parameters", DbParametersScript(d.Database))
+	if err != nil {
+		log.Log.Error(err, "Error to set DB parameters in Sqlpluspod")
+		return nil, ExecError(StepParameters, ReasonParametersFailed, fmt.Errorf("setting DB parameters failed in sqlpluspod: %w", err))
+	}
+	var pending []string
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, dbParameterMarker) {
+			pending = append(pending, strings.TrimPrefix(line, dbParameterMarker))
+		}
+	}
+	return pending, nil
+}
+
+//RestartDb deletes the DB pod,the statefulset starts it again with the parameters of the spfile
+func (d *DatabaseInstaller) RestartDb(req ctrl.Request) error {
+	dbpod := &corev1.Pod{}
+	dbpod.ObjectMeta.Name = DbPodName(d.Database)
+	dbpod.ObjectMeta.Namespace = req.NamespacedName.Namespace
+	if err := d.Client.Delete(context.Background(), dbpod); client.IgnoreNotFound(err) != nil {
+		return RetryableError(StepParameters, ReasonPodFailed, fmt.Errorf("unable to restart db pod %s: %v", dbpod.ObjectMeta.Name, err))
+	}
+	return nil
+}
+
+//DbParametersStep sets the DB parameters once per generation of the spec and restarts the DB for the static ones
+//with restartpolicy Automatic,at most once per generation. It returns the ParametersApplied condition to save and
+//the parameters waiting for a restart,a nil condition when there is nothing to do. The condition has reason
+//DbRestarting while the DB restarts,the step runs again once the DB pod is back.
+func (d *DatabaseInstaller) DbParametersStep(ctx context.Context, req ctrl.Request, conditions []metav1.Condition, generation int64) (*metav1.Condition, []string, error) {
+	if len(d.Database.Parameters) == 0 {
+		return nil, nil, nil
+	}
+	applied := meta.FindStatusCondition(conditions, operatorv1.ConditionParametersApplied)
+	restarted := applied != nil && applied.ObservedGeneration == generation && applied.Reason == ReasonDbRestarting
+	if applied != nil && applied.ObservedGeneration == generation && !restarted {
+		return nil, nil, nil
+	}
+
+	pending, err := d.ApplyDbParameters(ctx, req)
+	if err != nil {
+		return nil, nil, err
+	}
+	condition := &metav1.Condition{
+		Type:    operatorv1.ConditionParametersApplied,
+		Status:  metav1.ConditionTrue,
+		Reason:  ReasonParametersApplied,
+		Message: "DB parameters " + strings.Join(DbParameterNames(d.Database), ",") + " are set",
+	}
+	if len(pending) == 0 {
+		return condition, nil, nil
+	}
+
+	condition.Status = metav1.ConditionFalse
+	if d.Database.RestartPolicy == operatorv1.DbRestartAutomatic && !restarted {
+		if err := d.RestartDb(req); err != nil {
+			return nil, nil, err
+		}
+		condition.Reason = ReasonDbRestarting
+		condition.Message = "DB is restarting for " + strings.Join(pending, ",")
+		d.Recorder.Event(d.Owner, corev1.EventTypeNormal, ReasonDbRestarting, condition.Message)
+		return condition, pending, nil
+	}
+	condition.Reason = ReasonRestartRequired
+	condition.Message = strings.Join(pending, ",") + " take effect after a DB restart"
+	d.Recorder.Event(d.Owner, corev1.EventTypeWarning, ReasonRestartRequired, condition.Message)
+	return condition, pending, nil
+}
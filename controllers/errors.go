@@ -0,0 +1,87 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"errors"
+	"fmt"
+
+	"k8s.io/client-go/util/exec"
+)
+
+// StepError is returned by the reconcile steps. It carries the step that failed and a
+// short CamelCase reason used for the Failed condition, events and metrics.
+// Retryable errors are requeued with backoff, terminal errors wait for a spec change.
+type StepError struct {
+	Step      string
+	Reason    string
+	Retryable bool
+	Err       error
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("%s step failed (%s): %v", e.Step, e.Reason, e.Err)
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+//RetryableError wraps err as a failure which is expected to go away,ie pod not started yet
+func RetryableError(step string, reason string, err error) *StepError {
+	return &StepError{Step: step, Reason: reason, Retryable: true, Err: err}
+}
+
+//TerminalError wraps err as a failure which needs the user to fix something first
+func TerminalError(step string, reason string, err error) *StepError {
+	return &StepError{Step: step, Reason: reason, Retryable: false, Err: err}
+}
+
+//ExecError wraps the error of a command run in a pod. A non zero exit code or a sqlplus error means the
+//script itself failed and is terminal,anything else (stream,connection,DB not open yet) is retried.
+func ExecError(step string, reason string, err error) *StepError {
+	var sqlErr *SqlplusError
+	if errors.As(err, &sqlErr) {
+		if sqlErr.Transient() {
+			return RetryableError(step, reason, err)
+		}
+		return TerminalError(step, reason, err)
+	}
+	var exitErr exec.ExitError
+	if errors.As(err, &exitErr) {
+		return TerminalError(step, reason, err)
+	}
+	return RetryableError(step, reason, err)
+}
+
+//AsStepError returns err as a StepError,errors without step details are retryable
+func AsStepError(step string, err error) *StepError {
+	var stepErr *StepError
+	if errors.As(err, &stepErr) {
+		return stepErr
+	}
+	return RetryableError(step, "Error", err)
+}
+
+//IsRetryable tells if the reconcile should be requeued for err
+func IsRetryable(err error) bool {
+	var stepErr *StepError
+	if errors.As(err, &stepErr) {
+		return stepErr.Retryable
+	}
+	return true
+}
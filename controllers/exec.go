@@ -0,0 +1,317 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gorilla/websocket"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/httpstream"
+	utilremotecommand "k8s.io/apimachinery/pkg/util/remotecommand"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/remotecommand"
+	"k8s.io/client-go/transport/spdy"
+	"k8s.io/client-go/util/exec"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// Protocols of the pods/exec subresource a CommandRunner can speak
+const (
+	ExecProtocolSPDY      = "spdy"
+	ExecProtocolWebSocket = "websocket"
+)
+
+// CommandResult is what a command run in a pod printed and its exit code
+type CommandResult struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+// CommandRunner runs a command in the first container of a pod. A command which ran but
+// exited non zero returns its result together with an exec.ExitError.
+type CommandRunner interface {
+	Run(ctx context.Context, Namespace string, Podname string, Command []string, stdin io.Reader) (CommandResult, error)
+}
+
+// SPDYCommandRunner runs commands through the pods/exec subresource of the API server
+type SPDYCommandRunner struct {
+	config    *rest.Config
+	clientset kubernetes.Interface
+}
+
+//NewSPDYCommandRunner creates the clientset once for all commands
+func NewSPDYCommandRunner(cfg *rest.Config) (*SPDYCommandRunner, error) {
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &SPDYCommandRunner{config: cfg, clientset: clientset}, nil
+}
+
+// Run streams the command output into buffers. The connection is closed when ctx is done,the Stream of
+// this client-go version takes no context.
+func (r *SPDYCommandRunner) Run(ctx context.Context, Namespace string, Podname string, Command []string, stdin io.Reader) (CommandResult, error) {
+	execReq := r.clientset.CoreV1().RESTClient().Post().
+		Resource("pods").
+		Name(Podname).
+		Namespace(Namespace).
+		SubResource("exec")
+
+	execReq.VersionedParams(&corev1.PodExecOptions{
+		Command: Command,
+		Stdin:   stdin != nil,
+		Stdout:  true,
+		Stderr:  true,
+	}, scheme.ParameterCodec)
+
+	transport, upgrader, err := spdy.RoundTripperFor(r.config)
+	if err != nil {
+		log.Log.Error(err, "error while creating SPDY transport:")
+		return CommandResult{}, err
+	}
+	executor, err := remotecommand.NewSPDYExecutorForTransports(transport, &contextUpgrader{ctx: ctx, Upgrader: upgrader}, "POST", execReq.URL())
+	if err != nil {
+		log.Log.Error(err, "error while creating Executor:")
+		return CommandResult{}, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	err = executor.Stream(remotecommand.StreamOptions{
+		Stdin:  stdin,
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Tty:    false,
+	})
+	result := CommandResult{Stdout: stdout.String(), Stderr: stderr.String()}
+	if ctx.Err() != nil {
+		return result, ctx.Err()
+	}
+	var exitErr exec.ExitError
+	if errors.As(err, &exitErr) {
+		result.ExitCode = exitErr.ExitStatus()
+	}
+	return result, err
+}
+
+//contextUpgrader closes the upgraded exec connection when ctx is done,so Stream returns
+type contextUpgrader struct {
+	spdy.Upgrader
+	ctx context.Context
+}
+
+func (u *contextUpgrader) NewConnection(resp *http.Response) (httpstream.Connection, error) {
+	conn, err := u.Upgrader.NewConnection(resp)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		select {
+		case <-u.ctx.Done():
+			conn.Close()
+		case <-conn.CloseChan():
+		}
+	}()
+	return conn, nil
+}
+
+// WebSocketCommandRunner runs commands through the pods/exec subresource with the v4.channel.k8s.io
+// WebSocket protocol,for API servers or proxies which don't pass SPDY. Stdin is not supported,the protocol
+// can't close it.
+type WebSocketCommandRunner struct {
+	config    *rest.Config
+	clientset kubernetes.Interface
+	//auth adds the credentials of config to a request
+	auth http.RoundTripper
+}
+
+//NewWebSocketCommandRunner creates the clientset and the auth wrappers of cfg once for all commands
+func NewWebSocketCommandRunner(cfg *rest.Config) (*WebSocketCommandRunner, error) {
+	clientset, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	auth, err := rest.HTTPWrappersForConfig(cfg, headerRecorder{})
+	if err != nil {
+		return nil, err
+	}
+	return &WebSocketCommandRunner{config: cfg, clientset: clientset, auth: auth}, nil
+}
+
+//headerRecorder returns the request with the headers the auth wrappers set as response,it is not sent
+type headerRecorder struct{}
+
+func (headerRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: http.StatusOK, Request: req, Body: http.NoBody}, nil
+}
+
+// Run sends the command in the upgrade request and reads stdout,stderr and the exit status from the channels
+// of the messages. The connection is closed when ctx is done.
+func (r *WebSocketCommandRunner) Run(ctx context.Context, Namespace string, Podname string, Command []string, stdin io.Reader) (CommandResult, error) {
+	if stdin != nil {
+		return CommandResult{}, fmt.Errorf("the WebSocket exec protocol can't send stdin,use %s", ExecProtocolSPDY)
+	}
+	execReq := r.clientset.CoreV1().RESTClient().Get().
+		Resource("pods").
+		Name(Podname).
+		Namespace(Namespace).
+		SubResource("exec")
+	execReq.VersionedParams(&corev1.PodExecOptions{
+		Command: Command,
+		Stdout:  true,
+		Stderr:  true,
+	}, scheme.ParameterCodec)
+	execURL := execReq.URL()
+	header, err := r.header(ctx, execURL)
+	if err != nil {
+		return CommandResult{}, err
+	}
+	tlsConfig, err := rest.TLSConfigFor(r.config)
+	if err != nil {
+		return CommandResult{}, err
+	}
+	switch execURL.Scheme {
+	case "https":
+		execURL.Scheme = "wss"
+	case "http":
+		execURL.Scheme = "ws"
+	}
+	dialer := websocket.Dialer{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: tlsConfig,
+		Subprotocols:    []string{"v4.channel.k8s.io"},
+	}
+	conn, resp, err := dialer.DialContext(ctx, execURL.String(), header)
+	if err != nil {
+		if resp != nil {
+			return CommandResult{}, fmt.Errorf("%v: %s", err, resp.Status)
+		}
+		return CommandResult{}, err
+	}
+	defer conn.Close()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+	return readExecChannels(ctx, conn)
+}
+
+//header returns the headers with the credentials of the config of the runner
+func (r *WebSocketCommandRunner) header(ctx context.Context, execURL *url.URL) (http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, execURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.auth.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Request.Header, nil
+}
+
+//readExecChannels reads the messages of the command until the connection closes. The first byte of a message
+//is its channel,1 stdout,2 stderr and 3 the metav1.Status of the command.
+func readExecChannels(ctx context.Context, conn *websocket.Conn) (CommandResult, error) {
+	var stdout, stderr bytes.Buffer
+	var status []byte
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			result := CommandResult{Stdout: stdout.String(), Stderr: stderr.String()}
+			if ctx.Err() != nil {
+				return result, ctx.Err()
+			}
+			//the status is the last message,the API server may close the connection without a close frame after it
+			if len(status) == 0 && !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseNoStatusReceived) {
+				return result, err
+			}
+			err = execStatusError(status)
+			var exitErr exec.ExitError
+			if errors.As(err, &exitErr) {
+				result.ExitCode = exitErr.ExitStatus()
+			}
+			return result, err
+		}
+		if len(message) == 0 {
+			continue
+		}
+		switch message[0] {
+		case 1:
+			stdout.Write(message[1:])
+		case 2:
+			stderr.Write(message[1:])
+		case 3:
+			status = append(status, message[1:]...)
+		}
+	}
+}
+
+//execStatusError returns the error of the status the API server sends at the end of a command,
+//an exec.CodeExitError for a non zero exit code like the SPDY executor
+func execStatusError(message []byte) error {
+	if len(message) == 0 {
+		return nil
+	}
+	var status metav1.Status
+	if err := json.Unmarshal(message, &status); err != nil {
+		return fmt.Errorf("invalid exec status %q: %v", string(message), err)
+	}
+	if status.Status == metav1.StatusSuccess {
+		return nil
+	}
+	if status.Reason == utilremotecommand.NonZeroExitCodeReason && status.Details != nil {
+		for _, cause := range status.Details.Causes {
+			if cause.Type != utilremotecommand.ExitCodeCauseType {
+				continue
+			}
+			code, err := strconv.Atoi(cause.Message)
+			if err != nil {
+				return fmt.Errorf("invalid exit code %q", cause.Message)
+			}
+			return exec.CodeExitError{Err: fmt.Errorf("command terminated with exit code %d", code), Code: code}
+		}
+	}
+	return errors.New(status.Message)
+}
+
+//NewCommandRunner returns the runner of protocol,spdy or websocket
+func NewCommandRunner(cfg *rest.Config, protocol string) (CommandRunner, error) {
+	switch protocol {
+	case "", ExecProtocolSPDY:
+		return NewSPDYCommandRunner(cfg)
+	case ExecProtocolWebSocket:
+		return NewWebSocketCommandRunner(cfg)
+	}
+	return nil, fmt.Errorf("unknown exec protocol %q,use %s or %s", protocol, ExecProtocolSPDY, ExecProtocolWebSocket)
+}
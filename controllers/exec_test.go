@@ -0,0 +1,121 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	utilremotecommand "k8s.io/apimachinery/pkg/util/remotecommand"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/util/exec"
+)
+
+var _ = Describe("WebSocketCommandRunner", func() {
+	var (
+		server   *httptest.Server
+		requests chan *http.Request
+		//status is sent on the error channel after the output,nil hangs until the client goes away
+		status *metav1.Status
+	)
+
+	BeforeEach(func() {
+		requests = make(chan *http.Request, 1)
+		status = &metav1.Status{Status: metav1.StatusSuccess}
+		upgrader := websocket.Upgrader{Subprotocols: []string{"v4.channel.k8s.io"}}
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			requests <- req
+			conn, err := upgrader.Upgrade(w, req, nil)
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			_ = conn.WriteMessage(websocket.BinaryMessage, []byte("\x01out"))
+			_ = conn.WriteMessage(websocket.BinaryMessage, []byte("\x02err"))
+			if status == nil {
+				_, _, _ = conn.ReadMessage()
+				return
+			}
+			data, _ := json.Marshal(status)
+			_ = conn.WriteMessage(websocket.BinaryMessage, append([]byte{3}, data...))
+		}))
+	})
+	AfterEach(func() {
+		server.Close()
+	})
+
+	run := func(ctx context.Context) (CommandResult, error) {
+		runner, err := NewCommandRunner(&rest.Config{Host: server.URL, BearerToken: "token"}, ExecProtocolWebSocket)
+		Expect(err).NotTo(HaveOccurred())
+		return runner.Run(ctx, "ns", "pod", []string{"/bin/sh", "-c", "echo out"}, nil)
+	}
+
+	It("runs the command with the credentials of the config and reads stdout and stderr", func() {
+		result, err := run(context.Background())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result).To(Equal(CommandResult{Stdout: "out", Stderr: "err"}))
+
+		var req *http.Request
+		Expect(requests).To(Receive(&req))
+		Expect(req.URL.Path).To(Equal("/api/v1/namespaces/ns/pods/pod/exec"))
+		Expect(req.URL.Query()["command"]).To(Equal([]string{"/bin/sh", "-c", "echo out"}))
+		Expect(req.URL.Query().Get("stdin")).To(BeEmpty())
+		Expect(req.Header.Get("Authorization")).To(Equal("Bearer token"))
+	})
+
+	It("returns the exit code of a failed command", func() {
+		status = &metav1.Status{
+			Status: metav1.StatusFailure,
+			Reason: utilremotecommand.NonZeroExitCodeReason,
+			Details: &metav1.StatusDetails{Causes: []metav1.StatusCause{
+				{Type: utilremotecommand.ExitCodeCauseType, Message: "3"},
+			}},
+		}
+		result, err := run(context.Background())
+		var exitErr exec.ExitError
+		Expect(errors.As(err, &exitErr)).To(BeTrue())
+		Expect(exitErr.ExitStatus()).To(Equal(3))
+		Expect(result.ExitCode).To(Equal(3))
+		Expect(result.Stdout).To(Equal("out"))
+	})
+
+	It("stops when the context is done", func() {
+		status = nil
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		_, err := run(ctx)
+		Expect(err).To(MatchError(context.DeadlineExceeded))
+	})
+
+	It("rejects stdin and unknown protocols", func() {
+		runner, err := NewCommandRunner(&rest.Config{Host: server.URL}, ExecProtocolWebSocket)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = runner.Run(context.Background(), "ns", "pod", []string{"cat"}, strings.NewReader("in"))
+		Expect(err).To(HaveOccurred())
+		_, err = NewCommandRunner(&rest.Config{Host: server.URL}, "grpc")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,124 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// Images of the helper pods,the DB and Ords deployment images are in the templates
+const (
+	SqlplusImage = "henryxie/apexords-operator-instantclient-apex19:v1"
+	OrdsImage    = "henryxie/apexords-operator-apexords:v19"
+)
+
+//ImageConfig points the component images to a private registry,ie the mirror of an air-gapped cluster
+type ImageConfig struct {
+	//Registry with optional path replacing the registry of every image,ie registry.example.com/mirror
+	Registry string `json:"registry,omitempty"`
+
+	//Digests pin images to a digest,keyed by the image as the operator or the spec names it,
+	//ie henryxie/apexords-operator-database:19.2: sha256:...
+	Digests map[string]string `json:"digests,omitempty"`
+}
+
+//Images is the image config of the operator,set by the manager from its flags
+var Images ImageConfig
+
+//LoadImageConfig reads the image config file mounted from a ConfigMap,a missing file is an empty config
+func LoadImageConfig(path string) (ImageConfig, error) {
+	var config ImageConfig
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return config, err
+	}
+	err = yaml.UnmarshalStrict(data, &config)
+	return config, err
+}
+
+//Resolve returns the image pulled from the registry of the config and pinned to its digest if there is one
+func (c ImageConfig) Resolve(image string) string {
+	resolved := image
+	if digest, ok := c.Digests[image]; ok && !strings.Contains(image, "@") {
+		resolved = imageName(image) + "@" + digest
+	}
+	if c.Registry == "" {
+		return resolved
+	}
+	registry := strings.TrimSuffix(c.Registry, "/")
+	if strings.HasPrefix(resolved, registry+"/") {
+		return resolved
+	}
+	//the mirror keeps the repository path,without the registry host of the image
+	if parts := strings.SplitN(resolved, "/", 2); len(parts) == 2 && isRegistryHost(parts[0]) {
+		resolved = parts[1]
+	}
+	return registry + "/" + resolved
+}
+
+//ResolveImages resolves the images of all containers of the pod spec
+func (c ImageConfig) ResolveImages(podspec *corev1.PodSpec) {
+	for i := range podspec.InitContainers {
+		podspec.InitContainers[i].Image = c.Resolve(podspec.InitContainers[i].Image)
+	}
+	for i := range podspec.Containers {
+		podspec.Containers[i].Image = c.Resolve(podspec.Containers[i].Image)
+	}
+}
+
+//AddImagePullSecrets adds the secrets to the pod spec,skipping the ones it has already
+func AddImagePullSecrets(podspec *corev1.PodSpec, secrets []corev1.LocalObjectReference) {
+	podspec.ImagePullSecrets = mergeImagePullSecrets(podspec.ImagePullSecrets, secrets)
+}
+
+func mergeImagePullSecrets(lists ...[]corev1.LocalObjectReference) []corev1.LocalObjectReference {
+	var merged []corev1.LocalObjectReference
+	seen := map[string]bool{}
+	for _, list := range lists {
+		for _, secret := range list {
+			if !seen[secret.Name] {
+				seen[secret.Name] = true
+				merged = append(merged, secret)
+			}
+		}
+	}
+	return merged
+}
+
+//imageName returns the image without tag or digest
+func imageName(image string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image
+}
+
+//isRegistryHost tells if the first component of an image is a registry host rather than a Docker Hub user
+func isRegistryHost(component string) bool {
+	return strings.ContainsAny(component, ".:") || component == "localhost"
+}
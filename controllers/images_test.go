@@ -0,0 +1,71 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ImageConfig", func() {
+	It("keeps the images without a registry or digests", func() {
+		Expect(ImageConfig{}.Resolve("henryxie/apexords-operator-database:19.2")).To(Equal("henryxie/apexords-operator-database:19.2"))
+	})
+
+	It("replaces the registry host and keeps the repository path", func() {
+		images := ImageConfig{Registry: "registry.example.com/mirror/"}
+		Expect(images.Resolve("henryxie/apexords-operator-database:19.2")).To(Equal("registry.example.com/mirror/henryxie/apexords-operator-database:19.2"))
+		Expect(images.Resolve("container-registry.oracle.com/database/enterprise:19.3.0.0")).To(Equal("registry.example.com/mirror/database/enterprise:19.3.0.0"))
+		Expect(images.Resolve("localhost:5000/oradb")).To(Equal("registry.example.com/mirror/oradb"))
+		Expect(images.Resolve("registry.example.com/mirror/oradb:19")).To(Equal("registry.example.com/mirror/oradb:19"))
+	})
+
+	It("pins the configured images to their digest", func() {
+		images := ImageConfig{Digests: map[string]string{
+			"localhost:5000/oradb:19": "sha256:aaaa",
+			"oradb@sha256:bbbb":       "sha256:cccc",
+		}}
+		Expect(images.Resolve("localhost:5000/oradb:19")).To(Equal("localhost:5000/oradb@sha256:aaaa"))
+		Expect(images.Resolve("localhost:5000/oradb:21")).To(Equal("localhost:5000/oradb:21"))
+		Expect(images.Resolve("oradb@sha256:bbbb")).To(Equal("oradb@sha256:bbbb"))
+	})
+
+	It("reads the config file and ignores a missing one", func() {
+		dir, err := ioutil.TempDir("", "images")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+
+		images, err := LoadImageConfig(filepath.Join(dir, "images.yaml"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(images).To(Equal(ImageConfig{}))
+
+		path := filepath.Join(dir, "images.yaml")
+		Expect(ioutil.WriteFile(path, []byte("registry: registry.example.com\ndigests:\n  oradb:19: sha256:aaaa\n"), 0600)).To(Succeed())
+		images, err = LoadImageConfig(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(images.Registry).To(Equal("registry.example.com"))
+		Expect(images.Digests).To(HaveKeyWithValue("oradb:19", "sha256:aaaa"))
+
+		Expect(ioutil.WriteFile(path, []byte("registy: registry.example.com\n"), 0600)).To(Succeed())
+		_, err = LoadImageConfig(path)
+		Expect(err).To(HaveOccurred())
+	})
+})
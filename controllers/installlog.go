@@ -0,0 +1,114 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	operatorv1 "apexords-operator/apexords-operator/api/v1"
+)
+
+const (
+	//the install log keeps the end of the output of each step,a configmap holds 1MiB at most
+	installLogMaxBytes = 64 * 1024
+	//what the passwords of the credentials secret are replaced with in the install log
+	installLogMask = "********"
+)
+
+//InstallLogName returns the name of the configmap with the output of the install steps of owner
+func InstallLogName(owner client.Object) string {
+	switch o := owner.(type) {
+	case *operatorv1.ApexOrds:
+		return o.Spec.Ordsname + "-apexords-install-log"
+	case *operatorv1.OracleDatabase:
+		return o.Spec.Dbname + "-apexords-db-install-log"
+	}
+	return owner.GetName() + "-apexords-install-log"
+}
+
+//SaveInstallLog keeps the output of the install step in the install log configmap of owner,kubectl apexords logs
+//prints it. The passwords of the credentials secret Secretname are masked and the output is cut to its last
+//installLogMaxBytes. A step running again replaces its output. Errors are only logged,the log never fails a step
+func SaveInstallLog(ctx context.Context, c client.Client, s *runtime.Scheme, owner client.Object, Secretname string, step string, output string) {
+	//unmasked output must not end up in a configmap
+	credentials, err := ReadCredentials(ctx, c, owner.GetNamespace(), Secretname, "")
+	if err != nil {
+		log.Log.Error(err, "unable to read secret "+Secretname+",the output of "+step+" is not kept")
+		return
+	}
+	output = maskPasswords(output, credentials)
+	if len(output) > installLogMaxBytes {
+		output = "...\n" + output[len(output)-installLogMaxBytes:]
+	}
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      InstallLogName(owner),
+			Namespace: owner.GetNamespace(),
+		},
+	}
+	if _, err := controllerutil.CreateOrUpdate(ctx, c, cm, func() error {
+		cm.ObjectMeta.Labels = mergeLabels(Apexordsoperatorlabel, ComponentLabels(owner, ComponentInstall))
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		cm.Data[installLogKey(cm.Data, step)] = output
+		return controllerutil.SetControllerReference(owner, cm, s)
+	}); err != nil {
+		log.Log.Error(err, "unable to save the output of "+step+" in configmap "+cm.ObjectMeta.Name)
+	}
+}
+
+//InstallLogKeys returns the keys of the install log in the order the steps first ran
+func InstallLogKeys(data map[string]string) []string {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//installLogKey returns the key of step in the install log,the one it has already or the next number and the step
+func installLogKey(data map[string]string, step string) string {
+	for key := range data {
+		if strings.HasSuffix(key, "-"+step+".log") {
+			return key
+		}
+	}
+	return fmt.Sprintf("%02d-%s.log", len(data)+1, step)
+}
+
+//maskPasswords replaces the passwords of credentials in output
+func maskPasswords(output string, credentials *Credentials) string {
+	for _, password := range []string{credentials.Sys, credentials.ApexAdmin, credentials.Public, credentials.NewSys, credentials.NewApexAdmin, credentials.NewPublic} {
+		if password != "" {
+			output = strings.ReplaceAll(output, password, installLogMask)
+		}
+	}
+	return output
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	operatorv1 "apexords-operator/apexords-operator/api/v1"
+)
+
+//Recommended labels of the generated objects,see https://kubernetes.io/docs/concepts/overview/working-with-objects/common-labels/
+const (
+	LabelName      = "app.kubernetes.io/name"
+	LabelInstance  = "app.kubernetes.io/instance"
+	LabelComponent = "app.kubernetes.io/component"
+	LabelManagedBy = "app.kubernetes.io/managed-by"
+)
+
+//Components of the generated objects
+const (
+	ComponentDatabase    = "database"
+	ComponentOrds        = "ords"
+	ComponentMaintenance = "maintenance"
+	ComponentCredentials = "credentials"
+	ComponentInstall     = "install"
+)
+
+//ManagedBy is the value of the managed-by label of the generated objects
+const ManagedBy = "apexords-operator"
+
+//ownerKind is the kind of the resource in lower case,it is the name label of its objects
+func ownerKind(owner client.Object) string {
+	switch owner.(type) {
+	case *operatorv1.ApexOrds:
+		return "apexords"
+	case *operatorv1.OracleDatabase:
+		return "oracledatabase"
+	case *operatorv1.PluggableDatabase:
+		return "pluggabledatabase"
+	case *operatorv1.OrdsOAuthClient:
+		return "ordsoauthclient"
+	}
+	return ""
+}
+
+//InstanceLabels select the objects generated for owner
+func InstanceLabels(owner client.Object) map[string]string {
+	return map[string]string{
+		LabelName:      ownerKind(owner),
+		LabelInstance:  owner.GetName(),
+		LabelManagedBy: ManagedBy,
+	}
+}
+
+//ComponentLabels select the objects of a component generated for owner
+func ComponentLabels(owner client.Object, component string) map[string]string {
+	labels := InstanceLabels(owner)
+	labels[LabelComponent] = component
+	return labels
+}
+
+//mergeLabels returns a new map with the labels of base and extra,extra wins
+func mergeLabels(base map[string]string, extra map[string]string) map[string]string {
+	labels := make(map[string]string, len(base)+len(extra))
+	for k, v := range base {
+		labels[k] = v
+	}
+	for k, v := range extra {
+		labels[k] = v
+	}
+	return labels
+}
+
+//SetLabels adds the labels of the component of owner to obj,labels of the base manifests are kept
+func SetLabels(obj client.Object, owner client.Object, component string) {
+	obj.SetLabels(mergeLabels(obj.GetLabels(), ComponentLabels(owner, component)))
+}
+
+//isOwnedBy tells whether owner is an owner of obj
+func isOwnedBy(obj client.Object, owner client.Object) bool {
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.UID == owner.GetUID() {
+			return true
+		}
+	}
+	return false
+}
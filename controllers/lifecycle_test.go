@@ -0,0 +1,565 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	operatorv1 "apexords-operator/apexords-operator/api/v1"
+)
+
+// The lifecycle specs drive the reconcilers against envtest from creation to deletion.
+// envtest has no kubelet,scheduler or garbage collector: runPods plays the kubelet for the
+// helper pods and owner references are asserted instead of the cascading delete.
+var _ = Describe("ApexOrds lifecycle", func() {
+	var (
+		ctx       context.Context
+		namespace string
+		runner    *FakeCommandRunner
+		stopPods  func()
+		saved     time.Duration
+	)
+
+	reconcile := func(apexords *operatorv1.ApexOrds) error {
+		r := &ApexOrdsReconciler{Client: k8sClient, Scheme: scheme.Scheme, Recorder: record.NewFakeRecorder(100), Runner: runner}
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(apexords)})
+		return err
+	}
+
+	refresh := func(obj client.Object) client.Object {
+		ExpectWithOffset(1, k8sClient.Get(ctx, client.ObjectKeyFromObject(obj), obj)).To(Succeed())
+		return obj
+	}
+
+	get := func(obj client.Object, name string) client.Object {
+		ExpectWithOffset(1, k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, obj)).To(Succeed())
+		return obj
+	}
+
+	expectOwnedBy := func(obj client.Object, owner *operatorv1.ApexOrds) {
+		refs := obj.GetOwnerReferences()
+		ExpectWithOffset(1, refs).To(HaveLen(1), obj.GetName())
+		ExpectWithOffset(1, refs[0].APIVersion).To(Equal(operatorv1.GroupVersion.String()))
+		ExpectWithOffset(1, refs[0].Kind).To(Equal("ApexOrds"))
+		ExpectWithOffset(1, refs[0].Name).To(Equal(owner.Name))
+		ExpectWithOffset(1, refs[0].UID).To(Equal(owner.UID))
+		ExpectWithOffset(1, *refs[0].Controller).To(BeTrue())
+		ExpectWithOffset(1, *refs[0].BlockOwnerDeletion).To(BeTrue())
+	}
+
+	newApexOrds := func(name string, dbname string, ordsname string) *operatorv1.ApexOrds {
+		apexords := &operatorv1.ApexOrds{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       operatorv1.ApexOrdsSpec{Dbname: dbname, Dbservice: dbname + "pdb", Ordsname: ordsname},
+		}
+		ExpectWithOffset(1, k8sClient.Create(ctx, apexords)).To(Succeed())
+		return apexords
+	}
+
+	startDbPod := func(dbname string) {
+		dbpod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: dbname + "-apexords-db-sts-0", Namespace: namespace},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "oradb", Image: "oradb"}}},
+		}
+		ExpectWithOffset(1, k8sClient.Create(ctx, dbpod)).To(Succeed())
+		EventuallyWithOffset(1, func() corev1.PodPhase {
+			_ = k8sClient.Get(ctx, client.ObjectKeyFromObject(dbpod), dbpod)
+			return dbpod.Status.Phase
+		}).Should(Equal(corev1.PodRunning))
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		runner = &FakeCommandRunner{}
+		saved = PodPollInterval
+		PodPollInterval = 20 * time.Millisecond
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "apexords-lifecycle-"}}
+		Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+		namespace = ns.Name
+		stopPods = runPods(namespace, "devcdb-apexords-db-sts-0", "testcdb-apexords-db-sts-0", "devcdb-apexords-sqlpluspod", "testcdb-apexords-sqlpluspod",
+			"devords-apexords-ordspod", "testords-apexords-ordspod", "devclient-oauth-sqlpluspod")
+	})
+
+	AfterEach(func() {
+		stopPods()
+		PodPollInterval = saved
+	})
+
+	It("creates the DB, Apex and Ords objects with names, selectors, owner and env values", func() {
+		apexords := newApexOrds("apexords-dev", "devcdb", "devords")
+
+		By("requeueing until the DB pod runs")
+		Expect(reconcile(apexords)).To(HaveOccurred())
+		Expect(refresh(apexords).(*operatorv1.ApexOrds).Status.Phase).To(Equal(operatorv1.PhaseInstallingApex))
+		Expect(runner.Commands).To(BeEmpty())
+
+		sts := get(&appsv1.StatefulSet{}, "devcdb-apexords-db-sts").(*appsv1.StatefulSet)
+		expectOwnedBy(sts, apexords)
+		dbselector := map[string]string{"oradbsts": "devcdb-StsSelector"}
+		Expect(sts.Spec.Selector.MatchLabels).To(Equal(dbselector))
+		Expect(sts.Spec.Template.ObjectMeta.Labels).To(Equal(map[string]string{"oradbsts": "devcdb-StsSelector",
+			"app.kubernetes.io/name": "apexords", "app.kubernetes.io/instance": "apexords-dev",
+			"app.kubernetes.io/component": "database", "app.kubernetes.io/managed-by": "apexords-operator"}))
+		Expect(sts.ObjectMeta.Labels).To(HaveKeyWithValue("app", "apexords-operator"))
+		Expect(sts.ObjectMeta.Labels).To(HaveKeyWithValue(LabelInstance, "apexords-dev"))
+		Expect(sts.ObjectMeta.Labels).To(HaveKeyWithValue(LabelComponent, ComponentDatabase))
+		Expect(sts.Spec.Template.Spec.Containers[0].Env).To(Equal([]corev1.EnvVar{
+			{Name: "ORACLE_SID", Value: "DEVCDB"},
+			{Name: "ORACLE_PDB", Value: "DEVCDBPDB"},
+			{Name: "ORACLE_PWD", Value: Autopasswd("devcdb" + "devords")},
+		}))
+		Expect(sts.Spec.VolumeClaimTemplates[0].ObjectMeta.Name).To(Equal("devcdb-db-pv-storage"))
+		Expect(sts.Spec.Template.Spec.Containers[0].VolumeMounts[0].Name).To(Equal("devcdb-db-pv-storage"))
+
+		dbsvc := get(&corev1.Service{}, "devcdb-apexords-db-svc").(*corev1.Service)
+		expectOwnedBy(dbsvc, apexords)
+		Expect(dbsvc.Spec.Selector).To(Equal(dbselector))
+
+		By("installing Apex and Ords once the DB pod runs")
+		startDbPod("devcdb")
+		Expect(reconcile(apexords)).To(Succeed())
+		Expect(refresh(apexords).(*operatorv1.ApexOrds).Status.Phase).To(Equal(operatorv1.PhaseReady))
+		Expect(runner.Commands).To(HaveLen(4))
+
+		ordscm := get(&corev1.ConfigMap{}, "devords-apexords-ords-cm").(*corev1.ConfigMap)
+		expectOwnedBy(ordscm, apexords)
+		credentials := get(&corev1.Secret{}, "devords-apexords-credentials").(*corev1.Secret)
+		for name, file := range ordscm.Data {
+			Expect(file).NotTo(ContainSubstring("password="), name)
+			Expect(file).NotTo(ContainSubstring(`"db.password"`), name)
+			for _, password := range credentials.Data {
+				Expect(file).NotTo(ContainSubstring(string(password)), name)
+			}
+		}
+		ordssecret := get(&corev1.Secret{}, "devords-apexords-ords-secret").(*corev1.Secret)
+		expectOwnedBy(ordssecret, apexords)
+		params := string(ordssecret.Data["ords_params.properties"])
+		Expect(params).To(ContainSubstring("db.hostname=devcdb-apexords-db-svc"))
+		Expect(params).To(ContainSubstring("db.port=1521"))
+		Expect(params).To(ContainSubstring("db.servicename=devcdbpdb"))
+		Expect(params).To(ContainSubstring("sys.password=" + Autopasswd("devcdb"+"devords")))
+		Expect(params).NotTo(ContainSubstring("ordsauto"))
+		Expect(ordssecret.Data).To(HaveKey("apex_pu.xml"))
+		expectOwnedBy(get(&corev1.ConfigMap{}, "devords-apexords-http-cm"), apexords)
+
+		deployment := get(&appsv1.Deployment{}, "devords-apexords-ords-deployment").(*appsv1.Deployment)
+		expectOwnedBy(deployment, apexords)
+		ordsselector := map[string]string{"ordsauto": "devords-DeploymentSelector"}
+		Expect(deployment.Spec.Selector.MatchLabels).To(Equal(ordsselector))
+		Expect(deployment.Spec.Template.ObjectMeta.Labels).To(Equal(mergeLabels(ordsselector, ComponentLabels(apexords, ComponentOrds))))
+		Expect(deployment.ObjectMeta.Labels).To(HaveKeyWithValue(LabelComponent, ComponentOrds))
+		Expect(ordscm.ObjectMeta.Labels).To(HaveKeyWithValue(LabelInstance, "apexords-dev"))
+		secret := get(&corev1.Secret{}, "devords-apexords-credentials")
+		Expect(secret.GetLabels()).To(Equal(map[string]string{"app": "apexords-operator",
+			"app.kubernetes.io/name": "apexords", "app.kubernetes.io/instance": "apexords-dev",
+			"app.kubernetes.io/component": "credentials", "app.kubernetes.io/managed-by": "apexords-operator"}))
+		Expect(deployment.Spec.Template.Spec.Volumes[0].ConfigMap.Name).To(Equal("devords-apexords-http-cm"))
+		Expect(deployment.Spec.Template.Spec.Volumes[1].Projected.Sources[0].ConfigMap.Name).To(Equal("devords-apexords-ords-cm"))
+		Expect(deployment.Spec.Template.Spec.Volumes[1].Projected.Sources[1].Secret.Name).To(Equal("devords-apexords-ords-secret"))
+
+		for _, name := range []string{"devords-apexords-svc", "devords-apexords-nodeport-svc"} {
+			svc := get(&corev1.Service{}, name).(*corev1.Service)
+			expectOwnedBy(svc, apexords)
+			Expect(svc.Spec.Selector).To(Equal(ordsselector))
+		}
+
+		By("cleaning the helper pods")
+		for _, name := range []string{"devcdb-apexords-sqlpluspod", "devords-apexords-ordspod"} {
+			Eventually(func() bool {
+				return apierrors.IsNotFound(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, &corev1.Pod{}))
+			}).Should(BeTrue(), name)
+		}
+	})
+
+	It("recovers when an invalid spec is fixed", func() {
+		apexords := newApexOrds("apexords-dev", "devcdb", "")
+		Expect(reconcile(apexords)).To(Succeed())
+		failed := meta.FindStatusCondition(refresh(apexords).(*operatorv1.ApexOrds).Status.Conditions, operatorv1.ConditionFailed)
+		Expect(failed.Status).To(Equal(metav1.ConditionTrue))
+		Expect(failed.Reason).To(Equal(ReasonInvalidSpec))
+
+		apexords.Spec.Ordsname = "devords"
+		Expect(k8sClient.Update(ctx, apexords)).To(Succeed())
+		startDbPod("devcdb")
+		Expect(reconcile(apexords)).To(Succeed())
+
+		refresh(apexords)
+		Expect(apexords.Status.Phase).To(Equal(operatorv1.PhaseReady))
+		failed = meta.FindStatusCondition(apexords.Status.Conditions, operatorv1.ConditionFailed)
+		Expect(failed.Status).To(Equal(metav1.ConditionFalse))
+		Expect(failed.ObservedGeneration).To(Equal(apexords.Generation))
+		get(&appsv1.Deployment{}, "devords-apexords-ords-deployment")
+	})
+
+	It("fails an inline ApexOrds whose dbname is the DB of another one", func() {
+		apexords := newApexOrds("apexords-dev", "devcdb", "devords")
+		startDbPod("devcdb")
+		Expect(reconcile(apexords)).To(Succeed())
+		Expect(runner.Commands).To(HaveLen(4))
+
+		other := newApexOrds("apexords-test", "devcdb", "testords")
+		Expect(reconcile(other)).To(Succeed())
+		refresh(other)
+		Expect(other.Status.Phase).To(Equal(operatorv1.PhaseFailed))
+		failed := meta.FindStatusCondition(other.Status.Conditions, operatorv1.ConditionFailed)
+		Expect(failed.Reason).To(Equal(ReasonDatabaseInUse))
+		Expect(failed.Message).To(ContainSubstring("apexords apexords-dev"))
+		Expect(failed.Message).To(ContainSubstring("spec.databaseref"))
+		//no Apex install or password change ran in the DB of apexords-dev
+		Expect(runner.Commands).To(HaveLen(4))
+		Expect(meta.IsStatusConditionTrue(other.Status.Conditions, operatorv1.ConditionApexInstalled)).To(BeFalse())
+		expectOwnedBy(get(&appsv1.StatefulSet{}, "devcdb-apexords-db-sts"), apexords)
+		Expect(refresh(apexords).(*operatorv1.ApexOrds).Status.Phase).To(Equal(operatorv1.PhaseReady))
+	})
+
+	It("applies spec updates to a Ready ApexOrds", func() {
+		apexords := newApexOrds("apexords-dev", "devcdb", "devords")
+		startDbPod("devcdb")
+		Expect(reconcile(apexords)).To(Succeed())
+		Expect(runner.Commands).To(HaveLen(4))
+
+		By("setting DB parameters in the running DB")
+		refresh(apexords)
+		apexords.Spec.Database = &operatorv1.DatabaseSpec{Parameters: map[string]string{"processes": "300"}}
+		Expect(k8sClient.Update(ctx, apexords)).To(Succeed())
+		Expect(reconcile(apexords)).To(Succeed())
+		Expect(runner.Commands).To(HaveLen(5))
+		Expect(runner.Commands[4].Podname).To(Equal("devcdb-apexords-sqlpluspod"))
+		Expect(runner.Commands[4].Command[2]).To(ContainSubstring("set_parameter('processes', '300');"))
+		refresh(apexords)
+		applied := meta.FindStatusCondition(apexords.Status.Conditions, operatorv1.ConditionParametersApplied)
+		Expect(applied.Status).To(Equal(metav1.ConditionTrue))
+		Expect(applied.ObservedGeneration).To(Equal(apexords.Generation))
+		Expect(apexords.Status.Phase).To(Equal(operatorv1.PhaseReady))
+
+		By("switching the Ords services to the maintenance page once its rollout completed")
+		apexords.Spec.Maintenance = true
+		Expect(k8sClient.Update(ctx, apexords)).To(Succeed())
+		Expect(reconcile(apexords)).To(Succeed())
+		maintenance := get(&appsv1.Deployment{}, "devords-apexords-maintenance-deployment").(*appsv1.Deployment)
+		expectOwnedBy(maintenance, apexords)
+		expectOwnedBy(get(&corev1.ConfigMap{}, "devords-apexords-maintenance-cm"), apexords)
+		Expect(get(&corev1.Service{}, "devords-apexords-svc").(*corev1.Service).Spec.Selector).To(Equal(OrdsSelector(apexords)))
+		//envtest has no deployment controller,the rollout is done once the status has ready replicas
+		maintenance.Status.Replicas, maintenance.Status.ReadyReplicas = 1, 1
+		Expect(k8sClient.Status().Update(ctx, maintenance)).To(Succeed())
+		Expect(reconcile(apexords)).To(Succeed())
+		for _, name := range []string{"devords-apexords-svc", "devords-apexords-nodeport-svc"} {
+			Expect(get(&corev1.Service{}, name).(*corev1.Service).Spec.Selector).To(Equal(MaintenanceSelector(apexords)), name)
+		}
+		Expect(*get(&appsv1.Deployment{}, "devords-apexords-ords-deployment").(*appsv1.Deployment).Spec.Replicas).To(BeZero())
+		Expect(meta.IsStatusConditionTrue(refresh(apexords).(*operatorv1.ApexOrds).Status.Conditions, operatorv1.ConditionMaintenance)).To(BeTrue())
+
+		//the parameters are set again for the new generation,neither update reinstalls Apex or Ords
+		Expect(runner.Commands).To(HaveLen(6))
+		for _, command := range runner.Commands[4:] {
+			Expect(command.Command[2]).To(ContainSubstring("set_parameter('processes', '300');"))
+		}
+	})
+
+	//The scripts run in helper pods instead of Jobs,a helper pod which terminates is what a finished Job would be
+	It("fails the step when a helper pod terminates before its script ran and installs once it is replaced", func() {
+		stopJobPods := runPods(namespace, "jobcdb-apexords-db-sts-0", "jobords-apexords-ordspod")
+		defer stopJobPods()
+		apexords := newApexOrds("apexords-job", "jobcdb", "jobords")
+		Expect(reconcile(apexords)).To(HaveOccurred())
+		startDbPod("jobcdb")
+
+		podKey := client.ObjectKey{Namespace: namespace, Name: "jobcdb-apexords-sqlpluspod"}
+		terminated := make(chan struct{})
+		go func() {
+			defer GinkgoRecover()
+			defer close(terminated)
+			pod := &corev1.Pod{}
+			Eventually(func() error { return k8sClient.Get(ctx, podKey, pod) }).Should(Succeed())
+			pod.Status.Phase = corev1.PodFailed
+			pod.Status.Message = "OOMKilled"
+			Expect(k8sClient.Status().Update(ctx, pod)).To(Succeed())
+		}()
+		Expect(reconcile(apexords)).To(Succeed())
+		<-terminated
+		refresh(apexords)
+		Expect(apexords.Status.Phase).To(Equal(operatorv1.PhaseFailed))
+		failed := meta.FindStatusCondition(apexords.Status.Conditions, operatorv1.ConditionFailed)
+		Expect(failed.Reason).To(Equal(ReasonPodFailed))
+		Expect(failed.Message).To(ContainSubstring("OOMKilled"))
+		Expect(meta.IsStatusConditionTrue(apexords.Status.Conditions, operatorv1.ConditionApexInstalled)).To(BeFalse())
+		Expect(runner.Commands).To(BeEmpty())
+
+		By("running the scripts in a new pod")
+		Expect(k8sClient.Delete(ctx, &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: podKey.Name}})).To(Succeed())
+		stopSqlplusPod := runPods(namespace, podKey.Name)
+		defer stopSqlplusPod()
+		Expect(reconcile(apexords)).To(Succeed())
+		Expect(refresh(apexords).(*operatorv1.ApexOrds).Status.Phase).To(Equal(operatorv1.PhaseReady))
+		Expect(runner.Commands).To(HaveLen(4))
+		Expect(runner.Commands[0].Podname).To(Equal(podKey.Name))
+	})
+
+	It("keeps two ApexOrds in one namespace apart", func() {
+		dev := newApexOrds("apexords-dev", "devcdb", "devords")
+		test := newApexOrds("apexords-test", "testcdb", "testords")
+		startDbPod("devcdb")
+		startDbPod("testcdb")
+
+		Expect(reconcile(dev)).To(Succeed())
+		Expect(reconcile(test)).To(Succeed())
+		Expect(refresh(dev).(*operatorv1.ApexOrds).Status.Phase).To(Equal(operatorv1.PhaseReady))
+		Expect(refresh(test).(*operatorv1.ApexOrds).Status.Phase).To(Equal(operatorv1.PhaseReady))
+
+		for owner, prefix := range map[*operatorv1.ApexOrds][2]string{dev: {"devcdb", "devords"}, test: {"testcdb", "testords"}} {
+			expectOwnedBy(get(&appsv1.StatefulSet{}, prefix[0]+"-apexords-db-sts"), owner)
+			expectOwnedBy(get(&corev1.Service{}, prefix[0]+"-apexords-db-svc"), owner)
+			expectOwnedBy(get(&appsv1.Deployment{}, prefix[1]+"-apexords-ords-deployment"), owner)
+			expectOwnedBy(get(&corev1.Service{}, prefix[1]+"-apexords-svc"), owner)
+		}
+
+		//the labels of each instance select its objects only
+		for owner, prefix := range map[*operatorv1.ApexOrds][2]string{dev: {"devcdb", "devords"}, test: {"testcdb", "testords"}} {
+			var statefulsets appsv1.StatefulSetList
+			Expect(k8sClient.List(ctx, &statefulsets, client.InNamespace(namespace), client.MatchingLabels(InstanceLabels(owner)))).To(Succeed())
+			Expect(statefulsets.Items).To(HaveLen(1))
+			Expect(statefulsets.Items[0].Name).To(Equal(prefix[0] + "-apexords-db-sts"))
+			var services corev1.ServiceList
+			Expect(k8sClient.List(ctx, &services, client.InNamespace(namespace), client.MatchingLabels(ComponentLabels(owner, ComponentOrds)))).To(Succeed())
+			Expect(services.Items).To(HaveLen(2))
+		}
+
+		//each reconcile installs into its own DB
+		scripts := runner.Scripts()
+		Expect(scripts).To(HaveLen(8))
+		Expect(scripts[0]).To(ContainSubstring("@devcdb-apexords-db-svc:1521/devcdbpdb "))
+		Expect(scripts[4]).To(ContainSubstring("@testcdb-apexords-db-svc:1521/testcdbpdb "))
+	})
+
+	It("deletes an ApexOrds without waiting on finalizers", func() {
+		apexords := newApexOrds("apexords-dev", "devcdb", "devords")
+		startDbPod("devcdb")
+		Expect(reconcile(apexords)).To(Succeed())
+		Expect(refresh(apexords).GetFinalizers()).To(BeEmpty())
+
+		Expect(k8sClient.Delete(ctx, apexords)).To(Succeed())
+		Expect(apierrors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(apexords), apexords))).To(BeTrue())
+		//a reconcile of the deleted object is a no-op
+		Expect(reconcile(apexords)).To(Succeed())
+	})
+
+	It("drops the Ords OAuth client before its finalizer is removed", func() {
+		apexords := newApexOrds("apexords-dev", "devcdb", "devords")
+		runner.Results = func(cmd FakeCommand) (CommandResult, error) {
+			if strings.Contains(cmd.Command[2], "oauth_admin.create_client") {
+				return CommandResult{Stdout: ordsOAuthClientMarker + "clientid1:secret1\n"}, nil
+			}
+			return CommandResult{}, nil
+		}
+		oauthclient := &operatorv1.OrdsOAuthClient{
+			ObjectMeta: metav1.ObjectMeta{Name: "devclient", Namespace: namespace},
+			Spec:       operatorv1.OrdsOAuthClientSpec{ApexOrdsRef: apexords.Name, Schema: "hr", Roles: []operatorv1.OrdsOAuthName{"hr_role"}},
+		}
+		Expect(k8sClient.Create(ctx, oauthclient)).To(Succeed())
+		oauthreconciler := &OrdsOAuthClientReconciler{Client: k8sClient, Scheme: scheme.Scheme, Runner: runner}
+		req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(oauthclient)}
+
+		_, err := oauthreconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		refresh(oauthclient)
+		Expect(controllerutil.ContainsFinalizer(oauthclient, OrdsOAuthClientFinalizer)).To(BeTrue())
+		Expect(oauthclient.Status.ClientID).To(Equal("clientid1"))
+		secret := get(&corev1.Secret{}, "devclient-ords-oauth").(*corev1.Secret)
+		Expect(secret.Data).To(HaveKeyWithValue("client_secret", []byte("secret1")))
+		Expect(runner.Commands).To(HaveLen(1))
+		Expect(runner.Commands[0].Podname).To(Equal("devclient-oauth-sqlpluspod"))
+
+		Expect(k8sClient.Delete(ctx, oauthclient)).To(Succeed())
+		Expect(refresh(oauthclient).GetDeletionTimestamp()).NotTo(BeNil())
+
+		_, err = oauthreconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(runner.Commands).To(HaveLen(2))
+		Expect(runner.Commands[1].Command[2]).To(ContainSubstring("oauth_admin.delete_client(p_schema => 'HR', p_name => c.name)"))
+		Expect(runner.Commands[1].Command[2]).To(ContainSubstring("s.parsing_schema = 'HR' and c.name = 'devclient'"))
+		Expect(runner.Commands[1].Command[2]).NotTo(ContainSubstring("oauth_admin.create_client"))
+		Expect(apierrors.IsNotFound(k8sClient.Get(ctx, req.NamespacedName, oauthclient))).To(BeTrue())
+	})
+
+	It("creates the Ords OAuth client for its schema and rotates its secret keeping the client_id", func() {
+		apexords := newApexOrds("apexords-dev", "devcdb", "devords")
+		secrets := 0
+		runner.Results = func(cmd FakeCommand) (CommandResult, error) {
+			secrets++
+			return CommandResult{Stdout: ordsOAuthClientMarker + "clientid1:secret" + strconv.Itoa(secrets) + "\n"}, nil
+		}
+		oauthclient := &operatorv1.OrdsOAuthClient{
+			ObjectMeta: metav1.ObjectMeta{Name: "devclient", Namespace: namespace},
+			Spec:       operatorv1.OrdsOAuthClientSpec{ApexOrdsRef: apexords.Name, Schema: "hr", Roles: []operatorv1.OrdsOAuthName{"hr_role"}},
+		}
+		Expect(k8sClient.Create(ctx, oauthclient)).To(Succeed())
+		oauthreconciler := &OrdsOAuthClientReconciler{Client: k8sClient, Scheme: scheme.Scheme, Recorder: record.NewFakeRecorder(100), Runner: runner}
+		req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(oauthclient)}
+
+		_, err := oauthreconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(runner.Commands).To(HaveLen(1))
+		script := runner.Commands[0].Command[2]
+		//the session user is sys,the client must belong to the schema and be read from its clients
+		Expect(script).NotTo(ContainSubstring("current_schema"))
+		Expect(script).NotTo(ContainSubstring("user_ords_clients"))
+		Expect(script).To(ContainSubstring("oauth_admin.create_client(\n      p_schema          => 'HR',\n      p_name            => 'devclient',"))
+		Expect(script).To(ContainSubstring("oauth_admin.grant_client_role(p_schema => 'HR', p_client_name => 'devclient', p_role_name => 'hr_role');"))
+		Expect(script).To(ContainSubstring("from ords_metadata.ords_clients c, ords_metadata.ords_schemas s\n where c.schema_id = s.id and s.parsing_schema = 'HR' and c.name = 'devclient'"))
+		Expect(script).NotTo(ContainSubstring("rotate_client_secret"))
+		Expect(script).NotTo(ContainSubstring("delete_client"))
+
+		refresh(oauthclient)
+		oauthclient.Spec.RotationToken = "2"
+		Expect(k8sClient.Update(ctx, oauthclient)).To(Succeed())
+		_, err = oauthreconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(runner.Commands).To(HaveLen(2))
+		script = runner.Commands[1].Command[2]
+		Expect(script).To(ContainSubstring("oauth_admin.rotate_client_secret(\n      p_schema                 => 'HR',\n      p_client_key             => ords_types.oauth_client_key(p_name => 'devclient'),"))
+		Expect(script).NotTo(ContainSubstring("delete_client"))
+		refresh(oauthclient)
+		Expect(oauthclient.Status.ClientID).To(Equal("clientid1"))
+		Expect(oauthclient.Status.ObservedRotationToken).To(Equal("2"))
+		secret := get(&corev1.Secret{}, "devclient-ords-oauth").(*corev1.Secret)
+		Expect(secret.Data).To(HaveKeyWithValue("client_id", []byte("clientid1")))
+		Expect(secret.Data).To(HaveKeyWithValue("client_secret", []byte("secret2")))
+	})
+
+	It("waits with the Ords OAuth client while another resource runs scripts in the DB", func() {
+		apexords := newApexOrds("apexords-dev", "devcdb", "devords")
+		runner.Results = func(cmd FakeCommand) (CommandResult, error) {
+			return CommandResult{Stdout: ordsOAuthClientMarker + "clientid1:secret1\n"}, nil
+		}
+		oauthclient := &operatorv1.OrdsOAuthClient{
+			ObjectMeta: metav1.ObjectMeta{Name: "devclient", Namespace: namespace},
+			Spec:       operatorv1.OrdsOAuthClientSpec{ApexOrdsRef: apexords.Name, Schema: "hr"},
+		}
+		Expect(k8sClient.Create(ctx, oauthclient)).To(Succeed())
+		oauthreconciler := &OrdsOAuthClientReconciler{Client: k8sClient, Scheme: scheme.Scheme, Recorder: record.NewFakeRecorder(100), Runner: runner}
+		req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(oauthclient)}
+
+		key := namespace + "/devcdb"
+		_, ok := DbLocks.TryLock(key, "ApexOrds other")
+		Expect(ok).To(BeTrue())
+		result, err := oauthreconciler.Reconcile(ctx, req)
+		DbLocks.Unlock(key, "ApexOrds other")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(DatabaseLockRetryInterval))
+		Expect(runner.Commands).To(BeEmpty())
+		waiting := meta.FindStatusCondition(refresh(oauthclient).(*operatorv1.OrdsOAuthClient).Status.Conditions, operatorv1.ConditionWaitingForDatabase)
+		Expect(waiting).NotTo(BeNil())
+		Expect(waiting.Status).To(Equal(metav1.ConditionTrue))
+		Expect(waiting.Message).To(ContainSubstring("ApexOrds other"))
+
+		_, err = oauthreconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(runner.Commands).To(HaveLen(1))
+		refresh(oauthclient)
+		Expect(oauthclient.Status.ClientID).To(Equal("clientid1"))
+		Expect(meta.IsStatusConditionFalse(oauthclient.Status.Conditions, operatorv1.ConditionWaitingForDatabase)).To(BeTrue())
+	})
+
+	It("fails an Ords OAuth client with an invalid spec until it is fixed", func() {
+		apexords := newApexOrds("apexords-dev", "devcdb", "devords")
+		runner.Results = func(cmd FakeCommand) (CommandResult, error) {
+			return CommandResult{Stdout: ordsOAuthClientMarker + "clientid1:secret1\n"}, nil
+		}
+		oauthclient := &operatorv1.OrdsOAuthClient{
+			ObjectMeta: metav1.ObjectMeta{Name: "devclient", Namespace: namespace},
+			Spec:       operatorv1.OrdsOAuthClientSpec{Schema: "hr"},
+		}
+		Expect(k8sClient.Create(ctx, oauthclient)).To(Succeed())
+		recorder := record.NewFakeRecorder(100)
+		oauthreconciler := &OrdsOAuthClientReconciler{Client: k8sClient, Scheme: scheme.Scheme, Recorder: recorder, Runner: runner}
+		req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(oauthclient)}
+
+		result, err := oauthreconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Requeue).To(BeFalse())
+		Expect(runner.Commands).To(BeEmpty())
+		Expect(recorder.Events).To(Receive(ContainSubstring(ReasonInvalidSpec)))
+		refresh(oauthclient)
+		Expect(oauthclient.Status.Phase).To(Equal(operatorv1.PhaseFailed))
+		failed := meta.FindStatusCondition(oauthclient.Status.Conditions, operatorv1.ConditionFailed)
+		Expect(failed.Status).To(Equal(metav1.ConditionTrue))
+		Expect(failed.Reason).To(Equal(ReasonInvalidSpec))
+		Expect(failed.Message).To(ContainSubstring("apexordsref can't be empty"))
+
+		oauthclient.Spec.ApexOrdsRef = apexords.Name
+		Expect(k8sClient.Update(ctx, oauthclient)).To(Succeed())
+		_, err = oauthreconciler.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(runner.Commands).To(HaveLen(1))
+		refresh(oauthclient)
+		Expect(oauthclient.Status.Phase).To(Equal(operatorv1.PhaseReady))
+		Expect(meta.IsStatusConditionFalse(oauthclient.Status.Conditions, operatorv1.ConditionFailed)).To(BeTrue())
+	})
+
+	It("keeps the values of an Ords OAuth client to names and single lines", func() {
+		apexords := newApexOrds("apexords-dev", "devcdb", "devords")
+		newOAuthClient := func(spec operatorv1.OrdsOAuthClientSpec) *operatorv1.OrdsOAuthClient {
+			spec.ApexOrdsRef = apexords.Name
+			return &operatorv1.OrdsOAuthClient{
+				ObjectMeta: metav1.ObjectMeta{Name: "devclient", Namespace: namespace},
+				Spec:       spec,
+			}
+		}
+		//a line EOF would end the here-document feeding sqlplus and run the rest in the shell
+		for _, spec := range []operatorv1.OrdsOAuthClientSpec{
+			{Schema: "hr; grant dba to hr"},
+			{Schema: "hr", Description: "client\nEOF\nrm -rf /"},
+			{Schema: "hr", SupportEmail: "a@example.com\r"},
+			{Schema: "hr", Roles: []operatorv1.OrdsOAuthName{"hr_role\nEOF"}},
+			{Schema: "hr", Privileges: []operatorv1.OrdsOAuthName{"hr.priv\nEOF"}},
+		} {
+			oauthclient := newOAuthClient(spec)
+			Expect(apierrors.IsInvalid(k8sClient.Create(ctx, oauthclient))).To(BeTrue(), "%+v", spec)
+			Expect(ValidateOrdsOAuthClient(oauthclient)).NotTo(Succeed(), "%+v", spec)
+		}
+
+		runner.Results = func(cmd FakeCommand) (CommandResult, error) {
+			return CommandResult{Stdout: ordsOAuthClientMarker + "clientid1:secret1\n"}, nil
+		}
+		oauthclient := newOAuthClient(operatorv1.OrdsOAuthClientSpec{Schema: "hr", Description: "it's the HR client"})
+		Expect(ValidateOrdsOAuthClient(oauthclient)).To(Succeed())
+		Expect(k8sClient.Create(ctx, oauthclient)).To(Succeed())
+		oauthreconciler := &OrdsOAuthClientReconciler{Client: k8sClient, Scheme: scheme.Scheme, Runner: runner}
+		_, err := oauthreconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(oauthclient)})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(runner.Commands).To(HaveLen(1))
+		Expect(runner.Commands[0].Command[2]).To(ContainSubstring("p_schema          => 'HR'"))
+		Expect(runner.Commands[0].Command[2]).To(ContainSubstring("p_description     => 'it''s the HR client'"))
+	})
+})
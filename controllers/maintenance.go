@@ -0,0 +1,378 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	operatorv1 "apexords-operator/apexords-operator/api/v1"
+	"apexords-operator/apexords-operator/controllers/config"
+)
+
+//OrdsReplicasAnnotation keeps the replicas of the Ords deployment while maintenance scales it to zero
+const OrdsReplicasAnnotation = "operator.apexords-operator/ords-replicas"
+
+//MaintenancePageHashAnnotation on the maintenance pod template changes with the page,so the pods roll when it does
+const MaintenancePageHashAnnotation = "operator.apexords-operator/maintenance-page-hash"
+
+var (
+	//how often a paused ApexOrds observes its Ords deployment
+	PausedResyncInterval = time.Minute
+	//how often to check whether the pods to switch the Ords services to are ready
+	MaintenancePollInterval = 10 * time.Second
+)
+
+//DefaultMaintenancePage is served while spec.maintenance is set without spec.maintenancepage
+const DefaultMaintenancePage = `<!DOCTYPE html>
+<html>
+<head><title>Under maintenance</title></head>
+<body>
+<h1>Under maintenance</h1>
+<p>The site is under maintenance,please come back later.</p>
+</body>
+</html>
+`
+
+//maintenanceConf answers every request with a 503 and the maintenance page,httpd.conf includes it
+//from users-define.conf like the Ords proxy settings
+const maintenanceConf = `Listen 80
+<VirtualHost *:80>
+Alias /maintenance.html "/mnt/k8s/maintenance.html"
+<Directory /mnt/k8s/>
+Options FollowSymLinks
+AllowOverride none
+Require all granted
+</Directory>
+ErrorDocument 503 /maintenance.html
+RewriteEngine On
+RewriteCond %{REQUEST_URI} !^/maintenance\.html$
+RewriteRule ^ - [R=503,L]
+</VirtualHost>
+`
+
+//IsPaused tells whether the reconcile of the ApexOrds is paused by spec.paused or the paused annotation
+func IsPaused(apexords *operatorv1.ApexOrds) bool {
+	if apexords.Spec.Paused {
+		return true
+	}
+	paused, _ := strconv.ParseBool(apexords.ObjectMeta.Annotations[operatorv1.PausedAnnotation])
+	return paused
+}
+
+//OrdsDeploymentName is the name of the Ords and http deployment of the ApexOrds
+func OrdsDeploymentName(apexords *operatorv1.ApexOrds) string {
+	return apexords.Spec.Ordsname + "-apexords-ords-deployment"
+}
+
+//MaintenanceName is the name of the maintenance deployment and configmap of the ApexOrds
+func MaintenanceName(apexords *operatorv1.ApexOrds) string {
+	return apexords.Spec.Ordsname + "-apexords-maintenance"
+}
+
+//OrdsSelector selects the pods of the Ords deployment
+func OrdsSelector(apexords *operatorv1.ApexOrds) map[string]string {
+	return map[string]string{"ordsauto": apexords.Spec.Ordsname + "-DeploymentSelector"}
+}
+
+//MaintenanceSelector selects the pods serving the maintenance page
+func MaintenanceSelector(apexords *operatorv1.ApexOrds) map[string]string {
+	return map[string]string{"ordsauto": apexords.Spec.Ordsname + "-MaintenanceSelector"}
+}
+
+//ordsServiceNames are the services of the ApexOrds which maintenance switches to the maintenance page
+func ordsServiceNames(apexords *operatorv1.ApexOrds) []string {
+	return []string{apexords.Spec.Ordsname + "-apexords-svc", apexords.Spec.Ordsname + "-apexords-nodeport-svc"}
+}
+
+//MaintenanceObjects returns the configmap and the deployment serving the maintenance page of the ApexOrds.
+//The deployment is the httpd container of the Ords deployment with the maintenance configmap
+func MaintenanceObjects(apexords *operatorv1.ApexOrds, db *operatorv1.OracleDatabaseSpec, s *runtime.Scheme) (*corev1.ConfigMap, *appsv1.Deployment, error) {
+	decode := scheme.Codecs.UniversalDeserializer().Decode
+	obj, _, err := decode([]byte(config.Httpconfigmapyml), nil, nil)
+	if err != nil {
+		return nil, nil, TerminalError(StepOrds, ReasonTemplateInvalid, fmt.Errorf("can't deserialize http configmap yaml: %v", err))
+	}
+	configmap, ok := obj.(*corev1.ConfigMap)
+	if !ok {
+		return nil, nil, TerminalError(StepOrds, ReasonTemplateInvalid, fmt.Errorf("http configmap yaml is a %T", obj))
+	}
+	page := apexords.Spec.MaintenancePage
+	if page == "" {
+		page = DefaultMaintenancePage
+	}
+	configmap.ObjectMeta.Name = MaintenanceName(apexords) + "-cm"
+	configmap.ObjectMeta.Namespace = apexords.ObjectMeta.Namespace
+	configmap.Data["users-define.conf"] = maintenanceConf
+	configmap.Data["maintenance.html"] = page
+
+	obj, _, err = decode([]byte(config.Ordsyml), nil, nil)
+	if err != nil {
+		return nil, nil, TerminalError(StepOrds, ReasonTemplateInvalid, fmt.Errorf("can't deserialize Ords deployment yaml: %v", err))
+	}
+	deployment, ok := obj.(*appsv1.Deployment)
+	if !ok {
+		return nil, nil, TerminalError(StepOrds, ReasonTemplateInvalid, fmt.Errorf("Ords deployment yaml is a %T", obj))
+	}
+	podspec := &deployment.Spec.Template.Spec
+	var httpd []corev1.Container
+	for _, container := range podspec.Containers {
+		if container.Name == "httpd" {
+			container.ReadinessProbe = &corev1.Probe{
+				Handler:       corev1.Handler{TCPSocket: &corev1.TCPSocketAction{Port: intstr.FromInt(80)}},
+				PeriodSeconds: 5,
+			}
+			httpd = append(httpd, container)
+		}
+	}
+	podspec.Containers = httpd
+	podspec.Volumes = podspec.Volumes[:1]
+	podspec.Volumes[0].VolumeSource.ConfigMap.LocalObjectReference = corev1.LocalObjectReference{Name: configmap.ObjectMeta.Name}
+	deployment.ObjectMeta.Name = MaintenanceName(apexords) + "-deployment"
+	deployment.ObjectMeta.Namespace = apexords.ObjectMeta.Namespace
+	deployment.Spec.Selector.MatchLabels = MaintenanceSelector(apexords)
+	deployment.Spec.Template.ObjectMeta.Labels = mergeLabels(MaintenanceSelector(apexords), ComponentLabels(apexords, ComponentMaintenance))
+	deployment.Spec.Template.ObjectMeta.Annotations = map[string]string{MaintenancePageHashAnnotation: passwordHash(apexords, page)}
+	Images.ResolveImages(podspec)
+	AddImagePullSecrets(podspec, db.ImagePullSecrets)
+
+	for _, obj := range []client.Object{configmap, deployment} {
+		SetLabels(obj, apexords, ComponentMaintenance)
+		if err := setControllerReference(apexords, obj, s, StepOrds); err != nil {
+			return nil, nil, err
+		}
+		if err := ApplyOverrides(apexords.Spec.Overrides, obj); err != nil {
+			return nil, nil, TerminalError(StepOrds, ReasonOverrideInvalid, err)
+		}
+	}
+	return configmap, deployment, nil
+}
+
+//reconcilePaused only observes the ApexOrds while it is paused,no object is changed
+func (r *ApexOrdsReconciler) reconcilePaused(ctx context.Context, apexords *operatorv1.ApexOrds) (ctrl.Result, error) {
+	if !meta.IsStatusConditionTrue(apexords.Status.Conditions, operatorv1.ConditionPaused) {
+		log.Log.Info("ApexOrds " + apexords.ObjectMeta.Name + " is paused")
+		r.Recorder.Event(apexords, corev1.EventTypeNormal, ReasonPaused, "Reconcile is paused,no objects are changed")
+	}
+	meta.SetStatusCondition(&apexords.Status.Conditions, metav1.Condition{
+		Type:               operatorv1.ConditionPaused,
+		Status:             metav1.ConditionTrue,
+		Reason:             ReasonPaused,
+		Message:            "Reconcile is paused by spec.paused or annotation " + operatorv1.PausedAnnotation,
+		ObservedGeneration: apexords.ObjectMeta.Generation,
+	})
+	if err := r.observeOrds(ctx, apexords); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.Status().Update(ctx, apexords); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{RequeueAfter: PausedResyncInterval}, nil
+}
+
+//resume marks a paused ApexOrds reconciled again
+func (r *ApexOrdsReconciler) resume(ctx context.Context, apexords *operatorv1.ApexOrds) {
+	if !meta.IsStatusConditionTrue(apexords.Status.Conditions, operatorv1.ConditionPaused) {
+		return
+	}
+	log.Log.Info("ApexOrds " + apexords.ObjectMeta.Name + " is resumed")
+	r.Recorder.Event(apexords, corev1.EventTypeNormal, ReasonResumed, "Reconcile is resumed")
+	r.setCondition(ctx, apexords, operatorv1.ConditionPaused, metav1.ConditionFalse, ReasonResumed, "Reconcile is resumed")
+}
+
+//observeOrds records the ready pods of the Ords deployment in the status
+func (r *ApexOrdsReconciler) observeOrds(ctx context.Context, apexords *operatorv1.ApexOrds) error {
+	var deployment appsv1.Deployment
+	if err := r.Get(ctx, client.ObjectKey{Namespace: apexords.ObjectMeta.Namespace, Name: OrdsDeploymentName(apexords)}, &deployment); err != nil {
+		if apierrors.IsNotFound(err) {
+			apexords.Status.OrdsReadyReplicas = 0
+			return nil
+		}
+		return err
+	}
+	apexords.Status.OrdsReadyReplicas = deployment.Status.ReadyReplicas
+	return nil
+}
+
+//syncMaintenance switches the Ords services to the maintenance page while spec.maintenance is set and back
+//to Ords afterwards. The services are switched once the pods behind the new selector are ready,
+//it returns true while it waits for them.
+func (r *ApexOrdsReconciler) syncMaintenance(ctx context.Context, apexords *operatorv1.ApexOrds, db *operatorv1.OracleDatabaseSpec) (bool, error) {
+	configmap, maintenance, err := MaintenanceObjects(apexords, db, r.Scheme)
+	if err != nil {
+		return false, err
+	}
+	var ords appsv1.Deployment
+	if err := r.Get(ctx, client.ObjectKey{Namespace: apexords.ObjectMeta.Namespace, Name: OrdsDeploymentName(apexords)}, &ords); err != nil {
+		return false, RetryableError(StepOrds, ReasonCreateFailed, fmt.Errorf("unable to get deployment %s: %v", OrdsDeploymentName(apexords), err))
+	}
+
+	if !apexords.Spec.Maintenance {
+		if meta.FindStatusCondition(apexords.Status.Conditions, operatorv1.ConditionMaintenance) == nil {
+			return false, nil
+		}
+		//bring Ords back,the maintenance page is served until its pods are ready
+		if replicas, ok := ords.ObjectMeta.Annotations[OrdsReplicasAnnotation]; ok {
+			count, err := strconv.ParseInt(replicas, 10, 32)
+			if err != nil {
+				count = 1
+			}
+			scaled := int32(count)
+			ords.Spec.Replicas = &scaled
+			delete(ords.ObjectMeta.Annotations, OrdsReplicasAnnotation)
+			if err := r.Update(ctx, &ords); err != nil {
+				return false, RetryableError(StepOrds, ReasonCreateFailed, fmt.Errorf("unable to scale deployment %s: %v", ords.ObjectMeta.Name, err))
+			}
+			log.Log.Info("Scaled " + ords.ObjectMeta.Name + " back to " + replicas)
+		}
+		if ords.Status.ReadyReplicas == 0 {
+			r.setMaintenanceCondition(ctx, apexords, metav1.ConditionTrue, ReasonMaintenancePending, "Waiting for the pods of "+ords.ObjectMeta.Name+" to be ready")
+			return true, nil
+		}
+		if err := r.selectServices(ctx, apexords, OrdsSelector(apexords)); err != nil {
+			return false, err
+		}
+		for _, obj := range []client.Object{maintenance, configmap} {
+			if err := r.Delete(ctx, obj); err != nil && !apierrors.IsNotFound(err) {
+				return false, RetryableError(StepOrds, ReasonCreateFailed, fmt.Errorf("unable to delete %s: %v", obj.GetName(), err))
+			}
+		}
+		r.Recorder.Event(apexords, corev1.EventTypeNormal, ReasonMaintenanceFinished, "Ords services are switched back to "+ords.ObjectMeta.Name)
+		r.setMaintenanceCondition(ctx, apexords, metav1.ConditionFalse, ReasonMaintenanceFinished, "Ords serves the services")
+		return false, nil
+	}
+
+	//a changed page updates the configmap and rolls the maintenance deployment
+	if err := r.createOrUpdate(ctx, configmap, func(current client.Object) bool {
+		cm := current.(*corev1.ConfigMap)
+		if reflect.DeepEqual(cm.Data, configmap.Data) {
+			return false
+		}
+		cm.Data = configmap.Data
+		return true
+	}); err != nil {
+		return false, err
+	}
+	if err := r.createOrUpdate(ctx, maintenance, func(current client.Object) bool {
+		deployment := current.(*appsv1.Deployment)
+		if reflect.DeepEqual(deployment.Spec.Template.ObjectMeta.Annotations, maintenance.Spec.Template.ObjectMeta.Annotations) {
+			return false
+		}
+		deployment.Spec.Template.ObjectMeta.Annotations = maintenance.Spec.Template.ObjectMeta.Annotations
+		return true
+	}); err != nil {
+		return false, err
+	}
+	if err := r.Get(ctx, client.ObjectKeyFromObject(maintenance), maintenance); err != nil {
+		return false, RetryableError(StepOrds, ReasonCreateFailed, fmt.Errorf("unable to get deployment %s: %v", maintenance.ObjectMeta.Name, err))
+	}
+	if maintenance.Status.ReadyReplicas == 0 {
+		r.setMaintenanceCondition(ctx, apexords, metav1.ConditionFalse, ReasonMaintenancePending, "Waiting for the pods of "+maintenance.ObjectMeta.Name+" to be ready")
+		return true, nil
+	}
+	if err := r.selectServices(ctx, apexords, MaintenanceSelector(apexords)); err != nil {
+		return false, err
+	}
+	if _, ok := ords.ObjectMeta.Annotations[OrdsReplicasAnnotation]; !ok {
+		replicas := int32(1)
+		if ords.Spec.Replicas != nil {
+			replicas = *ords.Spec.Replicas
+		}
+		if ords.ObjectMeta.Annotations == nil {
+			ords.ObjectMeta.Annotations = map[string]string{}
+		}
+		ords.ObjectMeta.Annotations[OrdsReplicasAnnotation] = strconv.Itoa(int(replicas))
+		scaled := int32(0)
+		ords.Spec.Replicas = &scaled
+		if err := r.Update(ctx, &ords); err != nil {
+			return false, RetryableError(StepOrds, ReasonCreateFailed, fmt.Errorf("unable to scale deployment %s: %v", ords.ObjectMeta.Name, err))
+		}
+		log.Log.Info("Scaled " + ords.ObjectMeta.Name + " to zero for maintenance")
+		r.Recorder.Event(apexords, corev1.EventTypeNormal, ReasonMaintenanceStarted, "Ords services serve the maintenance page of "+maintenance.ObjectMeta.Name+",Ords is scaled to zero")
+	}
+	r.setMaintenanceCondition(ctx, apexords, metav1.ConditionTrue, ReasonMaintenanceStarted, "The Ords services serve the maintenance page")
+	return false, nil
+}
+
+//createOrUpdate creates obj,or lets update change the existing one and saves it when update returns true
+func (r *ApexOrdsReconciler) createOrUpdate(ctx context.Context, obj client.Object, update func(current client.Object) bool) error {
+	current := obj.DeepCopyObject().(client.Object)
+	err := r.Get(ctx, client.ObjectKeyFromObject(obj), current)
+	if apierrors.IsNotFound(err) {
+		if err := r.Create(ctx, obj); err != nil {
+			return RetryableError(StepOrds, ReasonCreateFailed, fmt.Errorf("unable to create %s: %v", obj.GetName(), err))
+		}
+		log.Log.Info("Created " + obj.GetName())
+		return nil
+	}
+	if err != nil {
+		return RetryableError(StepOrds, ReasonCreateFailed, fmt.Errorf("unable to get %s: %v", obj.GetName(), err))
+	}
+	if !update(current) {
+		return nil
+	}
+	if err := r.Update(ctx, current); err != nil {
+		return RetryableError(StepOrds, ReasonCreateFailed, fmt.Errorf("unable to update %s: %v", obj.GetName(), err))
+	}
+	return nil
+}
+
+//selectServices points the Ords services of the ApexOrds to the pods of selector
+func (r *ApexOrdsReconciler) selectServices(ctx context.Context, apexords *operatorv1.ApexOrds, selector map[string]string) error {
+	for _, name := range ordsServiceNames(apexords) {
+		var service corev1.Service
+		if err := r.Get(ctx, client.ObjectKey{Namespace: apexords.ObjectMeta.Namespace, Name: name}, &service); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return RetryableError(StepOrds, ReasonCreateFailed, fmt.Errorf("unable to get service %s: %v", name, err))
+		}
+		if reflect.DeepEqual(service.Spec.Selector, selector) {
+			continue
+		}
+		service.Spec.Selector = selector
+		if err := r.Update(ctx, &service); err != nil {
+			return RetryableError(StepOrds, ReasonCreateFailed, fmt.Errorf("unable to update service %s: %v", name, err))
+		}
+		log.Log.Info("Service " + name + " selects " + selector["ordsauto"])
+	}
+	return nil
+}
+
+//setMaintenanceCondition saves the Maintenance condition when it changes
+func (r *ApexOrdsReconciler) setMaintenanceCondition(ctx context.Context, apexords *operatorv1.ApexOrds, status metav1.ConditionStatus, reason string, message string) {
+	if current := meta.FindStatusCondition(apexords.Status.Conditions, operatorv1.ConditionMaintenance); current != nil &&
+		current.Status == status && current.Reason == reason && current.Message == message {
+		return
+	}
+	r.setCondition(ctx, apexords, operatorv1.ConditionMaintenance, status, reason, message)
+}
@@ -0,0 +1,161 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	operatorv1 "apexords-operator/apexords-operator/api/v1"
+)
+
+var (
+	//install steps run from minutes (DB pod start) up to an hour (Apex full install)
+	installBuckets = []float64{30, 60, 120, 300, 600, 900, 1200, 1800, 2700, 3600}
+
+	DbProvisionDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "apexords_db_provision_duration_seconds",
+		Help:    "Time taken to create the DB statefulset and service",
+		Buckets: installBuckets,
+	})
+	ApexInstallDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "apexords_apex_install_duration_seconds",
+		Help:    "Time taken to wait for the DB pod and install Apex",
+		Buckets: installBuckets,
+	})
+	OrdsInstallDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "apexords_ords_install_duration_seconds",
+		Help:    "Time taken to install Ords and create its deployment and services",
+		Buckets: installBuckets,
+	})
+	StepFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "apexords_step_failures_total",
+		Help: "Number of failed reconcile steps by step and reason",
+	}, []string{"step", "reason"})
+	InstancesByPhase = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "apexords_instances",
+		Help: "Number of ApexOrds by phase",
+	}, []string{"phase"})
+	OrdsEndpointUp = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "apexords_ords_endpoint_up",
+		Help: "Whether the Ords endpoint of an ApexOrds answers HTTP (1) or not (0)",
+	}, []string{"namespace", "name"})
+)
+
+func init() {
+	// Register custom metrics with the global prometheus registry
+	metrics.Registry.MustRegister(
+		DbProvisionDuration,
+		ApexInstallDuration,
+		OrdsInstallDuration,
+		StepFailures,
+		InstancesByPhase,
+		OrdsEndpointUp,
+	)
+}
+
+// OrdsEndpointChecker periodically probes the Ords service of every ApexOrds and
+// refreshes the phase and endpoint gauges. It is added to the manager as a Runnable.
+type OrdsEndpointChecker struct {
+	client.Client
+	Interval   time.Duration
+	HTTPClient *http.Client
+}
+
+// Start runs the checks until ctx is cancelled
+func (c *OrdsEndpointChecker) Start(ctx context.Context) error {
+	if c.Interval == 0 {
+		c.Interval = time.Minute
+	}
+	if c.HTTPClient == nil {
+		c.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+	for {
+		c.check(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// NeedLeaderElection makes only the leader probe the endpoints
+func (c *OrdsEndpointChecker) NeedLeaderElection() bool {
+	return true
+}
+
+func (c *OrdsEndpointChecker) check(ctx context.Context) {
+	var apexordslist operatorv1.ApexOrdsList
+	if err := c.List(ctx, &apexordslist); err != nil {
+		log.Log.Error(err, "unable to list ApexOrds for metrics")
+		return
+	}
+
+	phases := map[string]float64{
+		operatorv1.PhaseProvisioning:   0,
+		operatorv1.PhaseInstallingApex: 0,
+		operatorv1.PhaseInstallingOrds: 0,
+		operatorv1.PhaseReady:          0,
+		operatorv1.PhaseFailed:         0,
+	}
+	OrdsEndpointUp.Reset()
+	for i := range apexordslist.Items {
+		apexords := &apexordslist.Items[i]
+		phases[apexords.Status.Phase]++
+		if apexords.Spec.Ordsname == "" {
+			continue
+		}
+		up := 0.0
+		if c.probe(ctx, OrdsEndpointURL(apexords)) {
+			up = 1
+		}
+		OrdsEndpointUp.WithLabelValues(apexords.ObjectMeta.Namespace, apexords.ObjectMeta.Name).Set(up)
+	}
+	for phase, count := range phases {
+		if phase == "" {
+			continue
+		}
+		InstancesByPhase.WithLabelValues(phase).Set(count)
+	}
+}
+
+func (c *OrdsEndpointChecker) probe(ctx context.Context, url string) bool {
+	httpreq, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := c.HTTPClient.Do(httpreq)
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+	return resp.StatusCode < http.StatusInternalServerError
+}
+
+//OrdsEndpointURL returns the in-cluster url of the Apex landing page served by the Ords service
+func OrdsEndpointURL(apexords *operatorv1.ApexOrds) string {
+	return "http://" + apexords.Spec.Ordsname + "-apexords-svc." + apexords.ObjectMeta.Namespace + ".svc/apex/"
+}
@@ -0,0 +1,121 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+
+	operatorv1 "apexords-operator/apexords-operator/api/v1"
+)
+
+//DbObjects returns the objects generated for the DB of db,secretname is the secret with its passwords
+func DbObjects(db *operatorv1.OracleDatabaseSpec, secretname string) []operatorv1.GeneratedObject {
+	return []operatorv1.GeneratedObject{
+		{Kind: "StatefulSet", Name: db.Dbname + "-apexords-db-sts"},
+		{Kind: "Service", Name: db.Dbname + "-apexords-db-svc"},
+		{Kind: "Secret", Name: secretname},
+	}
+}
+
+//OrdsObjects returns the objects generated for the Ords of the ApexOrds
+func OrdsObjects(apexords *operatorv1.ApexOrds) []operatorv1.GeneratedObject {
+	objects := []operatorv1.GeneratedObject{
+		{Kind: "ConfigMap", Name: apexords.Spec.Ordsname + "-apexords-ords-cm"},
+		{Kind: "ConfigMap", Name: apexords.Spec.Ordsname + "-apexords-http-cm"},
+		{Kind: "Secret", Name: OrdsSecretName(apexords)},
+		{Kind: "Deployment", Name: OrdsDeploymentName(apexords)},
+		{Kind: "Service", Name: apexords.Spec.Ordsname + "-apexords-svc"},
+		{Kind: "Service", Name: apexords.Spec.Ordsname + "-apexords-nodeport-svc"},
+	}
+	if apexords.Spec.Maintenance {
+		objects = append(objects,
+			operatorv1.GeneratedObject{Kind: "ConfigMap", Name: MaintenanceName(apexords) + "-cm"},
+			operatorv1.GeneratedObject{Kind: "Deployment", Name: MaintenanceName(apexords) + "-deployment"})
+	}
+	return objects
+}
+
+//ApexOrdsObjects returns the objects generated for the ApexOrds,the DB objects belong to an OracleDatabase with databaseref
+func ApexOrdsObjects(apexords *operatorv1.ApexOrds) []operatorv1.GeneratedObject {
+	var objects []operatorv1.GeneratedObject
+	if apexords.Spec.DatabaseRef == "" {
+		objects = append(objects, DbObjects(InlineDatabase(apexords), CredentialsSecretName(apexords))...)
+	} else {
+		objects = append(objects, operatorv1.GeneratedObject{Kind: "Secret", Name: CredentialsSecretName(apexords)})
+	}
+	objects = append(objects, OrdsObjects(apexords)...)
+	//the install steps of an ApexOrds with databaseref ran in its OracleDatabase unless it has pools
+	if apexords.Spec.DatabaseRef == "" || len(OrdsPools(apexords)) > 0 {
+		objects = append(objects, operatorv1.GeneratedObject{Kind: "ConfigMap", Name: InstallLogName(apexords)})
+	}
+	return objects
+}
+
+//checkName returns a terminal error when field changed from recorded,the name the generated objects were created with.
+//Changing it would create new objects next to the old ones,which are still owned by the resource.
+func checkName(field string, recorded string, name string) *StepError {
+	if recorded == "" || recorded == name {
+		return nil
+	}
+	return TerminalError(StepSpec, ReasonNameChanged, fmt.Errorf("%s can't change from %s to %s,the generated objects are named after it. Set it back or create a new resource", field, recorded, name))
+}
+
+//ApexOrdsNames records dbname and ordsname of the ApexOrds in its status,or returns an error when they changed
+//since they were recorded. The dbname of an ApexOrds with databaseref is not used,its databaseref is recorded
+//once the OracleDatabase is ready so a wrong name can still be fixed
+func ApexOrdsNames(apexords *operatorv1.ApexOrds) *StepError {
+	//the objects of an inline DB or of the old OracleDatabase would be left behind
+	if apexords.Spec.DatabaseRef != "" && apexords.Status.Dbname != "" {
+		return TerminalError(StepSpec, ReasonNameChanged, fmt.Errorf("spec.databaseref can't be set,the ApexOrds created its own DB %s. Remove it or create a new resource", apexords.Status.Dbname))
+	}
+	if apexords.Spec.DatabaseRef == "" && apexords.Status.DatabaseRef != "" {
+		return TerminalError(StepSpec, ReasonNameChanged, fmt.Errorf("spec.databaseref can't be removed,the Ords objects were set up for OracleDatabase %s. Set it back or create a new resource", apexords.Status.DatabaseRef))
+	}
+	if err := checkName("spec.databaseref", apexords.Status.DatabaseRef, apexords.Spec.DatabaseRef); err != nil {
+		return err
+	}
+	if apexords.Spec.DatabaseRef == "" {
+		if err := checkName("spec.dbname", apexords.Status.Dbname, apexords.Spec.Dbname); err != nil {
+			return err
+		}
+		apexords.Status.Dbname = apexords.Spec.Dbname
+	}
+	if err := checkName("spec.ordsname", apexords.Status.Ordsname, apexords.Spec.Ordsname); err != nil {
+		return err
+	}
+	apexords.Status.Ordsname = apexords.Spec.Ordsname
+	return nil
+}
+
+//OracleDatabaseNames records the dbname of the OracleDatabase in its status,or returns an error when it changed
+func OracleDatabaseNames(oradb *operatorv1.OracleDatabase) *StepError {
+	if err := checkName("spec.dbname", oradb.Status.Dbname, oradb.Spec.Dbname); err != nil {
+		return err
+	}
+	oradb.Status.Dbname = oradb.Spec.Dbname
+	return nil
+}
+
+//PluggableDatabaseNames records the pdbname of the PluggableDatabase in its status,or returns an error when it changed.
+//The PDB of the old name would be left in the CDB and never dropped
+func PluggableDatabaseNames(pdb *operatorv1.PluggableDatabase) *StepError {
+	if err := checkName("spec.pdbname", pdb.Status.Pdbname, pdb.Spec.Pdbname); err != nil {
+		return err
+	}
+	pdb.Status.Pdbname = pdb.Spec.Pdbname
+	return nil
+}
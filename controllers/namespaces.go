@@ -0,0 +1,54 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strings"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
+)
+
+//WatchNamespaceEnv is the env var with the namespaces to watch when --watch-namespaces is not set
+const WatchNamespaceEnv = "WATCH_NAMESPACE"
+
+//WatchNamespaces parses a comma-separated namespace list,empty means all namespaces
+func WatchNamespaces(value string) []string {
+	var namespaces []string
+	seen := map[string]bool{}
+	for _, namespace := range strings.Split(value, ",") {
+		namespace = strings.TrimSpace(namespace)
+		if namespace == "" || seen[namespace] {
+			continue
+		}
+		seen[namespace] = true
+		namespaces = append(namespaces, namespace)
+	}
+	return namespaces
+}
+
+//SetWatchNamespaces limits the cache of the manager to the namespaces,a Role in each of them is then enough.
+//One namespace uses the namespaced cache,several a cache per namespace.
+func SetWatchNamespaces(options *ctrl.Options, namespaces []string) {
+	switch len(namespaces) {
+	case 0:
+	case 1:
+		options.Namespace = namespaces[0]
+	default:
+		options.NewCache = cache.MultiNamespacedCacheBuilder(namespaces)
+	}
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	operatorv1 "apexords-operator/apexords-operator/api/v1"
+)
+
+var _ = Describe("Watch namespaces", func() {
+	It("parses a comma-separated list", func() {
+		Expect(WatchNamespaces("")).To(BeEmpty())
+		Expect(WatchNamespaces(" , ")).To(BeEmpty())
+		Expect(WatchNamespaces("tenant-a")).To(Equal([]string{"tenant-a"}))
+		Expect(WatchNamespaces("tenant-a, tenant-b,,tenant-a")).To(Equal([]string{"tenant-a", "tenant-b"}))
+	})
+
+	It("watches all namespaces by default", func() {
+		options := ctrl.Options{}
+		SetWatchNamespaces(&options, nil)
+		Expect(options.Namespace).To(BeEmpty())
+		Expect(options.NewCache).To(BeNil())
+
+		SetWatchNamespaces(&options, []string{"tenant-a"})
+		Expect(options.Namespace).To(Equal("tenant-a"))
+		Expect(options.NewCache).To(BeNil())
+	})
+
+	It("reads only the listed namespaces with a multi-namespace cache", func() {
+		ctx := context.Background()
+		var namespaces []string
+		for i := 0; i < 3; i++ {
+			ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "watch-test-"}}
+			Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+			namespaces = append(namespaces, ns.Name)
+			Expect(k8sClient.Create(ctx, &operatorv1.ApexOrds{
+				ObjectMeta: metav1.ObjectMeta{Name: "apexords-watch", Namespace: ns.Name},
+				Spec:       operatorv1.ApexOrdsSpec{Dbname: "testcdb", Dbservice: "testpdb", Ordsname: "testords"},
+			})).To(Succeed())
+		}
+
+		options := ctrl.Options{Scheme: scheme.Scheme, MetricsBindAddress: "0"}
+		SetWatchNamespaces(&options, namespaces[:2])
+		Expect(options.NewCache).NotTo(BeNil())
+		mgr, err := ctrl.NewManager(cfg, options)
+		Expect(err).NotTo(HaveOccurred())
+		stopCtx, stop := context.WithCancel(ctx)
+		defer stop()
+		go func() {
+			defer GinkgoRecover()
+			Expect(mgr.Start(stopCtx)).To(Succeed())
+		}()
+		Expect(mgr.GetCache().WaitForCacheSync(stopCtx)).To(BeTrue())
+
+		var list operatorv1.ApexOrdsList
+		Expect(mgr.GetClient().List(ctx, &list)).To(Succeed())
+		var seen []string
+		for _, apexords := range list.Items {
+			seen = append(seen, apexords.ObjectMeta.Namespace)
+		}
+		Expect(seen).To(ConsistOf(namespaces[0], namespaces[1]))
+	})
+})
@@ -0,0 +1,413 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	operatorv1 "apexords-operator/apexords-operator/api/v1"
+)
+
+const (
+	//OracleDatabaseFinalizer keeps an OracleDatabase until no ApexOrds references it
+	OracleDatabaseFinalizer = "operator.apexords-operator/oracledatabase"
+)
+
+// OracleDatabaseReconciler reconciles a OracleDatabase object
+type OracleDatabaseReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	Runner   CommandRunner
+	//MaxConcurrentReconciles is the number of OracleDatabases reconciled at once,default 1
+	MaxConcurrentReconciles int
+}
+
+//+kubebuilder:rbac:groups=operator.apexords-operator,resources=oracledatabases,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=operator.apexords-operator,resources=oracledatabases/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=operator.apexords-operator,resources=oracledatabases/finalizers,verbs=update
+
+// Reconcile provisions the DB and installs Apex and the Ords schemas in it once,the ApexOrds referencing it set up their Ords only
+func (r *OracleDatabaseReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	_ = log.FromContext(ctx)
+
+	var oradb operatorv1.OracleDatabase
+	if err := r.Get(ctx, req.NamespacedName, &oradb); err != nil {
+		log.Log.Error(err, "unable to fetch CRD OracleDatabase")
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	//the DB is kept while ApexOrds still use it,their Ords would lose the DB and Apex
+	if !oradb.ObjectMeta.DeletionTimestamp.IsZero() {
+		if controllerutil.ContainsFinalizer(&oradb, OracleDatabaseFinalizer) {
+			users, err := ApexOrdsOfDatabase(ctx, r.Client, &oradb)
+			if err != nil {
+				return ctrl.Result{}, err
+			}
+			if len(users) > 0 {
+				return r.handleStepError(ctx, &oradb, RetryableError(StepDatabase, ReasonDatabaseInUse,
+					fmt.Errorf("OracleDatabase is used by ApexOrds %s,delete them or change their databaseref first", strings.Join(users, ","))))
+			}
+			controllerutil.RemoveFinalizer(&oradb, OracleDatabaseFinalizer)
+			if err := r.Update(ctx, &oradb); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if oradb.Spec.Dbname == "" || oradb.Spec.Dbservice == "" {
+		return r.handleStepError(ctx, &oradb, TerminalError(StepSpec, ReasonInvalidSpec, fmt.Errorf("DB name and service can't be empty")))
+	}
+	if err := ValidateDatabase(&oradb.Spec); err != nil {
+		return r.handleStepError(ctx, &oradb, TerminalError(StepSpec, ReasonInvalidSpec, err))
+	}
+	//the DB objects are named after dbname,it can't change afterwards
+	if err := OracleDatabaseNames(&oradb); err != nil {
+		return r.handleStepError(ctx, &oradb, err)
+	}
+	//the overrides are applied when the DB objects are created,they can't change afterwards either
+	if err := checkOverrides(oradb.Status.OverridesHash, oradb.Spec.Overrides); err != nil {
+		return r.handleStepError(ctx, &oradb, err)
+	}
+	//so are the settings the DB image creates the DB with
+	if err := checkDatabaseCreation(oradb.Status.DatabaseCreation, &oradb.Spec); err != nil {
+		return r.handleStepError(ctx, &oradb, err)
+	}
+	if !controllerutil.ContainsFinalizer(&oradb, OracleDatabaseFinalizer) {
+		controllerutil.AddFinalizer(&oradb, OracleDatabaseFinalizer)
+		if err := r.Update(ctx, &oradb); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	// set default db port to 1521
+	if oradb.Spec.Dbport == "" {
+		oradb.Spec.Dbport = "1521"
+	}
+	unlock := r.lockDatabase(ctx, &oradb)
+	if unlock == nil {
+		return ctrl.Result{RequeueAfter: DatabaseLockRetryInterval}, nil
+	}
+	defer unlock()
+
+	//the DB reads the sys password from the credentials secret,the ApexOrds of the DB copy it from there
+	dbinstaller := &DatabaseInstaller{
+		Client:            r.Client,
+		Scheme:            r.Scheme,
+		Recorder:          r.Recorder,
+		Runner:            r.Runner,
+		Owner:             &oradb,
+		Database:          &oradb.Spec,
+		Secretname:        DbCredentialsSecretName(&oradb),
+		SecretSysPassword: true,
+		Creating:          func() error { return r.recordCreation(ctx, &oradb) },
+	}
+	//the sys password of spec.credentials replaces the generated one
+	sysPassword, err := ResolveSysPassword(ctx, r.Client, req.Namespace, &oradb.Spec)
+	if err != nil {
+		log.Log.Error(err, "unable to read spec.credentials")
+		return r.handleStepError(ctx, &oradb, AsStepError(StepCredentials, err))
+	}
+	if sysPassword != nil {
+		dbinstaller.Dbpassword = sysPassword.Password
+	} else if dbinstaller.Dbpassword, err = r.generatedSysPassword(ctx, &oradb); err != nil {
+		log.Log.Error(err, "unable to generate the sys password")
+		return r.handleStepError(ctx, &oradb, AsStepError(StepCredentials, err))
+	}
+
+	//install DB statefulset
+	if !meta.IsStatusConditionTrue(oradb.Status.Conditions, operatorv1.ConditionDatabaseProvisioned) {
+		r.setPhase(ctx, &oradb, operatorv1.PhaseProvisioning)
+		start := time.Now()
+		if err := dbinstaller.CreateDbstsOption(req); err != nil {
+			log.Log.Error(err, "unable to create DB statefulset")
+			return r.handleStepError(ctx, &oradb, AsStepError(StepDatabase, err))
+		}
+		DbProvisionDuration.Observe(time.Since(start).Seconds())
+		r.setCondition(ctx, &oradb, operatorv1.ConditionDatabaseProvisioned, metav1.ConditionTrue, ReasonDbStatefulSetCreated, "DB statefulset and service are created")
+	}
+
+	//install apex in the db once for all ApexOrds
+	if !meta.IsStatusConditionTrue(oradb.Status.Conditions, operatorv1.ConditionApexInstalled) {
+		r.setPhase(ctx, &oradb, operatorv1.PhaseInstallingApex)
+		start := time.Now()
+		if err := dbinstaller.CreateApexOption(ctx, req); err != nil {
+			log.Log.Error(err, "unable to create Apex on DB")
+			return r.handleStepError(ctx, &oradb, AsStepError(StepApex, err))
+		}
+		ApexInstallDuration.Observe(time.Since(start).Seconds())
+		oradb.Status.ApexVersion = dbinstaller.ApexVersion
+		r.setCondition(ctx, &oradb, operatorv1.ConditionApexInstalled, metav1.ConditionTrue, ReasonApexInstallFinished, "Apex is installed in "+oradb.Spec.Dbservice)
+	}
+
+	//install the Ords schemas in dbservice once for all ApexOrds,they only set up their Ords
+	if !meta.IsStatusConditionTrue(oradb.Status.Conditions, operatorv1.ConditionOrdsInstalled) {
+		r.setPhase(ctx, &oradb, operatorv1.PhaseInstallingOrds)
+		start := time.Now()
+		if err := dbinstaller.CreateOrdsSchemaOption(ctx, req); err != nil {
+			log.Log.Error(err, "unable to create Ords schemas on DB")
+			return r.handleStepError(ctx, &oradb, AsStepError(StepOrds, err))
+		}
+		OrdsInstallDuration.Observe(time.Since(start).Seconds())
+		oradb.Status.OrdsVersion = dbinstaller.OrdsVersion
+		r.setCondition(ctx, &oradb, operatorv1.ConditionOrdsInstalled, metav1.ConditionTrue, ReasonOrdsInstallFinished, "Ords schemas are installed in "+oradb.Spec.Dbservice)
+	}
+
+	//set the DB parameters,again whenever the spec changes
+	condition, pending, err := dbinstaller.DbParametersStep(ctx, req, oradb.Status.Conditions, oradb.ObjectMeta.Generation)
+	if err != nil {
+		log.Log.Error(err, "unable to set DB parameters")
+		return r.handleStepError(ctx, &oradb, AsStepError(StepParameters, err))
+	}
+	if condition != nil {
+		oradb.Status.PendingRestart = pending
+		r.setCondition(ctx, &oradb, condition.Type, condition.Status, condition.Reason, condition.Message)
+		if condition.Reason == ReasonDbRestarting {
+			return ctrl.Result{RequeueAfter: PodPollInterval}, nil
+		}
+	}
+
+	//rotate the Apex admin and public passwords once per value of the annotation,
+	//the ApexOrds of the DB copy them from the credentials secret and roll their Ords.
+	//A rotation waits for the rollover of the previous one.
+	if rotation := RotationRequested(&oradb, oradb.Status.PasswordsRotation); rotation != "" && oradb.Status.PasswordsRollover == "" {
+		if err := dbinstaller.RotatePasswords(ctx, req); err != nil {
+			log.Log.Error(err, "unable to rotate passwords")
+			return r.handleStepError(ctx, &oradb, AsStepError(StepPasswords, err))
+		}
+		now := metav1.Now()
+		oradb.Status.PasswordsRotation = rotation
+		oradb.Status.PasswordsRotatedAt = &now
+		oradb.Status.PasswordsRollover = rotation
+		if err := r.Status().Update(ctx, &oradb); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	//the DB gets the sys password of each new version of the spec.credentials secret,
+	//the ApexOrds of the DB copy it from the credentials secret
+	if sysPassword != nil && sysPassword.Version != oradb.Status.CredentialsVersion {
+		if err := dbinstaller.UpdateSysPassword(ctx, req); err != nil {
+			log.Log.Error(err, "unable to change the sys password")
+			return r.handleStepError(ctx, &oradb, AsStepError(StepCredentials, err))
+		}
+		oradb.Status.CredentialsVersion = sysPassword.Version
+		if err := r.Status().Update(ctx, &oradb); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	//the old public password works until the Ords pods of all ApexOrds of the DB use the new one
+	rollover := false
+	if oradb.Status.PasswordsRollover != "" {
+		if rollover, err = r.finishPasswordsRollover(ctx, req, &oradb, dbinstaller); err != nil {
+			log.Log.Error(err, "unable to expire the old passwords")
+			return r.handleStepError(ctx, &oradb, AsStepError(StepPasswords, err))
+		}
+	}
+
+	meta.SetStatusCondition(&oradb.Status.Conditions, metav1.Condition{
+		Type:               operatorv1.ConditionFailed,
+		Status:             metav1.ConditionFalse,
+		Reason:             ReasonReconciled,
+		Message:            "All steps finished",
+		ObservedGeneration: oradb.ObjectMeta.Generation,
+	})
+	oradb.Status.Phase = operatorv1.PhaseReady
+	oradb.Status.Objects = append(DbObjects(&oradb.Spec, DbCredentialsSecretName(&oradb)), operatorv1.GeneratedObject{Kind: "ConfigMap", Name: InstallLogName(&oradb)})
+	oradb.Status.OverridesHash = OverridesHash(oradb.Spec.Overrides)
+	oradb.Status.DatabaseCreation = DatabaseCreationOf(&oradb.Spec)
+	if err := r.Status().Update(ctx, &oradb); err != nil {
+		return ctrl.Result{}, err
+	}
+	if rollover {
+		return ctrl.Result{RequeueAfter: RolloverPollInterval}, nil
+	}
+	if sysPassword != nil && sysPassword.RefreshAfter > 0 {
+		//a secret store without watch is read again for new versions
+		return ctrl.Result{RequeueAfter: sysPassword.RefreshAfter}, nil
+	}
+	return ctrl.Result{}, nil
+}
+
+//generatedSysPassword returns the sys password of the credentials secret of the OracleDatabase,
+//a random one is generated and kept there for a new DB
+func (r *OracleDatabaseReconciler) generatedSysPassword(ctx context.Context, oradb *operatorv1.OracleDatabase) (string, error) {
+	var genErr error
+	credentials, err := saveCredentials(ctx, r.Client, r.Scheme, oradb, DbCredentialsSecretName(oradb), func(cr *Credentials) {
+		if cr.Sys == "" {
+			cr.Sys, genErr = GeneratePassword(16, false)
+		}
+	})
+	if err != nil {
+		return "", err
+	}
+	if genErr != nil {
+		return "", RetryableError(StepCredentials, ReasonCreateFailed, fmt.Errorf("unable to generate the sys password: %v", genErr))
+	}
+	return credentials.Sys, nil
+}
+
+//handleStepError reports a failed step in events,metrics and the Failed condition.
+//Retryable errors are returned so the request is requeued with backoff,terminal errors are not.
+func (r *OracleDatabaseReconciler) handleStepError(ctx context.Context, oradb *operatorv1.OracleDatabase, stepErr *StepError) (ctrl.Result, error) {
+	log.Log.Error(stepErr, "reconcile step failed", "step", stepErr.Step, "reason", stepErr.Reason, "retryable", stepErr.Retryable)
+	StepFailures.WithLabelValues(stepErr.Step, stepErr.Reason).Inc()
+	r.Recorder.Eventf(oradb, corev1.EventTypeWarning, stepErr.Reason, "%v", stepErr.Err)
+
+	meta.SetStatusCondition(&oradb.Status.Conditions, metav1.Condition{
+		Type:               operatorv1.ConditionFailed,
+		Status:             metav1.ConditionTrue,
+		Reason:             stepErr.Reason,
+		Message:            stepErr.Error(),
+		ObservedGeneration: oradb.ObjectMeta.Generation,
+	})
+	if !stepErr.Retryable {
+		oradb.Status.Phase = operatorv1.PhaseFailed
+	}
+	if err := r.Status().Update(ctx, oradb); err != nil {
+		log.Log.Error(err, "unable to update OracleDatabase status")
+	}
+
+	if stepErr.Retryable {
+		return ctrl.Result{}, stepErr
+	}
+	return ctrl.Result{}, nil
+}
+
+//setPhase saves the phase in OracleDatabase status
+func (r *OracleDatabaseReconciler) setPhase(ctx context.Context, oradb *operatorv1.OracleDatabase, phase string) {
+	if oradb.Status.Phase == phase {
+		return
+	}
+	oradb.Status.Phase = phase
+	if err := r.Status().Update(ctx, oradb); err != nil {
+		log.Log.Error(err, "unable to update OracleDatabase status phase to "+phase)
+	}
+}
+
+//setCondition saves a step condition in OracleDatabase status
+func (r *OracleDatabaseReconciler) setCondition(ctx context.Context, oradb *operatorv1.OracleDatabase, conditionType string, status metav1.ConditionStatus, reason string, message string) {
+	meta.SetStatusCondition(&oradb.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: oradb.ObjectMeta.Generation,
+	})
+	if err := r.Status().Update(ctx, oradb); err != nil {
+		log.Log.Error(err, "unable to update OracleDatabase condition "+conditionType)
+	}
+}
+
+//recordCreation saves the overrides and the settings of the DB in status before the first DB object is created
+//with them,checkOverrides and checkDatabaseCreation compare the spec with them from then on
+func (r *OracleDatabaseReconciler) recordCreation(ctx context.Context, oradb *operatorv1.OracleDatabase) error {
+	changed := false
+	if oradb.Status.OverridesHash == "" {
+		oradb.Status.OverridesHash = OverridesHash(oradb.Spec.Overrides)
+		changed = true
+	}
+	if oradb.Status.DatabaseCreation == nil {
+		oradb.Status.DatabaseCreation = DatabaseCreationOf(&oradb.Spec)
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return r.Status().Update(ctx, oradb)
+}
+
+//lockDatabase takes the lock of the DB,while another resource runs scripts in the DB it marks the OracleDatabase
+//waiting and returns nil
+func (r *OracleDatabaseReconciler) lockDatabase(ctx context.Context, oradb *operatorv1.OracleDatabase) func() {
+	unlock, changed := lockDatabase(r.Recorder, oradb, "OracleDatabase", &oradb.Status.Conditions, &oradb.Spec)
+	if changed {
+		if err := r.Status().Update(ctx, oradb); err != nil {
+			log.Log.Error(err, "unable to update OracleDatabase status")
+		}
+	}
+	return unlock
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *OracleDatabaseReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		// status updates of every step must not trigger another reconcile
+		For(&operatorv1.OracleDatabase{}, builder.WithPredicates(predicate.Or(predicate.GenerationChangedPredicate{}, predicate.AnnotationChangedPredicate{}))).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(r.oracledatabasesOfSecret)).
+		// a deleted OracleDatabase waits for its ApexOrds
+		Watches(&source.Kind{Type: &operatorv1.ApexOrds{}}, handler.EnqueueRequestsFromMapFunc(r.deletedDatabaseOfApexOrds)).
+		// a change of the DB objects,ie the DB pod getting ready,reconciles the OracleDatabase
+		Owns(&appsv1.StatefulSet{}).
+		Owns(&corev1.Service{}).
+		Owns(&corev1.Secret{}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
+		Complete(r)
+}
+
+//oracledatabasesOfSecret returns the requests of the OracleDatabases whose spec.credentials is the secret
+func (r *OracleDatabaseReconciler) oracledatabasesOfSecret(obj client.Object) []reconcile.Request {
+	var oradblist operatorv1.OracleDatabaseList
+	if err := r.List(context.Background(), &oradblist, client.InNamespace(obj.GetNamespace())); err != nil {
+		log.Log.Error(err, "unable to list OracleDatabases of secret "+obj.GetName())
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, oradb := range oradblist.Items {
+		if CredentialsSecretOf(&oradb.Spec.DatabaseSpec) == obj.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&oradb)})
+		}
+	}
+	return requests
+}
+
+//deletedDatabaseOfApexOrds returns the request of the OracleDatabase of the databaseref of the ApexOrds while it is deleted
+func (r *OracleDatabaseReconciler) deletedDatabaseOfApexOrds(obj client.Object) []reconcile.Request {
+	apexords, ok := obj.(*operatorv1.ApexOrds)
+	if !ok || apexords.Spec.DatabaseRef == "" {
+		return nil
+	}
+	var oradb operatorv1.OracleDatabase
+	if err := r.Get(context.Background(), client.ObjectKey{Namespace: apexords.ObjectMeta.Namespace, Name: apexords.Spec.DatabaseRef}, &oradb); err != nil {
+		return nil
+	}
+	if oradb.ObjectMeta.DeletionTimestamp.IsZero() {
+		return nil
+	}
+	return []reconcile.Request{{NamespacedName: client.ObjectKeyFromObject(&oradb)}}
+}
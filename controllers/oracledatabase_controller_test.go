@@ -0,0 +1,704 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	operatorv1 "apexords-operator/apexords-operator/api/v1"
+)
+
+var _ = Describe("OracleDatabase shared by several ApexOrds", func() {
+	var (
+		ctx       context.Context
+		namespace string
+		runner    *FakeCommandRunner
+		stopPods  func()
+		saved     time.Duration
+	)
+
+	reconcileDb := func(oradb *operatorv1.OracleDatabase) error {
+		r := &OracleDatabaseReconciler{Client: k8sClient, Scheme: scheme.Scheme, Recorder: record.NewFakeRecorder(100), Runner: runner}
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(oradb)})
+		return err
+	}
+
+	reconcileApexOrds := func(apexords *operatorv1.ApexOrds) error {
+		r := &ApexOrdsReconciler{Client: k8sClient, Scheme: scheme.Scheme, Recorder: record.NewFakeRecorder(100), Runner: runner}
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(apexords)})
+		return err
+	}
+
+	get := func(obj client.Object, name string) client.Object {
+		ExpectWithOffset(1, k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, obj)).To(Succeed())
+		return obj
+	}
+
+	newOracleDatabase := func(name string, spec operatorv1.OracleDatabaseSpec) *operatorv1.OracleDatabase {
+		oradb := &operatorv1.OracleDatabase{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       spec,
+		}
+		ExpectWithOffset(1, k8sClient.Create(ctx, oradb)).To(Succeed())
+		return oradb
+	}
+
+	newApexOrds := func(name string, databaseref string, ordsname string) *operatorv1.ApexOrds {
+		apexords := &operatorv1.ApexOrds{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       operatorv1.ApexOrdsSpec{DatabaseRef: databaseref, Ordsname: ordsname},
+		}
+		ExpectWithOffset(1, k8sClient.Create(ctx, apexords)).To(Succeed())
+		return apexords
+	}
+
+	startDbPod := func(dbname string) {
+		dbpod := &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: dbname + "-apexords-db-sts-0", Namespace: namespace},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "oradb", Image: "oradb"}}},
+		}
+		ExpectWithOffset(1, k8sClient.Create(ctx, dbpod)).To(Succeed())
+		EventuallyWithOffset(1, func() corev1.PodPhase {
+			_ = k8sClient.Get(ctx, client.ObjectKeyFromObject(dbpod), dbpod)
+			return dbpod.Status.Phase
+		}).Should(Equal(corev1.PodRunning))
+	}
+
+	devdb := operatorv1.OracleDatabaseSpec{Dbname: "devcdb", Dbservice: "devpdb"}
+	//dbpassword returns the sys password the OracleDatabase generated into its credentials secret
+	dbpassword := func() string {
+		secret := &corev1.Secret{}
+		ExpectWithOffset(1, k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "devcdb-apexords-db-credentials"}, secret)).To(Succeed())
+		return string(secret.Data[CredentialsSysPasswordKey])
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		runner = &FakeCommandRunner{}
+		saved = PodPollInterval
+		PodPollInterval = 20 * time.Millisecond
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "apexords-oradb-"}}
+		Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+		namespace = ns.Name
+		stopPods = runPods(namespace, "devcdb-apexords-db-sts-0", "devcdb-apexords-sqlpluspod", "devcdb-apexords-db-ordspod", "devords-apexords-ordspod", "firstords-apexords-ordspod", "secondords-apexords-ordspod", "otherords-apexords-ordspod")
+	})
+
+	AfterEach(func() {
+		stopPods()
+		PodPollInterval = saved
+	})
+
+	It("marks an OracleDatabase without service as failed", func() {
+		oradb := newOracleDatabase("devdb", operatorv1.OracleDatabaseSpec{Dbname: "devcdb"})
+		Expect(reconcileDb(oradb)).To(Succeed())
+
+		get(oradb, "devdb")
+		Expect(oradb.Status.Phase).To(Equal(operatorv1.PhaseFailed))
+		Expect(meta.FindStatusCondition(oradb.Status.Conditions, operatorv1.ConditionFailed).Reason).To(Equal(ReasonInvalidSpec))
+	})
+
+	It("provisions the DB and installs Apex and the Ords schemas once", func() {
+		oradb := newOracleDatabase("devdb", devdb)
+
+		By("requeueing until the DB pod runs")
+		err := reconcileDb(oradb)
+		var stepErr *StepError
+		Expect(errors.As(err, &stepErr)).To(BeTrue())
+		Expect(stepErr.Reason).To(Equal(ReasonPodNotReady))
+
+		By("generating the sys password into the credentials secret,the statefulset reads it from there")
+		password := dbpassword()
+		Expect(password).To(HaveLen(16))
+		Expect(password).NotTo(Equal(Autopasswd("devcdb" + "devpdb")))
+		sts := get(&appsv1.StatefulSet{}, "devcdb-apexords-db-sts").(*appsv1.StatefulSet)
+		Expect(sts.OwnerReferences).To(HaveLen(1))
+		Expect(sts.OwnerReferences[0].Kind).To(Equal("OracleDatabase"))
+		Expect(sts.OwnerReferences[0].UID).To(Equal(oradb.UID))
+		oraclepwd := sts.Spec.Template.Spec.Containers[0].Env[2]
+		Expect(oraclepwd.Name).To(Equal("ORACLE_PWD"))
+		Expect(oraclepwd.Value).To(BeEmpty())
+		Expect(oraclepwd.ValueFrom.SecretKeyRef.Name).To(Equal("devcdb-apexords-db-credentials"))
+		Expect(oraclepwd.ValueFrom.SecretKeyRef.Key).To(Equal(CredentialsSysPasswordKey))
+		dbsvc := get(&corev1.Service{}, "devcdb-apexords-db-svc")
+		Expect(dbsvc.GetOwnerReferences()[0].Kind).To(Equal("OracleDatabase"))
+
+		By("installing Apex and the Ords schemas once the DB pod runs")
+		startDbPod("devcdb")
+		runner.Results = func(cmd FakeCommand) (CommandResult, error) {
+			if cmd.Podname == "devcdb-apexords-db-ordspod" {
+				return CommandResult{Stdout: versionMarker + "Oracle REST Data Services 19.2.0.r1991647\n"}, nil
+			}
+			return CommandResult{}, nil
+		}
+		Expect(reconcileDb(oradb)).To(Succeed())
+		get(oradb, "devdb")
+		Expect(oradb.Status.Phase).To(Equal(operatorv1.PhaseReady))
+		Expect(oradb.ObjectMeta.Finalizers).To(ContainElement(OracleDatabaseFinalizer))
+		Expect(meta.IsStatusConditionTrue(oradb.Status.Conditions, operatorv1.ConditionApexInstalled)).To(BeTrue())
+		Expect(meta.IsStatusConditionTrue(oradb.Status.Conditions, operatorv1.ConditionOrdsInstalled)).To(BeTrue())
+		Expect(oradb.Status.OrdsVersion).To(Equal("19.2.0.r1991647"))
+		Expect(runner.Scripts()).To(HaveLen(4))
+		Expect(runner.Scripts()[0]).To(ContainSubstring("@devcdb-apexords-db-svc:1521/devpdb "))
+		Expect(runner.Commands[3].Podname).To(Equal("devcdb-apexords-db-ordspod"))
+		Expect(runner.Commands[3].Command).To(Equal(OrdsInstallCommand()))
+		//the parameters file with the passwords goes away with the ords pod
+		Expect(apierrors.IsNotFound(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "devcdb-apexords-db-ordspod"}, &corev1.Secret{}))).To(BeTrue())
+
+		secret := get(&corev1.Secret{}, "devcdb-apexords-db-credentials").(*corev1.Secret)
+		Expect(secret.Data).To(HaveKeyWithValue(CredentialsSysPasswordKey, []byte(password)))
+
+		Expect(reconcileDb(oradb)).To(Succeed())
+		Expect(runner.Commands).To(HaveLen(4))
+	})
+
+	It("rejects a change of the settings the DB was created with", func() {
+		spec := devdb
+		spec.DatabaseSpec = operatorv1.DatabaseSpec{NationalCharacterSet: "UTF8"}
+		oradb := newOracleDatabase("devdb", spec)
+		startDbPod("devcdb")
+		Expect(reconcileDb(oradb)).To(Succeed())
+		get(oradb, "devdb")
+		Expect(oradb.Status.DatabaseCreation).To(Equal(&operatorv1.DatabaseCreation{NationalCharacterSet: "UTF8"}))
+
+		oradb.Spec.NationalCharacterSet = "AL16UTF16"
+		Expect(k8sClient.Update(ctx, oradb)).To(Succeed())
+		Expect(reconcileDb(oradb)).To(Succeed())
+		get(oradb, "devdb")
+		Expect(oradb.Status.Phase).To(Equal(operatorv1.PhaseFailed))
+		failed := meta.FindStatusCondition(oradb.Status.Conditions, operatorv1.ConditionFailed)
+		Expect(failed.Reason).To(Equal(ReasonInvalidSpec))
+		Expect(failed.Message).To(ContainSubstring("database nationalcharacterset can't change"))
+	})
+
+	It("rejects a change of the overrides while the DB is provisioned", func() {
+		spec := devdb
+		spec.Overrides = []operatorv1.ObjectOverride{{Kind: "StatefulSet", Patch: "metadata: {annotations: {team: apex}}"}}
+		oradb := newOracleDatabase("devdb", spec)
+		Expect(reconcileDb(oradb)).NotTo(Succeed())
+		get(oradb, "devdb")
+		Expect(oradb.Status.OverridesHash).To(Equal(OverridesHash(spec.Overrides)))
+		Expect(get(&appsv1.StatefulSet{}, "devcdb-apexords-db-sts").GetAnnotations()).To(HaveKeyWithValue("team", "apex"))
+
+		oradb.Spec.Overrides[0].Patch = "metadata: {annotations: {team: ords}}"
+		Expect(k8sClient.Update(ctx, oradb)).To(Succeed())
+		Expect(reconcileDb(oradb)).To(Succeed())
+		get(oradb, "devdb")
+		Expect(oradb.Status.Phase).To(Equal(operatorv1.PhaseFailed))
+		Expect(meta.FindStatusCondition(oradb.Status.Conditions, operatorv1.ConditionFailed).Reason).To(Equal(ReasonOverridesChanged))
+	})
+
+	It("rejects a change of the settings while the DB is provisioned", func() {
+		spec := devdb
+		spec.DatabaseSpec = operatorv1.DatabaseSpec{Edition: operatorv1.DbEditionSE2}
+		oradb := newOracleDatabase("devdb", spec)
+		Expect(reconcileDb(oradb)).NotTo(Succeed())
+		get(oradb, "devdb")
+		Expect(oradb.Status.DatabaseCreation).To(Equal(&operatorv1.DatabaseCreation{Edition: operatorv1.DbEditionSE2}))
+
+		//the statefulset creates a SE2 DB at first boot
+		oradb.Spec.Edition = operatorv1.DbEditionEE
+		Expect(k8sClient.Update(ctx, oradb)).To(Succeed())
+		Expect(reconcileDb(oradb)).To(Succeed())
+		get(oradb, "devdb")
+		Expect(oradb.Status.Phase).To(Equal(operatorv1.PhaseFailed))
+		failed := meta.FindStatusCondition(oradb.Status.Conditions, operatorv1.ConditionFailed)
+		Expect(failed.Reason).To(Equal(ReasonInvalidSpec))
+		Expect(failed.Message).To(ContainSubstring("database edition can't change"))
+	})
+
+	It("keeps an OracleDatabase until no ApexOrds references it", func() {
+		oradb := newOracleDatabase("devdb", devdb)
+		startDbPod("devcdb")
+		Expect(reconcileDb(oradb)).To(Succeed())
+		apexords := newApexOrds("apexords-dev", "devdb", "devords")
+
+		Expect(k8sClient.Delete(ctx, oradb)).To(Succeed())
+		err := reconcileDb(oradb)
+		var stepErr *StepError
+		Expect(errors.As(err, &stepErr)).To(BeTrue())
+		Expect(stepErr.Reason).To(Equal(ReasonDatabaseInUse))
+		Expect(stepErr.Error()).To(ContainSubstring("apexords-dev"))
+		get(oradb, "devdb")
+		Expect(oradb.ObjectMeta.DeletionTimestamp).NotTo(BeNil())
+		Expect(oradb.ObjectMeta.Finalizers).To(ContainElement(OracleDatabaseFinalizer))
+
+		r := &OracleDatabaseReconciler{Client: k8sClient}
+		Expect(r.deletedDatabaseOfApexOrds(apexords)).To(ConsistOf(ctrl.Request{NamespacedName: client.ObjectKeyFromObject(oradb)}))
+
+		Expect(k8sClient.Delete(ctx, apexords)).To(Succeed())
+		Expect(reconcileDb(oradb)).To(Succeed())
+		Expect(apierrors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(oradb), &operatorv1.OracleDatabase{}))).To(BeTrue())
+	})
+
+	It("rejects a new dbname and keeps the DB objects", func() {
+		oradb := newOracleDatabase("devdb", devdb)
+		startDbPod("devcdb")
+		Expect(reconcileDb(oradb)).To(Succeed())
+		get(oradb, "devdb")
+		Expect(oradb.Status.Dbname).To(Equal("devcdb"))
+		Expect(oradb.Status.Objects).To(Equal([]operatorv1.GeneratedObject{
+			{Kind: "StatefulSet", Name: "devcdb-apexords-db-sts"},
+			{Kind: "Service", Name: "devcdb-apexords-db-svc"},
+			{Kind: "Secret", Name: "devcdb-apexords-db-credentials"},
+			{Kind: "ConfigMap", Name: "devcdb-apexords-db-install-log"},
+		}))
+
+		oradb.Spec.Dbname = "othercdb"
+		Expect(k8sClient.Update(ctx, oradb)).To(Succeed())
+		Expect(reconcileDb(oradb)).To(Succeed())
+		get(oradb, "devdb")
+		Expect(oradb.Status.Phase).To(Equal(operatorv1.PhaseFailed))
+		Expect(meta.FindStatusCondition(oradb.Status.Conditions, operatorv1.ConditionFailed).Reason).To(Equal(ReasonNameChanged))
+		Expect(apierrors.IsNotFound(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "othercdb-apexords-db-sts"}, &appsv1.StatefulSet{}))).To(BeTrue())
+		get(&appsv1.StatefulSet{}, "devcdb-apexords-db-sts")
+		Expect(runner.Commands).To(HaveLen(4))
+	})
+
+	It("sets DB parameters and reports the static ones waiting for a restart", func() {
+		spec := devdb
+		spec.Parameters = map[string]string{"processes": "300", "SGA_TARGET": "2G"}
+		oradb := newOracleDatabase("devdb", spec)
+		startDbPod("devcdb")
+		runner.Results = func(cmd FakeCommand) (CommandResult, error) {
+			if strings.Contains(cmd.Command[2], dbParameterMarker) {
+				return CommandResult{Stdout: dbParameterMarker + "processes\n"}, nil
+			}
+			return CommandResult{}, nil
+		}
+		Expect(reconcileDb(oradb)).To(Succeed())
+
+		Expect(runner.Scripts()).To(HaveLen(5))
+		script := runner.Scripts()[4]
+		//parameters are set in the CDB root
+		Expect(script).To(ContainSubstring("@devcdb-apexords-db-svc:1521/devcdb "))
+		Expect(script).To(ContainSubstring("  set_parameter('processes', '300');\n  set_parameter('sga_target', '2G');\n"))
+		Expect(script).To(ContainSubstring("p.name in ('processes', 'sga_target')"))
+
+		get(oradb, "devdb")
+		Expect(oradb.Status.Phase).To(Equal(operatorv1.PhaseReady))
+		Expect(oradb.Status.PendingRestart).To(Equal([]string{"processes"}))
+		applied := meta.FindStatusCondition(oradb.Status.Conditions, operatorv1.ConditionParametersApplied)
+		Expect(applied.Status).To(Equal(metav1.ConditionFalse))
+		Expect(applied.Reason).To(Equal(ReasonRestartRequired))
+		Expect(applied.ObservedGeneration).To(Equal(oradb.Generation))
+		//restartpolicy Manual leaves the DB pod alone
+		Expect(get(&corev1.Pod{}, "devcdb-apexords-db-sts-0").GetDeletionTimestamp()).To(BeNil())
+
+		By("not setting them again for the same generation")
+		Expect(reconcileDb(oradb)).To(Succeed())
+		Expect(runner.Commands).To(HaveLen(5))
+
+		By("setting them again when the spec changes")
+		oradb.Spec.Parameters["open_cursors"] = "500"
+		Expect(k8sClient.Update(ctx, oradb)).To(Succeed())
+		Expect(reconcileDb(oradb)).To(Succeed())
+		Expect(runner.Commands).To(HaveLen(6))
+		Expect(runner.Scripts()[5]).To(ContainSubstring("set_parameter('open_cursors', '500');"))
+	})
+
+	It("restarts the DB once for static parameters with restartpolicy Automatic", func() {
+		spec := devdb
+		spec.Parameters = map[string]string{"processes": "300"}
+		spec.RestartPolicy = operatorv1.DbRestartAutomatic
+		oradb := newOracleDatabase("devdb", spec)
+		startDbPod("devcdb")
+		pending := true
+		runner.Results = func(cmd FakeCommand) (CommandResult, error) {
+			if pending && strings.Contains(cmd.Command[2], dbParameterMarker) {
+				return CommandResult{Stdout: dbParameterMarker + "processes\n"}, nil
+			}
+			return CommandResult{}, nil
+		}
+		r := &OracleDatabaseReconciler{Client: k8sClient, Scheme: scheme.Scheme, Recorder: record.NewFakeRecorder(100), Runner: runner}
+		req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(oradb)}
+		result, err := r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(Equal(PodPollInterval))
+
+		get(oradb, "devdb")
+		Expect(meta.FindStatusCondition(oradb.Status.Conditions, operatorv1.ConditionParametersApplied).Reason).To(Equal(ReasonDbRestarting))
+		Expect(oradb.Status.PendingRestart).To(Equal([]string{"processes"}))
+		dbpod := &corev1.Pod{}
+		Expect(apierrors.IsNotFound(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "devcdb-apexords-db-sts-0"}, dbpod))).To(BeTrue())
+
+		By("waiting for the DB pod to come back")
+		_, err = r.Reconcile(ctx, req)
+		var stepErr *StepError
+		Expect(errors.As(err, &stepErr)).To(BeTrue())
+		Expect(stepErr.Reason).To(Equal(ReasonPodNotReady))
+
+		By("checking the parameters once the DB runs again")
+		startDbPod("devcdb")
+		pending = false
+		result, err = r.Reconcile(ctx, req)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.RequeueAfter).To(BeZero())
+		oradb = get(&operatorv1.OracleDatabase{}, "devdb").(*operatorv1.OracleDatabase)
+		Expect(oradb.Status.Phase).To(Equal(operatorv1.PhaseReady))
+		Expect(oradb.Status.PendingRestart).To(BeEmpty())
+		Expect(meta.IsStatusConditionTrue(oradb.Status.Conditions, operatorv1.ConditionParametersApplied)).To(BeTrue())
+	})
+
+	It("accepts only numbers,names and quoted strings as values of DB parameters", func() {
+		for _, value := range []string{"300", " 2G ", "1.5", "TRUE", "exclusive", "AL32UTF8", "'LOCATION=/u01/arch'",
+			"'/u01/a', '/u02/b'", "'it''s'", "a,b"} {
+			Expect(ValidateDbParameters(map[string]string{"param": value})).To(Succeed(), value)
+		}
+		for _, value := range []string{"", " ", "300 scope=memory", "300 sid='orcl'", "300 comment='x'", "300 container=all",
+			"'a' scope=spfile", "300 deferred", "'unterminated", "'a'||'b'", "300,", "1e3", "300; drop user", "300\nexit"} {
+			err := ValidateDbParameters(map[string]string{"param": value})
+			Expect(err).To(HaveOccurred(), value)
+			Expect(err.Error()).To(ContainSubstring("is invalid"))
+		}
+	})
+
+	It("rejects invalid DB parameters", func() {
+		spec := devdb
+		spec.Parameters = map[string]string{"processes": "300; drop user"}
+		oradb := newOracleDatabase("devdb", spec)
+		Expect(reconcileDb(oradb)).To(Succeed())
+		get(oradb, "devdb")
+		Expect(oradb.Status.Phase).To(Equal(operatorv1.PhaseFailed))
+		Expect(meta.FindStatusCondition(oradb.Status.Conditions, operatorv1.ConditionFailed).Reason).To(Equal(ReasonInvalidSpec))
+
+		apexords := &operatorv1.ApexOrds{
+			ObjectMeta: metav1.ObjectMeta{Name: "apexords-dev", Namespace: namespace},
+			Spec: operatorv1.ApexOrdsSpec{DatabaseRef: "devdb", Ordsname: "devords",
+				Database: &operatorv1.DatabaseSpec{Parameters: map[string]string{"processes": "300"}}},
+		}
+		Expect(k8sClient.Create(ctx, apexords)).To(Succeed())
+		Expect(reconcileApexOrds(apexords)).To(Succeed())
+		get(apexords, "apexords-dev")
+		Expect(apexords.Status.Phase).To(Equal(operatorv1.PhaseFailed))
+		Expect(meta.FindStatusCondition(apexords.Status.Conditions, operatorv1.ConditionFailed).Message).To(ContainSubstring("databaseref"))
+		Expect(runner.Commands).To(BeEmpty())
+	})
+
+	It("waits for the referenced OracleDatabase before installing Ords", func() {
+		apexords := newApexOrds("apexords-dev", "devdb", "devords")
+
+		err := reconcileApexOrds(apexords)
+		var stepErr *StepError
+		Expect(errors.As(err, &stepErr)).To(BeTrue())
+		Expect(stepErr.Reason).To(Equal(ReasonDatabaseNotReady))
+		Expect(stepErr.Retryable).To(BeTrue())
+
+		oradb := newOracleDatabase("devdb", devdb)
+		Expect(reconcileDb(oradb)).To(HaveOccurred())
+		Expect(errors.As(reconcileApexOrds(apexords), &stepErr)).To(BeTrue())
+		Expect(stepErr.Reason).To(Equal(ReasonDatabaseNotReady))
+		Expect(runner.Commands).To(BeEmpty())
+		//a databaseref is recorded once the OracleDatabase is ready,a wrong name can still be fixed
+		get(apexords, apexords.Name)
+		Expect(apexords.Status.DatabaseRef).To(BeEmpty())
+		Expect(apexords.Status.Dbname).To(BeEmpty())
+
+		r := &ApexOrdsReconciler{Client: k8sClient}
+		other := newApexOrds("apexords-other", "otherdb", "otherords")
+		Expect(r.apexordsOfDatabase(oradb)).To(ConsistOf(ctrl.Request{NamespacedName: client.ObjectKeyFromObject(apexords)}))
+		Expect(r.apexordsOfDatabase(oradb)).NotTo(ContainElement(ctrl.Request{NamespacedName: client.ObjectKeyFromObject(other)}))
+	})
+
+	It("runs the scripts of ApexOrds reconciled at once one after the other", func() {
+		oradb := newOracleDatabase("devdb", devdb)
+		startDbPod("devcdb")
+		Expect(reconcileDb(oradb)).To(Succeed())
+
+		var mu sync.Mutex
+		active, maxActive := 0, 0
+		runner.Results = func(cmd FakeCommand) (CommandResult, error) {
+			mu.Lock()
+			active++
+			if active > maxActive {
+				maxActive = active
+			}
+			mu.Unlock()
+			time.Sleep(100 * time.Millisecond)
+			mu.Lock()
+			active--
+			mu.Unlock()
+			return CommandResult{}, nil
+		}
+
+		//the Ords schemas of devpdb are installed,each ApexOrds sets up the pool of another PDB
+		newPoolApexOrds := func(name string, ordsname string) *operatorv1.ApexOrds {
+			apexords := &operatorv1.ApexOrds{
+				ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+				Spec: operatorv1.ApexOrdsSpec{DatabaseRef: "devdb", Ordsname: ordsname, Ords: &operatorv1.OrdsSpec{
+					Pools: []operatorv1.OrdsPool{{Name: "sales", Dbservice: "salespdb", PathPrefix: "/sales"}}}},
+			}
+			Expect(k8sClient.Create(ctx, apexords)).To(Succeed())
+			return apexords
+		}
+		var waited int32
+		var wg sync.WaitGroup
+		for _, apexords := range []*operatorv1.ApexOrds{newPoolApexOrds("apexords-first", "firstords"), newPoolApexOrds("apexords-second", "secondords")} {
+			wg.Add(1)
+			go func(apexords *operatorv1.ApexOrds) {
+				defer GinkgoRecover()
+				defer wg.Done()
+				r := &ApexOrdsReconciler{Client: k8sClient, Scheme: scheme.Scheme, Recorder: record.NewFakeRecorder(100), Runner: runner}
+				for i := 0; i < 100; i++ {
+					result, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(apexords)})
+					Expect(err).NotTo(HaveOccurred())
+					if result.RequeueAfter == 0 {
+						return
+					}
+					atomic.AddInt32(&waited, 1)
+					time.Sleep(20 * time.Millisecond)
+				}
+			}(apexords)
+		}
+		wg.Wait()
+
+		Expect(runner.Commands).To(HaveLen(6))
+		Expect(maxActive).To(Equal(1))
+		Expect(atomic.LoadInt32(&waited)).To(BeNumerically(">", 0))
+		for _, name := range []string{"apexords-first", "apexords-second"} {
+			apexords := get(&operatorv1.ApexOrds{}, name).(*operatorv1.ApexOrds)
+			Expect(apexords.Status.Phase).To(Equal(operatorv1.PhaseReady))
+		}
+	})
+
+	It("sets up Ords for each ApexOrds without installing Apex and the Ords schemas again", func() {
+		oradb := newOracleDatabase("devdb", devdb)
+		startDbPod("devcdb")
+		runner.Results = func(cmd FakeCommand) (CommandResult, error) {
+			return CommandResult{Stdout: versionMarker + "Oracle REST Data Services 19.2.0.r1991647\n"}, nil
+		}
+		Expect(reconcileDb(oradb)).To(Succeed())
+		Expect(runner.Commands).To(HaveLen(4))
+		dbpassword := dbpassword()
+
+		first := newApexOrds("apexords-first", "devdb", "firstords")
+		second := newApexOrds("apexords-second", "devdb", "secondords")
+		Expect(reconcileApexOrds(first)).To(Succeed())
+		Expect(reconcileApexOrds(second)).To(Succeed())
+
+		//the ApexOrds run no ords.war install of their own
+		Expect(runner.Commands).To(HaveLen(4))
+		for _, name := range []string{"firstords-apexords-ordspod", "secondords-apexords-ordspod"} {
+			Expect(apierrors.IsNotFound(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, &corev1.Pod{}))).To(BeTrue())
+		}
+
+		for _, apexords := range []*operatorv1.ApexOrds{first, second} {
+			get(apexords, apexords.Name)
+			Expect(apexords.Status.Phase).To(Equal(operatorv1.PhaseReady))
+			installed := meta.FindStatusCondition(apexords.Status.Conditions, operatorv1.ConditionApexInstalled)
+			Expect(installed.Status).To(Equal(metav1.ConditionTrue))
+			Expect(installed.Reason).To(Equal(ReasonDatabaseReady))
+			Expect(apexords.Status.OrdsVersion).To(Equal("19.2.0.r1991647"))
+
+			//both pools use the password of the DB,so setting up the second Ords keeps the first working
+			ordssecret := get(&corev1.Secret{}, apexords.Spec.Ordsname+"-apexords-ords-secret").(*corev1.Secret)
+			Expect(string(ordssecret.Data["ords_params.properties"])).To(ContainSubstring("db.hostname=devcdb-apexords-db-svc\n"))
+			Expect(string(ordssecret.Data["ords_params.properties"])).To(ContainSubstring("db.servicename=devpdb\n"))
+			Expect(string(ordssecret.Data["ords_params.properties"])).To(ContainSubstring("sys.password=" + dbpassword + "\n"))
+			Expect(string(ordssecret.Data["apex_pu.xml"])).To(ContainSubstring(dbpassword))
+			secret := get(&corev1.Secret{}, apexords.Spec.Ordsname+"-apexords-credentials").(*corev1.Secret)
+			Expect(secret.Data).To(HaveKeyWithValue(CredentialsSysPasswordKey, []byte(dbpassword)))
+
+			deployment := get(&appsv1.Deployment{}, apexords.Spec.Ordsname+"-apexords-ords-deployment")
+			Expect(deployment.GetOwnerReferences()[0].UID).To(Equal(apexords.UID))
+		}
+
+		sts := get(&appsv1.StatefulSet{}, "devcdb-apexords-db-sts")
+		Expect(sts.GetOwnerReferences()[0].UID).To(Equal(oradb.UID))
+	})
+
+	It("rejects a change of the databaseref of an ApexOrds", func() {
+		oradb := newOracleDatabase("devdb", devdb)
+		startDbPod("devcdb")
+		runner.Results = func(cmd FakeCommand) (CommandResult, error) {
+			return CommandResult{Stdout: versionMarker + "Oracle REST Data Services 19.2.0.r1991647\n"}, nil
+		}
+		Expect(reconcileDb(oradb)).To(Succeed())
+		apexords := newApexOrds("apexords-dev", "devdb", "devords")
+		Expect(reconcileApexOrds(apexords)).To(Succeed())
+		get(apexords, apexords.Name)
+		Expect(apexords.Status.DatabaseRef).To(Equal("devdb"))
+
+		By("rejecting another OracleDatabase")
+		apexords.Spec.DatabaseRef = "otherdb"
+		Expect(k8sClient.Update(ctx, apexords)).To(Succeed())
+		Expect(reconcileApexOrds(apexords)).To(Succeed())
+		get(apexords, apexords.Name)
+		Expect(apexords.Status.Phase).To(Equal(operatorv1.PhaseFailed))
+		failed := meta.FindStatusCondition(apexords.Status.Conditions, operatorv1.ConditionFailed)
+		Expect(failed.Reason).To(Equal(ReasonNameChanged))
+		Expect(failed.Message).To(ContainSubstring("spec.databaseref can't change from devdb to otherdb"))
+		Expect(apexords.Status.DatabaseRef).To(Equal("devdb"))
+
+		By("rejecting an inline DB in place of the OracleDatabase")
+		apexords.Spec.DatabaseRef = ""
+		apexords.Spec.Dbname = "othercdb"
+		apexords.Spec.Dbservice = "otherpdb"
+		Expect(k8sClient.Update(ctx, apexords)).To(Succeed())
+		Expect(reconcileApexOrds(apexords)).To(Succeed())
+		get(apexords, apexords.Name)
+		failed = meta.FindStatusCondition(apexords.Status.Conditions, operatorv1.ConditionFailed)
+		Expect(failed.Message).To(ContainSubstring("spec.databaseref can't be removed"))
+		Expect(apexords.Status.Dbname).To(BeEmpty())
+		Expect(apierrors.IsNotFound(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "othercdb-apexords-db-sts"}, &appsv1.StatefulSet{}))).To(BeTrue())
+
+		By("rejecting an OracleDatabase in place of the inline DB")
+		inline := &operatorv1.ApexOrds{Spec: operatorv1.ApexOrdsSpec{DatabaseRef: "devdb", Ordsname: "devords"},
+			Status: operatorv1.ApexOrdsStatus{Dbname: "testcdb", Ordsname: "devords"}}
+		err := ApexOrdsNames(inline)
+		Expect(err).NotTo(BeNil())
+		Expect(err.Reason).To(Equal(ReasonNameChanged))
+		Expect(err.Error()).To(ContainSubstring("spec.databaseref can't be set,the ApexOrds created its own DB testcdb"))
+
+		By("going on once it is set back")
+		get(apexords, apexords.Name)
+		apexords.Spec.DatabaseRef = "devdb"
+		Expect(k8sClient.Update(ctx, apexords)).To(Succeed())
+		Expect(reconcileApexOrds(apexords)).To(Succeed())
+		get(apexords, apexords.Name)
+		Expect(apexords.Status.Phase).To(Equal(operatorv1.PhaseReady))
+	})
+
+	It("keeps a finished rotation when the status update at the end fails", func() {
+		oradb := newOracleDatabase("devdb", devdb)
+		startDbPod("devcdb")
+		Expect(reconcileDb(oradb)).To(Succeed())
+		Expect(runner.Commands).To(HaveLen(4))
+
+		get(oradb, "devdb")
+		oradb.ObjectMeta.Annotations = map[string]string{operatorv1.RotatePasswordsAnnotation: "1"}
+		Expect(k8sClient.Update(ctx, oradb)).To(Succeed())
+		//the status update after the rotation is the only one saved
+		updates := int32(1)
+		r := &OracleDatabaseReconciler{Client: failingStatusClient{Client: k8sClient, updates: &updates}, Scheme: scheme.Scheme, Recorder: record.NewFakeRecorder(100), Runner: runner}
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(oradb)})
+		Expect(apierrors.IsServiceUnavailable(err)).To(BeTrue())
+		//without ApexOrds no Ords pod uses the old public password,it is expired right away
+		Expect(runner.Commands).To(HaveLen(6))
+		Expect(runner.Scripts()[5]).To(ContainSubstring("expire password rollover period"))
+		get(oradb, "devdb")
+		Expect(oradb.Status.PasswordsRotation).To(Equal("1"))
+		Expect(oradb.Status.PasswordsRotatedAt).NotTo(BeNil())
+		Expect(oradb.Status.PasswordsRollover).To(Equal("1"))
+
+		//the passwords are not rotated again,the rollover is finished again
+		Expect(reconcileDb(oradb)).To(Succeed())
+		Expect(runner.Commands).To(HaveLen(7))
+		Expect(runner.Scripts()[6]).To(ContainSubstring("expire password rollover period"))
+		oradb = get(&operatorv1.OracleDatabase{}, "devdb").(*operatorv1.OracleDatabase)
+		Expect(oradb.Status.PasswordsRollover).To(BeEmpty())
+	})
+
+	It("rotates the passwords on the OracleDatabase and updates the Ords of its ApexOrds", func() {
+		oradb := newOracleDatabase("devdb", devdb)
+		startDbPod("devcdb")
+		Expect(reconcileDb(oradb)).To(Succeed())
+		apexords := newApexOrds("apexords-first", "devdb", "firstords")
+		Expect(reconcileApexOrds(apexords)).To(Succeed())
+		Expect(runner.Commands).To(HaveLen(4))
+		dbpassword := dbpassword()
+
+		get(oradb, "devdb")
+		oradb.ObjectMeta.Annotations = map[string]string{operatorv1.RotatePasswordsAnnotation: "1"}
+		Expect(k8sClient.Update(ctx, oradb)).To(Succeed())
+		Expect(reconcileDb(oradb)).To(Succeed())
+		Expect(runner.Commands).To(HaveLen(5))
+		Expect(runner.Scripts()[4]).To(ContainSubstring("@apxchpwd-silent-admin.sql &new_apex_admin_password"))
+
+		dbsecret := get(&corev1.Secret{}, "devcdb-apexords-db-credentials").(*corev1.Secret)
+		public := string(dbsecret.Data[CredentialsPublicPasswordKey])
+		Expect(public).NotTo(Equal(dbpassword))
+		Expect(dbsecret.Data).To(HaveKeyWithValue(CredentialsSysPasswordKey, []byte(dbpassword)))
+		get(oradb, "devdb")
+		Expect(oradb.Status.PasswordsRotation).To(Equal("1"))
+
+		//the ApexOrds copies the passwords and rolls its Ords without reinstalling it
+		Expect(reconcileApexOrds(apexords)).To(Succeed())
+		Expect(runner.Commands).To(HaveLen(5))
+		secret := get(&corev1.Secret{}, "firstords-apexords-credentials").(*corev1.Secret)
+		Expect(secret.Data).To(HaveKeyWithValue(CredentialsPublicPasswordKey, []byte(public)))
+		Expect(secret.Data).To(HaveKeyWithValue(CredentialsApexAdminPasswordKey, dbsecret.Data[CredentialsApexAdminPasswordKey]))
+		ordssecret := get(&corev1.Secret{}, "firstords-apexords-ords-secret").(*corev1.Secret)
+		Expect(string(ordssecret.Data["apex_pu.xml"])).To(ContainSubstring(`<entry key="db.password">` + public + `</entry>`))
+		deployment := get(&appsv1.Deployment{}, "firstords-apexords-ords-deployment").(*appsv1.Deployment)
+		Expect(deployment.Spec.Template.ObjectMeta.Annotations[OrdsPasswordHashAnnotation]).To(Equal(passwordHash(apexords, public)))
+		get(apexords, "apexords-first")
+		Expect(apexords.Status.PasswordsRotatedAt).NotTo(BeNil())
+
+		By("expiring the old public password once the Ords pods of the ApexOrds use the new one")
+		Expect(reconcileDb(oradb)).To(Succeed())
+		Expect(runner.Commands).To(HaveLen(5))
+		get(oradb, "devdb")
+		Expect(oradb.Status.PasswordsRollover).To(Equal("1"))
+		rollOut(deployment)
+		Expect(reconcileDb(oradb)).To(Succeed())
+		Expect(runner.Commands).To(HaveLen(6))
+		Expect(runner.Scripts()[5]).To(ContainSubstring("alter user ' || u.username || ' expire password rollover period"))
+		Expect(runner.Scripts()[5]).To(ContainSubstring("alter user ' || u.username || ' account unlock"))
+		oradb = get(&operatorv1.OracleDatabase{}, "devdb").(*operatorv1.OracleDatabase)
+		Expect(oradb.Status.PasswordsRollover).To(BeEmpty())
+
+		By("keeping the rotated public password when the statefulset is created again")
+		Expect(k8sClient.Delete(ctx, get(&appsv1.StatefulSet{}, "devcdb-apexords-db-sts"))).To(Succeed())
+		get(oradb, "devdb")
+		meta.RemoveStatusCondition(&oradb.Status.Conditions, operatorv1.ConditionDatabaseProvisioned)
+		Expect(k8sClient.Status().Update(ctx, oradb)).To(Succeed())
+		Expect(reconcileDb(oradb)).To(Succeed())
+		get(&appsv1.StatefulSet{}, "devcdb-apexords-db-sts")
+		dbsecret = get(&corev1.Secret{}, "devcdb-apexords-db-credentials").(*corev1.Secret)
+		Expect(dbsecret.Data).To(HaveKeyWithValue(CredentialsPublicPasswordKey, []byte(public)))
+		Expect(dbsecret.Data).To(HaveKeyWithValue(CredentialsSysPasswordKey, []byte(dbpassword)))
+	})
+})
+
+//failingStatusClient saves the first updates of the status and fails the later ones,as when the operator stops in the middle of a reconcile
+type failingStatusClient struct {
+	client.Client
+	updates *int32
+}
+
+func (c failingStatusClient) Status() client.StatusWriter {
+	return failingStatusWriter{StatusWriter: c.Client.Status(), updates: c.updates}
+}
+
+type failingStatusWriter struct {
+	client.StatusWriter
+	updates *int32
+}
+
+func (w failingStatusWriter) Update(ctx context.Context, obj client.Object, opts ...client.UpdateOption) error {
+	if atomic.AddInt32(w.updates, -1) < 0 {
+		return apierrors.NewServiceUnavailable("unavailable")
+	}
+	return w.StatusWriter.Update(ctx, obj, opts...)
+}
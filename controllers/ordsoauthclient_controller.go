@@ -0,0 +1,405 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	operatorv1 "apexords-operator/apexords-operator/api/v1"
+)
+
+// OrdsOAuthClientReconciler reconciles a OrdsOAuthClient object
+type OrdsOAuthClientReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Log      logr.Logger
+	Recorder record.EventRecorder
+	Runner   CommandRunner
+	//MaxConcurrentReconciles is the number of OrdsOAuthClients reconciled at once,default 1
+	MaxConcurrentReconciles int
+}
+
+//+kubebuilder:rbac:groups=operator.apexords-operator,resources=ordsoauthclients,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=operator.apexords-operator,resources=ordsoauthclients/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=operator.apexords-operator,resources=ordsoauthclients/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=pods,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=pods/exec,verbs=create;get
+
+const (
+	//finalizer to drop the OAuth client from Ords before the resource goes away
+	OrdsOAuthClientFinalizer = "operator.apexords-operator/oauthclient"
+	//marker printed in front of client_id:client_secret by the sqlplus script
+	ordsOAuthClientMarker = "APEXORDSOAUTH:"
+)
+
+//ordsOAuthSchemaRegexp is an unquoted Oracle identifier,the pattern of spec.schema in the CRD
+var ordsOAuthSchemaRegexp = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_$#]*$`)
+
+// Reconcile creates the Ords OAuth client in the DB and keeps its credentials in a Secret
+func (r *OrdsOAuthClientReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	_ = log.FromContext(ctx)
+
+	var oauthclient operatorv1.OrdsOAuthClient
+	if err := r.Get(ctx, req.NamespacedName, &oauthclient); err != nil {
+		log.Log.Error(err, "unable to fetch CRD OrdsOAuthClient")
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	if err := ValidateOrdsOAuthClient(&oauthclient); err != nil {
+		log.Log.Error(err, "invalid OrdsOAuthClient "+oauthclient.ObjectMeta.Name)
+		return r.handleStepError(ctx, &oauthclient, TerminalError(StepSpec, ReasonInvalidSpec, err))
+	}
+
+	// the DB and Ords come from the referenced ApexOrds
+	var apexords operatorv1.ApexOrds
+	apexordsErr := r.Get(ctx, client.ObjectKey{Namespace: req.Namespace, Name: oauthclient.Spec.ApexOrdsRef}, &apexords)
+
+	if !oauthclient.ObjectMeta.DeletionTimestamp.IsZero() {
+		if controllerutil.ContainsFinalizer(&oauthclient, OrdsOAuthClientFinalizer) {
+			// nothing left to clean in DB if the ApexOrds is gone already
+			if apexordsErr == nil {
+				oradb, err := ApexOrdsDatabase(ctx, r.Client, &apexords)
+				if err != nil {
+					log.Log.Error(err, "unable to get the DB of ApexOrds "+apexords.ObjectMeta.Name)
+					return ctrl.Result{}, err
+				}
+				unlock := r.lockDatabase(ctx, &oauthclient, &oradb.Spec)
+				if unlock == nil {
+					return ctrl.Result{RequeueAfter: DatabaseLockRetryInterval}, nil
+				}
+				defer unlock()
+				if err := DeleteOrdsOAuthClient(ctx, r, req, &apexords, &oauthclient); err != nil {
+					log.Log.Error(err, "unable to drop Ords OAuth client "+OrdsOAuthClientName(&oauthclient))
+					return ctrl.Result{}, err
+				}
+			}
+			controllerutil.RemoveFinalizer(&oauthclient, OrdsOAuthClientFinalizer)
+			if err := r.Update(ctx, &oauthclient); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if apexordsErr != nil {
+		log.Log.Error(apexordsErr, "unable to fetch ApexOrds "+oauthclient.Spec.ApexOrdsRef)
+		return ctrl.Result{}, apexordsErr
+	}
+
+	if !controllerutil.ContainsFinalizer(&oauthclient, OrdsOAuthClientFinalizer) {
+		controllerutil.AddFinalizer(&oauthclient, OrdsOAuthClientFinalizer)
+		if err := r.Update(ctx, &oauthclient); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	secretname := OrdsOAuthClientSecretName(&oauthclient)
+	var secret corev1.Secret
+	err := r.Get(ctx, client.ObjectKey{Namespace: req.Namespace, Name: secretname}, &secret)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return ctrl.Result{}, err
+	}
+	if err == nil && oauthclient.Status.ObservedRotationToken == oauthclient.Spec.RotationToken {
+		log.Log.Info("Ords OAuth client " + OrdsOAuthClientName(&oauthclient) + " is up to date. Do nothing")
+		//a fixed spec clears the Failed condition
+		if oauthclient.Status.Phase != operatorv1.PhaseReady {
+			r.setReady(&oauthclient)
+			if err := r.Status().Update(ctx, &oauthclient); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, nil
+	}
+
+	oradb, err := ApexOrdsDatabase(ctx, r.Client, &apexords)
+	if err != nil {
+		log.Log.Error(err, "unable to get the DB of ApexOrds "+apexords.ObjectMeta.Name)
+		return ctrl.Result{}, err
+	}
+	unlock := r.lockDatabase(ctx, &oauthclient, &oradb.Spec)
+	if unlock == nil {
+		return ctrl.Result{RequeueAfter: DatabaseLockRetryInterval}, nil
+	}
+	defer unlock()
+
+	// issue the client,a rotation gives it a new secret and the old one stops working
+	rotate := oauthclient.Status.ClientID != "" && oauthclient.Status.ObservedRotationToken != oauthclient.Spec.RotationToken
+	clientid, clientsecret, err := CreateOrdsOAuthClient(ctx, r, req, &apexords, &oauthclient, rotate)
+	if err != nil {
+		log.Log.Error(err, "unable to create Ords OAuth client "+OrdsOAuthClientName(&oauthclient))
+		return ctrl.Result{}, err
+	}
+
+	secret = corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      secretname,
+			Namespace: req.Namespace,
+		},
+	}
+	if _, err := controllerutil.CreateOrUpdate(ctx, r.Client, &secret, func() error {
+		secret.ObjectMeta.Labels = mergeLabels(Apexordsoperatorlabel, ComponentLabels(&oauthclient, ComponentCredentials))
+		secret.Type = corev1.SecretTypeOpaque
+		secret.Data = map[string][]byte{
+			"client_id":     []byte(clientid),
+			"client_secret": []byte(clientsecret),
+		}
+		return controllerutil.SetControllerReference(&oauthclient, &secret, r.Scheme)
+	}); err != nil {
+		log.Log.Error(err, "unable to write Ords OAuth client secret "+secretname)
+		return ctrl.Result{}, err
+	}
+
+	now := metav1.Now()
+	oauthclient.Status.ClientID = clientid
+	oauthclient.Status.SecretName = secretname
+	oauthclient.Status.ObservedRotationToken = oauthclient.Spec.RotationToken
+	oauthclient.Status.LastRotationTime = &now
+	r.setReady(&oauthclient)
+	if err := r.Status().Update(ctx, &oauthclient); err != nil {
+		return ctrl.Result{}, err
+	}
+	log.Log.Info("Ords OAuth client " + OrdsOAuthClientName(&oauthclient) + " credentials written to secret " + secretname)
+	return ctrl.Result{}, nil
+}
+
+//OrdsOAuthClientName returns the client name registered in Ords
+func OrdsOAuthClientName(oauthclient *operatorv1.OrdsOAuthClient) string {
+	if oauthclient.Spec.ClientName != "" {
+		return oauthclient.Spec.ClientName
+	}
+	return oauthclient.ObjectMeta.Name
+}
+
+//OrdsOAuthClientSecretName returns the name of the secret holding the client credentials
+func OrdsOAuthClientSecretName(oauthclient *operatorv1.OrdsOAuthClient) string {
+	if oauthclient.Spec.SecretName != "" {
+		return oauthclient.Spec.SecretName
+	}
+	return oauthclient.ObjectMeta.Name + "-ords-oauth"
+}
+
+//ValidateOrdsOAuthClient checks the values of the spec which go into the sqlplus script,like the CRD does.
+//The script is fed to sqlplus by a shell here-document,so no value may span lines.
+func ValidateOrdsOAuthClient(oauthclient *operatorv1.OrdsOAuthClient) error {
+	if oauthclient.Spec.ApexOrdsRef == "" {
+		return fmt.Errorf("apexordsref can't be empty")
+	}
+	if !ordsOAuthSchemaRegexp.MatchString(oauthclient.Spec.Schema) {
+		return fmt.Errorf("schema %q is not an unquoted Oracle identifier", oauthclient.Spec.Schema)
+	}
+	values := map[string]string{
+		"clientname":   OrdsOAuthClientName(oauthclient),
+		"description":  oauthclient.Spec.Description,
+		"supportemail": oauthclient.Spec.SupportEmail,
+	}
+	for i, role := range oauthclient.Spec.Roles {
+		values[fmt.Sprintf("roles[%d]", i)] = string(role)
+	}
+	for i, privilege := range oauthclient.Spec.Privileges {
+		values[fmt.Sprintf("privileges[%d]", i)] = string(privilege)
+	}
+	for field, value := range values {
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("%s can't contain line breaks", field)
+		}
+	}
+	return nil
+}
+
+//ordsOAuthClientQuery selects from the clients of the schema of the OrdsOAuthClient those with its name
+func ordsOAuthClientQuery(oauthclient *operatorv1.OrdsOAuthClient, columns string) string {
+	return "select " + columns + " from ords_metadata.ords_clients c, ords_metadata.ords_schemas s\n" +
+		" where c.schema_id = s.id and s.parsing_schema = " + sqlQuote(strings.ToUpper(oauthclient.Spec.Schema)) +
+		" and c.name = " + sqlQuote(OrdsOAuthClientName(oauthclient))
+}
+
+//CreateOrdsOAuthClient creates a client_credentials client of the schema with its roles and privileges and returns
+//client_id,client_secret. An existing client is kept,rotate issues a new secret for it so its client_id stays.
+func CreateOrdsOAuthClient(ctx context.Context, r *OrdsOAuthClientReconciler, req ctrl.Request, apexords *operatorv1.ApexOrds, oauthclient *operatorv1.OrdsOAuthClient, rotate bool) (string, string, error) {
+	schema := sqlQuote(strings.ToUpper(oauthclient.Spec.Schema))
+	name := sqlQuote(OrdsOAuthClientName(oauthclient))
+	var privileges []string
+	for _, privilege := range oauthclient.Spec.Privileges {
+		privileges = append(privileges, string(privilege))
+	}
+	plsql := "declare\n" +
+		"  l_clients number;\n" +
+		"begin\n" +
+		"  " + ordsOAuthClientQuery(oauthclient, "count(*) into l_clients") + ";\n" +
+		"  if l_clients = 0 then\n" +
+		"    oauth_admin.create_client(\n" +
+		"      p_schema          => " + schema + ",\n" +
+		"      p_name            => " + name + ",\n" +
+		"      p_grant_type      => 'client_credentials',\n" +
+		"      p_owner           => " + sqlQuote(oauthclient.Spec.Schema) + ",\n" +
+		"      p_description     => " + sqlQuote(oauthclient.Spec.Description) + ",\n" +
+		"      p_support_email   => " + sqlQuote(oauthclient.Spec.SupportEmail) + ",\n" +
+		"      p_privilege_names => " + sqlQuote(strings.Join(privileges, ",")) + ");\n"
+	for _, role := range oauthclient.Spec.Roles {
+		plsql += "    oauth_admin.grant_client_role(p_schema => " + schema + ", p_client_name => " + name + ", p_role_name => " + sqlQuote(string(role)) + ");\n"
+	}
+	if rotate {
+		//the tokens issued with the old secret stop working too
+		plsql += "  else\n" +
+			"    oauth_admin.rotate_client_secret(\n" +
+			"      p_schema                 => " + schema + ",\n" +
+			"      p_client_key             => ords_types.oauth_client_key(p_name => " + name + "),\n" +
+			"      p_revoke_existing_tokens => true,\n" +
+			"      p_revoke_sessions        => true);\n"
+	}
+	plsql += "  end if;\n" +
+		"  commit;\n" +
+		"end;\n" +
+		"/\n" +
+		ordsOAuthClientQuery(oauthclient, "'"+ordsOAuthClientMarker+"' || c.client_id || ':' || c.client_secret") + ";\n"
+
+	output, err := RunOrdsOAuthSQL(ctx, r, req, apexords, oauthclient, plsql)
+	if err != nil {
+		return "", "", err
+	}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, ordsOAuthClientMarker) {
+			creds := strings.SplitN(strings.TrimPrefix(line, ordsOAuthClientMarker), ":", 2)
+			if len(creds) == 2 && creds[0] != "" && creds[1] != "" {
+				return creds[0], creds[1], nil
+			}
+		}
+	}
+	return "", "", fmt.Errorf("no client credentials returned for Ords OAuth client %s", OrdsOAuthClientName(oauthclient))
+}
+
+//DeleteOrdsOAuthClient drops the OAuth client of the schema from Ords
+func DeleteOrdsOAuthClient(ctx context.Context, r *OrdsOAuthClientReconciler, req ctrl.Request, apexords *operatorv1.ApexOrds, oauthclient *operatorv1.OrdsOAuthClient) error {
+	plsql := "begin\n" +
+		"  for c in (" + ordsOAuthClientQuery(oauthclient, "c.name") + ") loop\n" +
+		"    oauth_admin.delete_client(p_schema => " + sqlQuote(strings.ToUpper(oauthclient.Spec.Schema)) + ", p_name => c.name);\n" +
+		"  end loop;\n" +
+		"  commit;\n" +
+		"end;\n" +
+		"/\n"
+	_, err := RunOrdsOAuthSQL(ctx, r, req, apexords, oauthclient, plsql)
+	return err
+}
+
+//RunOrdsOAuthSQL runs the sql as sys in a temporary sqlplus pod and returns the output
+func RunOrdsOAuthSQL(ctx context.Context, r *OrdsOAuthClientReconciler, req ctrl.Request, apexords *operatorv1.ApexOrds, oauthclient *operatorv1.OrdsOAuthClient, sql string) (string, error) {
+	Podname := oauthclient.ObjectMeta.Name + "-oauth-sqlpluspod"
+
+	oradb, err := ApexOrdsDatabase(ctx, r.Client, apexords)
+	if err != nil {
+		log.Log.Error(err, "unable to get the DB of ApexOrds "+apexords.ObjectMeta.Name)
+		return "", err
+	}
+	if err := CreateSqlplusPod(r.Client, req, Podname, CredentialsSecretName(apexords), &oradb.Spec); err != nil {
+		log.Log.Error(err, "unable to create "+Podname)
+		return "", err
+	}
+	defer func() {
+		if err := DeleteSqlplusPod(r.Client, req, Podname); err != nil {
+			log.Log.Error(err, "unable to delete "+Podname)
+		}
+	}()
+
+	//the session user is sys,OAUTH_ADMIN takes the schema owning the client as parameter
+	connect := DbConnectString(&oradb.Spec)
+	script := "set heading off feedback off pagesize 0 linesize 400 serveroutput on define off\n" + sql
+	log.Log.Info("Run Ords OAuth sql for client " + OrdsOAuthClientName(oauthclient) + " in " + Podname)
+	return RunSqlplus(ctx, r.Runner, req, Podname, StepOrds, connect, "Ords OAuth sql", script)
+}
+
+//handleStepError reports a failed step in events,metrics and the Failed condition.
+//Retryable errors are returned so the request is requeued with backoff,terminal errors are not.
+func (r *OrdsOAuthClientReconciler) handleStepError(ctx context.Context, oauthclient *operatorv1.OrdsOAuthClient, stepErr *StepError) (ctrl.Result, error) {
+	log.Log.Error(stepErr, "reconcile step failed", "step", stepErr.Step, "reason", stepErr.Reason, "retryable", stepErr.Retryable)
+	StepFailures.WithLabelValues(stepErr.Step, stepErr.Reason).Inc()
+	r.Recorder.Eventf(oauthclient, corev1.EventTypeWarning, stepErr.Reason, "%v", stepErr.Err)
+
+	meta.SetStatusCondition(&oauthclient.Status.Conditions, metav1.Condition{
+		Type:               operatorv1.ConditionFailed,
+		Status:             metav1.ConditionTrue,
+		Reason:             stepErr.Reason,
+		Message:            stepErr.Error(),
+		ObservedGeneration: oauthclient.ObjectMeta.Generation,
+	})
+	if !stepErr.Retryable {
+		oauthclient.Status.Phase = operatorv1.PhaseFailed
+	}
+	if err := r.Status().Update(ctx, oauthclient); err != nil {
+		log.Log.Error(err, "unable to update OrdsOAuthClient status")
+	}
+
+	if stepErr.Retryable {
+		return ctrl.Result{}, stepErr
+	}
+	return ctrl.Result{}, nil
+}
+
+//setReady marks the OrdsOAuthClient Ready and clears the Failed condition,the caller saves the status
+func (r *OrdsOAuthClientReconciler) setReady(oauthclient *operatorv1.OrdsOAuthClient) {
+	meta.SetStatusCondition(&oauthclient.Status.Conditions, metav1.Condition{
+		Type:               operatorv1.ConditionFailed,
+		Status:             metav1.ConditionFalse,
+		Reason:             ReasonReconciled,
+		Message:            "All steps finished",
+		ObservedGeneration: oauthclient.ObjectMeta.Generation,
+	})
+	oauthclient.Status.Phase = operatorv1.PhaseReady
+}
+
+//lockDatabase takes the lock of the DB of the ApexOrds,while another resource runs scripts in it it marks the
+//OrdsOAuthClient waiting and returns nil
+func (r *OrdsOAuthClientReconciler) lockDatabase(ctx context.Context, oauthclient *operatorv1.OrdsOAuthClient, db *operatorv1.OracleDatabaseSpec) func() {
+	unlock, changed := lockDatabase(r.Recorder, oauthclient, "OrdsOAuthClient", &oauthclient.Status.Conditions, db)
+	if changed {
+		if err := r.Status().Update(ctx, oauthclient); err != nil {
+			log.Log.Error(err, "unable to update OrdsOAuthClient status")
+		}
+	}
+	return unlock
+}
+
+//sqlQuote returns s as a sql string literal
+func sqlQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *OrdsOAuthClientReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&operatorv1.OrdsOAuthClient{}).
+		Owns(&corev1.Secret{}).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
+		Complete(r)
+}
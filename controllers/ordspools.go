@@ -0,0 +1,242 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	operatorv1 "apexords-operator/apexords-operator/api/v1"
+)
+
+const (
+	//key of the pool password in the credentials secret of a pool
+	OrdsPoolPasswordKey = "password"
+	//name of the default pool,the apex*.xml files
+	ordsDefaultPool = "apex"
+	//context path of Ords in standalone.properties
+	ordsContextPath = "/apex/"
+)
+
+//OrdsPools returns the extra pools of the ApexOrds
+func OrdsPools(apexords *operatorv1.ApexOrds) []operatorv1.OrdsPool {
+	if apexords.Spec.Ords == nil {
+		return nil
+	}
+	return apexords.Spec.Ords.Pools
+}
+
+//OrdsSecretName returns the name of the secret with the Ords config files carrying passwords:
+//the ones of the default pool and the ones of the extra pools
+func OrdsSecretName(apexords *operatorv1.ApexOrds) string {
+	return apexords.Spec.Ordsname + "-apexords-ords-secret"
+}
+
+//ordsSecretFiles are the files of the Ords configmap yaml carrying passwords,they go to the Ords secret
+var ordsSecretFiles = []string{"ords_params.properties", ordsDefaultPool + ".xml", ordsDefaultPool + "_al.xml", ordsDefaultPool + "_pu.xml", ordsDefaultPool + "_rt.xml"}
+
+//ValidateOrdsPools checks the pools have unique names and a url mapping
+func ValidateOrdsPools(pools []operatorv1.OrdsPool) error {
+	names := map[string]bool{ordsDefaultPool: true}
+	for i, pool := range pools {
+		if pool.Name == "" || pool.Dbservice == "" {
+			return fmt.Errorf("ords.pools[%d]: name and dbservice can't be empty", i)
+		}
+		if names[pool.Name] {
+			return fmt.Errorf("ords.pools[%d]: pool name %s is used already", i, pool.Name)
+		}
+		names[pool.Name] = true
+		if pool.PathPrefix == "" && pool.Host == "" {
+			return fmt.Errorf("ords.pools[%d]: pathprefix or host is required to route requests to pool %s", i, pool.Name)
+		}
+	}
+	return nil
+}
+
+//OrdsConfigVolumeSource returns the source of the /mnt/k8s volume of Ords: the Ords configmap and the Ords secret
+func OrdsConfigVolumeSource(apexords *operatorv1.ApexOrds) corev1.VolumeSource {
+	return corev1.VolumeSource{Projected: &corev1.ProjectedVolumeSource{
+		Sources: []corev1.VolumeProjection{
+			{ConfigMap: &corev1.ConfigMapProjection{LocalObjectReference: corev1.LocalObjectReference{Name: apexords.Spec.Ordsname + "-apexords-ords-cm"}}},
+			{Secret: &corev1.SecretProjection{LocalObjectReference: corev1.LocalObjectReference{Name: OrdsSecretName(apexords)}}},
+		},
+	}}
+}
+
+//splitOrdsSecretFiles moves the files carrying passwords out of the Ords configmap and returns them
+func splitOrdsSecretFiles(ordsconfigmap *corev1.ConfigMap) map[string][]byte {
+	files := map[string][]byte{}
+	for _, name := range ordsSecretFiles {
+		if file, ok := ordsconfigmap.Data[name]; ok {
+			files[name] = []byte(file)
+			delete(ordsconfigmap.Data, name)
+		}
+	}
+	return files
+}
+
+//OrdsPoolPassword returns the password of the Apex and Ords users of the pool
+func OrdsPoolPassword(ctx context.Context, c client.Client, Namespace string, pool operatorv1.OrdsPool, Dbpassword string) (string, error) {
+	if pool.CredentialsSecret == "" {
+		return Dbpassword, nil
+	}
+	var secret corev1.Secret
+	if err := c.Get(ctx, client.ObjectKey{Namespace: Namespace, Name: pool.CredentialsSecret}, &secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", RetryableError(StepOrds, ReasonSecretNotFound, fmt.Errorf("credentials secret %s of pool %s not found", pool.CredentialsSecret, pool.Name))
+		}
+		return "", RetryableError(StepOrds, ReasonSecretNotFound, err)
+	}
+	password, ok := secret.Data[OrdsPoolPasswordKey]
+	if !ok || len(password) == 0 {
+		return "", TerminalError(StepOrds, ReasonSecretNotFound, fmt.Errorf("credentials secret %s of pool %s has no %s", pool.CredentialsSecret, pool.Name, OrdsPoolPasswordKey))
+	}
+	return string(password), nil
+}
+
+//OrdsPoolFiles returns the config files of the pool and the parameters to install Ords in its PDB.
+//They are made from the apex*.xml and ords_params.properties of the default pool in the Ords configmap yaml,
+//with the connection of the pool added as the default pool keeps it in defaults.xml
+func OrdsPoolFiles(pool operatorv1.OrdsPool, db *operatorv1.OracleDatabaseSpec, password string, Dbpassword string) (map[string]string, error) {
+	pooldb := *db
+	pooldb.Dbservice = pool.Dbservice
+	if pooldb.TLS != nil {
+		//a tnsnames.ora alias names one service,pools connect with a TCPS descriptor
+		if pooldb.TLS.Host == "" {
+			return nil, TerminalError(StepOrds, ReasonInvalidSpec, fmt.Errorf("ords.pools need database.tls.host,tnsalias %s names one service only", pooldb.TLS.TNSAlias))
+		}
+		pooltls := *pooldb.TLS
+		pooltls.TNSAlias = ""
+		pooldb.TLS = &pooltls
+	}
+
+	poolconfigmap, err := OrdsTemplateConfigMap(&pooldb, password, Dbpassword)
+	if err != nil {
+		return nil, err
+	}
+
+	var connection string
+	if DbTLS(&pooldb) == nil {
+		connection = xmlEntry("db.hostname", pooldb.Dbname+"-apexords-db-svc") +
+			xmlEntry("db.port", pooldb.Dbport) +
+			xmlEntry("db.servicename", pooldb.Dbservice)
+	} else {
+		connection = xmlEntry("db.connectionType", "customurl") +
+			xmlEntry("db.customURL", DbJDBCURL(&pooldb))
+	}
+
+	files := map[string]string{
+		pool.Name + "_params.properties": poolconfigmap.Data["ords_params.properties"],
+	}
+	for _, suffix := range []string{"", "_al", "_pu", "_rt"} {
+		poolxml, ok := poolconfigmap.Data[ordsDefaultPool+suffix+".xml"]
+		if !ok {
+			return nil, TerminalError(StepOrds, ReasonTemplateInvalid, fmt.Errorf("Ords configmap yaml has no %s", ordsDefaultPool+suffix+".xml"))
+		}
+		files[pool.Name+suffix+".xml"] = strings.Replace(poolxml, "</properties>", connection+"</properties>", 1)
+	}
+	return files, nil
+}
+
+//OrdsURLMapping returns the url-mapping.xml routing requests to the pools by path prefix or host
+func OrdsURLMapping(pools []operatorv1.OrdsPool) string {
+	var mapping strings.Builder
+	mapping.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\" standalone=\"yes\"?>\n")
+	mapping.WriteString("<pool-config xmlns=\"http://xmlns.oracle.com/apex/pool-config\">\n")
+	for _, pool := range pools {
+		if pool.PathPrefix != "" {
+			mapping.WriteString(" <pool name=\"" + xmlEscape(pool.Name) + "\" base-path=\"" + xmlEscape(pool.PathPrefix) + "\"/>\n")
+		}
+		if pool.Host != "" {
+			//the http sidecar and load balancers may terminate TLS,match both schemes
+			for _, scheme := range []string{"http://", "https://"} {
+				mapping.WriteString(" <pool name=\"" + xmlEscape(pool.Name) + "\" base-url=\"" + xmlEscape(scheme+pool.Host+ordsContextPath) + "\"/>\n")
+			}
+		}
+	}
+	mapping.WriteString("</pool-config>\n")
+	return mapping.String()
+}
+
+//CreateOrdsSecret writes files,the ones of the default pool OrdsConfigMap returns,and the config files of the
+//extra pools to the Ords secret. It returns whether the secret changed.
+func CreateOrdsSecret(r *ApexOrdsReconciler, req ctrl.Request, apexords *operatorv1.ApexOrds, db *operatorv1.OracleDatabaseSpec, files map[string][]byte, Dbpassword string) (bool, error) {
+	ctx := context.Background()
+	data := map[string][]byte{}
+	for name, file := range files {
+		data[name] = file
+	}
+	for _, pool := range OrdsPools(apexords) {
+		password, err := OrdsPoolPassword(ctx, r.Client, req.NamespacedName.Namespace, pool, Dbpassword)
+		if err != nil {
+			return false, err
+		}
+		poolfiles, err := OrdsPoolFiles(pool, db, password, Dbpassword)
+		if err != nil {
+			return false, err
+		}
+		for name, file := range poolfiles {
+			data[name] = []byte(file)
+		}
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      OrdsSecretName(apexords),
+			Namespace: req.NamespacedName.Namespace,
+		},
+	}
+	result, err := controllerutil.CreateOrUpdate(ctx, r.Client, secret, func() error {
+		secret.ObjectMeta.Labels = mergeLabels(Apexordsoperatorlabel, ComponentLabels(apexords, ComponentOrds))
+		secret.Type = corev1.SecretTypeOpaque
+		secret.Data = data
+		return controllerutil.SetControllerReference(apexords, secret, r.Scheme)
+	})
+	if err != nil {
+		return false, RetryableError(StepOrds, ReasonCreateFailed, fmt.Errorf("unable to write secret %s: %v", secret.ObjectMeta.Name, err))
+	}
+	return result != controllerutil.OperationResultNone, nil
+}
+
+//OrdsPoolInstallCommand installs or upgrades the Ords schemas in the PDB of the pool and registers the pool
+func OrdsPoolInstallCommand(pool operatorv1.OrdsPool) []string {
+	params := "/tmp/" + pool.Name + "_params.properties"
+	ordstext := "cp /mnt/k8s/" + pool.Name + "_params.properties " + params + ";" +
+		"java -jar /opt/oracle/ords/ords.war setup --database " + pool.Name + " --parameterFile " + params + " --silent"
+	return []string{"/bin/sh", "-c", ordstext}
+}
+
+//xmlEntry returns a properties entry of an Ords xml config file
+func xmlEntry(key string, value string) string {
+	return "<entry key=\"" + xmlEscape(key) + "\">" + xmlEscape(value) + "</entry>\n"
+}
+
+func xmlEscape(s string) string {
+	var escaped bytes.Buffer
+	_ = xml.EscapeText(&escaped, []byte(s))
+	return escaped.String()
+}
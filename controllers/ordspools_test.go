@@ -0,0 +1,68 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	operatorv1 "apexords-operator/apexords-operator/api/v1"
+)
+
+var _ = Describe("Ords pools", func() {
+	sales := operatorv1.OrdsPool{Name: "sales", Dbservice: "salespdb", PathPrefix: "/sales"}
+
+	It("requires unique names and a url mapping", func() {
+		Expect(ValidateOrdsPools([]operatorv1.OrdsPool{sales})).To(Succeed())
+		Expect(ValidateOrdsPools([]operatorv1.OrdsPool{sales, sales})).NotTo(Succeed())
+		Expect(ValidateOrdsPools([]operatorv1.OrdsPool{{Name: "apex", Dbservice: "apexpdb", PathPrefix: "/apex2"}})).NotTo(Succeed())
+		Expect(ValidateOrdsPools([]operatorv1.OrdsPool{{Name: "hr", Dbservice: "hrpdb"}})).NotTo(Succeed())
+	})
+
+	It("writes the url mapping of path prefixes and hosts", func() {
+		mapping := OrdsURLMapping([]operatorv1.OrdsPool{sales, {Name: "hr", Dbservice: "hrpdb", Host: "hr.example.com"}})
+		Expect(mapping).To(Equal(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<pool-config xmlns="http://xmlns.oracle.com/apex/pool-config">
+ <pool name="sales" base-path="/sales"/>
+ <pool name="hr" base-url="http://hr.example.com/apex/"/>
+ <pool name="hr" base-url="https://hr.example.com/apex/"/>
+</pool-config>
+`))
+	})
+
+	It("connects the pool files to the PDB of the pool", func() {
+		db := &operatorv1.OracleDatabaseSpec{Dbname: "testcdb", Dbservice: "testpdb", Dbport: "1521"}
+		files, err := OrdsPoolFiles(sales, db, "pool#pw", "syspw")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files).To(HaveLen(5))
+		Expect(files["sales.xml"]).To(ContainSubstring(`<entry key="db.username">APEX_PUBLIC_USER</entry>`))
+		Expect(files["sales.xml"]).To(ContainSubstring(`<entry key="db.password">pool#pw</entry>`))
+		Expect(files["sales.xml"]).To(ContainSubstring("<entry key=\"db.hostname\">testcdb-apexords-db-svc</entry>\n<entry key=\"db.port\">1521</entry>\n<entry key=\"db.servicename\">salespdb</entry>\n</properties>"))
+		Expect(files["sales_params.properties"]).To(ContainSubstring("user.public.password=pool#pw\n"))
+
+		db.TLS = &operatorv1.DatabaseTLS{WalletSecret: "testcdb-wallet", TNSAlias: "testcdb_tcps"}
+		_, err = OrdsPoolFiles(sales, db, "poolpw", "syspw")
+		Expect(err).To(MatchError(ContainSubstring("database.tls.host")))
+
+		db.TLS.Host = "db.example.com"
+		files, err = OrdsPoolFiles(sales, db, "poolpw", "syspw")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(files["sales_pu.xml"]).To(ContainSubstring("(HOST=db.example.com)(PORT=2484))(CONNECT_DATA=(SERVICE_NAME=salespdb))"))
+		Expect(files["sales_pu.xml"]).NotTo(ContainSubstring("db.hostname"))
+		Expect(files["sales_params.properties"]).To(ContainSubstring("db.connectionType=customurl\n"))
+	})
+})
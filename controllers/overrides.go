@@ -0,0 +1,112 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/yaml"
+
+	operatorv1 "apexords-operator/apexords-operator/api/v1"
+)
+
+//ApplyOverrides patches obj with the spec.overrides matching its kind and name, in the order of the spec.
+//The name and namespace of obj can't be changed as the operator looks up the objects by them.
+func ApplyOverrides(overrides []operatorv1.ObjectOverride, obj client.Object) error {
+	if len(overrides) == 0 {
+		return nil
+	}
+	gvk, err := apiutil.GVKForObject(obj, scheme.Scheme)
+	if err != nil {
+		return err
+	}
+	name, namespace := obj.GetName(), obj.GetNamespace()
+	for i, override := range overrides {
+		if override.Kind != gvk.Kind || (override.Name != "" && override.Name != name) {
+			continue
+		}
+		if err := applyOverride(override, obj); err != nil {
+			return fmt.Errorf("overrides[%d] for %s %s: %v", i, gvk.Kind, name, err)
+		}
+		if obj.GetName() != name || obj.GetNamespace() != namespace {
+			return fmt.Errorf("overrides[%d] for %s %s must not change name or namespace", i, gvk.Kind, name)
+		}
+		obj.GetObjectKind().SetGroupVersionKind(gvk)
+	}
+	return nil
+}
+
+//applyOverride patches the json of obj and decodes the result back into obj
+func applyOverride(override operatorv1.ObjectOverride, obj client.Object) error {
+	original, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	patch, err := yaml.YAMLToJSON([]byte(override.Patch))
+	if err != nil {
+		return fmt.Errorf("invalid patch: %v", err)
+	}
+
+	var patched []byte
+	switch override.Type {
+	case "", operatorv1.PatchTypeStrategicMerge:
+		patched, err = strategicpatch.StrategicMergePatch(original, patch, obj)
+	case operatorv1.PatchTypeJSON:
+		var jsonPatch jsonpatch.Patch
+		if jsonPatch, err = jsonpatch.DecodePatch(patch); err == nil {
+			patched, err = jsonPatch.Apply(original)
+		}
+	default:
+		err = fmt.Errorf("unknown patch type %q", override.Type)
+	}
+	if err != nil {
+		return err
+	}
+
+	//start from an empty object so fields removed by the patch are gone
+	value := reflect.ValueOf(obj).Elem()
+	value.Set(reflect.Zero(value.Type()))
+	return json.Unmarshal(patched, obj)
+}
+
+//OverridesHash returns a hash of overrides,the status records the one of the overrides the objects were created with
+func OverridesHash(overrides []operatorv1.ObjectOverride) string {
+	if len(overrides) == 0 {
+		overrides = nil
+	}
+	data, _ := json.Marshal(overrides)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+//checkOverrides returns a terminal error when overrides changed since the objects were created with them,recorded
+//is their hash. The overrides are applied when an object is created only,so a change would never reach the objects.
+func checkOverrides(recorded string, overrides []operatorv1.ObjectOverride) *StepError {
+	if recorded == "" || recorded == OverridesHash(overrides) {
+		return nil
+	}
+	return TerminalError(StepSpec, ReasonOverridesChanged, fmt.Errorf("spec.overrides can't change once the objects are created with them,they are applied on create only. Set them back and patch the objects instead"))
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+
+	operatorv1 "apexords-operator/apexords-operator/api/v1"
+	config "apexords-operator/apexords-operator/controllers/config"
+)
+
+var _ = Describe("ApplyOverrides", func() {
+	var sts *appsv1.StatefulSet
+
+	withOverrides := func(overrides ...operatorv1.ObjectOverride) []operatorv1.ObjectOverride {
+		return overrides
+	}
+
+	BeforeEach(func() {
+		obj, _, err := scheme.Codecs.UniversalDeserializer().Decode([]byte(config.OradbStsyml), nil, nil)
+		Expect(err).NotTo(HaveOccurred())
+		sts = obj.(*appsv1.StatefulSet)
+		sts.ObjectMeta.Name = "testcdb-apexords-db-sts"
+	})
+
+	It("adds a sidecar with a strategic merge patch", func() {
+		Expect(ApplyOverrides(withOverrides(operatorv1.ObjectOverride{
+			Kind: "StatefulSet",
+			Patch: `
+spec:
+  template:
+    spec:
+      containers:
+      - name: exporter
+        image: exporter:latest
+`,
+		}), sts)).To(Succeed())
+
+		Expect(sts.Spec.Template.Spec.Containers).To(HaveLen(2))
+		names := []string{sts.Spec.Template.Spec.Containers[0].Name, sts.Spec.Template.Spec.Containers[1].Name}
+		Expect(names).To(ConsistOf("oradbauto", "exporter"))
+		Expect(sts.Kind).To(Equal("StatefulSet"))
+	})
+
+	It("applies json patches only to the named object", func() {
+		patch := `[{"op": "add", "path": "/metadata/annotations", "value": {"team": "apex"}}]`
+		Expect(ApplyOverrides(withOverrides(
+			operatorv1.ObjectOverride{Kind: "StatefulSet", Name: "othercdb-apexords-db-sts", Type: operatorv1.PatchTypeJSON, Patch: patch},
+		), sts)).To(Succeed())
+		Expect(sts.ObjectMeta.Annotations).To(BeEmpty())
+
+		Expect(ApplyOverrides(withOverrides(
+			operatorv1.ObjectOverride{Kind: "StatefulSet", Name: "testcdb-apexords-db-sts", Type: operatorv1.PatchTypeJSON, Patch: patch},
+		), sts)).To(Succeed())
+		Expect(sts.ObjectMeta.Annotations).To(HaveKeyWithValue("team", "apex"))
+	})
+
+	It("ignores overrides of other kinds", func() {
+		svc := &corev1.Service{}
+		svc.ObjectMeta.Name = "testcdb-apexords-db-svc"
+		Expect(ApplyOverrides(withOverrides(operatorv1.ObjectOverride{Kind: "StatefulSet", Patch: "metadata: {labels: {a: b}}"}), svc)).To(Succeed())
+		Expect(svc.ObjectMeta.Labels).To(BeEmpty())
+	})
+
+	It("rejects renames and broken patches", func() {
+		Expect(ApplyOverrides(withOverrides(operatorv1.ObjectOverride{Kind: "StatefulSet", Patch: "metadata: {name: renamed}"}), sts)).NotTo(Succeed())
+		Expect(ApplyOverrides(withOverrides(operatorv1.ObjectOverride{Kind: "StatefulSet", Type: operatorv1.PatchTypeJSON, Patch: "[{op: remove, path: /nothere}]"}), sts)).NotTo(Succeed())
+	})
+})
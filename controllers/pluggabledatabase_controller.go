@@ -0,0 +1,411 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	operatorv1 "apexords-operator/apexords-operator/api/v1"
+)
+
+// PluggableDatabaseReconciler reconciles a PluggableDatabase object
+type PluggableDatabaseReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+	Runner   CommandRunner
+	//MaxConcurrentReconciles is the number of PluggableDatabases reconciled at once,default 1
+	MaxConcurrentReconciles int
+}
+
+//+kubebuilder:rbac:groups=operator.apexords-operator,resources=pluggabledatabases,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=operator.apexords-operator,resources=pluggabledatabases/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=operator.apexords-operator,resources=pluggabledatabases/finalizers,verbs=update
+
+const (
+	//finalizer to drop the PDB from the CDB before the resource goes away
+	PluggableDatabaseFinalizer = "operator.apexords-operator/pdb"
+	//marker printed in front of the open mode by the sqlplus script
+	pdbOpenModeMarker = "APEXORDSPDB:"
+	//datafiles of the PDBs go to the data volume of the DB statefulset
+	pdbFileDest = "/opt/oracle/oradata"
+)
+
+// Reconcile creates the PDB in the CDB of the referenced OracleDatabase and brings it to the state of the spec
+func (r *PluggableDatabaseReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	_ = log.FromContext(ctx)
+
+	var pdb operatorv1.PluggableDatabase
+	if err := r.Get(ctx, req.NamespacedName, &pdb); err != nil {
+		log.Log.Error(err, "unable to fetch CRD PluggableDatabase")
+		return ctrl.Result{}, client.IgnoreNotFound(err)
+	}
+
+	// the CDB comes from the referenced OracleDatabase
+	var oradb operatorv1.OracleDatabase
+	oradbErr := r.Get(ctx, client.ObjectKey{Namespace: req.Namespace, Name: pdb.Spec.DatabaseRef}, &oradb)
+
+	if !pdb.ObjectMeta.DeletionTimestamp.IsZero() {
+		if controllerutil.ContainsFinalizer(&pdb, PluggableDatabaseFinalizer) {
+			// nothing left to drop if the OracleDatabase is gone already,any other error is retried
+			if oradbErr != nil && !apierrors.IsNotFound(oradbErr) {
+				return r.handleStepError(ctx, &pdb, RetryableError(StepDatabase, ReasonDatabaseNotReady, fmt.Errorf("unable to get OracleDatabase %s: %v", pdb.Spec.DatabaseRef, oradbErr)))
+			}
+			// only the PDB this resource created is dropped,status.pdbname is empty if it was rejected before
+			if oradbErr == nil && !pdb.Spec.KeepOnDelete && pdb.Status.Pdbname != "" {
+				unlock := r.lockDatabase(ctx, &pdb, &oradb)
+				if unlock == nil {
+					return ctrl.Result{RequeueAfter: DatabaseLockRetryInterval}, nil
+				}
+				defer unlock()
+				created := pdb.DeepCopy()
+				created.Spec.Pdbname = pdb.Status.Pdbname
+				if _, err := RunPdbSQL(ctx, r, req, &oradb, created, PdbDropScript(created)); err != nil {
+					log.Log.Error(err, "unable to drop PDB "+created.Spec.Pdbname)
+					return r.handleStepError(ctx, &pdb, ExecError(StepPdb, ReasonPdbSQLFailed, fmt.Errorf("dropping PDB %s failed: %w", created.Spec.Pdbname, err)))
+				}
+				r.Recorder.Event(&pdb, corev1.EventTypeNormal, ReasonReconciled, "PDB "+created.Spec.Pdbname+" is dropped")
+			}
+			controllerutil.RemoveFinalizer(&pdb, PluggableDatabaseFinalizer)
+			if err := r.Update(ctx, &pdb); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, nil
+	}
+
+	if err := ValidatePluggableDatabase(&pdb); err != nil {
+		return r.handleStepError(ctx, &pdb, TerminalError(StepSpec, ReasonInvalidSpec, err))
+	}
+	if pdb.Status.Pdbname != "" {
+		if err := PluggableDatabaseNames(&pdb); err != nil {
+			return r.handleStepError(ctx, &pdb, err)
+		}
+	}
+
+	r.setPhase(ctx, &pdb, operatorv1.PhaseProvisioning)
+	if oradbErr != nil {
+		return r.handleStepError(ctx, &pdb, RetryableError(StepDatabase, ReasonDatabaseNotReady, fmt.Errorf("unable to get OracleDatabase %s: %v", pdb.Spec.DatabaseRef, oradbErr)))
+	}
+	if strings.EqualFold(pdb.Spec.Pdbname, oradb.Spec.Dbservice) {
+		return r.handleStepError(ctx, &pdb, TerminalError(StepSpec, ReasonInvalidSpec, fmt.Errorf("PDB %s is the dbservice of OracleDatabase %s", pdb.Spec.Pdbname, oradb.ObjectMeta.Name)))
+	}
+	//a PDB managed by another resource would be dropped with this one,the check is skipped once the PDB is ours
+	if pdb.Status.Pdbname == "" {
+		owner, err := r.pdbOwner(ctx, &pdb)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if owner != "" {
+			return r.handleStepError(ctx, &pdb, TerminalError(StepSpec, ReasonInvalidSpec, fmt.Errorf("PDB %s on OracleDatabase %s is used by %s", pdb.Spec.Pdbname, oradb.ObjectMeta.Name, owner)))
+		}
+	}
+	//the credentials secret and the running DB pod come with the Apex step of the OracleDatabase
+	if !meta.IsStatusConditionTrue(oradb.Status.Conditions, operatorv1.ConditionApexInstalled) {
+		log.Log.Info("waiting for OracleDatabase " + oradb.ObjectMeta.Name + " to be ready.......")
+		return r.handleStepError(ctx, &pdb, RetryableError(StepDatabase, ReasonDatabaseNotReady, fmt.Errorf("OracleDatabase %s is %s", oradb.ObjectMeta.Name, oradb.Status.Phase)))
+	}
+
+	if !controllerutil.ContainsFinalizer(&pdb, PluggableDatabaseFinalizer) {
+		controllerutil.AddFinalizer(&pdb, PluggableDatabaseFinalizer)
+		if err := r.Update(ctx, &pdb); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+
+	unlock := r.lockDatabase(ctx, &pdb, &oradb)
+	if unlock == nil {
+		return ctrl.Result{RequeueAfter: DatabaseLockRetryInterval}, nil
+	}
+	defer unlock()
+	//record the name before the PDB is created,so deleting the resource drops it even if the script fails halfway
+	if pdb.Status.Pdbname == "" {
+		pdb.Status.Pdbname = pdb.Spec.Pdbname
+		if err := r.Status().Update(ctx, &pdb); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
+	output, err := RunPdbSQL(ctx, r, req, &oradb, &pdb, PdbSyncScript(&pdb))
+	if err != nil {
+		log.Log.Error(err, "unable to apply PDB "+pdb.Spec.Pdbname)
+		return r.handleStepError(ctx, &pdb, ExecError(StepPdb, ReasonPdbSQLFailed, fmt.Errorf("applying PDB %s failed: %w", pdb.Spec.Pdbname, err)))
+	}
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, pdbOpenModeMarker) {
+			pdb.Status.OpenMode = strings.TrimPrefix(line, pdbOpenModeMarker)
+		}
+	}
+	r.Recorder.Event(&pdb, corev1.EventTypeNormal, ReasonReconciled, "PDB "+pdb.Spec.Pdbname+" is "+PdbState(&pdb))
+
+	meta.SetStatusCondition(&pdb.Status.Conditions, metav1.Condition{
+		Type:               operatorv1.ConditionFailed,
+		Status:             metav1.ConditionFalse,
+		Reason:             ReasonReconciled,
+		Message:            "All steps finished",
+		ObservedGeneration: pdb.ObjectMeta.Generation,
+	})
+	pdb.Status.Phase = operatorv1.PhaseReady
+	if err := r.Status().Update(ctx, &pdb); err != nil {
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+//ValidatePluggableDatabase checks the settings the CRD schema can't
+func ValidatePluggableDatabase(pdb *operatorv1.PluggableDatabase) error {
+	if pdb.Spec.DatabaseRef == "" || pdb.Spec.Pdbname == "" {
+		return fmt.Errorf("databaseref and pdbname can't be empty")
+	}
+	if strings.EqualFold(pdb.Spec.Pdbname, pdb.Spec.CloneFrom) {
+		return fmt.Errorf("PDB %s can't be cloned from itself", pdb.Spec.Pdbname)
+	}
+	return nil
+}
+
+//pdbOwner returns the resource already using the pdbname of the PluggableDatabase on its CDB,another PluggableDatabase,
+//an ApexOrds with the PDB as dbservice or,unless the PDB is kept on delete,an ApexOrds serving it with a pool.
+//It returns "" if there is none
+func (r *PluggableDatabaseReconciler) pdbOwner(ctx context.Context, pdb *operatorv1.PluggableDatabase) (string, error) {
+	var pdblist operatorv1.PluggableDatabaseList
+	if err := r.List(ctx, &pdblist, client.InNamespace(pdb.Namespace)); err != nil {
+		return "", fmt.Errorf("unable to list PluggableDatabases: %v", err)
+	}
+	for _, other := range pdblist.Items {
+		if other.Name != pdb.Name && other.Spec.DatabaseRef == pdb.Spec.DatabaseRef && strings.EqualFold(other.Spec.Pdbname, pdb.Spec.Pdbname) {
+			return "PluggableDatabase " + other.Name, nil
+		}
+	}
+	var apexordslist operatorv1.ApexOrdsList
+	if err := r.List(ctx, &apexordslist, client.InNamespace(pdb.Namespace)); err != nil {
+		return "", fmt.Errorf("unable to list ApexOrds: %v", err)
+	}
+	for _, apexords := range apexordslist.Items {
+		if apexords.Spec.DatabaseRef != pdb.Spec.DatabaseRef {
+			continue
+		}
+		if strings.EqualFold(apexords.Spec.Dbservice, pdb.Spec.Pdbname) {
+			return "ApexOrds " + apexords.Name, nil
+		}
+		if pdb.Spec.KeepOnDelete {
+			continue
+		}
+		for _, pool := range OrdsPools(&apexords) {
+			if strings.EqualFold(pool.Dbservice, pdb.Spec.Pdbname) {
+				return "pool " + pool.Name + " of ApexOrds " + apexords.Name + ",set keepondelete to serve the PDB with it", nil
+			}
+		}
+	}
+	return "", nil
+}
+
+//PdbState returns the state the PDB should be in,default is Open
+func PdbState(pdb *operatorv1.PluggableDatabase) string {
+	if pdb.Spec.State == "" {
+		return operatorv1.PdbStateOpen
+	}
+	return pdb.Spec.State
+}
+
+//PdbMaxSize returns the storage quota of the PDB,default is UNLIMITED
+func PdbMaxSize(pdb *operatorv1.PluggableDatabase) string {
+	if pdb.Spec.MaxSize == "" {
+		return "UNLIMITED"
+	}
+	return pdb.Spec.MaxSize
+}
+
+//PdbSyncScript creates the PDB from the seed or the clonefrom PDB if it is missing,opens or closes it,
+//applies the storage quota and saves or discards its state. Every statement checks v$pdbs first,
+//so the script can run again on each change of the spec. The pdbadmin user gets the sys password of the CDB.
+func PdbSyncScript(pdb *operatorv1.PluggableDatabase) string {
+	name := strings.ToUpper(pdb.Spec.Pdbname)
+	storage := " storage (maxsize " + PdbMaxSize(pdb) + ") create_file_dest = ''" + pdbFileDest + "''"
+	create := "create pluggable database " + name + " admin user pdbadmin identified by \"&sys_password\"" + storage
+	if pdb.Spec.CloneFrom != "" {
+		create = "create pluggable database " + name + " from " + strings.ToUpper(pdb.Spec.CloneFrom) + storage
+	}
+
+	script := "set heading off feedback off pagesize 0 linesize 400 serveroutput on\n" +
+		"declare\n" +
+		"  n number;\n" +
+		"begin\n" +
+		"  select count(*) into n from v$pdbs where name = '" + name + "';\n" +
+		"  if n = 0 then\n" +
+		"    execute immediate '" + create + "';\n" +
+		"  end if;\n" +
+		"end;\n" +
+		"/\n"
+	if PdbState(pdb) == operatorv1.PdbStateOpen {
+		script += pdbOpenModeBlock(name, "p.open_mode = 'MOUNTED'", "alter pluggable database "+name+" open") +
+			//the quota of an existing PDB is changed from inside it,which needs it open
+			"alter session set container = " + name + ";\n" +
+			"alter pluggable database storage (maxsize " + PdbMaxSize(pdb) + ");\n" +
+			"alter session set container = CDB$ROOT;\n"
+	} else {
+		script += pdbOpenModeBlock(name, "p.open_mode <> 'MOUNTED'", "alter pluggable database "+name+" close immediate")
+	}
+	if pdb.Spec.SaveState {
+		script += "alter pluggable database " + name + " save state;\n"
+	} else {
+		script += "alter pluggable database " + name + " discard state;\n"
+	}
+	script += "select '" + pdbOpenModeMarker + "' || open_mode from v$pdbs where name = '" + name + "';\n"
+	return script
+}
+
+//PdbDropScript closes and drops the PDB including its datafiles,nothing is done if it is missing
+func PdbDropScript(pdb *operatorv1.PluggableDatabase) string {
+	name := strings.ToUpper(pdb.Spec.Pdbname)
+	return "set heading off feedback off pagesize 0 linesize 400 serveroutput on\n" +
+		"begin\n" +
+		"  for p in (select open_mode from v$pdbs where name = '" + name + "') loop\n" +
+		"    if p.open_mode <> 'MOUNTED' then\n" +
+		"      execute immediate 'alter pluggable database " + name + " close immediate';\n" +
+		"    end if;\n" +
+		"    execute immediate 'drop pluggable database " + name + " including datafiles';\n" +
+		"  end loop;\n" +
+		"end;\n" +
+		"/\n"
+}
+
+//pdbOpenModeBlock runs the statement when the open mode of the PDB matches the condition
+func pdbOpenModeBlock(name string, condition string, statement string) string {
+	return "begin\n" +
+		"  for p in (select open_mode from v$pdbs where name = '" + name + "') loop\n" +
+		"    if " + condition + " then\n" +
+		"      execute immediate '" + statement + "';\n" +
+		"    end if;\n" +
+		"  end loop;\n" +
+		"end;\n" +
+		"/\n"
+}
+
+//RunPdbSQL runs the script as sys in the root container of the CDB in a temporary sqlplus pod and returns the output
+func RunPdbSQL(ctx context.Context, r *PluggableDatabaseReconciler, req ctrl.Request, oradb *operatorv1.OracleDatabase, pdb *operatorv1.PluggableDatabase, script string) (string, error) {
+	Podname := pdb.ObjectMeta.Name + "-pdb-sqlpluspod"
+	cdb := CdbDatabase(&oradb.Spec)
+
+	if err := CreateSqlplusPod(r.Client, req, Podname, DbCredentialsSecretName(oradb), cdb); err != nil {
+		log.Log.Error(err, "unable to create "+Podname)
+		return "", err
+	}
+	defer func() {
+		if err := DeleteSqlplusPod(r.Client, req, Podname); err != nil {
+			log.Log.Error(err, "unable to delete "+Podname)
+		}
+	}()
+
+	log.Log.Info("Run PDB sql for " + pdb.Spec.Pdbname + " in " + Podname)
+	return RunSqlplus(ctx, r.Runner, req, Podname, StepPdb, DbConnectString(cdb), "PDB sql", script)
+}
+
+//handleStepError reports a failed step in events,metrics and the Failed condition.
+//Retryable errors are returned so the request is requeued with backoff,terminal errors are not.
+func (r *PluggableDatabaseReconciler) handleStepError(ctx context.Context, pdb *operatorv1.PluggableDatabase, stepErr *StepError) (ctrl.Result, error) {
+	log.Log.Error(stepErr, "reconcile step failed", "step", stepErr.Step, "reason", stepErr.Reason, "retryable", stepErr.Retryable)
+	StepFailures.WithLabelValues(stepErr.Step, stepErr.Reason).Inc()
+	r.Recorder.Eventf(pdb, corev1.EventTypeWarning, stepErr.Reason, "%v", stepErr.Err)
+
+	meta.SetStatusCondition(&pdb.Status.Conditions, metav1.Condition{
+		Type:               operatorv1.ConditionFailed,
+		Status:             metav1.ConditionTrue,
+		Reason:             stepErr.Reason,
+		Message:            stepErr.Error(),
+		ObservedGeneration: pdb.ObjectMeta.Generation,
+	})
+	if !stepErr.Retryable {
+		pdb.Status.Phase = operatorv1.PhaseFailed
+	}
+	if err := r.Status().Update(ctx, pdb); err != nil {
+		log.Log.Error(err, "unable to update PluggableDatabase status")
+	}
+
+	if stepErr.Retryable {
+		return ctrl.Result{}, stepErr
+	}
+	return ctrl.Result{}, nil
+}
+
+//setPhase saves the phase in PluggableDatabase status
+func (r *PluggableDatabaseReconciler) setPhase(ctx context.Context, pdb *operatorv1.PluggableDatabase, phase string) {
+	if pdb.Status.Phase == phase {
+		return
+	}
+	pdb.Status.Phase = phase
+	if err := r.Status().Update(ctx, pdb); err != nil {
+		log.Log.Error(err, "unable to update PluggableDatabase status phase to "+phase)
+	}
+}
+
+//lockDatabase takes the lock of the CDB,while another resource runs scripts in it it marks the PluggableDatabase
+//waiting and returns nil
+func (r *PluggableDatabaseReconciler) lockDatabase(ctx context.Context, pdb *operatorv1.PluggableDatabase, oradb *operatorv1.OracleDatabase) func() {
+	unlock, changed := lockDatabase(r.Recorder, pdb, "PluggableDatabase", &pdb.Status.Conditions, &oradb.Spec)
+	if changed {
+		if err := r.Status().Update(ctx, pdb); err != nil {
+			log.Log.Error(err, "unable to update PluggableDatabase status")
+		}
+	}
+	return unlock
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *PluggableDatabaseReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		// status updates must not trigger another reconcile
+		For(&operatorv1.PluggableDatabase{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		// create the PDBs as soon as the referenced OracleDatabase is ready
+		Watches(&source.Kind{Type: &operatorv1.OracleDatabase{}}, handler.EnqueueRequestsFromMapFunc(r.pluggabledatabasesOfDatabase)).
+		WithOptions(controller.Options{MaxConcurrentReconciles: r.MaxConcurrentReconciles}).
+		Complete(r)
+}
+
+//pluggabledatabasesOfDatabase returns the requests of the PluggableDatabases with databaseref to the OracleDatabase
+func (r *PluggableDatabaseReconciler) pluggabledatabasesOfDatabase(obj client.Object) []reconcile.Request {
+	var pdblist operatorv1.PluggableDatabaseList
+	if err := r.List(context.Background(), &pdblist, client.InNamespace(obj.GetNamespace())); err != nil {
+		log.Log.Error(err, "unable to list PluggableDatabases of OracleDatabase "+obj.GetName())
+		return nil
+	}
+	var requests []reconcile.Request
+	for _, pdb := range pdblist.Items {
+		if pdb.Spec.DatabaseRef == obj.GetName() {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&pdb)})
+		}
+	}
+	return requests
+}
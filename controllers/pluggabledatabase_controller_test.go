@@ -0,0 +1,291 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	operatorv1 "apexords-operator/apexords-operator/api/v1"
+)
+
+var _ = Describe("PluggableDatabase", func() {
+	var (
+		ctx       context.Context
+		namespace string
+		runner    *FakeCommandRunner
+		stopPods  func()
+		saved     time.Duration
+	)
+
+	reconcilePdb := func(pdb *operatorv1.PluggableDatabase) error {
+		r := &PluggableDatabaseReconciler{Client: k8sClient, Scheme: scheme.Scheme, Recorder: record.NewFakeRecorder(100), Runner: runner}
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(pdb)})
+		return err
+	}
+
+	refresh := func(pdb *operatorv1.PluggableDatabase) *operatorv1.PluggableDatabase {
+		ExpectWithOffset(1, k8sClient.Get(ctx, client.ObjectKeyFromObject(pdb), pdb)).To(Succeed())
+		return pdb
+	}
+
+	newPluggableDatabase := func(name string, spec operatorv1.PluggableDatabaseSpec) *operatorv1.PluggableDatabase {
+		pdb := &operatorv1.PluggableDatabase{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       spec,
+		}
+		ExpectWithOffset(1, k8sClient.Create(ctx, pdb)).To(Succeed())
+		return pdb
+	}
+
+	//readyDatabase plays the OracleDatabase controller having installed Apex in the CDB
+	readyDatabase := func() *operatorv1.OracleDatabase {
+		oradb := &operatorv1.OracleDatabase{
+			ObjectMeta: metav1.ObjectMeta{Name: "devdb", Namespace: namespace},
+			Spec:       operatorv1.OracleDatabaseSpec{Dbname: "devcdb", Dbservice: "devpdb"},
+		}
+		ExpectWithOffset(1, k8sClient.Create(ctx, oradb)).To(Succeed())
+		meta.SetStatusCondition(&oradb.Status.Conditions, metav1.Condition{
+			Type:   operatorv1.ConditionApexInstalled,
+			Status: metav1.ConditionTrue,
+			Reason: ReasonApexInstallFinished,
+		})
+		oradb.Status.Phase = operatorv1.PhaseReady
+		ExpectWithOffset(1, k8sClient.Status().Update(ctx, oradb)).To(Succeed())
+		return oradb
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		runner = &FakeCommandRunner{Results: func(cmd FakeCommand) (CommandResult, error) {
+			if strings.Contains(cmd.Command[2], pdbOpenModeMarker) {
+				return CommandResult{Stdout: pdbOpenModeMarker + "READ WRITE\n"}, nil
+			}
+			return CommandResult{}, nil
+		}}
+		saved = PodPollInterval
+		PodPollInterval = 20 * time.Millisecond
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "apexords-pdb-"}}
+		Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+		namespace = ns.Name
+		stopPods = runPods(namespace, "teampdb-pdb-sqlpluspod")
+	})
+
+	AfterEach(func() {
+		stopPods()
+		PodPollInterval = saved
+	})
+
+	It("waits for the referenced OracleDatabase", func() {
+		pdb := newPluggableDatabase("teampdb", operatorv1.PluggableDatabaseSpec{DatabaseRef: "devdb", Pdbname: "teampdb"})
+
+		err := reconcilePdb(pdb)
+		var stepErr *StepError
+		Expect(errors.As(err, &stepErr)).To(BeTrue())
+		Expect(stepErr.Reason).To(Equal(ReasonDatabaseNotReady))
+		Expect(stepErr.Retryable).To(BeTrue())
+		Expect(runner.Commands).To(BeEmpty())
+		Expect(refresh(pdb).Status.Phase).To(Equal(operatorv1.PhaseProvisioning))
+
+		oradb := readyDatabase()
+		r := &PluggableDatabaseReconciler{Client: k8sClient}
+		Expect(r.pluggabledatabasesOfDatabase(oradb)).To(ConsistOf(ctrl.Request{NamespacedName: client.ObjectKeyFromObject(pdb)}))
+		Expect(reconcilePdb(pdb)).To(Succeed())
+		Expect(refresh(pdb).Status.Phase).To(Equal(operatorv1.PhaseReady))
+	})
+
+	It("refuses to manage the Apex PDB of the OracleDatabase", func() {
+		readyDatabase()
+		pdb := newPluggableDatabase("teampdb", operatorv1.PluggableDatabaseSpec{DatabaseRef: "devdb", Pdbname: "DEVPDB"})
+
+		Expect(reconcilePdb(pdb)).To(Succeed())
+		refresh(pdb)
+		Expect(pdb.Status.Phase).To(Equal(operatorv1.PhaseFailed))
+		Expect(meta.FindStatusCondition(pdb.Status.Conditions, operatorv1.ConditionFailed).Reason).To(Equal(ReasonInvalidSpec))
+		Expect(runner.Commands).To(BeEmpty())
+	})
+
+	It("creates and opens the PDB with its quota and saved state", func() {
+		readyDatabase()
+		pdb := newPluggableDatabase("teampdb", operatorv1.PluggableDatabaseSpec{DatabaseRef: "devdb", Pdbname: "teampdb", MaxSize: "10G", SaveState: true})
+
+		Expect(reconcilePdb(pdb)).To(Succeed())
+		refresh(pdb)
+		Expect(pdb.Status.Phase).To(Equal(operatorv1.PhaseReady))
+		Expect(pdb.Status.OpenMode).To(Equal("READ WRITE"))
+		Expect(controllerutil.ContainsFinalizer(pdb, PluggableDatabaseFinalizer)).To(BeTrue())
+
+		Expect(runner.Commands).To(HaveLen(1))
+		Expect(runner.Commands[0].Podname).To(Equal("teampdb-pdb-sqlpluspod"))
+		script := runner.Scripts()[0]
+		//sys connects to the root container,whose service is the CDB name
+		Expect(script).To(ContainSubstring("@devcdb-apexords-db-svc:1521/devcdb "))
+		Expect(script).To(ContainSubstring("create pluggable database TEAMPDB admin user pdbadmin identified by \"&sys_password\" storage (maxsize 10G) create_file_dest = ''/opt/oracle/oradata''"))
+		Expect(script).To(ContainSubstring("alter pluggable database TEAMPDB open"))
+		Expect(script).To(ContainSubstring("alter pluggable database storage (maxsize 10G);"))
+		Expect(script).To(ContainSubstring("alter pluggable database TEAMPDB save state;"))
+		Expect(script).NotTo(ContainSubstring("close immediate"))
+
+		sqlpluspod := &corev1.Pod{}
+		Expect(apierrors.IsNotFound(k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: "teampdb-pdb-sqlpluspod"}, sqlpluspod))).To(BeTrue())
+	})
+
+	It("clones and closes the PDB", func() {
+		readyDatabase()
+		pdb := newPluggableDatabase("teampdb", operatorv1.PluggableDatabaseSpec{DatabaseRef: "devdb", Pdbname: "teampdb", CloneFrom: "devpdb", State: operatorv1.PdbStateClosed})
+
+		Expect(reconcilePdb(pdb)).To(Succeed())
+		script := runner.Scripts()[0]
+		Expect(script).To(ContainSubstring("create pluggable database TEAMPDB from DEVPDB storage (maxsize UNLIMITED)"))
+		Expect(script).NotTo(ContainSubstring("admin user"))
+		Expect(script).To(ContainSubstring("alter pluggable database TEAMPDB close immediate"))
+		Expect(script).To(ContainSubstring("alter pluggable database TEAMPDB discard state;"))
+		Expect(script).NotTo(ContainSubstring("alter session set container"))
+	})
+
+	It("drops the PDB before its finalizer is removed", func() {
+		readyDatabase()
+		pdb := newPluggableDatabase("teampdb", operatorv1.PluggableDatabaseSpec{DatabaseRef: "devdb", Pdbname: "teampdb"})
+		Expect(reconcilePdb(pdb)).To(Succeed())
+
+		Expect(k8sClient.Delete(ctx, pdb)).To(Succeed())
+		Expect(reconcilePdb(pdb)).To(Succeed())
+		Expect(runner.Commands).To(HaveLen(2))
+		Expect(runner.Scripts()[1]).To(ContainSubstring("drop pluggable database TEAMPDB including datafiles"))
+		Expect(runner.Scripts()[1]).NotTo(ContainSubstring("create pluggable database"))
+		Expect(apierrors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(pdb), pdb))).To(BeTrue())
+	})
+
+	It("keeps the PDB on delete with keepondelete", func() {
+		readyDatabase()
+		pdb := newPluggableDatabase("teampdb", operatorv1.PluggableDatabaseSpec{DatabaseRef: "devdb", Pdbname: "teampdb", KeepOnDelete: true})
+		Expect(reconcilePdb(pdb)).To(Succeed())
+
+		Expect(k8sClient.Delete(ctx, pdb)).To(Succeed())
+		Expect(reconcilePdb(pdb)).To(Succeed())
+		Expect(runner.Commands).To(HaveLen(1))
+		Expect(apierrors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(pdb), pdb))).To(BeTrue())
+	})
+
+	It("keeps the finalizer while the OracleDatabase can't be read", func() {
+		readyDatabase()
+		pdb := newPluggableDatabase("teampdb", operatorv1.PluggableDatabaseSpec{DatabaseRef: "devdb", Pdbname: "teampdb"})
+		Expect(reconcilePdb(pdb)).To(Succeed())
+		Expect(k8sClient.Delete(ctx, pdb)).To(Succeed())
+
+		r := &PluggableDatabaseReconciler{Client: failingGetClient{Client: k8sClient}, Scheme: scheme.Scheme, Recorder: record.NewFakeRecorder(100), Runner: runner}
+		_, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(pdb)})
+		var stepErr *StepError
+		Expect(errors.As(err, &stepErr)).To(BeTrue())
+		Expect(stepErr.Retryable).To(BeTrue())
+		Expect(controllerutil.ContainsFinalizer(refresh(pdb), PluggableDatabaseFinalizer)).To(BeTrue())
+		Expect(runner.Commands).To(HaveLen(1))
+
+		Expect(reconcilePdb(pdb)).To(Succeed())
+		Expect(runner.Scripts()[1]).To(ContainSubstring("drop pluggable database TEAMPDB including datafiles"))
+	})
+
+	It("rejects a pdbname another resource uses on the CDB and drops nothing for it", func() {
+		readyDatabase()
+		first := newPluggableDatabase("teampdb", operatorv1.PluggableDatabaseSpec{DatabaseRef: "devdb", Pdbname: "teampdb"})
+		Expect(reconcilePdb(first)).To(Succeed())
+
+		second := newPluggableDatabase("otherpdb", operatorv1.PluggableDatabaseSpec{DatabaseRef: "devdb", Pdbname: "TEAMPDB"})
+		Expect(reconcilePdb(second)).To(Succeed())
+		refresh(second)
+		Expect(second.Status.Phase).To(Equal(operatorv1.PhaseFailed))
+		failed := meta.FindStatusCondition(second.Status.Conditions, operatorv1.ConditionFailed)
+		Expect(failed.Reason).To(Equal(ReasonInvalidSpec))
+		Expect(failed.Message).To(ContainSubstring("PluggableDatabase teampdb"))
+		Expect(second.Status.Pdbname).To(BeEmpty())
+		Expect(runner.Commands).To(HaveLen(1))
+
+		Expect(k8sClient.Delete(ctx, second)).To(Succeed())
+		Expect(reconcilePdb(second)).To(Succeed())
+		Expect(runner.Commands).To(HaveLen(1))
+		Expect(apierrors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(second), second))).To(BeTrue())
+		Expect(refresh(first).Status.Phase).To(Equal(operatorv1.PhaseReady))
+	})
+
+	It("drops the PDB of an Ords pool only with keepondelete unset", func() {
+		readyDatabase()
+		apexords := &operatorv1.ApexOrds{
+			ObjectMeta: metav1.ObjectMeta{Name: "apexords-dev", Namespace: namespace},
+			Spec: operatorv1.ApexOrdsSpec{DatabaseRef: "devdb", Ordsname: "devords", Ords: &operatorv1.OrdsSpec{
+				Pools: []operatorv1.OrdsPool{{Name: "team", Dbservice: "teampdb", PathPrefix: "/team"}}}},
+		}
+		Expect(k8sClient.Create(ctx, apexords)).To(Succeed())
+
+		pdb := newPluggableDatabase("teampdb", operatorv1.PluggableDatabaseSpec{DatabaseRef: "devdb", Pdbname: "teampdb"})
+		Expect(reconcilePdb(pdb)).To(Succeed())
+		refresh(pdb)
+		Expect(pdb.Status.Phase).To(Equal(operatorv1.PhaseFailed))
+		Expect(meta.FindStatusCondition(pdb.Status.Conditions, operatorv1.ConditionFailed).Message).To(ContainSubstring("pool team of ApexOrds apexords-dev"))
+		Expect(runner.Commands).To(BeEmpty())
+
+		pdb.Spec.KeepOnDelete = true
+		Expect(k8sClient.Update(ctx, pdb)).To(Succeed())
+		Expect(reconcilePdb(pdb)).To(Succeed())
+		Expect(refresh(pdb).Status.Phase).To(Equal(operatorv1.PhaseReady))
+	})
+
+	It("rejects a change of pdbname and drops the PDB it created", func() {
+		readyDatabase()
+		pdb := newPluggableDatabase("teampdb", operatorv1.PluggableDatabaseSpec{DatabaseRef: "devdb", Pdbname: "teampdb"})
+		Expect(reconcilePdb(pdb)).To(Succeed())
+		Expect(refresh(pdb).Status.Pdbname).To(Equal("teampdb"))
+
+		pdb.Spec.Pdbname = "salespdb"
+		Expect(k8sClient.Update(ctx, pdb)).To(Succeed())
+		Expect(reconcilePdb(pdb)).To(Succeed())
+		refresh(pdb)
+		Expect(pdb.Status.Phase).To(Equal(operatorv1.PhaseFailed))
+		Expect(meta.FindStatusCondition(pdb.Status.Conditions, operatorv1.ConditionFailed).Reason).To(Equal(ReasonNameChanged))
+		Expect(runner.Commands).To(HaveLen(1))
+
+		Expect(k8sClient.Delete(ctx, pdb)).To(Succeed())
+		Expect(reconcilePdb(pdb)).To(Succeed())
+		Expect(runner.Scripts()[1]).To(ContainSubstring("drop pluggable database TEAMPDB including datafiles"))
+		Expect(runner.Scripts()[1]).NotTo(ContainSubstring("SALESPDB"))
+	})
+})
+
+//failingGetClient fails to get OracleDatabases,as when the API server is unavailable
+type failingGetClient struct {
+	client.Client
+}
+
+func (c failingGetClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object) error {
+	if _, ok := obj.(*operatorv1.OracleDatabase); ok {
+		return apierrors.NewServiceUnavailable("unavailable")
+	}
+	return c.Client.Get(ctx, key, obj)
+}
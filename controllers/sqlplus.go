@@ -0,0 +1,198 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+var (
+	//ORA- database, SP2- sqlplus and PLS- PL/SQL compiler errors
+	sqlplusErrorRegexp = regexp.MustCompile(`\b(ORA|SP2|PLS)-\d{4,5}\b`)
+
+	//errors which only tell where the real error happened,ie ORA-06512: at line 5
+	sqlplusContextErrors = map[string]bool{
+		"ORA-06512": true,
+		"ORA-06550": true,
+	}
+
+	//errors of a DB which is starting,stopping or not registered with the listener yet
+	sqlplusTransientErrors = map[string]bool{
+		"ORA-01033": true,
+		"ORA-01034": true,
+		"ORA-01089": true,
+		"ORA-01109": true,
+		"ORA-03113": true,
+		"ORA-03114": true,
+		"ORA-12170": true,
+		"ORA-12514": true,
+		"ORA-12528": true,
+		"ORA-12537": true,
+		"ORA-12541": true,
+	}
+)
+
+// SqlplusError is an ORA-,SP2- or PLS- error printed by sqlplus
+type SqlplusError struct {
+	// Code is the error code ie ORA-01017
+	Code string
+	// Message is the output line with the code
+	Message string
+	// Script is the sql script which failed
+	Script string
+	// Err is the error of the command if sqlplus exited non zero
+	Err error
+}
+
+func (e *SqlplusError) Error() string {
+	if e.Script == "" {
+		return e.Message
+	}
+	return e.Script + " failed: " + e.Message
+}
+
+func (e *SqlplusError) Unwrap() error {
+	return e.Err
+}
+
+//Transient tells if the error goes away by itself once the DB is up
+func (e *SqlplusError) Transient() bool {
+	return sqlplusTransientErrors[e.Code]
+}
+
+//ParseSqlplusErrors returns the ORA-/SP2-/PLS- errors in sqlplus output in the order they were printed
+func ParseSqlplusErrors(output string) []SqlplusError {
+	var sqlErrs []SqlplusError
+	for _, line := range strings.Split(output, "\n") {
+		code := sqlplusErrorRegexp.FindString(line)
+		if code == "" {
+			continue
+		}
+		sqlErrs = append(sqlErrs, SqlplusError{Code: code, Message: strings.TrimSpace(line)})
+	}
+	return sqlErrs
+}
+
+//FirstSqlplusError returns the first error which is not just the location of another one,nil if there is no error
+func FirstSqlplusError(output string) *SqlplusError {
+	sqlErrs := ParseSqlplusErrors(output)
+	if len(sqlErrs) == 0 {
+		return nil
+	}
+	for i := range sqlErrs {
+		if !sqlplusContextErrors[sqlErrs[i].Code] {
+			return &sqlErrs[i]
+		}
+	}
+	return &sqlErrs[0]
+}
+
+// Keys of the credentials secret,the sqlplus pod gets them as env variables and scripts as sqlplus defines.
+// The public password is the one of APEX_PUBLIC_USER,APEX_LISTENER,APEX_REST_PUBLIC_USER and ORDS_PUBLIC_USER,
+// the new_ keys hold the passwords of a rotation or a new sys password until the DB has them.
+const (
+	CredentialsSysPasswordKey          = "sys_password"
+	CredentialsApexAdminPasswordKey    = "apex_admin_password"
+	CredentialsPublicPasswordKey       = "public_password"
+	CredentialsNewApexAdminPasswordKey = "new_apex_admin_password"
+	CredentialsNewPublicPasswordKey    = "new_public_password"
+	CredentialsNewSysPasswordKey       = "new_sys_password"
+)
+
+//SqlplusDefines are the passwords every sqlplus script can use
+var SqlplusDefines = []string{CredentialsSysPasswordKey, CredentialsApexAdminPasswordKey}
+
+//RotationDefines are the passwords of the script rotating them
+var RotationDefines = append(append([]string{}, SqlplusDefines...), CredentialsNewApexAdminPasswordKey, CredentialsNewPublicPasswordKey)
+
+//SysPasswordDefines are the passwords of the script changing the sys password
+var SysPasswordDefines = append(append([]string{}, SqlplusDefines...), CredentialsNewSysPasswordKey)
+
+//SqlplusCommand runs script as sys in a sqlplus /nolog session which exits with failure on the first sql or os error.
+//connect is host:port/service. The passwords are read from the SYS_PASSWORD and APEX_ADMIN_PASSWORD env of the pod
+//and fed to sqlplus on stdin by shell builtins,so they are in no process arguments. Scripts use them as
+//&sys_password and &apex_admin_password,verify is off so sqlplus does not print the substituted lines.
+func SqlplusCommand(connect string, script string) []string {
+	return SqlplusDefinesCommand(connect, script, SqlplusDefines)
+}
+
+//SqlplusDefinesCommand is SqlplusCommand with the given defines,each read from the env of its upper case name
+func SqlplusDefinesCommand(connect string, script string, defines []string) []string {
+	var format, values string
+	for _, define := range defines {
+		format += "define " + define + " = \"%s\"\\n"
+		values += " \"$" + strings.ToUpper(define) + "\""
+	}
+	sqltext := "{ printf 'whenever sqlerror exit failure\\nwhenever oserror exit failure\\nset verify off\\n'\n" +
+		"printf 'connect sys/\"%s\"@" + connect + " as sysdba\\n' \"$SYS_PASSWORD\"\n" +
+		"printf '" + format + "'" + values + "\n" +
+		"cat <<'EOF'\n" +
+		script + "\n" +
+		"exit\n" +
+		"EOF\n" +
+		"} | sqlplus -s -L /nolog"
+	return []string{"/bin/sh", "-c", sqltext}
+}
+
+//SqlplusEnv returns the env of a sqlplus pod with the passwords of the credentials secret
+func SqlplusEnv(Secretname string) []corev1.EnvVar {
+	return CredentialsEnv(Secretname, SqlplusDefines)
+}
+
+//RotationEnv returns the env of the sqlplus pod rotating the passwords,SqlplusEnv plus the new passwords
+func RotationEnv(Secretname string) []corev1.EnvVar {
+	return CredentialsEnv(Secretname, RotationDefines)
+}
+
+//CredentialsEnv returns env variables named after the upper case keys with the values of the credentials secret,
+//as SqlplusDefinesCommand reads them
+func CredentialsEnv(Secretname string, keys []string) []corev1.EnvVar {
+	var env []corev1.EnvVar
+	for _, key := range keys {
+		env = append(env, corev1.EnvVar{
+			Name: strings.ToUpper(key),
+			ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: Secretname},
+				Key:                  key,
+			}},
+		})
+	}
+	return env
+}
+
+//RunSqlplus runs script with sqlplus in the pod and returns its output. Errors printed by sqlplus are
+//returned as SqlplusError even if sqlplus exited 0,ie SP2- errors which whenever sqlerror does not catch.
+//step sets how long the script may run,see ExecTimeouts
+func RunSqlplus(ctx context.Context, runner CommandRunner, req ctrl.Request, Podname string, step string, connect string, name string, script string) (string, error) {
+	return RunSqlplusDefines(ctx, runner, req, Podname, step, connect, name, script, SqlplusDefines)
+}
+
+//RunSqlplusDefines is RunSqlplus with the given defines,the pod needs their env
+func RunSqlplusDefines(ctx context.Context, runner CommandRunner, req ctrl.Request, Podname string, step string, connect string, name string, script string, defines []string) (string, error) {
+	output, err := ExecPodCmdOutput(ctx, runner, req, Podname, step, SqlplusDefinesCommand(connect, script, defines))
+	if sqlErr := FirstSqlplusError(output); sqlErr != nil {
+		sqlErr.Script = name
+		sqlErr.Err = err
+		return output, sqlErr
+	}
+	return output, err
+}
@@ -17,11 +17,18 @@ limitations under the License.
 package controllers
 
 import (
+	"context"
+	"io"
+	"io/ioutil"
 	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -58,7 +65,8 @@ var _ = BeforeSuite(func() {
 		ErrorIfCRDPathMissing: true,
 	}
 
-	cfg, err := testEnv.Start()
+	var err error
+	cfg, err = testEnv.Start()
 	Expect(err).NotTo(HaveOccurred())
 	Expect(cfg).NotTo(BeNil())
 
@@ -78,3 +86,94 @@ var _ = AfterSuite(func() {
 	err := testEnv.Stop()
 	Expect(err).NotTo(HaveOccurred())
 })
+
+// FakeCommand is a command run through the FakeCommandRunner
+type FakeCommand struct {
+	Namespace string
+	Podname   string
+	Command   []string
+	Stdin     string
+}
+
+// FakeCommandRunner records the commands instead of running them in pods
+type FakeCommandRunner struct {
+	mu       sync.Mutex
+	Commands []FakeCommand
+	// Results returns the result of a command,nil means every command succeeds with no output
+	Results func(cmd FakeCommand) (CommandResult, error)
+	// Block makes the commands it returns true for hang until their ctx is done,like an exec which never returns
+	Block func(cmd FakeCommand) bool
+}
+
+func (f *FakeCommandRunner) Run(ctx context.Context, Namespace string, Podname string, Command []string, stdin io.Reader) (CommandResult, error) {
+	cmd := FakeCommand{Namespace: Namespace, Podname: Podname, Command: Command}
+	if stdin != nil {
+		data, err := ioutil.ReadAll(stdin)
+		if err != nil {
+			return CommandResult{}, err
+		}
+		cmd.Stdin = string(data)
+	}
+	f.mu.Lock()
+	f.Commands = append(f.Commands, cmd)
+	f.mu.Unlock()
+	if f.Block != nil && f.Block(cmd) {
+		<-ctx.Done()
+		return CommandResult{}, ctx.Err()
+	}
+	if f.Results == nil {
+		return CommandResult{}, nil
+	}
+	return f.Results(cmd)
+}
+
+// Scripts returns the shell scripts run by "/bin/sh -c" in the order they were issued
+func (f *FakeCommandRunner) Scripts() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var scripts []string
+	for _, cmd := range f.Commands {
+		scripts = append(scripts, cmd.Command[len(cmd.Command)-1])
+	}
+	return scripts
+}
+
+// runPods plays the kubelet for envtest: the named pods are marked Running as soon as they
+// are created, until the returned stop function is called
+func runPods(namespace string, names ...string) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for ctx.Err() == nil {
+			for _, name := range names {
+				pod := &corev1.Pod{}
+				if err := k8sClient.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, pod); err != nil {
+					continue
+				}
+				if pod.Status.Phase != corev1.PodRunning {
+					pod.Status.Phase = corev1.PodRunning
+					_ = k8sClient.Status().Update(ctx, pod)
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}
+}
+
+// rollOut plays the deployment controller for envtest: all pods of the deployment are
+// updated and available and the pods of its old ReplicaSets are gone
+func rollOut(deployment *appsv1.Deployment) {
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	deployment.Status.ObservedGeneration = deployment.ObjectMeta.Generation
+	deployment.Status.Replicas, deployment.Status.UpdatedReplicas = replicas, replicas
+	deployment.Status.ReadyReplicas, deployment.Status.AvailableReplicas = replicas, replicas
+	Expect(k8sClient.Status().Update(context.Background(), deployment)).To(Succeed())
+}
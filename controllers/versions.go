@@ -0,0 +1,44 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strings"
+)
+
+//marker printed in front of the installed Apex and Ords versions
+const versionMarker = "APEXORDSVERSION:"
+
+//ApexVersionQuery prints the Apex version installed in the PDB
+const ApexVersionQuery = "select '" + versionMarker + "' || version_no from apex_release;"
+
+//OrdsVersionCommand prints the version of ords.war,ords.war version prints ie Oracle REST Data Services 19.4.0.r3521226
+const OrdsVersionCommand = "echo " + versionMarker + "$(java -jar /opt/oracle/ords/ords.war version)"
+
+//ParseVersion returns the version printed after the marker,empty if the output has none
+func ParseVersion(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, versionMarker) {
+			fields := strings.Fields(strings.TrimPrefix(line, versionMarker))
+			if len(fields) > 0 {
+				return fields[len(fields)-1]
+			}
+		}
+	}
+	return ""
+}
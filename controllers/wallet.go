@@ -0,0 +1,140 @@
+/*
+Copyright 2021 Henry Xie.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	operatorv1 "apexords-operator/apexords-operator/api/v1"
+)
+
+const (
+	//where the wallet secret is mounted,also the TNS_ADMIN of sqlplus and Ords
+	WalletMountPath = "/opt/oracle/wallet"
+	walletVolume    = "db-wallet"
+	//default TCPS listening port
+	DefaultTCPSPort = "2484"
+)
+
+//DbTLS returns the TLS settings of the DB,nil for plain TCP
+func DbTLS(db *operatorv1.OracleDatabaseSpec) *operatorv1.DatabaseTLS {
+	return db.TLS
+}
+
+//DbTCPSPort returns the TCPS port of the database
+func DbTCPSPort(tls *operatorv1.DatabaseTLS) string {
+	if tls.Port != "" {
+		return tls.Port
+	}
+	return DefaultTCPSPort
+}
+
+//ValidateDbTLS checks tls names the database to connect to,the DB created by the operator has no TCPS listener
+func ValidateDbTLS(tls *operatorv1.DatabaseTLS) error {
+	if tls == nil {
+		return nil
+	}
+	if tls.WalletSecret == "" {
+		return fmt.Errorf("database.tls.walletsecret can't be empty")
+	}
+	if tls.TNSAlias == "" && tls.Host == "" {
+		return fmt.Errorf("database.tls needs tnsalias or host of a DB with a TCPS listener,the DB created by the operator listens on TCP only")
+	}
+	if tls.Port != "" {
+		if port, err := strconv.Atoi(tls.Port); err != nil || port < 1 || port > 65535 {
+			return fmt.Errorf("database.tls.port %s is not a port number", tls.Port)
+		}
+	}
+	return nil
+}
+
+//DbConnectString returns the sqlplus connect identifier of the database: host:port/service for TCP,
+//the tnsnames.ora alias or a TCPS descriptor for TLS
+func DbConnectString(db *operatorv1.OracleDatabaseSpec) string {
+	tls := DbTLS(db)
+	if tls == nil {
+		dbport := db.Dbport
+		if dbport == "" {
+			dbport = "1521"
+		}
+		return db.Dbname + "-apexords-db-svc:" + dbport + "/" + db.Dbservice
+	}
+	if tls.TNSAlias != "" {
+		return tls.TNSAlias
+	}
+	return "(DESCRIPTION=(ADDRESS=(PROTOCOL=TCPS)(HOST=" + tls.Host + ")(PORT=" + DbTCPSPort(tls) + "))" +
+		"(CONNECT_DATA=(SERVICE_NAME=" + db.Dbservice + ")))"
+}
+
+//DbJDBCURL returns the jdbc url Ords uses for TLS
+func DbJDBCURL(db *operatorv1.OracleDatabaseSpec) string {
+	return "jdbc:oracle:thin:@" + DbConnectString(db)
+}
+
+//MountWallet mounts the wallet secret into the container and points TNS_ADMIN and the jdbc driver to it,
+//nothing is done for plain TCP
+func MountWallet(db *operatorv1.OracleDatabaseSpec, podspec *corev1.PodSpec, containerName string) {
+	tls := DbTLS(db)
+	if tls == nil {
+		return
+	}
+	podspec.Volumes = append(podspec.Volumes, corev1.Volume{
+		Name: walletVolume,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{SecretName: tls.WalletSecret},
+		},
+	})
+	for i := range podspec.Containers {
+		container := &podspec.Containers[i]
+		if container.Name != containerName {
+			continue
+		}
+		container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+			Name:      walletVolume,
+			MountPath: WalletMountPath,
+			ReadOnly:  true,
+		})
+		container.Env = append(container.Env,
+			corev1.EnvVar{Name: "TNS_ADMIN", Value: WalletMountPath},
+			corev1.EnvVar{Name: "JAVA_TOOL_OPTIONS", Value: "-Doracle.net.tns_admin=" + WalletMountPath +
+				" -Doracle.net.wallet_location=(SOURCE=(METHOD=FILE)(METHOD_DATA=(DIRECTORY=" + WalletMountPath + ")))"},
+		)
+	}
+}
+
+//OrdsTLSConfig switches the Ords pool and installation parameters to the TCPS jdbc url
+func OrdsTLSConfig(db *operatorv1.OracleDatabaseSpec, ordsconfigmap *corev1.ConfigMap) {
+	if DbTLS(db) == nil {
+		return
+	}
+	jdbcurl := DbJDBCURL(db)
+	if defaults, ok := ordsconfigmap.Data["defaults.xml"]; ok {
+		ordsconfigmap.Data["defaults.xml"] = strings.Replace(defaults, "</properties>",
+			xmlEntry("db.connectionType", "customurl")+
+				xmlEntry("db.customURL", jdbcurl)+
+				"</properties>", 1)
+	}
+	if params, ok := ordsconfigmap.Data["ords_params.properties"]; ok {
+		ordsconfigmap.Data["ords_params.properties"] = params +
+			"db.connectionType=customurl\n" +
+			"db.customURL=" + strings.NewReplacer("=", "\\=", ":", "\\:").Replace(jdbcurl) + "\n"
+	}
+}
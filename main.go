@@ -19,6 +19,8 @@ package main
 import (
 	"flag"
 	"os"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
@@ -52,11 +54,35 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var ordsCheckInterval time.Duration
+	var imageRegistry string
+	var imageConfigFile string
+	var watchNamespaces string
+	var maxConcurrentReconciles int
+	var execProtocol string
+	var vaultAddresses string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.DurationVar(&ordsCheckInterval, "ords-check-interval", time.Minute,
+		"How often the Ords endpoint of each ApexOrds is probed for the apexords_ords_endpoint_up metric.")
+	flag.StringVar(&imageRegistry, "image-registry", "",
+		"Registry with optional path to pull all component images from, ie registry.example.com/mirror. Overrides the registry of --image-config.")
+	flag.StringVar(&imageConfigFile, "image-config", "/etc/apexords/images.yaml",
+		"File with the image registry and the digests to pin images to, mounted from a ConfigMap. A missing file is ignored.")
+	flag.StringVar(&watchNamespaces, "watch-namespaces", os.Getenv(controllers.WatchNamespaceEnv),
+		"Comma-separated namespaces to watch, default is $"+controllers.WatchNamespaceEnv+" or all namespaces. "+
+			"A Role in each namespace is enough for the operator then.")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", 1,
+		"How many resources of each kind are reconciled at once. Scripts in the same DB still run one after the other.")
+	flag.StringVar(&execProtocol, "exec-protocol", controllers.ExecProtocolSPDY,
+		"Protocol to run the install scripts in the helper pods with, spdy or websocket for API servers and proxies which don't pass SPDY.")
+	flag.StringVar(&vaultAddresses, "vault-addresses", "",
+		"Comma-separated Vault addresses, ie https://vault.example.com:8200, the operator logs in to with its service account token "+
+			"for database.credentials.vault.role. Other Vaults need database.credentials.vault.tokensecret. "+
+			"Any namespace can name any role, bind the policy of each role to the secrets of its namespaces.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -65,28 +91,96 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	images, err := controllers.LoadImageConfig(imageConfigFile)
+	if err != nil {
+		setupLog.Error(err, "unable to read image config "+imageConfigFile)
+		os.Exit(1)
+	}
+	if imageRegistry != "" {
+		images.Registry = imageRegistry
+	}
+	controllers.Images = images
+	if vaultAddresses != "" {
+		vault := controllers.CredentialsProviders[operatorv1.CredentialsProviderVault].(*controllers.VaultCredentialsProvider)
+		vault.AllowedAddresses = strings.Split(vaultAddresses, ",")
+	}
+
+	options := ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
 		Port:                   9443,
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "30b7b948.apexords-operator",
-	})
+	}
+	namespaces := controllers.WatchNamespaces(watchNamespaces)
+	controllers.SetWatchNamespaces(&options, namespaces)
+	if len(namespaces) > 0 {
+		setupLog.Info("watching namespaces", "namespaces", namespaces)
+	}
+
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), options)
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
+	runner, err := controllers.NewCommandRunner(mgr.GetConfig(), execProtocol)
+	if err != nil {
+		setupLog.Error(err, "unable to create pod command runner")
+		os.Exit(1)
+	}
+
 	if err = (&controllers.ApexOrdsReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		Recorder:                mgr.GetEventRecorderFor("apexords-controller"),
+		Runner:                  runner,
+		MaxConcurrentReconciles: maxConcurrentReconciles,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ApexOrds")
 		os.Exit(1)
 	}
+	if err = (&controllers.OracleDatabaseReconciler{
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		Recorder:                mgr.GetEventRecorderFor("oracledatabase-controller"),
+		Runner:                  runner,
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "OracleDatabase")
+		os.Exit(1)
+	}
+	if err = (&controllers.PluggableDatabaseReconciler{
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		Recorder:                mgr.GetEventRecorderFor("pluggabledatabase-controller"),
+		Runner:                  runner,
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "PluggableDatabase")
+		os.Exit(1)
+	}
+	if err = (&controllers.OrdsOAuthClientReconciler{
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		Recorder:                mgr.GetEventRecorderFor("ordsoauthclient-controller"),
+		Runner:                  runner,
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "OrdsOAuthClient")
+		os.Exit(1)
+	}
 	//+kubebuilder:scaffold:builder
 
+	if err := mgr.Add(&controllers.OrdsEndpointChecker{
+		Client:   mgr.GetClient(),
+		Interval: ordsCheckInterval,
+	}); err != nil {
+		setupLog.Error(err, "unable to set up Ords endpoint checker")
+		os.Exit(1)
+	}
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)